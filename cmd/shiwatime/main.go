@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -17,12 +18,21 @@ import (
 	"github.com/shiwatime/shiwatime/internal/server"
 )
 
+// maxReplayMismatches число расхождений выбора, выводимых replay
+const maxReplayMismatches = 20
+
 var (
 	configPath string
 	logLevel   string
 	version    = "1.0.0"
 	buildTime  = "unknown"
 	gitCommit  = "unknown"
+	
+	tuneAlgorithm string
+	tuneOptions   clock.TuneConfig
+	
+	replayAlgorithm string
+	replayOutput    string
 )
 
 func main() {
@@ -69,7 +79,40 @@ func main() {
 	}
 	
 	configCmd.AddCommand(validateConfigCmd, showConfigCmd)
-	rootCmd.AddCommand(versionCmd, configCmd)
+	
+	// Команда tune: подбор параметров дисциплины по записанной трассе
+	tuneCmd := &cobra.Command{
+		Use:   "tune <trace>",
+		Short: "Tune discipline gains and filter length on a recorded offset/frequency trace",
+		Long: `Повторяет записанную трассу смещений и поправок частоты
+(CSV timestamp,offset,frequency[,delay] или JSON lines) в симуляции с
+выбранной дисциплиной, ищет коэффициенты PID/PI и длину фильтра измерений
+оптимизаторами MLOptimizer и выводит фрагмент конфигурации с лучшими
+параметрами, СКО смещения и MTIE.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runTune,
+	}
+	tuneCmd.Flags().StringVar(&tuneAlgorithm, "algorithm", "", "Discipline algorithm (default from config, pid)")
+	tuneCmd.Flags().StringVar(&tuneOptions.Strategy, "optimizer", "ensemble", "Search strategy: genetic, bayesian, ensemble")
+	tuneCmd.Flags().IntVar(&tuneOptions.Budget, "budget", 40, "Number of simulated replays")
+	tuneCmd.Flags().DurationVar(&tuneOptions.Settle, "settle", 0, "Initial part of the trace excluded from scoring (default a quarter of the trace)")
+	tuneCmd.Flags().Int64Var(&tuneOptions.Seed, "seed", 1, "Random seed of the search")
+	
+	// Команда replay: повтор записи измерений и решений
+	replayCmd := &cobra.Command{
+		Use:   "replay <recording>",
+		Short: "Replay a recording of source samples through selection and discipline",
+		Long: `Повторяет запись clock.recording (вместе с ротированными файлами) через
+выбор источников и дисциплину текущей конфигурации в виртуальном времени
+и сравнивает решения с записанными: выбор системного источника по циклам,
+шаги, СКО смещения и расхождение часов повтора с записанными.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runReplay,
+	}
+	replayCmd.Flags().StringVar(&replayAlgorithm, "algorithm", "", "Discipline algorithm (default from config or recording)")
+	replayCmd.Flags().StringVar(&replayOutput, "output", "", "Write replayed records as JSON lines to this file")
+	
+	rootCmd.AddCommand(versionCmd, configCmd, tuneCmd, replayCmd)
 	
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -144,6 +187,11 @@ func runShiwaTime(cmd *cobra.Command, args []string) {
 		logger.Fatal("Failed to start clock manager: ", err)
 	}
 	
+	// События часов и источников пишутся в лог и отправляются в метрики
+	events := clockManager.Events().Subscribe(clock.EventFilter{}, 0)
+	defer events.Close()
+	go publishEvents(events, metricsClient, logger)
+	
 	// Запускаем HTTP сервер
 	if httpServer != nil {
 		go func() {
@@ -203,6 +251,43 @@ func runShiwaTime(cmd *cobra.Command, args []string) {
 	logger.Info("ShiwaTime stopped")
 }
 
+// publishEvents записывает события шины в лог и, если настроен клиент
+// метрик, отправляет их в индекс shiwatime_event-*, а переходы состояния
+// часов - еще и в индекс shiwatime_clock-*
+func publishEvents(sub *clock.EventSubscription, client *metrics.Client, logger *logrus.Logger) {
+	for event := range sub.C {
+		logger.WithFields(logrus.Fields{
+			"event":  event.Type,
+			"source": event.Source,
+			"id":     event.ID,
+		}).Info(event.Message)
+		
+		if client == nil {
+			continue
+		}
+		
+		doc := map[string]interface{}{
+			"@timestamp": event.Timestamp,
+			"event_id":   event.ID,
+			"event_type": string(event.Type),
+			"source_id":  event.Source,
+			"message":    event.Message,
+		}
+		client.SendMetric("shiwatime_event-"+event.Timestamp.Format("2006.01.02"), doc)
+		
+		if transition, ok := event.Data.(clock.StateTransition); ok && event.Type == clock.EventStateChange {
+			client.SendMetric("shiwatime_clock-"+transition.Timestamp.Format("2006.01.02"), map[string]interface{}{
+				"@timestamp":     transition.Timestamp,
+				"clock_state":    transition.To.String(),
+				"previous_state": transition.From.String(),
+				"reason":         transition.Reason,
+				"offset_ns":      transition.Offset.Nanoseconds(),
+				"duration_ns":    transition.Duration.Nanoseconds(),
+			})
+		}
+	}
+}
+
 func validateConfig(cmd *cobra.Command, args []string) {
 	logger := logrus.New()
 	logger.SetLevel(logrus.WarnLevel)
@@ -246,4 +331,99 @@ func showConfig(cmd *cobra.Command, args []string) {
 	}
 	
 	fmt.Printf("Elasticsearch hosts: %v\n", cfg.Output.Elasticsearch.Hosts)
-}
\ No newline at end of file
+}
+
+func runTune(cmd *cobra.Command, args []string) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel) // Симуляция пишет в лог на каждом повторе
+	
+	// Конфигурация необязательна: без нее используются значения по умолчанию
+	var cfg config.ShiwaTimeConfig
+	if loaded, err := config.LoadConfig(configPath); err == nil {
+		cfg = loaded.ShiwaTime
+	} else if cmd.Flags().Changed("config") {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if tuneAlgorithm != "" {
+		cfg.Clock.Algorithm = tuneAlgorithm
+	}
+	
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open trace: %v\n", err)
+		os.Exit(1)
+	}
+	trace, err := clock.ReadTrace(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read trace: %v\n", err)
+		os.Exit(1)
+	}
+	
+	result, err := clock.Tune(trace, cfg, tuneOptions, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Tuning failed: %v\n", err)
+		os.Exit(1)
+	}
+	
+	fmt.Print(result.ConfigSnippet())
+}
+
+func runReplay(cmd *cobra.Command, args []string) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	
+	// Конфигурация необязательна: без нее используются значения по умолчанию
+	var cfg config.ShiwaTimeConfig
+	if loaded, err := config.LoadConfig(configPath); err == nil {
+		cfg = loaded.ShiwaTime
+	} else if cmd.Flags().Changed("config") {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if replayAlgorithm != "" {
+		cfg.Clock.Algorithm = replayAlgorithm
+	}
+	
+	records, err := clock.ReadRecordingFiles(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read recording: %v\n", err)
+		os.Exit(1)
+	}
+	
+	result, err := clock.Replay(records, cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay failed: %v\n", err)
+		os.Exit(1)
+	}
+	
+	fmt.Print(result.Summary())
+	for i, mismatch := range result.Mismatches {
+		if i == maxReplayMismatches {
+			fmt.Printf("  ... %d more\n", len(result.Mismatches)-i)
+			break
+		}
+		fmt.Printf("  %s: recorded %q, replayed %q\n", mismatch.Time.Format(time.RFC3339Nano), mismatch.Recorded, mismatch.Replayed)
+	}
+	
+	if replayOutput != "" {
+		file, err := os.Create(replayOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output: %v\n", err)
+			os.Exit(1)
+		}
+		encoder := json.NewEncoder(file)
+		for _, record := range result.Replayed {
+			if err := encoder.Encode(record); err != nil {
+				file.Close()
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
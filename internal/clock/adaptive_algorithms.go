@@ -11,7 +11,23 @@ import (
 	"gonum.org/v1/gonum/mat"
 )
 
-// AdaptiveController представляет адаптивный контроллер с машинным обучением
+const (
+	// Доля оцененного смещения, которую алгоритмы убирают за одно обновление
+	adaptiveBaseGain = 0.3
+	
+	// Сглаживание оценок качества алгоритмов (вес нового измерения)
+	adaptivePerformanceSmoothing = 0.05
+	
+	// Масштаб нормировки входов нейросети, нс
+	adaptiveNeuralScale = float64(time.Microsecond)
+)
+
+// AdaptiveController представляет адаптивный контроллер с машинным обучением.
+// Фильтр Калмана оценивает смещение и частоту генератора, остальные
+// алгоритмы по-своему решают, какую долю смещения убрать до следующего
+// обновления. Выходы смешиваются с весами по качеству каждого алгоритма:
+// насколько его прошлый выход отличался от частоты, которая убрала бы
+// смещение полностью.
 type AdaptiveController struct {
 	mu sync.RWMutex
 	
@@ -39,13 +55,13 @@ type AdaptiveController struct {
 // NewAdaptiveController создает новый адаптивный контроллер
 func NewAdaptiveController(logger *logrus.Logger) *AdaptiveController {
 	return &AdaptiveController{
-		neuralNetwork:     NewNeuralNetwork(),
-		kalmanFilter:      NewKalmanFilter(),
-		fuzzyController:   NewFuzzyController(),
-		rlAgent:          NewReinforcementLearningAgent(),
-		extremeHandler:    NewExtremeConditionsHandler(),
+		neuralNetwork:      NewNeuralNetwork(),
+		kalmanFilter:       NewKalmanFilter(),
+		fuzzyController:    NewFuzzyController(),
+		rlAgent:            NewReinforcementLearningAgent(),
+		extremeHandler:     NewExtremeConditionsHandler(),
 		performanceMetrics: NewPerformanceMetrics(),
-		logger:           logger,
+		logger:             logger,
 	}
 }
 
@@ -54,394 +70,364 @@ func (ac *AdaptiveController) Update(input *AdaptiveInput) *AdaptiveOutput {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
 	
-	// Update performance metrics
-	ac.performanceMetrics.Update(input)
+	// Kalman filter state estimation is shared by all algorithms
+	state := ac.kalmanFilter.Update(input)
 	
-	// Check for extreme conditions
-	if ac.extremeHandler.IsExtremeCondition(input) {
-		return ac.extremeHandler.HandleExtremeCondition(input)
+	dt := input.Interval.Seconds()
+	if dt <= 0 {
+		// Интервал обновлений еще неизвестен: держим оцененную частоту
+		return &AdaptiveOutput{
+			FrequencyAdjustment: state.Rate,
+			Confidence:          0,
+			Algorithm:           "initializing",
+		}
 	}
 	
-	// Neural network prediction
-	prediction := ac.neuralNetwork.Predict(input)
-	
-	// Kalman filter state estimation
-	stateEstimate := ac.kalmanFilter.Update(input)
+	// Частота, которая за прошлый интервал убрала бы смещение полностью
+	ideal := input.Frequency + state.Phase/dt
+	ac.performanceMetrics.Evaluate(ideal)
 	
-	// Fuzzy logic control
-	fuzzyOutput := ac.fuzzyController.Control(input)
+	// Learning from the outcome of the previous update
+	ac.neuralNetwork.Update(state.Innovation)
+	ac.rlAgent.Update(input, state)
 	
-	// Reinforcement learning decision
-	rlDecision := ac.rlAgent.GetAction(input)
-	
-	// Combine all outputs using weighted average
-	output := ac.combineOutputs(prediction, stateEstimate, fuzzyOutput, rlDecision)
+	// Check for extreme conditions
+	if ac.extremeHandler.IsExtremeCondition(input) {
+		ac.performanceMetrics.Reset()
+		return ac.extremeHandler.HandleExtremeCondition(state)
+	}
 	
-	// Update learning models
-	ac.updateLearningModels(input, output)
+	outputs := [...]*AdaptiveOutput{
+		ac.neuralNetwork.Predict(state, dt),
+		ac.kalmanFilter.Control(state, dt),
+		ac.fuzzyController.Control(input, state, dt),
+		ac.rlAgent.GetAction(input, state, dt),
+	}
+	ac.performanceMetrics.Record(outputs)
 	
-	return output
+	return ac.combineOutputs(outputs)
 }
 
-// combineOutputs объединяет выходы различных алгоритмов
-func (ac *AdaptiveController) combineOutputs(prediction, stateEstimate, fuzzyOutput, rlDecision *AdaptiveOutput) *AdaptiveOutput {
-	// Dynamic weight calculation based on performance
-	weights := ac.calculateDynamicWeights()
-	
-	output := &AdaptiveOutput{
-		FrequencyAdjustment: weights.Neural*prediction.FrequencyAdjustment +
-			weights.Kalman*stateEstimate.FrequencyAdjustment +
-			weights.Fuzzy*fuzzyOutput.FrequencyAdjustment +
-			weights.RL*rlDecision.FrequencyAdjustment,
-		
-		Confidence: weights.Neural*prediction.Confidence +
-			weights.Kalman*stateEstimate.Confidence +
-			weights.Fuzzy*fuzzyOutput.Confidence +
-			weights.RL*rlDecision.Confidence,
-		
-		Algorithm: "adaptive_combined",
-	}
-	
-	// Apply limits
-	output.FrequencyAdjustment = ac.limitFrequencyAdjustment(output.FrequencyAdjustment)
-	
-	return output
+// Frequency возвращает оценку частоты генератора (поправку, удерживающую
+// смещение) в ppb
+func (ac *AdaptiveController) Frequency() float64 {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.kalmanFilter.Rate()
 }
 
-// calculateDynamicWeights вычисляет динамические веса алгоритмов
-func (ac *AdaptiveController) calculateDynamicWeights() *AlgorithmWeights {
-	metrics := ac.performanceMetrics.GetMetrics()
-	
-	// Calculate weights based on recent performance
-	neuralWeight := ac.calculateAlgorithmWeight(metrics.NeuralPerformance)
-	kalmanWeight := ac.calculateAlgorithmWeight(metrics.KalmanPerformance)
-	fuzzyWeight := ac.calculateAlgorithmWeight(metrics.FuzzyPerformance)
-	rlWeight := ac.calculateAlgorithmWeight(metrics.RLPerformance)
-	
-	// Normalize weights
-	total := neuralWeight + kalmanWeight + fuzzyWeight + rlWeight
-	if total > 0 {
-		neuralWeight /= total
-		kalmanWeight /= total
-		fuzzyWeight /= total
-		rlWeight /= total
-	}
-	
-	return &AlgorithmWeights{
-		Neural: neuralWeight,
-		Kalman: kalmanWeight,
-		Fuzzy:  fuzzyWeight,
-		RL:     rlWeight,
-	}
+// SetFrequency задает начальную оценку частоты генератора в ppb
+func (ac *AdaptiveController) SetFrequency(ppb float64) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.kalmanFilter.SetRate(ppb)
 }
 
-// calculateAlgorithmWeight вычисляет вес алгоритма на основе производительности
-func (ac *AdaptiveController) calculateAlgorithmWeight(performance float64) float64 {
-	// Exponential weighting based on performance
-	return math.Exp(performance / 10.0)
+// Reset начинает оценку смещения заново (после step); оценка частоты и
+// обученные модели сохраняются
+func (ac *AdaptiveController) Reset() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.kalmanFilter.ResetPhase()
+	ac.neuralNetwork.Reset()
+	ac.rlAgent.Reset()
+	ac.performanceMetrics.Reset()
 }
 
-// limitFrequencyAdjustment ограничивает частотную подстройку
-func (ac *AdaptiveController) limitFrequencyAdjustment(adjustment float64) float64 {
-	maxAdjustment := 1000000.0 // 1 second in ppb
-	return math.Max(-maxAdjustment, math.Min(maxAdjustment, adjustment))
+// Performance возвращает метрики качества алгоритмов
+func (ac *AdaptiveController) Performance() AlgorithmPerformance {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.performanceMetrics.GetMetrics()
 }
 
-// updateLearningModels обновляет модели машинного обучения
-func (ac *AdaptiveController) updateLearningModels(input *AdaptiveInput, output *AdaptiveOutput) {
-	// Update neural network
-	ac.neuralNetwork.Update(input, output)
+// combineOutputs объединяет выходы различных алгоритмов
+func (ac *AdaptiveController) combineOutputs(outputs [4]*AdaptiveOutput) *AdaptiveOutput {
+	// Dynamic weight calculation based on performance
+	weights := ac.performanceMetrics.Weights()
+	w := [...]float64{weights.Neural, weights.Kalman, weights.Fuzzy, weights.RL}
+	
+	output := &AdaptiveOutput{Algorithm: "adaptive_combined"}
+	for i, o := range outputs {
+		output.FrequencyAdjustment += w[i] * o.FrequencyAdjustment
+		output.Confidence += w[i] * o.Confidence
+	}
 	
-	// Update reinforcement learning agent
-	ac.rlAgent.Update(input, output)
+	// Apply limits
+	output.FrequencyAdjustment = clampFrequency(output.FrequencyAdjustment, maxFrequencyPPB)
 	
-	// Update performance metrics
-	ac.performanceMetrics.UpdateWithOutput(input, output)
+	return output
 }
 
-// NeuralNetwork представляет нейронную сеть для предсказания
+// KalmanState оценка фильтра Калмана после очередного измерения
+type KalmanState struct {
+	Phase      float64 // Оценка смещения, нс
+	Rate       float64 // Оценка частоты, удерживающей смещение, ppb
+	RateStd    float64 // СКО оценки частоты, ppb
+	Innovation float64 // Отклонение измерения от предсказания, нс
+}
+
+// NeuralNetwork представляет нейронную сеть для предсказания: линейный
+// нейрон по последним отклонениям измерений от модели Калмана предсказывает
+// следующее отклонение, и оно убирается вместе со смещением. Для белого
+// шума предсказание стремится к нулю, а коррелированное блуждание сеть
+// учится убирать заранее.
 type NeuralNetwork struct {
-	layers []*NeuralLayer
-	mu     sync.RWMutex
+	layer   *NeuralLayer
+	inputs  []float64 // Последние отклонения, нормированные на adaptiveNeuralScale
+	pending *mat.Dense
+	
+	predictionError float64 // Сглаженный квадрат ошибки предсказания
+	innovationPower float64 // Сглаженный квадрат отклонения
 }
 
 // NewNeuralNetwork создает новую нейронную сеть
 func NewNeuralNetwork() *NeuralNetwork {
-	nn := &NeuralNetwork{
-		layers: make([]*NeuralLayer, 0),
+	return &NeuralNetwork{
+		// 3 last innovations and bias -> next innovation
+		layer:  NewNeuralLayer(4, 1),
+		inputs: make([]float64, 3),
 	}
-	
-	// Create layers: input -> hidden -> output
-	nn.layers = append(nn.layers, NewNeuralLayer(8, 16)) // 8 inputs, 16 hidden
-	nn.layers = append(nn.layers, NewNeuralLayer(16, 8))  // 16 hidden, 8 hidden
-	nn.layers = append(nn.layers, NewNeuralLayer(8, 1))   // 8 hidden, 1 output
-	
-	return nn
 }
 
 // Predict выполняет предсказание
-func (nn *NeuralNetwork) Predict(input *AdaptiveInput) *AdaptiveOutput {
-	nn.mu.RLock()
-	defer nn.mu.RUnlock()
-	
-	// Convert input to neural network input
-	nnInput := nn.convertInput(input)
-	
-	// Forward propagation
-	current := nnInput
-	for _, layer := range nn.layers {
-		current = layer.Forward(current)
-	}
-	
-	// Convert output
-	frequencyAdjustment := current.At(0, 0)
-	confidence := nn.calculateConfidence(input)
+func (nn *NeuralNetwork) Predict(state KalmanState, dt float64) *AdaptiveOutput {
+	nn.pending = nn.convertInput()
+	predicted := nn.layer.Forward(nn.pending).At(0, 0) * adaptiveNeuralScale
 	
 	return &AdaptiveOutput{
-		FrequencyAdjustment: frequencyAdjustment,
-		Confidence:          confidence,
+		FrequencyAdjustment: state.Rate + adaptiveBaseGain*(state.Phase+predicted)/dt,
+		Confidence:          nn.calculateConfidence(),
 		Algorithm:           "neural_network",
 	}
 }
 
 // convertInput конвертирует входные данные для нейронной сети
-func (nn *NeuralNetwork) convertInput(input *AdaptiveInput) *mat.Dense {
-	data := []float64{
-		float64(input.Offset) / float64(time.Second),
-		float64(input.Delay) / float64(time.Second),
-		float64(input.Jitter) / float64(time.Second),
-		input.Quality,
-		input.Temperature,
-		input.Voltage,
-		input.Frequency,
-		input.Stability,
-	}
-	
-	return mat.NewDense(1, 8, data)
+func (nn *NeuralNetwork) convertInput() *mat.Dense {
+	data := append(append([]float64(nil), nn.inputs...), 1)
+	return mat.NewDense(1, len(data), data)
 }
 
-// calculateConfidence вычисляет уверенность предсказания
-func (nn *NeuralNetwork) calculateConfidence(input *AdaptiveInput) float64 {
-	// Confidence based on input quality and stability
-	qualityFactor := input.Quality / 100.0
-	stabilityFactor := input.Stability / 100.0
-	
-	return (qualityFactor + stabilityFactor) / 2.0
+// calculateConfidence вычисляет уверенность предсказания: насколько
+// предсказание лучше нулевого
+func (nn *NeuralNetwork) calculateConfidence() float64 {
+	if nn.innovationPower == 0 {
+		return 0.5
+	}
+	return 0.5 + 0.5*math.Max(0, 1-math.Sqrt(nn.predictionError/nn.innovationPower))
 }
 
-// Update обновляет нейронную сеть
-func (nn *NeuralNetwork) Update(input *AdaptiveInput, output *AdaptiveOutput) {
-	// Simple online learning - could be enhanced with backpropagation
-	// For now, just update weights based on performance
-	nn.mu.Lock()
-	defer nn.mu.Unlock()
+// Update обучает сеть на фактическом отклонении innovation (нс)
+func (nn *NeuralNetwork) Update(innovation float64) {
+	target := innovation / adaptiveNeuralScale
 	
-	// Calculate error
-	expected := output.FrequencyAdjustment
-	actual := input.Frequency
-	error := expected - actual
+	if nn.pending != nil {
+		err := target - nn.layer.Forward(nn.pending).At(0, 0)
+		nn.layer.UpdateWeights(nn.pending, err)
+		
+		nn.predictionError += adaptivePerformanceSmoothing * (err*err - nn.predictionError)
+		nn.innovationPower += adaptivePerformanceSmoothing * (target*target - nn.innovationPower)
+	}
 	
-	// Update weights (simplified)
-	for _, layer := range nn.layers {
-		layer.UpdateWeights(error)
+	copy(nn.inputs[1:], nn.inputs)
+	nn.inputs[0] = target
+}
+
+// Reset очищает историю отклонений; веса сохраняются
+func (nn *NeuralNetwork) Reset() {
+	for i := range nn.inputs {
+		nn.inputs[i] = 0
 	}
+	nn.pending = nil
 }
 
-// NeuralLayer представляет слой нейронной сети
+// NeuralLayer представляет линейный слой нейронной сети
 type NeuralLayer struct {
 	weights *mat.Dense
 	biases  *mat.Dense
-	mu      sync.RWMutex
 }
 
-// NewNeuralLayer создает новый слой нейронной сети
+// NewNeuralLayer создает слой с нулевыми весами: необученная сеть
+// предсказывает ноль и не вносит поправку
 func NewNeuralLayer(inputSize, outputSize int) *NeuralLayer {
-	weights := mat.NewDense(outputSize, inputSize, nil)
-	biases := mat.NewDense(outputSize, 1, nil)
-	
-	// Initialize with small random values
-	for i := 0; i < outputSize; i++ {
-		for j := 0; j < inputSize; j++ {
-			weights.Set(i, j, (rand.Float64()-0.5)*0.1)
-		}
-		biases.Set(i, 0, (rand.Float64()-0.5)*0.1)
-	}
-	
 	return &NeuralLayer{
-		weights: weights,
-		biases:  biases,
+		weights: mat.NewDense(outputSize, inputSize, nil),
+		biases:  mat.NewDense(outputSize, 1, nil),
 	}
 }
 
-// Forward выполняет прямое распространение
+// Forward выполняет прямое распространение вектора-строки input
 func (nl *NeuralLayer) Forward(input *mat.Dense) *mat.Dense {
-	nl.mu.RLock()
-	defer nl.mu.RUnlock()
-	
 	// Matrix multiplication: output = weights * input + biases
 	var output mat.Dense
 	output.Mul(nl.weights, input.T())
 	output.Add(&output, nl.biases)
 	
-	// Apply activation function (ReLU)
-	for i := 0; i < output.RawMatrix().Rows; i++ {
-		val := output.At(i, 0)
-		if val < 0 {
-			output.Set(i, 0, 0)
-		}
-	}
-	
-	return &output
+	return mat.DenseCopyOf(output.T())
 }
 
-// UpdateWeights обновляет веса слоя
-func (nl *NeuralLayer) UpdateWeights(error float64) {
-	nl.mu.Lock()
-	defer nl.mu.Unlock()
+// UpdateWeights обновляет веса слоя с одним выходом нормированным
+// LMS по ошибке err на входе input
+func (nl *NeuralLayer) UpdateWeights(input *mat.Dense, err float64) {
+	learningRate := 0.001
+	norm := 1 + mat.Dot(input.RowView(0), input.RowView(0))
 	
-	// Simple weight update based on error
-	learningRate := 0.01
-	for i := 0; i < nl.weights.RawMatrix().Rows; i++ {
-		for j := 0; j < nl.weights.RawMatrix().Cols; j++ {
-			current := nl.weights.At(i, j)
-			update := learningRate * error
-			nl.weights.Set(i, j, current+update)
-		}
+	_, cols := nl.weights.Dims()
+	for j := 0; j < cols; j++ {
+		current := nl.weights.At(0, j)
+		nl.weights.Set(0, j, current+learningRate*err*input.At(0, j)/norm)
 	}
 }
 
 // KalmanFilter представляет фильтр Калмана для оценки состояния
+// [смещение (нс), частота, удерживающая смещение (ppb)]. Выданная часам
+// частота входит в модель как управление.
 type KalmanFilter struct {
-	state     *mat.Dense // State vector [offset, velocity, frequency]
-	covariance *mat.Dense // State covariance matrix
-	mu        sync.RWMutex
+	state      *mat.VecDense
+	covariance *mat.Dense
+	
+	initialized bool
 }
 
 // NewKalmanFilter создает новый фильтр Калмана
 func NewKalmanFilter() *KalmanFilter {
-	// Initialize state: [offset, velocity, frequency]
-	state := mat.NewDense(3, 1, []float64{0, 0, 0})
-	
-	// Initialize covariance matrix
-	covariance := mat.NewDense(3, 3, []float64{
-		1e6, 0, 0,    // offset variance
-		0, 1e3, 0,    // velocity variance
-		0, 0, 1e3,    // frequency variance
-	})
-	
 	return &KalmanFilter{
-		state:      state,
-		covariance: covariance,
+		state: mat.NewVecDense(2, nil),
+		covariance: mat.NewDense(2, 2, []float64{
+			0, 0,
+			0, maxFrequencyPPB * maxFrequencyPPB, // frequency unknown
+		}),
 	}
 }
 
 // Update обновляет фильтр Калмана
-func (kf *KalmanFilter) Update(input *AdaptiveInput) *AdaptiveOutput {
-	kf.mu.Lock()
-	defer kf.mu.Unlock()
+func (kf *KalmanFilter) Update(input *AdaptiveInput) KalmanState {
+	z := float64(input.Offset)
 	
-	// Prediction step
-	kf.predict()
+	// Measurement noise from filter jitter
+	r := float64(input.Jitter)
+	r = math.Max(r*r, 1)
 	
-	// Update step
-	kf.update(input)
+	dt := input.Interval.Seconds()
+	if !kf.initialized || dt <= 0 {
+		kf.state.SetVec(0, z)
+		kf.covariance.Set(0, 0, r)
+		kf.covariance.Set(0, 1, 0)
+		kf.covariance.Set(1, 0, 0)
+		kf.initialized = true
+		return kf.estimate(0)
+	}
 	
-	// Extract frequency adjustment from state
-	frequencyAdjustment := kf.state.At(2, 0)
-	confidence := kf.calculateConfidence()
+	kf.predict(dt, input.Frequency)
+	innovation := kf.update(z, r)
 	
-	return &AdaptiveOutput{
-		FrequencyAdjustment: frequencyAdjustment,
-		Confidence:          confidence,
-		Algorithm:           "kalman_filter",
-	}
+	return kf.estimate(innovation)
 }
 
-// predict выполняет шаг предсказания
-func (kf *KalmanFilter) predict() {
+// predict выполняет шаг предсказания: смещение уходит с оцененной
+// частотой, уменьшаясь на выданную поправку
+func (kf *KalmanFilter) predict(dt, applied float64) {
 	// State transition matrix
-	F := mat.NewDense(3, 3, []float64{
-		1, 1, 0, // offset += velocity
-		0, 1, 0, // velocity unchanged
-		0, 0, 1, // frequency unchanged
+	F := mat.NewDense(2, 2, []float64{
+		1, dt, // offset += rate * dt
+		0, 1, // rate unchanged
 	})
 	
-	// Process noise covariance
-	Q := mat.NewDense(3, 3, []float64{
-		1e3, 0, 0,   // offset process noise
-		0, 1e2, 0,   // velocity process noise
-		0, 0, 1e2,   // frequency process noise
+	// Process noise covariance, как у дисциплины kalman
+	Q := mat.NewDense(2, 2, []float64{
+		1.0 * dt, 0,
+		0, 0.2 * dt,
 	})
 	
-	// Predict state
-	var newState mat.Dense
-	newState.Mul(F, kf.state)
+	var newState mat.VecDense
+	newState.MulVec(F, kf.state)
+	newState.SetVec(0, newState.AtVec(0)-applied*dt)
 	kf.state = &newState
 	
-	// Predict covariance
+	var FP mat.Dense
+	FP.Mul(F, kf.covariance)
 	var newCovariance mat.Dense
-	newCovariance.Mul(F, kf.covariance)
-	var temp mat.Dense
-	temp.Mul(&newCovariance, F.T())
-	newCovariance.Add(&temp, Q)
+	newCovariance.Mul(&FP, F.T())
+	newCovariance.Add(&newCovariance, Q)
 	kf.covariance = &newCovariance
 }
 
-// update выполняет шаг обновления
-func (kf *KalmanFilter) update(input *AdaptiveInput) {
-	// Measurement matrix (we measure offset)
-	H := mat.NewDense(1, 3, []float64{1, 0, 0})
-	
-	// Measurement noise
-	R := mat.NewDense(1, 1, []float64{float64(input.Delay) / float64(time.Second)})
-	
-	// Measurement
-	z := mat.NewDense(1, 1, []float64{float64(input.Offset) / float64(time.Second)})
-	
-	// Kalman gain calculation
-	var S mat.Dense
-	S.Mul(H, kf.covariance)
-	var temp mat.Dense
-	temp.Mul(&S, H.T())
-	S.Add(&temp, R)
-	
-	var K mat.Dense
-	K.Mul(kf.covariance, H.T())
-	var SInv mat.Dense
-	SInv.Inverse(&S)
-	K.Mul(&K, &SInv)
-	
-	// Update state
-	var innovation mat.Dense
-	innovation.Mul(H, kf.state)
-	innovation.Sub(z, &innovation)
-	
-	var correction mat.Dense
-	correction.Mul(&K, &innovation)
-	kf.state.Add(kf.state, &correction)
-	
-	// Update covariance
-	I := mat.NewDense(3, 3, []float64{1, 0, 0, 0, 1, 0, 0, 0, 1})
-	var temp2 mat.Dense
-	temp2.Mul(&K, H)
-	var temp3 mat.Dense
-	temp3.Sub(I, &temp2)
+// update выполняет шаг обновления по измерению смещения z и возвращает
+// отклонение измерения от предсказания
+func (kf *KalmanFilter) update(z, r float64) float64 {
+	p00 := kf.covariance.At(0, 0)
+	p10 := kf.covariance.At(1, 0)
+	
+	// Kalman gain for measurement matrix H = [1 0]
+	s := p00 + r
+	K := mat.NewVecDense(2, []float64{p00 / s, p10 / s})
+	
+	innovation := z - kf.state.AtVec(0)
+	kf.state.AddScaledVec(kf.state, innovation, K)
+	kf.state.SetVec(1, clampFrequency(kf.state.AtVec(1), maxFrequencyPPB))
+	
+	// P = (I - K H) P
+	H := mat.NewDense(1, 2, []float64{1, 0})
+	var KH mat.Dense
+	KH.Mul(K, H)
+	var IKH mat.Dense
+	IKH.Sub(mat.NewDiagDense(2, []float64{1, 1}), &KH)
 	var newCovariance mat.Dense
-	newCovariance.Mul(&temp3, kf.covariance)
+	newCovariance.Mul(&IKH, kf.covariance)
 	kf.covariance = &newCovariance
+	
+	return innovation
+}
+
+// estimate возвращает текущую оценку фильтра
+func (kf *KalmanFilter) estimate(innovation float64) KalmanState {
+	return KalmanState{
+		Phase:      kf.state.AtVec(0),
+		Rate:       kf.state.AtVec(1),
+		RateStd:    math.Sqrt(math.Max(kf.covariance.At(1, 1), 0)),
+		Innovation: innovation,
+	}
+}
+
+// Control возвращает выход фильтра: оценку частоты и поправку, убирающую
+// долю смещения до следующего обновления
+func (kf *KalmanFilter) Control(state KalmanState, dt float64) *AdaptiveOutput {
+	return &AdaptiveOutput{
+		FrequencyAdjustment: state.Rate + adaptiveBaseGain*state.Phase/dt,
+		Confidence:          kf.calculateConfidence(state),
+		Algorithm:           "kalman_filter",
+	}
+}
+
+// calculateConfidence вычисляет уверенность фильтра Калмана по СКО
+// оценки частоты: 100 ppb дают уверенность 0.5
+func (kf *KalmanFilter) calculateConfidence(state KalmanState) float64 {
+	return 1 / (1 + state.RateStd/100)
 }
 
-// calculateConfidence вычисляет уверенность фильтра Калмана
-func (kf *KalmanFilter) calculateConfidence() float64 {
-	// Confidence based on covariance trace
-	trace := kf.covariance.At(0, 0) + kf.covariance.At(1, 1) + kf.covariance.At(2, 2)
-	return math.Max(0, 1-math.Log10(trace)/10)
+// Rate возвращает оценку частоты в ppb
+func (kf *KalmanFilter) Rate() float64 {
+	return kf.state.AtVec(1)
 }
 
-// FuzzyController представляет нечеткий контроллер
+// SetRate задает оценку частоты, например из drift файла
+func (kf *KalmanFilter) SetRate(ppb float64) {
+	kf.state.SetVec(1, clampFrequency(ppb, maxFrequencyPPB))
+	kf.covariance.Set(1, 1, 100*100)
+	kf.covariance.Set(0, 1, 0)
+	kf.covariance.Set(1, 0, 0)
+}
+
+// ResetPhase начинает оценку смещения заново со следующего измерения
+func (kf *KalmanFilter) ResetPhase() {
+	kf.initialized = false
+}
+
+// FuzzyController представляет нечеткий контроллер: правила по размеру
+// смещения относительно джиттера и по уровню джиттера выбирают, какую долю
+// смещения убирать за обновление
 type FuzzyController struct {
 	rules []FuzzyRule
-	mu    sync.RWMutex
 }
 
 // NewFuzzyController создает новый нечеткий контроллер
@@ -458,81 +444,64 @@ func NewFuzzyController() *FuzzyController {
 
 // initializeRules инициализирует нечеткие правила
 func (fc *FuzzyController) initializeRules() {
-	// Rule 1: If offset is large positive, then frequency adjustment is large positive
+	// Rule 1: If offset is large, pull in fast
 	fc.rules = append(fc.rules, FuzzyRule{
 		Conditions: []FuzzyCondition{
-			{Variable: "offset", Membership: "large_positive"},
-		},
-		Output: FuzzyOutput{
-			FrequencyAdjustment: 500000, // 0.5 second in ppb
-			Confidence:          0.8,
+			{Variable: "offset", Membership: "large"},
 		},
+		Output: FuzzyOutput{Gain: 0.5, Confidence: 0.8},
 	})
 	
-	// Rule 2: If offset is large negative, then frequency adjustment is large negative
+	// Rule 2: If offset is small and jitter is low, track normally
 	fc.rules = append(fc.rules, FuzzyRule{
 		Conditions: []FuzzyCondition{
-			{Variable: "offset", Membership: "large_negative"},
-		},
-		Output: FuzzyOutput{
-			FrequencyAdjustment: -500000,
-			Confidence:          0.8,
+			{Variable: "offset", Membership: "small"},
+			{Variable: "jitter", Membership: "low"},
 		},
+		Output: FuzzyOutput{Gain: adaptiveBaseGain, Confidence: 0.9},
 	})
 	
-	// Rule 3: If offset is small and jitter is low, then small adjustment
+	// Rule 3: If jitter is high, average longer
 	fc.rules = append(fc.rules, FuzzyRule{
 		Conditions: []FuzzyCondition{
-			{Variable: "offset", Membership: "small"},
-			{Variable: "jitter", Membership: "low"},
-		},
-		Output: FuzzyOutput{
-			FrequencyAdjustment: 50000,
-			Confidence:          0.9,
+			{Variable: "jitter", Membership: "high"},
 		},
+		Output: FuzzyOutput{Gain: 0.1, Confidence: 0.7},
 	})
 }
 
 // Control выполняет нечеткое управление
-func (fc *FuzzyController) Control(input *AdaptiveInput) *AdaptiveOutput {
-	fc.mu.RLock()
-	defer fc.mu.RUnlock()
-	
+func (fc *FuzzyController) Control(input *AdaptiveInput, state KalmanState, dt float64) *AdaptiveOutput {
 	var totalWeight float64
-	var weightedSum float64
+	var gainSum float64
 	var confidenceSum float64
 	
 	for _, rule := range fc.rules {
-		weight := fc.calculateRuleWeight(rule, input)
+		weight := fc.calculateRuleWeight(rule, input, state)
 		totalWeight += weight
-		weightedSum += weight * rule.Output.FrequencyAdjustment
+		gainSum += weight * rule.Output.Gain
 		confidenceSum += weight * rule.Output.Confidence
 	}
 	
+	gain, confidence := adaptiveBaseGain, 0.5
 	if totalWeight > 0 {
-		frequencyAdjustment := weightedSum / totalWeight
-		confidence := confidenceSum / totalWeight
-		
-		return &AdaptiveOutput{
-			FrequencyAdjustment: frequencyAdjustment,
-			Confidence:          confidence,
-			Algorithm:           "fuzzy_controller",
-		}
+		gain = gainSum / totalWeight
+		confidence = confidenceSum / totalWeight
 	}
 	
 	return &AdaptiveOutput{
-		FrequencyAdjustment: 0,
-		Confidence:          0.5,
+		FrequencyAdjustment: state.Rate + gain*state.Phase/dt,
+		Confidence:          confidence,
 		Algorithm:           "fuzzy_controller",
 	}
 }
 
 // calculateRuleWeight вычисляет вес правила
-func (fc *FuzzyController) calculateRuleWeight(rule FuzzyRule, input *AdaptiveInput) float64 {
+func (fc *FuzzyController) calculateRuleWeight(rule FuzzyRule, input *AdaptiveInput, state KalmanState) float64 {
 	weight := 1.0
 	
 	for _, condition := range rule.Conditions {
-		membership := fc.calculateMembership(condition.Variable, condition.Membership, input)
+		membership := fc.calculateMembership(condition.Variable, condition.Membership, input, state)
 		weight *= membership
 	}
 	
@@ -540,239 +509,196 @@ func (fc *FuzzyController) calculateRuleWeight(rule FuzzyRule, input *AdaptiveIn
 }
 
 // calculateMembership вычисляет функцию принадлежности
-func (fc *FuzzyController) calculateMembership(variable, membership string, input *AdaptiveInput) float64 {
+func (fc *FuzzyController) calculateMembership(variable, membership string, input *AdaptiveInput, state KalmanState) float64 {
 	switch variable {
 	case "offset":
-		offset := float64(input.Offset) / float64(time.Second)
-		return fc.calculateOffsetMembership(offset, membership)
+		// Смещение в единицах джиттера
+		ratio := math.Abs(state.Phase) / math.Max(float64(input.Jitter), 1)
+		return fc.calculateOffsetMembership(ratio, membership)
 	case "jitter":
 		jitter := float64(input.Jitter) / float64(time.Second)
 		return fc.calculateJitterMembership(jitter, membership)
 	default:
-		return 0.5
+		return 0
 	}
 }
 
-// calculateOffsetMembership вычисляет принадлежность для смещения
-func (fc *FuzzyController) calculateOffsetMembership(offset float64, membership string) float64 {
+// calculateOffsetMembership вычисляет принадлежность для смещения в
+// единицах джиттера
+func (fc *FuzzyController) calculateOffsetMembership(ratio float64, membership string) float64 {
 	switch membership {
-	case "large_positive":
-		if offset > 0.1 {
-			return 1.0
-		} else if offset > 0.01 {
-			return (offset - 0.01) / 0.09
-		}
-		return 0.0
-	case "large_negative":
-		if offset < -0.1 {
-			return 1.0
-		} else if offset < -0.01 {
-			return (-offset - 0.01) / 0.09
-		}
-		return 0.0
+	case "large":
+		return ramp(ratio, 3, 10)
 	case "small":
-		if math.Abs(offset) < 0.01 {
-			return 1.0
-		} else if math.Abs(offset) < 0.1 {
-			return 1.0 - math.Abs(offset)/0.1
-		}
-		return 0.0
+		return 1 - ramp(ratio, 3, 10)
 	default:
-		return 0.5
+		return 0
 	}
 }
 
-// calculateJitterMembership вычисляет принадлежность для джиттера
+// calculateJitterMembership вычисляет принадлежность для джиттера в секундах
 func (fc *FuzzyController) calculateJitterMembership(jitter float64, membership string) float64 {
 	switch membership {
 	case "low":
-		if jitter < 0.001 {
-			return 1.0
-		} else if jitter < 0.01 {
-			return 1.0 - jitter/0.01
-		}
-		return 0.0
+		return 1 - ramp(jitter, 0.0001, 0.001)
+	case "high":
+		return ramp(jitter, 0.0001, 0.001)
 	default:
-		return 0.5
+		return 0
 	}
 }
 
-// ReinforcementLearningAgent представляет агент обучения с подкреплением
+// ramp линейно растет от 0 при low до 1 при high
+func ramp(value, low, high float64) float64 {
+	return math.Max(0, math.Min(1, (value-low)/(high-low)))
+}
+
+// ReinforcementLearningAgent представляет агент обучения с подкреплением:
+// Q-learning выбирает долю смещения, убираемую за обновление, и получает
+// награду по смещению на следующем обновлении
 type ReinforcementLearningAgent struct {
 	qTable map[string]map[string]float64
-	mu     sync.RWMutex
+	visits map[string]int
+	rng    *rand.Rand
+	
+	lastState  string
+	lastAction string
 }
 
+// Действия агента и соответствующие доли смещения
+var rlActionGains = map[string]float64{
+	"slow":       0.1,
+	"normal":     0.2,
+	"fast":       adaptiveBaseGain,
+	"aggressive": 0.5,
+}
+
+var rlActions = []string{"slow", "normal", "fast", "aggressive"}
+
 // NewReinforcementLearningAgent создает нового агента RL
 func NewReinforcementLearningAgent() *ReinforcementLearningAgent {
 	return &ReinforcementLearningAgent{
 		qTable: make(map[string]map[string]float64),
+		visits: make(map[string]int),
+		// Фиксированное зерно: поведение повторяется в симуляции и replay
+		rng: rand.New(rand.NewSource(1)),
 	}
 }
 
 // GetAction получает действие от агента RL
-func (rl *ReinforcementLearningAgent) GetAction(input *AdaptiveInput) *AdaptiveOutput {
-	rl.mu.RLock()
-	defer rl.mu.RUnlock()
-	
-	state := rl.discretizeState(input)
-	action := rl.selectAction(state)
-	
-	// Convert action to frequency adjustment
-	frequencyAdjustment := rl.actionToFrequencyAdjustment(action)
-	confidence := rl.calculateConfidence(state, action)
+func (rl *ReinforcementLearningAgent) GetAction(input *AdaptiveInput, state KalmanState, dt float64) *AdaptiveOutput {
+	s := rl.discretizeState(input, state)
+	action := rl.selectAction(s)
+	rl.lastState, rl.lastAction = s, action
 	
 	return &AdaptiveOutput{
-		FrequencyAdjustment: frequencyAdjustment,
-		Confidence:          confidence,
+		FrequencyAdjustment: state.Rate + rlActionGains[action]*state.Phase/dt,
+		Confidence:          rl.calculateConfidence(s),
 		Algorithm:           "reinforcement_learning",
 	}
 }
 
 // discretizeState дискретизирует состояние
-func (rl *ReinforcementLearningAgent) discretizeState(input *AdaptiveInput) string {
-	offset := float64(input.Offset) / float64(time.Second)
+func (rl *ReinforcementLearningAgent) discretizeState(input *AdaptiveInput, state KalmanState) string {
+	ratio := math.Abs(state.Phase) / math.Max(float64(input.Jitter), 1)
 	jitter := float64(input.Jitter) / float64(time.Second)
-	quality := input.Quality
 	
-	// Discretize offset
+	// Discretize offset in units of jitter
 	var offsetState string
-	if offset > 0.1 {
-		offsetState = "large_positive"
-	} else if offset > 0.01 {
-		offsetState = "positive"
-	} else if offset < -0.1 {
-		offsetState = "large_negative"
-	} else if offset < -0.01 {
-		offsetState = "negative"
-	} else {
+	switch {
+	case ratio > 10:
+		offsetState = "large"
+	case ratio > 1:
+		offsetState = "medium"
+	default:
 		offsetState = "small"
 	}
 	
 	// Discretize jitter
 	var jitterState string
-	if jitter > 0.01 {
+	switch {
+	case jitter > 0.001:
 		jitterState = "high"
-	} else if jitter > 0.001 {
+	case jitter > 0.0001:
 		jitterState = "medium"
-	} else {
+	default:
 		jitterState = "low"
 	}
 	
-	// Discretize quality
-	var qualityState string
-	if quality > 80 {
-		qualityState = "high"
-	} else if quality > 50 {
-		qualityState = "medium"
-	} else {
-		qualityState = "low"
-	}
-	
-	return fmt.Sprintf("%s_%s_%s", offsetState, jitterState, qualityState)
+	return fmt.Sprintf("%s_%s", offsetState, jitterState)
 }
 
 // selectAction выбирает действие
 func (rl *ReinforcementLearningAgent) selectAction(state string) string {
-	actions := []string{"decrease_large", "decrease_small", "no_change", "increase_small", "increase_large"}
-	
-	if rl.qTable[state] == nil {
-		rl.qTable[state] = make(map[string]float64)
-	}
-	
 	// Epsilon-greedy strategy
 	epsilon := 0.1
-	if rand.Float64() < epsilon {
-		// Random action
-		return actions[rand.Intn(len(actions))]
+	if rl.rng.Float64() < epsilon {
+		return rlActions[rl.rng.Intn(len(rlActions))]
 	}
 	
-	// Best action
-	var bestAction string
-	var bestValue float64
-	
-	for _, action := range actions {
-		value := rl.qTable[state][action]
-		if value > bestValue {
+	// Best action; untried actions have zero value and rewards are negative,
+	// so each action is tried at least once
+	bestAction := "fast"
+	bestValue := math.Inf(-1)
+	for _, action := range rlActions {
+		if value := rl.qTable[state][action]; value > bestValue {
 			bestValue = value
 			bestAction = action
 		}
 	}
 	
-	if bestAction == "" {
-		bestAction = "no_change"
-	}
-	
 	return bestAction
 }
 
-// actionToFrequencyAdjustment конвертирует действие в частотную подстройку
-func (rl *ReinforcementLearningAgent) actionToFrequencyAdjustment(action string) float64 {
-	switch action {
-	case "decrease_large":
-		return -200000
-	case "decrease_small":
-		return -50000
-	case "no_change":
-		return 0
-	case "increase_small":
-		return 50000
-	case "increase_large":
-		return 200000
-	default:
-		return 0
-	}
+// calculateConfidence вычисляет уверенность RL агента по опыту в состоянии
+func (rl *ReinforcementLearningAgent) calculateConfidence(state string) float64 {
+	n := float64(rl.visits[state])
+	return 0.9 * n / (n + 20)
 }
 
-// calculateConfidence вычисляет уверенность RL агента
-func (rl *ReinforcementLearningAgent) calculateConfidence(state, action string) float64 {
-	if rl.qTable[state] == nil {
-		return 0.5
+// Update награждает прошлое действие по новому смещению
+func (rl *ReinforcementLearningAgent) Update(input *AdaptiveInput, state KalmanState) {
+	if rl.lastAction == "" {
+		return
 	}
 	
-	value := rl.qTable[state][action]
-	// Normalize confidence based on Q-value
-	return math.Max(0.1, math.Min(0.9, (value+1000)/2000))
-}
-
-// Update обновляет агента RL
-func (rl *ReinforcementLearningAgent) Update(input *AdaptiveInput, output *AdaptiveOutput) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	
-	state := rl.discretizeState(input)
-	action := rl.selectAction(state)
+	reward := rl.calculateReward(input, state)
+	next := rl.discretizeState(input, state)
 	
-	// Calculate reward based on performance
-	reward := rl.calculateReward(input, output)
+	var nextValue float64
+	for i, action := range rlActions {
+		if value := rl.qTable[next][action]; i == 0 || value > nextValue {
+			nextValue = value
+		}
+	}
 	
-	// Update Q-table
-	if rl.qTable[state] == nil {
-		rl.qTable[state] = make(map[string]float64)
+	if rl.qTable[rl.lastState] == nil {
+		rl.qTable[rl.lastState] = make(map[string]float64)
 	}
 	
 	learningRate := 0.1
-	discountFactor := 0.9
+	discountFactor := 0.5
 	
-	currentValue := rl.qTable[state][action]
-	// Simple Q-learning update
-	rl.qTable[state][action] = currentValue + learningRate*(reward-discountFactor*currentValue)
+	// Q-learning update
+	currentValue := rl.qTable[rl.lastState][rl.lastAction]
+	rl.qTable[rl.lastState][rl.lastAction] = currentValue + learningRate*(reward+discountFactor*nextValue-currentValue)
+	rl.visits[rl.lastState]++
+	rl.lastAction = ""
 }
 
-// calculateReward вычисляет награду
-func (rl *ReinforcementLearningAgent) calculateReward(input *AdaptiveInput, output *AdaptiveOutput) float64 {
-	// Reward based on offset reduction and stability
-	offsetReduction := math.Abs(float64(input.Offset)) - math.Abs(float64(input.Offset)+output.FrequencyAdjustment)
-	stabilityReward := input.Stability / 100.0
-	
-	return offsetReduction*1000 + stabilityReward*100
+// calculateReward вычисляет награду: минус смещение в единицах джиттера
+func (rl *ReinforcementLearningAgent) calculateReward(input *AdaptiveInput, state KalmanState) float64 {
+	return -math.Abs(state.Phase) / math.Max(float64(input.Jitter), 1)
 }
 
-// ExtremeConditionsHandler обрабатывает экстремальные условия
-type ExtremeConditionsHandler struct {
-	mu sync.RWMutex
+// Reset забывает последнее действие (после step награда за него неверна)
+func (rl *ReinforcementLearningAgent) Reset() {
+	rl.lastAction = ""
 }
 
+// ExtremeConditionsHandler обрабатывает экстремальные условия
+type ExtremeConditionsHandler struct{}
+
 // NewExtremeConditionsHandler создает новый обработчик экстремальных условий
 func NewExtremeConditionsHandler() *ExtremeConditionsHandler {
 	return &ExtremeConditionsHandler{}
@@ -780,124 +706,106 @@ func NewExtremeConditionsHandler() *ExtremeConditionsHandler {
 
 // IsExtremeCondition проверяет, является ли условие экстремальным
 func (ech *ExtremeConditionsHandler) IsExtremeCondition(input *AdaptiveInput) bool {
-	// Check for extreme conditions
-	offset := math.Abs(float64(input.Offset))
-	jitter := float64(input.Jitter)
-	temperature := input.Temperature
-	voltage := input.Voltage
-	
-	// Extreme offset
-	if offset > 10*float64(time.Second) {
+	// Extreme offset: такое смещение убирает step, а не дисциплина
+	if math.Abs(float64(input.Offset)) > 10*float64(time.Second) {
 		return true
 	}
 	
 	// Extreme jitter
-	if jitter > 100*float64(time.Millisecond) {
-		return true
-	}
-	
-	// Extreme temperature
-	if temperature > 80 || temperature < -20 {
-		return true
-	}
-	
-	// Extreme voltage
-	if voltage > 5.5 || voltage < 4.5 {
+	if float64(input.Jitter) > 100*float64(time.Millisecond) {
 		return true
 	}
 	
 	return false
 }
 
-// HandleExtremeCondition обрабатывает экстремальное условие
-func (ech *ExtremeConditionsHandler) HandleExtremeCondition(input *AdaptiveInput) *AdaptiveOutput {
-	ech.mu.Lock()
-	defer ech.mu.Unlock()
-	
-	// Emergency response algorithm
-	offset := float64(input.Offset)
-	
-	// Large step adjustment for extreme conditions
-	var frequencyAdjustment float64
-	if math.Abs(offset) > 10*float64(time.Second) {
-		// Emergency step
-		frequencyAdjustment = offset * 0.1 // 10% of offset
-	} else {
-		// Conservative adjustment
-		frequencyAdjustment = offset * 0.01 // 1% of offset
-	}
-	
+// HandleExtremeCondition обрабатывает экстремальное условие: частота
+// удерживается, а низкая уверенность передает управление PID
+func (ech *ExtremeConditionsHandler) HandleExtremeCondition(state KalmanState) *AdaptiveOutput {
 	return &AdaptiveOutput{
-		FrequencyAdjustment: frequencyAdjustment,
+		FrequencyAdjustment: state.Rate,
 		Confidence:          0.3, // Low confidence in extreme conditions
 		Algorithm:           "extreme_conditions",
 	}
 }
 
-// PerformanceMetrics отслеживает производительность алгоритмов
+// PerformanceMetrics отслеживает производительность алгоритмов: сглаженный
+// квадрат отличия выхода каждого алгоритма от частоты, которая за
+// прошедший интервал убрала бы смещение полностью
 type PerformanceMetrics struct {
-	mu sync.RWMutex
-	
-	neuralPerformance float64
-	kalmanPerformance float64
-	fuzzyPerformance  float64
-	rlPerformance     float64
-	
-	history []PerformanceRecord
+	last    [4]float64 // Выходы алгоритмов на прошлом обновлении
+	pending bool
+	squares [4]float64
+	samples uint64
 }
 
 // NewPerformanceMetrics создает новые метрики производительности
 func NewPerformanceMetrics() *PerformanceMetrics {
-	return &PerformanceMetrics{
-		history: make([]PerformanceRecord, 0),
+	return &PerformanceMetrics{}
+}
+
+// Record запоминает выходы алгоритмов для оценки на следующем обновлении
+func (pm *PerformanceMetrics) Record(outputs [4]*AdaptiveOutput) {
+	for i, o := range outputs {
+		pm.last[i] = o.FrequencyAdjustment
 	}
+	pm.pending = true
 }
 
-// Update обновляет метрики
-func (pm *PerformanceMetrics) Update(input *AdaptiveInput) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
-	
-	// Calculate performance based on input quality
-	performance := input.Quality / 100.0
+// Evaluate оценивает выходы прошлого обновления по частоте ideal
+func (pm *PerformanceMetrics) Evaluate(ideal float64) {
+	if !pm.pending {
+		return
+	}
+	pm.pending = false
 	
-	// Update algorithm performances (simplified)
-	pm.neuralPerformance = performance * 0.9
-	pm.kalmanPerformance = performance * 0.85
-	pm.fuzzyPerformance = performance * 0.8
-	pm.rlPerformance = performance * 0.75
+	alpha := adaptivePerformanceSmoothing
+	if pm.samples == 0 {
+		alpha = 1
+	}
+	for i, freq := range pm.last {
+		diff := freq - ideal
+		pm.squares[i] += alpha * (diff*diff - pm.squares[i])
+	}
+	pm.samples++
 }
 
-// UpdateWithOutput обновляет метрики с выходными данными
-func (pm *PerformanceMetrics) UpdateWithOutput(input *AdaptiveInput, output *AdaptiveOutput) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
-	
-	// Record performance
-	record := PerformanceRecord{
-		Timestamp: time.Now(),
-		Input:     input,
-		Output:    output,
+// Reset отменяет оценку прошлых выходов (после step или экстремального
+// условия они не применялись)
+func (pm *PerformanceMetrics) Reset() {
+	pm.pending = false
+}
+
+// Weights вычисляет веса алгоритмов обратно пропорционально среднему
+// квадрату ошибки; до первой оценки веса равны
+func (pm *PerformanceMetrics) Weights() AlgorithmWeights {
+	var w [4]float64
+	var total float64
+	for i := range w {
+		w[i] = 1
+		if pm.samples > 0 {
+			w[i] = 1 / (pm.squares[i] + 1)
+		}
+		total += w[i]
 	}
 	
-	pm.history = append(pm.history, record)
-	
-	// Keep only recent history
-	if len(pm.history) > 1000 {
-		pm.history = pm.history[1:]
+	return AlgorithmWeights{
+		Neural: w[0] / total,
+		Kalman: w[1] / total,
+		Fuzzy:  w[2] / total,
+		RL:     w[3] / total,
 	}
 }
 
 // GetMetrics возвращает метрики
-func (pm *PerformanceMetrics) GetMetrics() *AlgorithmPerformance {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-	
-	return &AlgorithmPerformance{
-		NeuralPerformance: pm.neuralPerformance,
-		KalmanPerformance: pm.kalmanPerformance,
-		FuzzyPerformance:  pm.fuzzyPerformance,
-		RLPerformance:     pm.rlPerformance,
+func (pm *PerformanceMetrics) GetMetrics() AlgorithmPerformance {
+	return AlgorithmPerformance{
+		NeuralPerformance: math.Sqrt(pm.squares[0]),
+		KalmanPerformance: math.Sqrt(pm.squares[1]),
+		FuzzyPerformance:  math.Sqrt(pm.squares[2]),
+		RLPerformance:     math.Sqrt(pm.squares[3]),
+		Weights:           pm.Weights(),
+		Samples:           pm.samples,
 	}
 }
 
@@ -905,15 +813,13 @@ func (pm *PerformanceMetrics) GetMetrics() *AlgorithmPerformance {
 
 // AdaptiveInput представляет входные данные для адаптивного контроллера
 type AdaptiveInput struct {
-	Offset      time.Duration `json:"offset"`
-	Delay       time.Duration `json:"delay"`
-	Jitter      time.Duration `json:"jitter"`
-	Quality     float64       `json:"quality"`
-	Temperature float64       `json:"temperature"`
-	Voltage     float64       `json:"voltage"`
-	Frequency   float64       `json:"frequency"`
-	Stability   float64       `json:"stability"`
-	Timestamp   time.Time     `json:"timestamp"`
+	Offset    time.Duration `json:"offset"` // Смещение, перенесенное на момент Timestamp
+	Delay     time.Duration `json:"delay"`
+	Jitter    time.Duration `json:"jitter"`
+	Quality   float64       `json:"quality"`
+	Interval  time.Duration `json:"interval"`  // Время с предыдущего обновления
+	Frequency float64       `json:"frequency"` // Частота, выданная часам за этот интервал, ppb
+	Timestamp time.Time     `json:"timestamp"`
 }
 
 // AdaptiveOutput представляет выходные данные адаптивного контроллера
@@ -943,23 +849,20 @@ type FuzzyCondition struct {
 	Membership string `json:"membership"`
 }
 
-// FuzzyOutput представляет выход нечеткого правила
+// FuzzyOutput представляет выход нечеткого правила: долю смещения,
+// убираемую за обновление
 type FuzzyOutput struct {
-	FrequencyAdjustment float64 `json:"frequency_adjustment"`
-	Confidence          float64 `json:"confidence"`
+	Gain       float64 `json:"gain"`
+	Confidence float64 `json:"confidence"`
 }
 
-// AlgorithmPerformance представляет производительность алгоритмов
+// AlgorithmPerformance представляет производительность алгоритмов: СКО
+// отличия выхода от частоты, убравшей бы смещение, в ppb (меньше - лучше)
 type AlgorithmPerformance struct {
-	NeuralPerformance float64 `json:"neural_performance"`
-	KalmanPerformance float64 `json:"kalman_performance"`
-	FuzzyPerformance  float64 `json:"fuzzy_performance"`
-	RLPerformance     float64 `json:"rl_performance"`
-}
-
-// PerformanceRecord представляет запись производительности
-type PerformanceRecord struct {
-	Timestamp time.Time      `json:"timestamp"`
-	Input     *AdaptiveInput `json:"input"`
-	Output    *AdaptiveOutput `json:"output"`
-}
\ No newline at end of file
+	NeuralPerformance float64          `json:"neural_performance"`
+	KalmanPerformance float64          `json:"kalman_performance"`
+	FuzzyPerformance  float64          `json:"fuzzy_performance"`
+	RLPerformance     float64          `json:"rl_performance"`
+	Weights           AlgorithmWeights `json:"weights"`
+	Samples           uint64           `json:"samples"`
+}
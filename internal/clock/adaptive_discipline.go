@@ -0,0 +1,254 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultAdaptiveMinConfidence   = 0.5
+	defaultAdaptiveMaxDivergence   = 10000.0 // ppb
+	defaultAdaptiveRecoverySamples = 30
+)
+
+// AdaptiveDiscipline управляет часами через AdaptiveController внутри
+// защитного контура: параллельно работает PID регулятор, и при падении
+// уверенности или расхождении выхода с оценкой частоты PID управление
+// передается PID.
+type AdaptiveDiscipline struct {
+	mu sync.RWMutex
+
+	controller *AdaptiveController
+	fallback   *PIDController
+	logger     *logrus.Logger
+
+	// Защитный контур
+	minConfidence   float64
+	maxDivergence   float64
+	recoverySamples int
+
+	inFallback     bool
+	goodSamples    int
+	fallbackCount  uint64
+	fallbackReason string
+
+	lastConfidence float64
+	lastAlgorithm  string
+	lastAdaptive   float64
+	lastPID        float64
+
+	// Выданная часам частота для переноса смещения на текущий момент
+	applied      appliedHistory
+	lastMeasured time.Time
+
+	// Качество управления в каждом режиме (сумма квадратов смещения)
+	adaptiveSamples uint64
+	adaptiveSquares float64
+	fallbackSamples uint64
+	fallbackSquares float64
+}
+
+// AdaptiveStatus состояние адаптивной дисциплины для API
+type AdaptiveStatus struct {
+	Active             bool                 `json:"active"`
+	Fallback           bool                 `json:"fallback"`
+	FallbackCount      uint64               `json:"fallback_count"`
+	FallbackReason     string               `json:"fallback_reason,omitempty"`
+	LastConfidence     float64              `json:"last_confidence"`
+	LastAlgorithm      string               `json:"last_algorithm"`
+	LastAdaptiveOutput float64              `json:"last_adaptive_output"`
+	LastPIDOutput      float64              `json:"last_pid_output"`
+	AdaptiveRMSOffset  time.Duration        `json:"adaptive_rms_offset"`
+	FallbackRMSOffset  time.Duration        `json:"fallback_rms_offset"`
+	Performance        AlgorithmPerformance `json:"performance"`
+}
+
+// NewAdaptiveDiscipline создает адаптивную дисциплину с защитным контуром;
+// kp, ki и kd - коэффициенты резервного PID регулятора
+func NewAdaptiveDiscipline(cfg config.AdaptiveGuardConfig, kp, ki, kd float64, logger *logrus.Logger) *AdaptiveDiscipline {
+	ad := &AdaptiveDiscipline{
+		controller:      NewAdaptiveController(logger),
+		fallback:        NewPIDController(kp, ki, kd, maxFrequencyPPB, maxFrequencyPPB),
+		logger:          logger,
+		minConfidence:   defaultAdaptiveMinConfidence,
+		maxDivergence:   defaultAdaptiveMaxDivergence,
+		recoverySamples: defaultAdaptiveRecoverySamples,
+		// Пока адаптивный контроллер не обучился, управляет PID
+		inFallback:     true,
+		fallbackReason: "warmup",
+	}
+
+	if cfg.MinConfidence > 0 {
+		ad.minConfidence = cfg.MinConfidence
+	}
+	if cfg.MaxDivergence > 0 {
+		ad.maxDivergence = cfg.MaxDivergence
+	}
+	if cfg.RecoverySamples > 0 {
+		ad.recoverySamples = cfg.RecoverySamples
+	}
+
+	return ad
+}
+
+// Name возвращает имя алгоритма
+func (ad *AdaptiveDiscipline) Name() string {
+	return "adaptive"
+}
+
+// Sample обрабатывает измерение и возвращает поправку частоты в ppb
+func (ad *AdaptiveDiscipline) Sample(input DisciplineInput) float64 {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	// Смещение переносится на текущий момент по частоте, которая
+	// действительно была выдана часам, кем бы она ни была выбрана
+	estimate := ad.controller.Frequency()
+	offset := ad.applied.project(float64(input.Offset), input.Measured, input.Timestamp, estimate)
+	if input.Measured.After(ad.lastMeasured) {
+		ad.lastMeasured = input.Measured
+	}
+
+	// PID работает всегда, чтобы быть готовым принять управление
+	projected := input
+	projected.Offset = time.Duration(offset)
+	projected.Measured = input.Timestamp
+	pidOutput := ad.fallback.Sample(projected)
+
+	output := ad.controller.Update(&AdaptiveInput{
+		Offset:    time.Duration(offset),
+		Delay:     input.Delay,
+		Jitter:    input.Jitter,
+		Quality:   float64(input.Quality),
+		Interval:  input.Interval,
+		Frequency: ad.applied.last(estimate),
+		Timestamp: input.Timestamp,
+	})
+
+	// Оцениваем качество управления режима, действовавшего до этого измерения
+	offsetSquare := offset * offset
+	if ad.inFallback {
+		ad.fallbackSamples++
+		ad.fallbackSquares += offsetSquare
+	} else {
+		ad.adaptiveSamples++
+		ad.adaptiveSquares += offsetSquare
+	}
+
+	ad.lastConfidence = output.Confidence
+	ad.lastAlgorithm = output.Algorithm
+	ad.lastAdaptive = output.FrequencyAdjustment
+	ad.lastPID = pidOutput
+
+	freq := ad.choose(output, pidOutput, ad.fallback.Frequency())
+	if !ad.inFallback {
+		// Пока управляет адаптивный контроллер, интегратор PID не видит
+		// результата своих выходов и уходил бы случайным блужданием:
+		// оценка частоты PID подтягивается к оценке контроллера с
+		// постоянной времени recovery_samples, и передача управления
+		// проходит без скачка частоты
+		pidFrequency := ad.fallback.Frequency()
+		ad.fallback.SetFrequency(pidFrequency + (ad.controller.Frequency()-pidFrequency)/float64(ad.recoverySamples))
+	}
+	return ad.applied.add(input.Timestamp, freq, ad.lastMeasured)
+}
+
+// choose выбирает выход адаптивного контроллера или PID по защитному контуру
+func (ad *AdaptiveDiscipline) choose(output *AdaptiveOutput, pidOutput, pidFrequency float64) float64 {
+	if reason := ad.checkEnvelope(output, pidFrequency); reason != "" {
+		ad.goodSamples = 0
+		if !ad.inFallback {
+			ad.inFallback = true
+			ad.fallbackCount++
+			ad.fallbackReason = reason
+			ad.logger.WithFields(logrus.Fields{
+				"reason":     reason,
+				"confidence": output.Confidence,
+				"adaptive":   output.FrequencyAdjustment,
+				"pid":        pidOutput,
+			}).Warn("Adaptive controller left safety envelope, falling back to PID")
+		}
+		return pidOutput
+	}
+
+	if ad.inFallback {
+		ad.goodSamples++
+		if ad.goodSamples < ad.recoverySamples {
+			return pidOutput
+		}
+		ad.inFallback = false
+		ad.logger.WithField("samples", ad.goodSamples).Info("Adaptive controller back within safety envelope")
+	}
+
+	return clampFrequency(output.FrequencyAdjustment, maxFrequencyPPB)
+}
+
+// checkEnvelope возвращает причину выхода из защитного контура или пустую
+// строку. Выход сравнивается с оценкой частоты PID, а не с его выходом:
+// пропорциональная составляющая PID повторяет шум каждого измерения.
+func (ad *AdaptiveDiscipline) checkEnvelope(output *AdaptiveOutput, pidFrequency float64) string {
+	freq := output.FrequencyAdjustment
+
+	switch {
+	case math.IsNaN(freq) || math.IsInf(freq, 0):
+		return "invalid_output"
+	case math.Abs(freq) >= maxFrequencyPPB:
+		return "saturated"
+	case output.Confidence < ad.minConfidence:
+		return "low_confidence"
+	case math.Abs(freq-pidFrequency) > ad.maxDivergence:
+		return "diverged"
+	}
+
+	return ""
+}
+
+// Reset сбрасывает PID регулятор и оценку смещения адаптивного
+// контроллера; оценка частоты и обученные модели сохраняются после step
+func (ad *AdaptiveDiscipline) Reset() {
+	ad.fallback.Reset()
+	ad.controller.Reset()
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+	ad.applied.reset()
+	ad.lastMeasured = time.Time{}
+}
+
+// SetFrequency задает начальную частоту PID регулятору и оценке частоты
+// адаптивного контроллера
+func (ad *AdaptiveDiscipline) SetFrequency(ppb float64) {
+	ad.fallback.SetFrequency(ppb)
+	ad.controller.SetFrequency(ppb)
+}
+
+// Status возвращает состояние адаптивной дисциплины и метрики алгоритмов
+func (ad *AdaptiveDiscipline) Status() AdaptiveStatus {
+	ad.mu.RLock()
+	defer ad.mu.RUnlock()
+
+	status := AdaptiveStatus{
+		Active:             !ad.inFallback,
+		Fallback:           ad.inFallback,
+		FallbackCount:      ad.fallbackCount,
+		FallbackReason:     ad.fallbackReason,
+		LastConfidence:     ad.lastConfidence,
+		LastAlgorithm:      ad.lastAlgorithm,
+		LastAdaptiveOutput: ad.lastAdaptive,
+		LastPIDOutput:      ad.lastPID,
+		Performance:        ad.controller.Performance(),
+	}
+
+	if ad.adaptiveSamples > 0 {
+		status.AdaptiveRMSOffset = time.Duration(math.Sqrt(ad.adaptiveSquares / float64(ad.adaptiveSamples)))
+	}
+	if ad.fallbackSamples > 0 {
+		status.FallbackRMSOffset = time.Duration(math.Sqrt(ad.fallbackSquares / float64(ad.fallbackSamples)))
+	}
+
+	return status
+}
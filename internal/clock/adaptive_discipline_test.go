@@ -0,0 +1,115 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestAdaptiveDisciplineControlsClock(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ad := NewAdaptiveDiscipline(config.AdaptiveGuardConfig{}, defaultKP, defaultKI, defaultKD, logger)
+
+	duration := 2000 * time.Second
+	maxOffset, freq := runDisciplineLoop(ad, 20000, time.Second, 7*time.Second, duration, duration/2)
+	if maxOffset > float64(10*time.Microsecond) {
+		t.Errorf("max offset after settle = %v, want <= 10µs", time.Duration(maxOffset))
+	}
+	if math.Abs(freq+20000) > 10 {
+		t.Errorf("frequency = %.1f ppb, want -20000", freq)
+	}
+
+	// Контроллер вышел из прогрева и управляет часами сам
+	status := ad.Status()
+	if !status.Active || status.Fallback {
+		t.Fatalf("status = %+v, want adaptive controller active", status)
+	}
+	if status.AdaptiveRMSOffset == 0 || status.AdaptiveRMSOffset > status.FallbackRMSOffset {
+		t.Errorf("adaptive rms %v, fallback rms %v, want adaptive better than warmup",
+			status.AdaptiveRMSOffset, status.FallbackRMSOffset)
+	}
+
+	perf := status.Performance
+	if perf.Samples == 0 {
+		t.Fatal("performance samples = 0, want algorithms evaluated")
+	}
+	for name, value := range map[string]float64{
+		"neural": perf.NeuralPerformance,
+		"kalman": perf.KalmanPerformance,
+		"fuzzy":  perf.FuzzyPerformance,
+		"rl":     perf.RLPerformance,
+	} {
+		if value <= 0 || math.IsNaN(value) {
+			t.Errorf("%s performance = %v, want positive error estimate", name, value)
+		}
+	}
+	w := perf.Weights
+	if sum := w.Neural + w.Kalman + w.Fuzzy + w.RL; math.Abs(sum-1) > 1e-9 {
+		t.Errorf("weights sum = %v, want 1", sum)
+	}
+}
+
+func TestAdaptiveDisciplineExtremeJitter(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ad := NewAdaptiveDiscipline(config.AdaptiveGuardConfig{RecoverySamples: 5}, defaultKP, defaultKI, defaultKD, logger)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var offset float64
+	for i := 0; i < 400; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		input := DisciplineInput{
+			Offset:    time.Duration(offset),
+			Jitter:    time.Microsecond,
+			Timestamp: now,
+			Measured:  now,
+		}
+		if i > 0 {
+			input.Interval = time.Second
+		}
+		if i >= 300 {
+			// Джиттер за пределами рабочего диапазона
+			input.Jitter = 200 * time.Millisecond
+		}
+
+		freq := ad.Sample(input)
+		if i == 299 && !ad.Status().Active {
+			t.Fatalf("status before jitter = %+v, want adaptive active", ad.Status())
+		}
+		offset -= 5000 + freq
+	}
+
+	status := ad.Status()
+	if status.Active || status.FallbackReason != "low_confidence" || status.LastAlgorithm != "extreme_conditions" {
+		t.Errorf("status = %+v, want PID fallback on extreme conditions", status)
+	}
+	if status.FallbackCount != 1 {
+		t.Errorf("fallback count = %d, want 1", status.FallbackCount)
+	}
+}
+
+func TestSimulationAdaptive(t *testing.T) {
+	oscillator := SimOscillatorConfig{FrequencyOffset: 20000, RandomWalk: 0.1, InitialOffset: 200 * time.Millisecond, Seed: 7}
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "adaptive"}}
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+
+	result := sim.Run(2 * time.Hour)
+	if state := result.Final().State; state != ClockStateLocked {
+		t.Errorf("final state = %v, want locked", state)
+	}
+	if rms := result.RMSOffset(90 * time.Minute); rms > 20*time.Microsecond {
+		t.Errorf("rms offset = %v, want <= 20µs", rms)
+	}
+
+	status, ok := sim.Manager().GetAdaptiveStatus()
+	if !ok {
+		t.Fatal("adaptive status not available")
+	}
+	if !status.Active || status.Performance.Samples == 0 {
+		t.Errorf("status = %+v, want active adaptive controller with performance", status)
+	}
+}
@@ -0,0 +1,474 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	// maxFrequencyPPB предел частотной подстройки ядра (±500 ppm)
+	maxFrequencyPPB = 500000.0
+
+	// Коэффициенты PID и PI по умолчанию на одно обновление: постоянная
+	// времени контура - 8 интервалов обновления, критическое затухание
+	defaultKP = 0.125
+	defaultKI = defaultKP * defaultKP / 4
+	defaultKD = 0.0
+)
+
+// DisciplineInput входные данные для алгоритма дисциплины часов
+type DisciplineInput struct {
+	Offset    time.Duration // Смещение источника относительно локальных часов
+	Delay     time.Duration // Задержка до источника
+	Jitter    time.Duration // Оценка джиттера смещения
+	Quality   int           // Качество источника (0-255)
+	Interval  time.Duration // Время с предыдущего обновления
+	Timestamp time.Time     // Время обновления
+	Measured  time.Time     // Время измерения, выбранного фильтром (может быть раньше Timestamp)
+}
+
+// Discipline интерфейс алгоритма дисциплины (серво) часов.
+// Sample принимает очередное измерение и возвращает частотную
+// поправку в ppb, которую нужно применить к часам.
+type Discipline interface {
+	// Name возвращает имя алгоритма
+	Name() string
+
+	// Sample обрабатывает измерение и возвращает поправку частоты в ppb
+	Sample(input DisciplineInput) float64
+
+	// Reset сбрасывает внутреннее состояние (например, после step)
+	Reset()
+}
+
+// FrequencySetter дисциплина, которой можно задать начальную оценку
+// частоты (например, восстановленную из drift файла)
+type FrequencySetter interface {
+	// SetFrequency задает текущую частотную поправку в ppb
+	SetFrequency(ppb float64)
+}
+
+// NewDiscipline создает алгоритм дисциплины по секции clock конфигурации
+func NewDiscipline(cfg config.ClockConfig, logger *logrus.Logger) (Discipline, error) {
+	kp, ki, kd := disciplineGains(cfg)
+	switch strings.ToLower(cfg.Algorithm) {
+	case "", "pid":
+		integrator := cfg.Integrator
+		if integrator == 0 {
+			integrator = maxFrequencyPPB
+		}
+		return NewPIDController(kp, ki, kd, integrator, maxFrequencyPPB), nil
+	case "pi":
+		return NewPIController(kp, ki, maxFrequencyPPB), nil
+	case "kalman":
+		return NewKalmanDiscipline(kp, maxFrequencyPPB), nil
+	case "adaptive":
+		return NewAdaptiveDiscipline(cfg.Adaptive, kp, ki, kd, logger), nil
+	case "hybrid":
+		return NewHybridDiscipline(cfg.Hybrid, maxFrequencyPPB, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown clock algorithm: %s", cfg.Algorithm)
+	}
+}
+
+// disciplineGains возвращает коэффициенты алгоритма с учетом значений по
+// умолчанию (нулевые коэффициенты в конфигурации)
+func disciplineGains(cfg config.ClockConfig) (kp, ki, kd float64) {
+	kp, ki, kd = cfg.KP, cfg.KI, cfg.KD
+	switch strings.ToLower(cfg.Algorithm) {
+	case "", "pid", "adaptive":
+		if kp == 0 && ki == 0 && kd == 0 {
+			kp, ki, kd = defaultKP, defaultKI, defaultKD
+		}
+	case "pi":
+		if kp == 0 && ki == 0 {
+			kp, ki = defaultKP, defaultKI
+		}
+		kd = 0
+	case "kalman":
+		if kp <= 0 {
+			kp = 0.5
+		}
+		ki, kd = 0, 0
+	default:
+		return 0, 0, 0
+	}
+	return kp, ki, kd
+}
+
+// GetSupportedAlgorithms возвращает список поддерживаемых алгоритмов дисциплины
+func GetSupportedAlgorithms() []string {
+	return append([]string(nil), config.ClockAlgorithms...)
+}
+
+// clampFrequency ограничивает поправку частоты пределом
+func clampFrequency(ppb, limit float64) float64 {
+	return math.Max(-limit, math.Min(limit, ppb))
+}
+
+// appliedFrequency частота, выданная дисциплиной в момент from
+type appliedFrequency struct {
+	from time.Time
+	freq float64
+}
+
+// appliedHistory частоты, выданные дисциплиной после последнего
+// использованного измерения. Фильтр источника выбирает измерение с
+// минимальной задержкой, и оно может быть на несколько опросов старше
+// текущего момента; запаздывание фазы делает контур неустойчивым, поэтому
+// смещение переносится на текущий момент по выданной с тех пор частоте.
+type appliedHistory struct {
+	segments []appliedFrequency
+}
+
+// add запоминает частоту, выданную в момент now, и отбрасывает сегменты,
+// закончившиеся до keepFrom
+func (h *appliedHistory) add(now time.Time, freq float64, keepFrom time.Time) float64 {
+	h.segments = append(h.segments, appliedFrequency{from: now, freq: freq})
+
+	// Последний сегмент до keepFrom действовал в момент измерения
+	keep := 0
+	for keep+1 < len(h.segments) && !h.segments[keep+1].from.After(keepFrom) {
+		keep++
+	}
+	h.segments = h.segments[keep:]
+	return freq
+}
+
+// last возвращает последнюю выданную частоту или fallback
+func (h *appliedHistory) last(fallback float64) float64 {
+	if len(h.segments) == 0 {
+		return fallback
+	}
+	return h.segments[len(h.segments)-1].freq
+}
+
+// mean возвращает среднюю выданную частоту на интервале [from, to] или
+// fallback, если история пуста
+func (h *appliedHistory) mean(from, to time.Time, fallback float64) float64 {
+	total := to.Sub(from).Seconds()
+	if total <= 0 || len(h.segments) == 0 {
+		return fallback
+	}
+
+	var sum float64
+	for i, segment := range h.segments {
+		start := segment.from
+		if start.Before(from) {
+			start = from
+		}
+		end := to
+		if i+1 < len(h.segments) && h.segments[i+1].from.Before(to) {
+			end = h.segments[i+1].from
+		}
+		if end.After(start) {
+			sum += segment.freq * end.Sub(start).Seconds()
+		}
+	}
+
+	// До первого известного сегмента действовала частота первого сегмента
+	if first := h.segments[0].from; first.After(from) {
+		end := first
+		if end.After(to) {
+			end = to
+		}
+		sum += h.segments[0].freq * end.Sub(from).Seconds()
+	}
+	return sum / total
+}
+
+// project переносит смещение, измеренное в момент measured, на момент now:
+// с тех пор смещение менялось на разницу оценки частоты генератора
+// estimate и выданной частоты
+func (h *appliedHistory) project(offset float64, measured, now time.Time, estimate float64) float64 {
+	if measured.IsZero() || !now.After(measured) {
+		return offset
+	}
+	age := now.Sub(measured).Seconds()
+	return offset + (estimate-h.mean(measured, now, estimate))*age
+}
+
+// reset очищает историю
+func (h *appliedHistory) reset() {
+	h.segments = nil
+}
+
+// PIDController implements a PID controller for clock discipline.
+// Коэффициенты безразмерные и задаются на одно обновление: за интервал до
+// следующего обновления P-составляющая убирает долю Kp смещения, поэтому
+// постоянная времени контура равна интервалу обновлений, деленному на Kp,
+// и не зависит от интервала опроса источника. Интегральная составляющая -
+// оценка частоты генератора в ppb, каждое обновление она сдвигается на
+// долю Ki смещения; при Ki = Kp²/4 контур критически затухает.
+type PIDController struct {
+	Kp, Ki, Kd    float64 // PID gains
+	integral      float64 // Integral term accumulator, ppb
+	prevError     float64 // Previous error for derivative
+	integralLimit float64 // Integral windup limit, ppb
+	outputLimit   float64 // Output saturation limit
+	applied       appliedHistory
+	lastMeasured  time.Time
+}
+
+// NewPIDController creates a new PID controller
+func NewPIDController(kp, ki, kd, integralLimit, outputLimit float64) *PIDController {
+	return &PIDController{
+		Kp:            kp,
+		Ki:            ki,
+		Kd:            kd,
+		integralLimit: integralLimit,
+		outputLimit:   outputLimit,
+	}
+}
+
+// Name возвращает имя алгоритма
+func (pid *PIDController) Name() string {
+	return "pid"
+}
+
+// Sample обрабатывает измерение смещения (ошибка в наносекундах)
+func (pid *PIDController) Sample(input DisciplineInput) float64 {
+	dt := input.Interval.Seconds()
+	if dt <= 0 {
+		// Интервал еще неизвестен: держим накопленную (например,
+		// восстановленную из drift файла) частоту
+		return pid.applied.add(input.Timestamp, clampFrequency(pid.integral, pid.outputLimit), pid.lastMeasured)
+	}
+
+	offset := pid.applied.project(float64(input.Offset), input.Measured, input.Timestamp, pid.integral)
+	if input.Measured.After(pid.lastMeasured) {
+		pid.lastMeasured = input.Measured
+	}
+	return pid.applied.add(input.Timestamp, pid.Update(offset, dt), pid.lastMeasured)
+}
+
+// Update calculates PID controller output for the error at the current
+// moment and the interval dt (seconds) until the next update
+func (pid *PIDController) Update(error, dt float64) float64 {
+	// Proportional term
+	p := pid.Kp * error / dt
+
+	// Integral term with windup protection
+	pid.integral += pid.Ki * error / dt
+	if pid.integral > pid.integralLimit {
+		pid.integral = pid.integralLimit
+	} else if pid.integral < -pid.integralLimit {
+		pid.integral = -pid.integralLimit
+	}
+
+	// Derivative term
+	d := pid.Kd * (error - pid.prevError) / dt
+	pid.prevError = error
+
+	// Calculate output with saturation
+	return clampFrequency(p+pid.integral+d, pid.outputLimit)
+}
+
+// Reset resets the PID controller state, keeping the frequency estimate
+func (pid *PIDController) Reset() {
+	pid.prevError = 0
+	pid.applied.reset()
+	pid.lastMeasured = time.Time{}
+}
+
+// SetFrequency задает интегральную составляющую так, чтобы выход при
+// нулевом смещении был равен ppb
+func (pid *PIDController) SetFrequency(ppb float64) {
+	pid.integral = clampFrequency(ppb, pid.integralLimit)
+}
+
+// Frequency возвращает оценку частоты генератора (интегральную
+// составляющую) в ppb
+func (pid *PIDController) Frequency() float64 {
+	return pid.integral
+}
+
+// PIController PI серво в стиле linuxptp: первые два измерения
+// используются для оценки начальной частоты, далее работает PI регулятор
+// с коэффициентами на одно обновление, как у PIDController.
+type PIController struct {
+	Kp, Ki      float64
+	drift       float64 // Накопленная частотная поправка (ppb)
+	outputLimit float64
+
+	count        int
+	lastOffset   time.Duration
+	lastMeasured time.Time
+	applied      appliedHistory
+}
+
+// NewPIController создает новый PI серво
+func NewPIController(kp, ki, outputLimit float64) *PIController {
+	return &PIController{
+		Kp:          kp,
+		Ki:          ki,
+		outputLimit: outputLimit,
+	}
+}
+
+// Name возвращает имя алгоритма
+func (pi *PIController) Name() string {
+	return "pi"
+}
+
+// Sample обрабатывает измерение и возвращает поправку частоты в ppb
+func (pi *PIController) Sample(input DisciplineInput) float64 {
+	dt := input.Interval.Seconds()
+	measured := input.Measured
+	if measured.IsZero() {
+		measured = input.Timestamp
+	}
+
+	switch pi.count {
+	case 0:
+		// Запоминаем первое измерение
+		pi.lastOffset = input.Offset
+		pi.lastMeasured = measured
+		pi.count++
+		return pi.applied.add(input.Timestamp, pi.drift, pi.lastMeasured)
+	case 1:
+		// Оцениваем частоту по двум измерениям: смещение менялось на
+		// разницу частоты генератора и выданной частоты
+		if interval := measured.Sub(pi.lastMeasured).Seconds(); interval > 0 {
+			pi.drift = pi.applied.mean(pi.lastMeasured, measured, pi.drift) + float64(input.Offset-pi.lastOffset)/interval
+			pi.drift = clampFrequency(pi.drift, pi.outputLimit)
+			pi.lastOffset = input.Offset
+			pi.lastMeasured = measured
+			pi.count++
+		}
+		return pi.applied.add(input.Timestamp, pi.drift, pi.lastMeasured)
+	}
+
+	if dt <= 0 {
+		return pi.applied.last(pi.drift)
+	}
+
+	offset := pi.applied.project(float64(input.Offset), measured, input.Timestamp, pi.drift)
+	pi.drift += pi.Ki * offset / dt
+	pi.drift = clampFrequency(pi.drift, pi.outputLimit)
+	pi.lastOffset = input.Offset
+	if measured.After(pi.lastMeasured) {
+		pi.lastMeasured = measured
+	}
+
+	return pi.applied.add(input.Timestamp, clampFrequency(pi.Kp*offset/dt+pi.drift, pi.outputLimit), pi.lastMeasured)
+}
+
+// Reset сбрасывает состояние, сохраняя оценку частоты
+func (pi *PIController) Reset() {
+	pi.count = 0
+	pi.lastOffset = 0
+	pi.lastMeasured = time.Time{}
+	pi.applied.reset()
+}
+
+// SetFrequency задает накопленную частотную поправку
+func (pi *PIController) SetFrequency(ppb float64) {
+	pi.drift = clampFrequency(ppb, pi.outputLimit)
+}
+
+// KalmanDiscipline дисциплина на базе фильтра Калмана с состоянием
+// [смещение (нс), скорость ухода смещения (нс/с)]. Выход — оценка
+// скорости ухода плюс поправка, убирающая долю оцененного смещения до
+// следующего обновления.
+type KalmanDiscipline struct {
+	phaseGain   float64
+	outputLimit float64
+
+	phase float64 // Оценка смещения, нс
+	rate  float64 // Оценка скорости ухода, нс/с (ppb)
+	p     [2][2]float64
+
+	lastOutput   float64
+	initialized  bool
+	lastMeasured time.Time
+	applied      appliedHistory
+}
+
+// NewKalmanDiscipline создает дисциплину на базе фильтра Калмана
+func NewKalmanDiscipline(phaseGain, outputLimit float64) *KalmanDiscipline {
+	if phaseGain <= 0 {
+		phaseGain = 0.5
+	}
+	kd := &KalmanDiscipline{
+		phaseGain:   phaseGain,
+		outputLimit: outputLimit,
+	}
+	kd.Reset()
+	return kd
+}
+
+// Name возвращает имя алгоритма
+func (kd *KalmanDiscipline) Name() string {
+	return "kalman"
+}
+
+// Sample обрабатывает измерение и возвращает поправку частоты в ppb
+func (kd *KalmanDiscipline) Sample(input DisciplineInput) float64 {
+	dt := input.Interval.Seconds()
+	z := kd.applied.project(float64(input.Offset), input.Measured, input.Timestamp, kd.rate)
+	if input.Measured.After(kd.lastMeasured) {
+		kd.lastMeasured = input.Measured
+	}
+
+	if !kd.initialized || dt <= 0 {
+		// Интервал обновлений еще неизвестен, фаза пока не подстраивается
+		kd.phase = z
+		kd.initialized = true
+		kd.lastOutput = kd.rate
+		return kd.applied.add(input.Timestamp, kd.lastOutput, kd.lastMeasured)
+	}
+
+	// Предсказание: смещение уходит со скоростью rate, уменьшаясь на
+	// примененную поправку частоты
+	kd.phase += (kd.rate - kd.lastOutput) * dt
+
+	qPhase := 1.0 * dt // нс^2 на секунду
+	qRate := 0.2 * dt  // (нс/с)^2 на секунду
+	p00 := kd.p[0][0] + dt*(kd.p[1][0]+kd.p[0][1]) + dt*dt*kd.p[1][1] + qPhase
+	p01 := kd.p[0][1] + dt*kd.p[1][1]
+	p10 := kd.p[1][0] + dt*kd.p[1][1]
+	p11 := kd.p[1][1] + qRate
+
+	// Шум измерения по джиттеру фильтра: сама задержка не ошибка смещения,
+	// ее асимметрию учитывает root distance при выборе источника
+	r := float64(input.Jitter)
+	r = math.Max(r*r, 1)
+
+	// Обновление
+	s := p00 + r
+	k0 := p00 / s
+	k1 := p10 / s
+	innovation := z - kd.phase
+	kd.phase += k0 * innovation
+	kd.rate += k1 * innovation
+	kd.rate = clampFrequency(kd.rate, kd.outputLimit)
+
+	kd.p[0][0] = (1 - k0) * p00
+	kd.p[0][1] = (1 - k0) * p01
+	kd.p[1][0] = p10 - k1*p00
+	kd.p[1][1] = p11 - k1*p01
+
+	kd.lastOutput = clampFrequency(kd.rate+kd.phaseGain*kd.phase/dt, kd.outputLimit)
+	return kd.applied.add(input.Timestamp, kd.lastOutput, kd.lastMeasured)
+}
+
+// Reset сбрасывает оценку смещения, сохраняя оценку частоты
+func (kd *KalmanDiscipline) Reset() {
+	kd.phase = 0
+	kd.initialized = false
+	kd.lastMeasured = time.Time{}
+	kd.applied.reset()
+	kd.p = [2][2]float64{{1e12, 0}, {0, 1e6}}
+}
+
+// SetFrequency задает оценку скорости ухода
+func (kd *KalmanDiscipline) SetFrequency(ppb float64) {
+	kd.rate = clampFrequency(ppb, kd.outputLimit)
+	kd.lastOutput = kd.rate
+}
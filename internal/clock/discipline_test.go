@@ -0,0 +1,117 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// runDisciplineLoop замыкает дисциплину на генератор, уходящий на
+// natural ppb. Раз в poll дисциплина получает смещение, измеренное age
+// назад, как после фильтра с минимальной задержкой. Возвращает
+// наибольшее смещение и последнюю поправку частоты после settle.
+func runDisciplineLoop(d Discipline, natural float64, poll, age, duration, settle time.Duration) (float64, float64) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []float64{float64(time.Millisecond)} // Смещение на каждую секунду
+	var freq, maxOffset float64
+	var last time.Time
+
+	for t := time.Duration(0); t < duration; t += time.Second {
+		second := int(t / time.Second)
+		if t%poll == 0 && t >= age {
+			now := start.Add(t)
+			input := DisciplineInput{
+				Offset:    time.Duration(offsets[second-int(age/time.Second)]),
+				Jitter:    time.Microsecond,
+				Timestamp: now,
+				Measured:  now.Add(-age),
+			}
+			if !last.IsZero() {
+				input.Interval = now.Sub(last)
+			}
+			last = now
+			freq = d.Sample(input)
+		}
+		if t >= settle {
+			maxOffset = math.Max(maxOffset, math.Abs(offsets[second]))
+		}
+		offsets = append(offsets, offsets[second]-(natural+freq))
+	}
+	return maxOffset, freq
+}
+
+func TestDisciplineConvergence(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	tests := []struct {
+		name string
+		poll time.Duration
+		age  time.Duration
+	}{
+		// Фильтр NTP выбирает измерение на несколько опросов старше текущего
+		{name: "stale samples", poll: time.Second, age: 7 * time.Second},
+		// Коэффициенты заданы на одно обновление и следуют за интервалом опроса
+		{name: "long poll", poll: 64 * time.Second},
+	}
+
+	for _, algorithm := range []string{"pid", "pi", "kalman"} {
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				d, err := NewDiscipline(config.ClockConfig{Algorithm: algorithm}, logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				duration := 1000 * tt.poll
+				maxOffset, freq := runDisciplineLoop(d, 20000, tt.poll, tt.age, duration, duration/2)
+				if maxOffset > float64(10*time.Microsecond) {
+					t.Errorf("max offset after settle = %v, want <= 10µs", time.Duration(maxOffset))
+				}
+				if math.Abs(freq+20000) > 1 {
+					t.Errorf("frequency = %.1f ppb, want -20000", freq)
+				}
+			})
+		}
+	}
+}
+
+func TestSupportedAlgorithms(t *testing.T) {
+	// Каждый алгоритм, который пропускает проверка конфигурации, создается
+	for _, algorithm := range GetSupportedAlgorithms() {
+		if _, err := NewDiscipline(config.ClockConfig{Algorithm: algorithm}, logrus.New()); err != nil {
+			t.Errorf("NewDiscipline(%q): %v", algorithm, err)
+		}
+	}
+}
+
+func TestAdaptiveFallbackGains(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	tests := []struct {
+		name       string
+		kp, ki, kd float64
+		want       [3]float64
+	}{
+		{name: "defaults", want: [3]float64{defaultKP, defaultKI, defaultKD}},
+		{name: "configured", kp: 0.5, ki: 0.01, kd: 0.1, want: [3]float64{0.5, 0.01, 0.1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ClockConfig{Algorithm: "adaptive", KP: tt.kp, KI: tt.ki, KD: tt.kd}
+			d, err := NewDiscipline(cfg, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pid := d.(*AdaptiveDiscipline).fallback
+			if got := [3]float64{pid.Kp, pid.Ki, pid.Kd}; got != tt.want {
+				t.Errorf("fallback gains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDriftFileInterval = time.Hour // Как ntpd: drift файл обновляется раз в час
+)
+
+// DriftStatus состояние drift файла для статистики и API
+type DriftStatus struct {
+	Path           string    `json:"path"`
+	Restored       bool      `json:"restored"`
+	Frequency      float64   `json:"frequency"`       // Последняя сохраненная или восстановленная частота, ppb
+	FrequencyError float64   `json:"frequency_error"` // Стандартная ошибка частоты, ppb
+	LastSaved      time.Time `json:"last_saved,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// DriftFile хранит выученную частоту генератора между перезапусками.
+// Формат как у chrony: одна строка "<частота ppb> <ошибка ppb>".
+type DriftFile struct {
+	mu sync.RWMutex
+
+	path     string
+	interval time.Duration
+	status   DriftStatus
+}
+
+// NewDriftFile создает drift файл с заданным периодом сохранения
+func NewDriftFile(path string, interval time.Duration) *DriftFile {
+	if interval <= 0 {
+		interval = defaultDriftFileInterval
+	}
+	return &DriftFile{
+		path:     path,
+		interval: interval,
+		status:   DriftStatus{Path: path},
+	}
+}
+
+// Load читает сохраненную частоту и ее ошибку
+func (d *DriftFile) Load() (float64, float64, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read drift file: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("drift file %s is empty", d.path)
+	}
+
+	freq, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid frequency in drift file: %w", err)
+	}
+	if math.IsNaN(freq) || math.Abs(freq) > maxFrequencyPPB {
+		return 0, 0, fmt.Errorf("frequency %.3f ppb in drift file is out of range", freq)
+	}
+
+	var freqErr float64
+	if len(fields) > 1 {
+		freqErr, err = strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid frequency error in drift file: %w", err)
+		}
+	}
+
+	d.mu.Lock()
+	d.status.Restored = true
+	d.status.Frequency = freq
+	d.status.FrequencyError = freqErr
+	d.mu.Unlock()
+
+	return freq, freqErr, nil
+}
+
+// Due возвращает true, если пора сохранить частоту
+func (d *DriftFile) Due(now time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return now.Sub(d.status.LastSaved) >= d.interval
+}
+
+// Save атомарно записывает частоту и ее ошибку
+func (d *DriftFile) Save(freq, freqErr float64, now time.Time) error {
+	err := d.write(freq, freqErr)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Неудачная попытка тоже откладывает следующую, чтобы не писать каждую секунду
+	d.status.LastSaved = now
+	if err != nil {
+		d.status.LastError = err.Error()
+		return err
+	}
+
+	d.status.Frequency = freq
+	d.status.FrequencyError = freqErr
+	d.status.LastError = ""
+	return nil
+}
+
+// write записывает файл через временный файл и rename
+func (d *DriftFile) write(freq, freqErr float64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create drift file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintf(tmp, "%.3f %.3f\n", freq, freqErr); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write drift file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write drift file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return fmt.Errorf("failed to replace drift file: %w", err)
+	}
+
+	return nil
+}
+
+// Status возвращает состояние drift файла
+func (d *DriftFile) Status() DriftStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.status
+}
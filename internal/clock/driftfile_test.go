@@ -0,0 +1,140 @@
+package clock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDriftFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shiwatime.drift")
+	now := simulationEpoch
+
+	d := NewDriftFile(path, time.Hour)
+	if !d.Due(now) {
+		t.Error("new drift file must be due")
+	}
+	if err := d.Save(-20123.4567, 12.5, now); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if d.Due(now.Add(59*time.Minute)) || !d.Due(now.Add(time.Hour)) {
+		t.Error("drift file must be due once per interval")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "-20123.457 12.500\n" {
+		t.Errorf("drift file = %q", data)
+	}
+
+	loaded := NewDriftFile(path, 0)
+	freq, freqErr, err := loaded.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if freq != -20123.457 || freqErr != 12.5 {
+		t.Errorf("Load() = %v, %v, want -20123.457, 12.5", freq, freqErr)
+	}
+	status := loaded.Status()
+	if !status.Restored || status.Frequency != freq || status.FrequencyError != freqErr || status.Path != path {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestDriftFileLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "empty", content: "\n", err: "is empty"},
+		{name: "not a number", content: "fast 1.0\n", err: "invalid frequency in drift file"},
+		{name: "out of range", content: "600000000 1.0\n", err: "out of range"},
+		{name: "nan", content: "NaN 1.0\n", err: "out of range"},
+		{name: "invalid error", content: "-20000.000 ???\n", err: "invalid frequency error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "shiwatime.drift")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDriftFile(path, 0)
+			if _, _, err := d.Load(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want %q", err, tt.err)
+			}
+			if d.Status().Restored {
+				t.Error("corrupt drift file must not be restored")
+			}
+		})
+	}
+
+	// Без ошибки частоты файл в формате ntpd тоже читается
+	path := filepath.Join(t.TempDir(), "ntp.drift")
+	if err := os.WriteFile(path, []byte("-20.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if freq, freqErr, err := NewDriftFile(path, 0).Load(); err != nil || freq != -20.5 || freqErr != 0 {
+		t.Errorf("Load() = %v, %v, %v, want -20.5, 0", freq, freqErr, err)
+	}
+
+	// Отсутствующий файл - ошибка, но не паника: частота просто не восстанавливается
+	d := NewDriftFile(filepath.Join(t.TempDir(), "missing.drift"), 0)
+	if _, _, err := d.Load(); err == nil || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load() error = %v, want not exist", err)
+	}
+}
+
+func TestDriftFileAtomicSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shiwatime.drift")
+	now := simulationEpoch
+
+	d := NewDriftFile(path, time.Hour)
+	if err := d.Save(100, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Save(200, 2, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Файл заменяется целиком, временные файлы не остаются
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "shiwatime.drift" {
+		t.Errorf("directory entries = %v, want only drift file", entries)
+	}
+	if freq, _, err := NewDriftFile(path, 0).Load(); err != nil || freq != 200 {
+		t.Errorf("Load() = %v, %v, want 200", freq, err)
+	}
+
+	// Неудачная замена не трогает цель и откладывает следующую попытку
+	target := filepath.Join(dir, "busy")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	busy := NewDriftFile(target, time.Hour)
+	if err := busy.Save(300, 3, now); err == nil || !strings.Contains(err.Error(), "failed to replace drift file") {
+		t.Fatalf("Save() error = %v, want replace failure", err)
+	}
+	status := busy.Status()
+	if status.LastError == "" || !status.LastSaved.Equal(now) || status.Frequency != 0 {
+		t.Errorf("status = %+v, want failed save recorded", status)
+	}
+	if busy.Due(now.Add(time.Minute)) {
+		t.Error("failed save must postpone the next attempt")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("directory entries = %v, temporary file left behind", entries)
+	}
+}
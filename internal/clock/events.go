@@ -0,0 +1,211 @@
+package clock
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEventBuffer = 64
+	eventHistorySize   = 256
+)
+
+// EventType тип события часов или источника
+type EventType string
+
+const (
+	EventSourceUp       EventType = "source_up"       // Источник подключился
+	EventSourceDown     EventType = "source_down"     // Источник потерял соединение
+	EventSourceSelected EventType = "source_selected" // Сменился системный источник
+	EventStep           EventType = "step"            // Выполнен step часов
+	EventStepRejected   EventType = "step_rejected"   // Step или смещение отвергнуто политикой шага
+	EventStateChange    EventType = "state_change"    // Переход машины состояний
+	EventLeapArmed      EventType = "leap_armed"      // Ожидается секунда координации
+	EventGNSSFixLost    EventType = "gnss_fix_lost"   // GNSS приемник потерял фикс
+)
+
+// Event событие шины. Data содержит запись соответствующего журнала:
+// StateTransition, StepRecord, SwitchRecord, LeapStatus или GNSSStatus.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      EventType   `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Source    string      `json:"source,omitempty"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// EventFilter отбирает события по типам и источникам. Пустой список
+// означает любые значения.
+type EventFilter struct {
+	Types   []EventType
+	Sources []string
+}
+
+// ParseEventFilter создает фильтр из списков через запятую, как в
+// параметрах запроса ?type=step,state_change&source=gnss
+func ParseEventFilter(types, sources string) EventFilter {
+	var filter EventFilter
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, EventType(t))
+		}
+	}
+	for _, s := range strings.Split(sources, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			filter.Sources = append(filter.Sources, s)
+		}
+	}
+	return filter
+}
+
+// Match проверяет, проходит ли событие фильтр
+func (f EventFilter) Match(event Event) bool {
+	if len(f.Types) > 0 && !containsEventType(f.Types, event.Type) {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsString(f.Sources, event.Source) {
+		return false
+	}
+	return true
+}
+
+func containsEventType(types []EventType, t EventType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, candidate := range values {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// EventSubscription подписка на события шины. События приходят в C, пока
+// подписка не закрыта; при переполнении буфера они теряются и учитываются
+// в Dropped.
+type EventSubscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	filter  EventFilter
+	dropped uint64
+	bus     *EventBus
+	once    sync.Once
+}
+
+// Dropped возвращает число событий, потерянных из-за полного буфера
+func (s *EventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close отменяет подписку и закрывает канал
+func (s *EventSubscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscribers, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// EventBus внутрипроцессная шина событий часов и источников. Публикация
+// не блокируется: медленный подписчик теряет события, но не задерживает
+// цикл синхронизации. Последние события хранятся для запросов API.
+type EventBus struct {
+	mu sync.RWMutex
+
+	nextID      uint64
+	history     []Event
+	subscribers map[*EventSubscription]struct{}
+
+	logger *logrus.Logger
+}
+
+// NewEventBus создает шину событий
+func NewEventBus(logger *logrus.Logger) *EventBus {
+	return &EventBus{
+		subscribers: make(map[*EventSubscription]struct{}),
+		logger:      logger,
+	}
+}
+
+// Publish присваивает событию номер и рассылает его подписчикам
+func (b *EventBus) Publish(event Event) Event {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[1:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+			b.logger.WithField("event", event.Type).Debug("Event subscriber buffer full, event dropped")
+		}
+	}
+
+	return event
+}
+
+// Subscribe подписывает на события, прошедшие фильтр. Канал ограничен
+// buffer событиями (по умолчанию 64).
+func (b *EventBus) Subscribe(filter EventFilter, buffer int) *EventSubscription {
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+
+	ch := make(chan Event, buffer)
+	sub := &EventSubscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+		bus:    b,
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// History возвращает сохраненные события с номером больше since,
+// прошедшие фильтр
+func (b *EventBus) History(filter EventFilter, since uint64) []Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	events := make([]Event, 0, len(b.history))
+	for _, event := range b.history {
+		if event.ID > since && filter.Match(event) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
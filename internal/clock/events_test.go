@@ -0,0 +1,83 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestEventBusFilterAndBuffer(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	bus := NewEventBus(logger)
+	steps := bus.Subscribe(ParseEventFilter("step", ""), 2)
+	gnss := bus.Subscribe(ParseEventFilter("", "gnss"), 16)
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(Event{Type: EventStep, Source: "ntp"})
+	}
+	bus.Publish(Event{Type: EventSourceDown, Source: "gnss"})
+	bus.Publish(Event{Type: EventGNSSFixLost, Source: "gnss"})
+
+	// Буфер на 2 события: третий step потерян, публикация не блокируется
+	if len(steps.C) != 2 || steps.Dropped() != 1 {
+		t.Errorf("step subscription: queued %d, dropped %d, want 2 and 1", len(steps.C), steps.Dropped())
+	}
+	if first := <-steps.C; first.ID != 1 {
+		t.Errorf("first event id = %d, want 1", first.ID)
+	}
+
+	gnss.Close()
+	var types []EventType
+	for event := range gnss.C {
+		types = append(types, event.Type)
+	}
+	if len(types) != 2 || types[0] != EventSourceDown || types[1] != EventGNSSFixLost {
+		t.Errorf("gnss events = %v, want [source_down gnss_fix_lost]", types)
+	}
+
+	// После закрытия подписка не получает событий
+	bus.Publish(Event{Type: EventStep, Source: "gnss"})
+
+	if history := bus.History(ParseEventFilter("step", ""), 2); len(history) != 2 {
+		t.Errorf("step history after id 2 = %d events, want 2", len(history))
+	}
+}
+
+func TestSimulationEvents(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman"}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 1000, InitialOffset: 10 * time.Second, Seed: 1}
+	outage := SimOutage{Start: 30 * time.Minute, End: 40 * time.Minute}
+
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond, outage))
+	sub := sim.Manager().Events().Subscribe(EventFilter{}, 256)
+	defer sub.Close()
+	sim.Run(time.Hour)
+
+	counts := make(map[EventType]int)
+	for len(sub.C) > 0 {
+		event := <-sub.C
+		counts[event.Type]++
+	}
+
+	want := map[EventType]int{
+		EventSourceUp:       6, // При запуске и после восстановления
+		EventSourceDown:     3,
+		EventStep:           1,
+		EventSourceSelected: 3, // initial, no_survivors, recovered
+	}
+	for eventType, n := range want {
+		if counts[eventType] != n {
+			t.Errorf("%s events = %d, want %d (all: %v)", eventType, counts[eventType], n, counts)
+		}
+	}
+	if counts[EventStateChange] == 0 {
+		t.Error("no state_change events published")
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("dropped = %d, want 0", sub.Dropped())
+	}
+}
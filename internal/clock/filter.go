@@ -0,0 +1,335 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultNTPFilterStages   = 8    // NSTAGE из RFC 5905
+	defaultLuckyFilterWindow = 16
+	defaultLuckyPercentile   = 0.25
+
+	// Скорость роста дисперсии старых измерений (PHI из RFC 5905), 15 ppm
+	filterDispersionRate = 15e-6
+)
+
+// FilterSample сырое измерение источника
+type FilterSample struct {
+	Offset    time.Duration
+	Delay     time.Duration
+	Precision time.Duration
+	Timestamp time.Time
+}
+
+// FilterOutput отфильтрованное смещение источника
+type FilterOutput struct {
+	Offset     time.Duration
+	Delay      time.Duration
+	Dispersion time.Duration // Оценка ошибки отфильтрованного смещения
+	Jitter     time.Duration // Разброс смещений в окне фильтра
+	Timestamp  time.Time     // Время использованного измерения
+	Fresh      bool          // Выбрано измерение, которое еще не передавалось дисциплине
+}
+
+// SampleFilter фильтр измерений одного источника
+type SampleFilter interface {
+	// Name возвращает имя фильтра
+	Name() string
+
+	// Add добавляет измерение и возвращает текущий результат фильтра
+	Add(sample FilterSample) FilterOutput
+
+	// Reset очищает окно фильтра (например, после step)
+	Reset()
+}
+
+// NewSampleFilter создает фильтр, заданный в конфигурации источника.
+// Если фильтр не указан, выбирается по протоколу: ntp для NTP,
+// lucky для PTP, none для остальных.
+func NewSampleFilter(cfg config.TimeSourceConfig) (SampleFilter, error) {
+	name := strings.ToLower(cfg.Filter)
+	if name == "" {
+		switch cfg.Type {
+		case "ntp":
+			name = "ntp"
+		case "ptp":
+			name = "lucky"
+		default:
+			name = "none"
+		}
+	}
+
+	switch name {
+	case "ntp":
+		return NewNTPFilter(cfg.FilterLength), nil
+	case "lucky":
+		return NewLuckyPacketFilter(cfg.FilterLength, cfg.FilterPercentile), nil
+	case "none":
+		return NewPassthroughFilter(), nil
+	default:
+		return nil, fmt.Errorf("unsupported sample filter: %s", cfg.Filter)
+	}
+}
+
+// filterStage ступень регистра NTP фильтра
+type filterStage struct {
+	offset     time.Duration
+	delay      time.Duration
+	dispersion float64 // ns
+	timestamp  time.Time
+}
+
+// NTPFilter фильтр часов NTPv4 (RFC 5905 A.5.2): регистр из 8 последних
+// измерений, из которого берется измерение с минимальной задержкой
+type NTPFilter struct {
+	stages   int
+	register []filterStage
+	lastUsed time.Time
+	last     FilterOutput
+}
+
+// NewNTPFilter создает NTP фильтр с заданным числом ступеней
+func NewNTPFilter(stages int) *NTPFilter {
+	if stages <= 0 {
+		stages = defaultNTPFilterStages
+	}
+	return &NTPFilter{stages: stages}
+}
+
+// Name возвращает имя фильтра
+func (f *NTPFilter) Name() string {
+	return "ntp"
+}
+
+// Add добавляет измерение в регистр и выбирает измерение с минимальной задержкой
+func (f *NTPFilter) Add(sample FilterSample) FilterOutput {
+	if n := len(f.register); n > 0 && !sample.Timestamp.After(f.register[n-1].timestamp) {
+		// Повтор уже учтенного измерения
+		out := f.last
+		out.Fresh = false
+		return out
+	}
+
+	// Старые измерения стареют: дисперсия растет со скоростью PHI
+	if n := len(f.register); n > 0 {
+		elapsed := sample.Timestamp.Sub(f.register[n-1].timestamp).Seconds()
+		for i := range f.register {
+			f.register[i].dispersion += filterDispersionRate * elapsed * 1e9
+		}
+	}
+
+	f.register = append(f.register, filterStage{
+		offset:     sample.Offset,
+		delay:      sample.Delay,
+		dispersion: float64(sample.Precision),
+		timestamp:  sample.Timestamp,
+	})
+	if len(f.register) > f.stages {
+		f.register = f.register[1:]
+	}
+
+	sorted := append([]filterStage(nil), f.register...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].delay < sorted[j].delay
+	})
+
+	best := sorted[0]
+
+	// Дисперсия фильтра: сумма дисперсий ступеней с весами 1/2^(i+1)
+	var dispersion float64
+	for i, s := range sorted {
+		dispersion += s.dispersion / math.Pow(2, float64(i+1))
+	}
+
+	var jitter float64
+	if len(sorted) > 1 {
+		for _, s := range sorted[1:] {
+			diff := float64(s.offset - best.offset)
+			jitter += diff * diff
+		}
+		jitter = math.Sqrt(jitter / float64(len(sorted)-1))
+	}
+	if jitter < float64(sample.Precision) {
+		jitter = float64(sample.Precision)
+	}
+
+	out := FilterOutput{
+		Offset:     best.offset,
+		Delay:      best.delay,
+		Dispersion: time.Duration(dispersion),
+		Jitter:     time.Duration(jitter),
+		Timestamp:  best.timestamp,
+	}
+
+	// Дисциплине передаются только измерения новее последнего использованного
+	if best.timestamp.After(f.lastUsed) {
+		out.Fresh = true
+		f.lastUsed = best.timestamp
+	}
+
+	f.last = out
+	return out
+}
+
+// Reset очищает регистр фильтра
+func (f *NTPFilter) Reset() {
+	f.register = nil
+	f.lastUsed = time.Time{}
+	f.last = FilterOutput{}
+}
+
+// LuckyPacketFilter перцентильный фильтр для PTP: из окна измерений
+// усредняются только "удачные" пакеты с задержкой не выше заданного перцентиля
+type LuckyPacketFilter struct {
+	window     int
+	percentile float64
+	samples    []FilterSample
+	last       FilterOutput
+}
+
+// NewLuckyPacketFilter создает перцентильный фильтр
+func NewLuckyPacketFilter(window int, percentile float64) *LuckyPacketFilter {
+	if window <= 0 {
+		window = defaultLuckyFilterWindow
+	}
+	if percentile <= 0 || percentile > 1 {
+		percentile = defaultLuckyPercentile
+	}
+	return &LuckyPacketFilter{
+		window:     window,
+		percentile: percentile,
+	}
+}
+
+// Name возвращает имя фильтра
+func (f *LuckyPacketFilter) Name() string {
+	return "lucky"
+}
+
+// Add добавляет измерение и усредняет пакеты с наименьшей задержкой
+func (f *LuckyPacketFilter) Add(sample FilterSample) FilterOutput {
+	if n := len(f.samples); n > 0 && !sample.Timestamp.After(f.samples[n-1].Timestamp) {
+		out := f.last
+		out.Fresh = false
+		return out
+	}
+
+	f.samples = append(f.samples, sample)
+	if len(f.samples) > f.window {
+		f.samples = f.samples[1:]
+	}
+
+	sorted := append([]FilterSample(nil), f.samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Delay < sorted[j].Delay
+	})
+
+	count := int(math.Ceil(f.percentile * float64(len(sorted))))
+	if count < 1 {
+		count = 1
+	}
+	lucky := sorted[:count]
+
+	// Среднее смещение относится к среднему времени удачных измерений, а не
+	// к последнему из них: иначе дисциплина недооценивает возраст измерения
+	var sumOffset, sumDelay, sumAge float64
+	for _, s := range lucky {
+		sumOffset += float64(s.Offset)
+		sumDelay += float64(s.Delay)
+		sumAge += float64(sample.Timestamp.Sub(s.Timestamp))
+	}
+	meanOffset := sumOffset / float64(count)
+
+	var variance, spread float64
+	for _, s := range lucky {
+		diff := float64(s.Offset) - meanOffset
+		variance += diff * diff
+		spread = math.Max(spread, math.Abs(diff))
+	}
+
+	jitter := 0.0
+	if count > 1 {
+		jitter = math.Sqrt(variance / float64(count-1))
+	}
+
+	out := FilterOutput{
+		Offset:     time.Duration(meanOffset),
+		Delay:      time.Duration(sumDelay / float64(count)),
+		Dispersion: time.Duration(spread) + sample.Precision,
+		Jitter:     time.Duration(jitter),
+		Timestamp:  sample.Timestamp.Add(-time.Duration(sumAge / float64(count))),
+		Fresh:      true,
+	}
+
+	f.last = out
+	return out
+}
+
+// Reset очищает окно фильтра
+func (f *LuckyPacketFilter) Reset() {
+	f.samples = nil
+	f.last = FilterOutput{}
+}
+
+// PassthroughFilter передает измерения без фильтрации, оценивая только джиттер
+type PassthroughFilter struct {
+	jitter float64 // ns
+	last   FilterOutput
+}
+
+// NewPassthroughFilter создает фильтр без фильтрации
+func NewPassthroughFilter() *PassthroughFilter {
+	return &PassthroughFilter{}
+}
+
+// Name возвращает имя фильтра
+func (f *PassthroughFilter) Name() string {
+	return "none"
+}
+
+// Add возвращает измерение как есть
+func (f *PassthroughFilter) Add(sample FilterSample) FilterOutput {
+	if !f.last.Timestamp.IsZero() {
+		if !sample.Timestamp.After(f.last.Timestamp) {
+			out := f.last
+			out.Fresh = false
+			return out
+		}
+
+		// Экспоненциальное среднее квадрата разности соседних смещений (AVG из RFC 5905)
+		diff := float64(sample.Offset - f.last.Offset)
+		f.jitter = math.Sqrt(f.jitter*f.jitter + 0.25*(diff*diff-f.jitter*f.jitter))
+	}
+
+	out := FilterOutput{
+		Offset:     sample.Offset,
+		Delay:      sample.Delay,
+		Dispersion: sample.Precision,
+		Jitter:     time.Duration(f.jitter),
+		Timestamp:  sample.Timestamp,
+		Fresh:      true,
+	}
+
+	f.last = out
+	return out
+}
+
+// Reset сбрасывает оценку джиттера
+func (f *PassthroughFilter) Reset() {
+	f.jitter = 0
+	f.last = FilterOutput{}
+}
+
+// precisionToDuration переводит точность источника (log2 секунд) в длительность
+func precisionToDuration(precision int) time.Duration {
+	if precision >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ldexp(float64(time.Second), precision))
+}
@@ -0,0 +1,181 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// filterSamples строит измерения с шагом в секунду от simulationEpoch
+func filterSamples(offsets, delays []time.Duration) []FilterSample {
+	samples := make([]FilterSample, len(offsets))
+	for i := range offsets {
+		samples[i] = FilterSample{
+			Offset:    offsets[i],
+			Delay:     delays[i],
+			Timestamp: simulationEpoch.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return samples
+}
+
+func TestNewSampleFilter(t *testing.T) {
+	tests := []struct {
+		cfg     config.TimeSourceConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: config.TimeSourceConfig{Type: "ntp"}, want: "ntp"},
+		{cfg: config.TimeSourceConfig{Type: "ptp"}, want: "lucky"},
+		{cfg: config.TimeSourceConfig{Type: "pps"}, want: "none"},
+		{cfg: config.TimeSourceConfig{Type: "ptp", Filter: "NTP"}, want: "ntp"},
+		{cfg: config.TimeSourceConfig{Type: "ntp", Filter: "median"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		f, err := NewSampleFilter(tt.cfg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewSampleFilter(%+v) = %s, want error", tt.cfg, f.Name())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewSampleFilter(%+v): %v", tt.cfg, err)
+			continue
+		}
+		if f.Name() != tt.want {
+			t.Errorf("NewSampleFilter(%+v) = %s, want %s", tt.cfg, f.Name(), tt.want)
+		}
+	}
+}
+
+func TestNTPFilterMinimumDelay(t *testing.T) {
+	ms := time.Millisecond
+	// Минимальная задержка у первого измерения, затем у пятого
+	samples := filterSamples(
+		[]time.Duration{1 * ms, 2 * ms, 3 * ms, 4 * ms, 5 * ms, 6 * ms, 7 * ms, 8 * ms, 9 * ms, 10 * ms},
+		[]time.Duration{1 * ms, 9 * ms, 8 * ms, 7 * ms, 2 * ms, 6 * ms, 5 * ms, 4 * ms, 3 * ms, 9 * ms},
+	)
+
+	f := NewNTPFilter(0)
+	var outputs []FilterOutput
+	for _, s := range samples {
+		outputs = append(outputs, f.Add(s))
+	}
+
+	// Пока первое измерение в регистре из 8 ступеней, выбирается оно
+	for i := 0; i < 8; i++ {
+		if outputs[i].Offset != 1*ms || outputs[i].Delay != 1*ms {
+			t.Errorf("sample %d: offset %v delay %v, want first sample", i, outputs[i].Offset, outputs[i].Delay)
+		}
+		if outputs[i].Fresh != (i == 0) {
+			t.Errorf("sample %d: fresh = %v, want %v", i, outputs[i].Fresh, i == 0)
+		}
+	}
+
+	// Девятое измерение вытесняет первое, и лучшим становится пятое
+	for i := 8; i < 10; i++ {
+		if outputs[i].Offset != 5*ms || outputs[i].Delay != 2*ms {
+			t.Errorf("sample %d: offset %v delay %v, want fifth sample", i, outputs[i].Offset, outputs[i].Delay)
+		}
+		if !outputs[i].Timestamp.Equal(samples[4].Timestamp) {
+			t.Errorf("sample %d: timestamp %v, want %v", i, outputs[i].Timestamp, samples[4].Timestamp)
+		}
+	}
+	if !outputs[8].Fresh || outputs[9].Fresh {
+		t.Errorf("fresh = %v, %v, want true, false", outputs[8].Fresh, outputs[9].Fresh)
+	}
+}
+
+func TestNTPFilterPopcornSpike(t *testing.T) {
+	ms := time.Millisecond
+	// Выброс на 50 мс пришел с большой задержкой очереди
+	samples := filterSamples(
+		[]time.Duration{ms, ms + 10*time.Microsecond, 50 * ms, ms - 10*time.Microsecond},
+		[]time.Duration{2 * ms, 3 * ms, 40 * ms, 2500 * time.Microsecond},
+	)
+
+	f := NewNTPFilter(0)
+	for i, s := range samples {
+		out := f.Add(s)
+		if out.Offset != ms {
+			t.Errorf("sample %d: offset %v, want %v", i, out.Offset, ms)
+		}
+	}
+
+	// Выброс учитывается в джиттере, но не в смещении
+	if out := f.Add(FilterSample{Offset: ms, Delay: 3 * ms, Timestamp: samples[3].Timestamp}); out.Jitter < 20*ms {
+		t.Errorf("jitter = %v, want spike in jitter", out.Jitter)
+	}
+}
+
+func TestNTPFilterBeforeWindowFills(t *testing.T) {
+	f := NewNTPFilter(8)
+
+	first := FilterSample{
+		Offset:    3 * time.Millisecond,
+		Delay:     5 * time.Millisecond,
+		Precision: time.Microsecond,
+		Timestamp: simulationEpoch,
+	}
+	out := f.Add(first)
+	if out.Offset != first.Offset || out.Delay != first.Delay || !out.Fresh {
+		t.Fatalf("first sample: %+v, want sample passed through", out)
+	}
+	if out.Jitter != first.Precision {
+		t.Errorf("first sample jitter = %v, want precision %v", out.Jitter, first.Precision)
+	}
+
+	// Повтор того же измерения не передается дисциплине повторно
+	if out := f.Add(first); out.Fresh || out.Offset != first.Offset {
+		t.Errorf("repeated sample: %+v, want stale copy of first", out)
+	}
+
+	// Второе измерение с меньшей задержкой выбирается сразу
+	second := FilterSample{Offset: time.Millisecond, Delay: time.Millisecond, Timestamp: simulationEpoch.Add(time.Second)}
+	if out := f.Add(second); out.Offset != second.Offset || !out.Fresh {
+		t.Errorf("second sample: %+v, want second sample", out)
+	}
+
+	// После Reset регистр пуст, и старое время снова принимается
+	f.Reset()
+	if out := f.Add(first); out.Offset != first.Offset || !out.Fresh {
+		t.Errorf("after reset: %+v, want first sample", out)
+	}
+}
+
+func TestLuckyPacketFilter(t *testing.T) {
+	us := time.Microsecond
+	// Удачные пакеты (задержка 10 мкс) чередуются с пакетами из очереди
+	offsets := []time.Duration{100 * us, 900 * us, 110 * us, 800 * us, 90 * us, 700 * us, 100 * us, 600 * us}
+	delays := []time.Duration{10 * us, 500 * us, 10 * us, 400 * us, 10 * us, 300 * us, 10 * us, 200 * us}
+	samples := filterSamples(offsets, delays)
+
+	f := NewLuckyPacketFilter(8, 0.5)
+	var out FilterOutput
+	for _, s := range samples {
+		out = f.Add(s)
+	}
+
+	if out.Offset != 100*us || out.Delay != 10*us {
+		t.Errorf("offset %v delay %v, want 100µs and 10µs", out.Offset, out.Delay)
+	}
+	// Время результата среднее по удачным измерениям 0, 2, 4 и 6 с
+	if want := simulationEpoch.Add(3 * time.Second); !out.Timestamp.Equal(want) {
+		t.Errorf("timestamp %v, want %v", out.Timestamp, want)
+	}
+	if out.Jitter <= 0 || out.Jitter > 10*us {
+		t.Errorf("jitter = %v, want spread of lucky offsets", out.Jitter)
+	}
+
+	// До заполнения окна перцентиль берется от имеющихся измерений
+	f.Reset()
+	if out := f.Add(samples[1]); out.Offset != offsets[1] || !out.Fresh {
+		t.Errorf("first sample: %+v, want sample passed through", out)
+	}
+	if out := f.Add(samples[1]); out.Fresh {
+		t.Errorf("repeated sample: fresh, want stale")
+	}
+}
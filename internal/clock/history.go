@@ -0,0 +1,163 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryDepth = 4096 // Больше часа измерений при опросе раз в секунду
+)
+
+// SourceHistoryPoint измерение источника и результат его фильтра. После
+// прореживания значения усреднены по интервалу, OffsetMin/OffsetMax дают
+// огибающую смещения, а Samples - число исходных измерений.
+type SourceHistoryPoint struct {
+	Timestamp        time.Time     `json:"timestamp"`
+	Offset           time.Duration `json:"offset"`
+	OffsetMin        time.Duration `json:"offset_min"`
+	OffsetMax        time.Duration `json:"offset_max"`
+	Delay            time.Duration `json:"delay"`
+	Quality          int           `json:"quality"`
+	FilterOffset     time.Duration `json:"filter_offset"`
+	FilterDelay      time.Duration `json:"filter_delay"`
+	FilterJitter     time.Duration `json:"filter_jitter"`
+	FilterDispersion time.Duration `json:"filter_dispersion"`
+	Samples          int           `json:"samples"`
+}
+
+// SourceHistory кольцевой буфер последних измерений одного источника
+type SourceHistory struct {
+	mu sync.RWMutex
+
+	points []SourceHistoryPoint
+	start  int // Индекс самого старого измерения
+	count  int
+}
+
+// NewSourceHistory создает буфер на depth измерений
+func NewSourceHistory(depth int) *SourceHistory {
+	if depth <= 0 {
+		depth = defaultHistoryDepth
+	}
+	return &SourceHistory{points: make([]SourceHistoryPoint, depth)}
+}
+
+// Add добавляет измерение, вытесняя самое старое при заполнении буфера
+func (h *SourceHistory) Add(point SourceHistoryPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	point.OffsetMin = point.Offset
+	point.OffsetMax = point.Offset
+	point.Samples = 1
+
+	depth := len(h.points)
+	if h.count < depth {
+		h.points[(h.start+h.count)%depth] = point
+		h.count++
+		return
+	}
+	h.points[h.start] = point
+	h.start = (h.start + 1) % depth
+}
+
+// Len возвращает число сохраненных измерений
+func (h *SourceHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count
+}
+
+// Query возвращает измерения в интервале [from, to] в порядке времени.
+// Нулевые границы не ограничивают интервал. Если step больше нуля,
+// измерения усредняются по интервалам длиной step, отсчитанным от from
+// (или от первого измерения).
+func (h *SourceHistory) Query(from, to time.Time, step time.Duration) []SourceHistoryPoint {
+	h.mu.RLock()
+	points := make([]SourceHistoryPoint, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		point := h.points[(h.start+i)%len(h.points)]
+		if (!from.IsZero() && point.Timestamp.Before(from)) || (!to.IsZero() && point.Timestamp.After(to)) {
+			continue
+		}
+		points = append(points, point)
+	}
+	h.mu.RUnlock()
+
+	if step <= 0 || len(points) == 0 {
+		return points
+	}
+
+	origin := from
+	if origin.IsZero() {
+		origin = points[0].Timestamp
+	}
+	return downsample(points, origin, step)
+}
+
+// downsample усредняет измерения по интервалам длиной step от origin
+func downsample(points []SourceHistoryPoint, origin time.Time, step time.Duration) []SourceHistoryPoint {
+	var result []SourceHistoryPoint
+	var bucket []SourceHistoryPoint
+	var bucketStart time.Time
+
+	flush := func() {
+		if len(bucket) > 0 {
+			result = append(result, mergePoints(bucketStart, bucket))
+		}
+		bucket = bucket[:0]
+	}
+
+	for _, point := range points {
+		start := origin.Add(point.Timestamp.Sub(origin) / step * step)
+		if len(bucket) > 0 && !start.Equal(bucketStart) {
+			flush()
+		}
+		bucketStart = start
+		bucket = append(bucket, point)
+	}
+	flush()
+
+	return result
+}
+
+// mergePoints усредняет измерения одного интервала
+func mergePoints(start time.Time, points []SourceHistoryPoint) SourceHistoryPoint {
+	merged := SourceHistoryPoint{
+		Timestamp: start,
+		OffsetMin: points[0].OffsetMin,
+		OffsetMax: points[0].OffsetMax,
+	}
+
+	var offset, delay, filterOffset, filterDelay, filterJitter, filterDispersion time.Duration
+	var quality int
+	for _, point := range points {
+		offset += point.Offset
+		delay += point.Delay
+		quality += point.Quality
+		filterOffset += point.FilterOffset
+		filterDelay += point.FilterDelay
+		filterJitter += point.FilterJitter
+		filterDispersion += point.FilterDispersion
+		merged.Samples += point.Samples
+
+		if point.OffsetMin < merged.OffsetMin {
+			merged.OffsetMin = point.OffsetMin
+		}
+		if point.OffsetMax > merged.OffsetMax {
+			merged.OffsetMax = point.OffsetMax
+		}
+	}
+
+	n := time.Duration(len(points))
+	merged.Offset = offset / n
+	merged.Delay = delay / n
+	merged.Quality = quality / len(points)
+	merged.FilterOffset = filterOffset / n
+	merged.FilterDelay = filterDelay / n
+	merged.FilterJitter = filterJitter / n
+	merged.FilterDispersion = filterDispersion / n
+
+	return merged
+}
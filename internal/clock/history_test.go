@@ -0,0 +1,103 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestSourceHistoryRing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := NewSourceHistory(10)
+	for i := 0; i < 25; i++ {
+		history.Add(SourceHistoryPoint{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Offset:    time.Duration(i) * time.Microsecond,
+		})
+	}
+
+	if history.Len() != 10 {
+		t.Fatalf("len = %d, want 10", history.Len())
+	}
+
+	points := history.Query(time.Time{}, time.Time{}, 0)
+	for i, point := range points {
+		if want := time.Duration(15+i) * time.Microsecond; point.Offset != want {
+			t.Errorf("point %d offset = %v, want %v", i, point.Offset, want)
+		}
+	}
+
+	points = history.Query(start.Add(17*time.Second), start.Add(20*time.Second), 0)
+	if len(points) != 4 || points[0].Offset != 17*time.Microsecond {
+		t.Errorf("range query = %+v, want 4 points from 17µs", points)
+	}
+}
+
+func TestSourceHistoryDownsample(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := NewSourceHistory(0)
+	for i := 0; i < 60; i++ {
+		history.Add(SourceHistoryPoint{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Offset:    time.Duration(i%10) * time.Microsecond,
+			Delay:     time.Millisecond,
+			Quality:   100,
+		})
+	}
+
+	points := history.Query(start, time.Time{}, 10*time.Second)
+	if len(points) != 6 {
+		t.Fatalf("buckets = %d, want 6", len(points))
+	}
+	for i, point := range points {
+		if want := start.Add(time.Duration(i) * 10 * time.Second); !point.Timestamp.Equal(want) {
+			t.Errorf("bucket %d at %v, want %v", i, point.Timestamp, want)
+		}
+		if point.Samples != 10 || point.Offset != 4500*time.Nanosecond {
+			t.Errorf("bucket %d = %d samples, offset %v; want 10, 4.5µs", i, point.Samples, point.Offset)
+		}
+		if point.OffsetMin != 0 || point.OffsetMax != 9*time.Microsecond {
+			t.Errorf("bucket %d envelope = [%v, %v], want [0, 9µs]", i, point.OffsetMin, point.OffsetMax)
+		}
+		if point.Delay != time.Millisecond || point.Quality != 100 {
+			t.Errorf("bucket %d delay/quality = %v/%d", i, point.Delay, point.Quality)
+		}
+	}
+}
+
+func TestSimulationSourceHistory(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{HistoryDepth: 600}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, Seed: 1}
+	sources := []SimSourceConfig{
+		{Name: "ntp", Noise: 20 * time.Microsecond, Delay: time.Millisecond, Seed: 1},
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+	sim.Run(20 * time.Minute)
+
+	points, ok := sim.Manager().GetSourceHistory("ntp", time.Time{}, time.Time{}, 0)
+	if !ok {
+		t.Fatal("history for ntp not found")
+	}
+	if len(points) != 600 {
+		t.Fatalf("history length = %d, want 600", len(points))
+	}
+	for i := 1; i < len(points); i++ {
+		if !points[i].Timestamp.After(points[i-1].Timestamp) {
+			t.Fatalf("point %d at %v not after %v", i, points[i].Timestamp, points[i-1].Timestamp)
+		}
+	}
+	if last := points[len(points)-1]; last.FilterDelay == 0 || last.Delay == 0 {
+		t.Errorf("last point has no delay: %+v", last)
+	}
+
+	minutes, _ := sim.Manager().GetSourceHistory("ntp", time.Time{}, time.Time{}, time.Minute)
+	if len(minutes) < 10 || len(minutes) > 11 {
+		t.Errorf("minute buckets = %d, want 10-11", len(minutes))
+	}
+
+	if _, ok := sim.Manager().GetSourceHistory("missing", time.Time{}, time.Time{}, 0); ok {
+		t.Error("history for unknown source found")
+	}
+}
@@ -0,0 +1,299 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultHoldoverWindow      = 256
+	defaultHoldoverMinSamples  = 16
+	defaultHoldoverMaxDuration = 24 * time.Hour
+	defaultHoldoverMaxError    = time.Millisecond
+	defaultLockThreshold       = time.Millisecond
+)
+
+// holdoverSample частота, выданная дисциплиной в захваченном состоянии
+type holdoverSample struct {
+	timestamp time.Time
+	frequency float64 // ppb
+}
+
+// HoldoverEstimator обучает модель частоты и дрейфа генератора, пока часы
+// захвачены, и прогнозирует частоту и накопленную ошибку после потери
+// всех источников.
+type HoldoverEstimator struct {
+	mu sync.RWMutex
+
+	window      int
+	minSamples  int
+	maxDuration time.Duration
+	maxError    time.Duration
+
+	samples []holdoverSample
+
+	// Модель: frequency + drift*(t - lastLearned)
+	frequency    float64 // ppb
+	drift        float64 // ppb/s
+	frequencyErr float64 // ppb, стандартная ошибка частоты
+	driftErr     float64 // ppb/s, стандартная ошибка дрейфа
+	lastLearned  time.Time
+	lastOffset   time.Duration
+
+	active  bool
+	start   time.Time
+	expired bool      // Бюджет holdover исчерпан, часы идут свободно
+	end     time.Time // Момент исчерпания бюджета
+}
+
+// HoldoverStatus состояние holdover для статистики и API
+type HoldoverStatus struct {
+	Ready          bool          `json:"ready"`
+	Active         bool          `json:"active"`
+	Expired        bool          `json:"expired"`
+	Samples        int           `json:"samples"`
+	Start          time.Time     `json:"start"`
+	Duration       time.Duration `json:"duration"`
+	Frequency      float64       `json:"frequency"`
+	Drift          float64       `json:"drift"`
+	EstimatedError time.Duration `json:"estimated_error"`
+	MaxDuration    time.Duration `json:"max_duration"`
+	MaxError       time.Duration `json:"max_error"`
+}
+
+// NewHoldoverEstimator создает оценщик holdover
+func NewHoldoverEstimator(cfg config.HoldoverConfig) *HoldoverEstimator {
+	h := &HoldoverEstimator{
+		window:      defaultHoldoverWindow,
+		minSamples:  defaultHoldoverMinSamples,
+		maxDuration: defaultHoldoverMaxDuration,
+		maxError:    defaultHoldoverMaxError,
+	}
+
+	if cfg.LearningWindow > 0 {
+		h.window = cfg.LearningWindow
+	}
+	if h.minSamples > h.window {
+		h.minSamples = h.window
+	}
+	if cfg.MaxDuration > 0 {
+		h.maxDuration = cfg.MaxDuration
+	}
+	if cfg.MaxError > 0 {
+		h.maxError = cfg.MaxError
+	}
+
+	return h
+}
+
+// Learn добавляет измерение частоты, полученное в захваченном состоянии
+func (h *HoldoverEstimator) Learn(timestamp time.Time, frequency float64, offset time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, holdoverSample{timestamp: timestamp, frequency: frequency})
+	if len(h.samples) > h.window {
+		h.samples = h.samples[1:]
+	}
+	h.lastLearned = timestamp
+	h.lastOffset = offset
+	h.expired = false
+
+	h.fit()
+}
+
+// fit оценивает частоту и дрейф линейной регрессией по окну измерений
+func (h *HoldoverEstimator) fit() {
+	n := len(h.samples)
+	if n == 0 {
+		return
+	}
+
+	last := h.samples[n-1]
+	if n < 3 {
+		h.frequency = last.frequency
+		h.drift = 0
+		return
+	}
+
+	// Время отсчитываем от последнего измерения, чтобы intercept был частотой "сейчас"
+	var sumT, sumF float64
+	for _, s := range h.samples {
+		sumT += s.timestamp.Sub(last.timestamp).Seconds()
+		sumF += s.frequency
+	}
+	meanT := sumT / float64(n)
+	meanF := sumF / float64(n)
+
+	var sxx, sxy float64
+	for _, s := range h.samples {
+		dt := s.timestamp.Sub(last.timestamp).Seconds() - meanT
+		sxx += dt * dt
+		sxy += dt * (s.frequency - meanF)
+	}
+
+	if sxx == 0 {
+		h.frequency = meanF
+		h.drift = 0
+		return
+	}
+
+	slope := sxy / sxx
+	intercept := meanF - slope*meanT
+
+	var residuals float64
+	for _, s := range h.samples {
+		t := s.timestamp.Sub(last.timestamp).Seconds()
+		r := s.frequency - (intercept + slope*t)
+		residuals += r * r
+	}
+	variance := residuals / float64(n-2)
+
+	h.driftErr = math.Sqrt(variance / sxx)
+	h.frequencyErr = math.Sqrt(variance * (1/float64(n) + meanT*meanT/sxx))
+
+	// Незначимый дрейф не экстраполируем, иначе шум серво уводит частоту
+	if math.Abs(slope) < 2*h.driftErr {
+		h.frequency = meanF
+		h.drift = 0
+		h.frequencyErr = math.Sqrt(variance / float64(n))
+		return
+	}
+
+	h.frequency = intercept
+	h.drift = slope
+}
+
+// Ready возвращает true, если модель обучена достаточно для holdover
+func (h *HoldoverEstimator) Ready() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.samples) >= h.minSamples
+}
+
+// Active возвращает true, если часы находятся в holdover
+func (h *HoldoverEstimator) Active() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.active
+}
+
+// Drift возвращает оценку дрейфа частоты в ppb/s
+func (h *HoldoverEstimator) Drift() float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.drift
+}
+
+// Model возвращает обученную частоту и ее стандартную ошибку в ppb
+func (h *HoldoverEstimator) Model() (float64, float64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.frequency, h.frequencyErr
+}
+
+// Enter переводит оценщик в holdover
+func (h *HoldoverEstimator) Enter(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.active = true
+	h.expired = false
+	h.start = now
+	h.end = time.Time{}
+}
+
+// Expire завершает holdover с исчерпанным бюджетом: длительность и оценка
+// ошибки фиксируются на момент исчерпания и не растут, пока часы идут
+// свободно
+func (h *HoldoverEstimator) Expire(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.active {
+		return
+	}
+
+	h.active = false
+	h.expired = true
+	h.end = now
+}
+
+// Exit завершает holdover и возвращает его длительность и оценку ошибки
+// на момент выхода
+func (h *HoldoverEstimator) Exit(now time.Time) (time.Duration, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.active {
+		return 0, 0
+	}
+
+	duration := now.Sub(h.start)
+	estimated := h.estimatedError(now)
+	h.active = false
+	h.start = time.Time{}
+
+	return duration, estimated
+}
+
+// Frequency возвращает прогноз частоты в ppb на момент now
+func (h *HoldoverEstimator) Frequency(now time.Time) float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	elapsed := now.Sub(h.lastLearned).Seconds()
+	return clampFrequency(h.frequency+h.drift*elapsed, maxFrequencyPPB)
+}
+
+// estimatedError оценивает накопленную с момента потери захвата ошибку фазы:
+// начальное смещение плюс интеграл ошибки частоты и дрейфа
+func (h *HoldoverEstimator) estimatedError(now time.Time) time.Duration {
+	if h.lastLearned.IsZero() {
+		return 0
+	}
+
+	elapsed := now.Sub(h.lastLearned).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	// ppb * s = ns
+	errNs := math.Abs(float64(h.lastOffset)) +
+		h.frequencyErr*elapsed +
+		0.5*h.driftErr*elapsed*elapsed
+
+	return time.Duration(errNs)
+}
+
+// Status возвращает состояние holdover на момент now
+func (h *HoldoverEstimator) Status(now time.Time) HoldoverStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	status := HoldoverStatus{
+		Ready:       len(h.samples) >= h.minSamples,
+		Active:      h.active,
+		Samples:     len(h.samples),
+		Frequency:   h.frequency,
+		Drift:       h.drift,
+		MaxDuration: h.maxDuration,
+		MaxError:    h.maxError,
+	}
+
+	if h.active || h.expired {
+		end := now
+		if h.expired {
+			end = h.end
+		}
+		status.Start = h.start
+		status.Duration = end.Sub(h.start)
+		status.EstimatedError = h.estimatedError(end)
+		status.Expired = h.expired || status.Duration > h.maxDuration || status.EstimatedError > h.maxError
+	}
+
+	return status
+}
@@ -0,0 +1,161 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// learnHoldover обучает оценщик частотами freq(i) раз в секунду от
+// simulationEpoch и возвращает время последнего измерения
+func learnHoldover(h *HoldoverEstimator, n int, offset time.Duration, freq func(i int) float64) time.Time {
+	var last time.Time
+	for i := 0; i < n; i++ {
+		last = simulationEpoch.Add(time.Duration(i) * time.Second)
+		h.Learn(last, freq(i), offset)
+	}
+	return last
+}
+
+// alternating частота с шумом ±noise ppb без дрейфа
+func alternating(base, noise float64) func(i int) float64 {
+	return func(i int) float64 {
+		if i%2 == 0 {
+			return base + noise
+		}
+		return base - noise
+	}
+}
+
+func TestHoldoverEstimatorFit(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples int
+		freq    func(i int) float64
+		want    float64 // Частота на момент последнего измерения, ppb
+		drift   float64 // ppb/s
+	}{
+		{name: "too few samples", samples: 2, freq: func(i int) float64 { return 100 * float64(i+1) }, want: 200},
+		{name: "linear drift", samples: 100, freq: func(i int) float64 { return -20000 + 0.5*float64(i) }, want: -20000 + 0.5*99, drift: 0.5},
+		// Незначимый наклон шума не экстраполируется
+		{name: "noise without drift", samples: 100, freq: alternating(500, 1), want: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHoldoverEstimator(config.HoldoverConfig{})
+			last := learnHoldover(h, tt.samples, 0, tt.freq)
+
+			freq, _ := h.Model()
+			if math.Abs(freq-tt.want) > 1e-6 || math.Abs(h.Drift()-tt.drift) > 1e-9 {
+				t.Errorf("model = %.6f ppb, %.9f ppb/s, want %.6f ppb, %.9f ppb/s", freq, h.Drift(), tt.want, tt.drift)
+			}
+			// Прогноз продолжает дрейф от последнего измерения
+			if got, want := h.Frequency(last.Add(10*time.Second)), tt.want+10*tt.drift; math.Abs(got-want) > 1e-6 {
+				t.Errorf("Frequency(+10s) = %.6f, want %.6f", got, want)
+			}
+		})
+	}
+
+	// Окно обучения ограничивает число измерений и минимум для готовности
+	h := NewHoldoverEstimator(config.HoldoverConfig{LearningWindow: 10})
+	learnHoldover(h, 9, 0, alternating(0, 1))
+	if h.Ready() {
+		t.Error("estimator ready before the learning window is filled")
+	}
+	learnHoldover(h, 100, 0, alternating(0, 1))
+	if status := h.Status(simulationEpoch); !status.Ready || status.Samples != 10 {
+		t.Errorf("status = %+v, want ready with 10 samples", status)
+	}
+}
+
+func TestHoldoverEstimatedError(t *testing.T) {
+	h := NewHoldoverEstimator(config.HoldoverConfig{MaxDuration: 1000 * time.Hour, MaxError: time.Second})
+	last := learnHoldover(h, 100, -50*time.Microsecond, alternating(-15000, 10))
+	if h.frequencyErr <= 0 {
+		t.Fatalf("frequency error = %v, want > 0 with noisy samples", h.frequencyErr)
+	}
+	h.Enter(last)
+
+	// Начальное смещение плюс интеграл ошибки частоты и дрейфа
+	var previous time.Duration
+	for _, elapsed := range []time.Duration{0, time.Minute, time.Hour, 24 * time.Hour} {
+		status := h.Status(last.Add(elapsed))
+		s := elapsed.Seconds()
+		want := time.Duration(50000 + h.frequencyErr*s + 0.5*h.driftErr*s*s)
+		if status.EstimatedError != want {
+			t.Errorf("estimated error after %v = %v, want %v", elapsed, status.EstimatedError, want)
+		}
+		if elapsed > 0 && status.EstimatedError <= previous {
+			t.Errorf("estimated error after %v = %v, not growing from %v", elapsed, status.EstimatedError, previous)
+		}
+		previous = status.EstimatedError
+	}
+
+	duration, estimated := h.Exit(last.Add(time.Hour))
+	if duration != time.Hour || estimated != h.estimatedError(last.Add(time.Hour)) {
+		t.Errorf("Exit() = %v, %v", duration, estimated)
+	}
+	if status := h.Status(last.Add(2 * time.Hour)); status.Active || status.EstimatedError != 0 {
+		t.Errorf("status after exit = %+v", status)
+	}
+}
+
+func TestHoldoverExpiry(t *testing.T) {
+	// Время, за которое ошибки частоты и дрейфа добавят к смещению 100 мкс:
+	// frequencyErr*t + driftErr*t^2/2 = 100000 нс
+	learned := NewHoldoverEstimator(config.HoldoverConfig{})
+	learnHoldover(learned, 100, 0, alternating(0, 10))
+	fe, de := learned.frequencyErr, learned.driftErr
+	errorTime := time.Duration((math.Sqrt(fe*fe+2*de*100000) - fe) / de * float64(time.Second))
+
+	tests := []struct {
+		name    string
+		cfg     config.HoldoverConfig
+		offset  time.Duration
+		before  time.Duration // Бюджет еще не исчерпан
+		expires time.Duration // Бюджет исчерпан
+	}{
+		{name: "max duration", cfg: config.HoldoverConfig{MaxDuration: time.Hour, MaxError: time.Second}, before: 59 * time.Minute, expires: 61 * time.Minute},
+		{name: "max error", cfg: config.HoldoverConfig{MaxDuration: 1000 * time.Hour, MaxError: time.Millisecond}, offset: 900 * time.Microsecond, before: errorTime / 2, expires: 2 * errorTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHoldoverEstimator(tt.cfg)
+			last := learnHoldover(h, 100, tt.offset, alternating(0, 10))
+			h.Enter(last)
+
+			if status := h.Status(last.Add(tt.before)); status.Expired || !status.Active {
+				t.Fatalf("status after %v = %+v, want active", tt.before, status)
+			}
+			expiry := last.Add(tt.expires)
+			if status := h.Status(expiry); !status.Expired {
+				t.Fatalf("status after %v = %+v, want expired", tt.expires, status)
+			}
+
+			// После исчерпания holdover не активен, а длительность и
+			// оценка ошибки не растут, пока часы идут свободно
+			h.Expire(expiry)
+			status := h.Status(expiry.Add(24 * time.Hour))
+			if h.Active() || status.Active || !status.Expired {
+				t.Errorf("status = %+v, want expired and inactive", status)
+			}
+			if status.Duration != tt.expires || status.EstimatedError != h.estimatedError(expiry) {
+				t.Errorf("duration = %v, error = %v, want frozen at %v, %v",
+					status.Duration, status.EstimatedError, tt.expires, h.estimatedError(expiry))
+			}
+			if duration, estimated := h.Exit(expiry.Add(24 * time.Hour)); duration != 0 || estimated != 0 {
+				t.Errorf("Exit() after expiry = %v, %v, want no holdover to leave", duration, estimated)
+			}
+
+			// Новый захват сбрасывает признак исчерпания
+			h.Learn(expiry.Add(25*time.Hour), 0, 0)
+			if status := h.Status(expiry.Add(25 * time.Hour)); status.Expired || status.Duration != 0 {
+				t.Errorf("status after relock = %+v", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	// Интервал опроса, начиная с которого работает только FLL (как
+	// allan intercept в ntpd)
+	defaultHybridFLLInterval = 1024 * time.Second
+
+	// Постоянная времени контура равна интервалу опроса, умноженному на
+	// 2^shift; shift растет, пока смещения в пределах джиттера
+	hybridMinShift = 2
+	hybridMaxShift = 8
+
+	hybridPhaseGate  = 4.0  // Смещение в пределах gate·jitter считается шумом
+	hybridShiftLimit = 8    // Счетчик, после которого меняется shift
+	hybridFLLGain    = 0.25 // Доля измеренной ошибки частоты за одно обновление
+)
+
+// LoopMode режим контура гибридной дисциплины
+type LoopMode string
+
+const (
+	LoopModePLL LoopMode = "pll" // Фаза и частота
+	LoopModeFLL LoopMode = "fll" // Только частота
+)
+
+// LoopStatus состояние контура дисциплины
+type LoopStatus struct {
+	Mode         LoopMode      `json:"mode"`
+	TimeConstant time.Duration `json:"time_constant"`
+	Interval     time.Duration `json:"interval"`
+	Frequency    float64       `json:"frequency"` // Оценка частоты генератора, ppb
+}
+
+// LoopStatusProvider дисциплина, сообщающая состояние контура
+type LoopStatusProvider interface {
+	LoopStatus() LoopStatus
+}
+
+// HybridDiscipline гибридная PLL/FLL дисциплина в духе ntpd. Постоянная
+// времени контура следует за интервалом между измерениями источника и
+// растет, пока смещения остаются в пределах джиттера, поэтому источник с
+// опросом раз в 64 с или шумный канал через WAN ведут часы медленнее
+// локального PHC. Выдаваемая частота - оценка частоты генератора плюс
+// поправка фазы θ/τ. При коротком опросе оценку частоты ведет PLL второго
+// порядка (критическое затухание, интегратор θ·μ/(4τ²)). С интервала
+// fll_interval фаза источника слишком шумная для интегратора, и контур
+// переходит в FLL: оценка частоты следует за скоростью изменения смещения.
+type HybridDiscipline struct {
+	mu sync.RWMutex
+
+	fllInterval time.Duration
+	outputLimit float64
+
+	freq         float64 // Оценка частоты, ppb
+	shift        int
+	count        int
+	lastOffset   float64 // нс
+	lastMeasured time.Time
+	hasLast      bool
+	applied      appliedHistory
+	status       LoopStatus
+
+	logger *logrus.Logger
+}
+
+// NewHybridDiscipline создает гибридную PLL/FLL дисциплину
+func NewHybridDiscipline(cfg config.HybridConfig, outputLimit float64, logger *logrus.Logger) *HybridDiscipline {
+	hd := &HybridDiscipline{
+		fllInterval: defaultHybridFLLInterval,
+		outputLimit: outputLimit,
+		shift:       hybridMinShift,
+		status:      LoopStatus{Mode: LoopModePLL},
+		logger:      logger,
+	}
+	if cfg.FLLInterval > 0 {
+		hd.fllInterval = cfg.FLLInterval
+	}
+	return hd
+}
+
+// Name возвращает имя алгоритма
+func (hd *HybridDiscipline) Name() string {
+	return "hybrid"
+}
+
+// Sample обрабатывает измерение и возвращает поправку частоты в ppb
+func (hd *HybridDiscipline) Sample(input DisciplineInput) float64 {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+
+	offset := float64(input.Offset)
+	measured := input.Measured
+	if measured.IsZero() {
+		measured = input.Timestamp
+	}
+
+	if !hd.hasLast || input.Interval <= 0 {
+		// Первое измерение после запуска или step: интервал опроса еще
+		// неизвестен, поэтому фаза не подстраивается
+		hd.lastOffset = offset
+		hd.lastMeasured = measured
+		hd.hasLast = true
+		hd.status.Frequency = hd.freq
+		return hd.applied.add(input.Timestamp, hd.freq, hd.lastMeasured)
+	}
+
+	// Фильтр источника может выдать то же или более старое измерение,
+	// чем в прошлый раз: новой информации о частоте в нем нет
+	interval := measured.Sub(hd.lastMeasured)
+	if interval <= 0 {
+		return hd.applied.last(hd.freq)
+	}
+
+	// Фильтр выбирает измерение с минимальной задержкой, и оно может быть
+	// на несколько опросов старше текущего момента. Запаздывание фазы в
+	// контуре делает его неустойчивым, поэтому смещение переносится на
+	// текущий момент по разнице оценки частоты и выданной с тех пор частоты.
+	rawOffset := offset
+	offset = hd.applied.project(offset, measured, input.Timestamp, hd.freq)
+
+	mu := interval.Seconds()
+	hd.adaptShift(offset, float64(input.Jitter))
+	tc := hd.timeConstant(interval)
+
+	// Перцентильный фильтр усредняет измерения за несколько обновлений, и
+	// перенос на текущий момент точен только при постоянной частоте:
+	// контур быстрее минимальной постоянной для возраста измерения
+	// раскачивается
+	if age := input.Timestamp.Sub(measured).Seconds(); tc < age*(1<<hybridMinShift) {
+		tc = age * (1 << hybridMinShift)
+	}
+
+	// Интервал между измерениями немного плавает относительно интервала
+	// опроса, поэтому порог сравнивается с запасом
+	mode := LoopModePLL
+	if interval >= hd.fllInterval-hd.fllInterval/8 {
+		mode = LoopModeFLL
+	}
+	if mode != hd.status.Mode {
+		hd.logger.WithFields(logrus.Fields{
+			"mode":          mode,
+			"interval":      interval,
+			"time_constant": time.Duration(tc * float64(time.Second)),
+		}).Info("Clock discipline loop mode changed")
+	}
+
+	switch mode {
+	case LoopModePLL:
+		hd.freq += offset * mu / (4 * tc * tc)
+	case LoopModeFLL:
+		// Скорость изменения смещения - ошибка частоты, которая была
+		// выдана между измерениями; оценка частоты сглаживает ее
+		target := (rawOffset-hd.lastOffset)/mu + hd.applied.mean(hd.lastMeasured, measured, hd.freq)
+		hd.freq += hybridFLLGain * (target - hd.freq)
+	}
+	hd.freq = clampFrequency(hd.freq, hd.outputLimit)
+	hd.lastOffset = rawOffset
+	hd.lastMeasured = measured
+
+	hd.status.Mode = mode
+	hd.status.Interval = interval
+	hd.status.TimeConstant = time.Duration(tc * float64(time.Second))
+	hd.status.Frequency = hd.freq
+
+	return hd.applied.add(input.Timestamp, clampFrequency(hd.freq+offset/tc, hd.outputLimit), hd.lastMeasured)
+}
+
+// timeConstant возвращает постоянную времени контура в секундах
+func (hd *HybridDiscipline) timeConstant(interval time.Duration) float64 {
+	return interval.Seconds() * float64(int(1)<<hd.shift)
+}
+
+// adaptShift удлиняет контур, пока смещения в пределах джиттера, и
+// укорачивает, когда смещения выходят за него
+func (hd *HybridDiscipline) adaptShift(offset, jitter float64) {
+	if math.Abs(offset) <= hybridPhaseGate*jitter {
+		hd.count++
+		if hd.count >= hybridShiftLimit && hd.shift < hybridMaxShift {
+			hd.shift++
+			hd.count = 0
+		}
+		return
+	}
+
+	hd.count -= 2
+	if hd.count <= -hybridShiftLimit && hd.shift > hybridMinShift {
+		hd.shift--
+		hd.count = 0
+	}
+}
+
+// Reset сбрасывает фазу и постоянную времени, сохраняя оценку частоты
+func (hd *HybridDiscipline) Reset() {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+
+	hd.hasLast = false
+	hd.lastOffset = 0
+	hd.lastMeasured = time.Time{}
+	hd.applied.reset()
+	hd.shift = hybridMinShift
+	hd.count = 0
+}
+
+// SetFrequency задает оценку частоты
+func (hd *HybridDiscipline) SetFrequency(ppb float64) {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+
+	hd.freq = clampFrequency(ppb, hd.outputLimit)
+}
+
+// LoopStatus возвращает состояние контура
+func (hd *HybridDiscipline) LoopStatus() LoopStatus {
+	hd.mu.RLock()
+	defer hd.mu.RUnlock()
+
+	return hd.status
+}
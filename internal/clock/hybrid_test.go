@@ -0,0 +1,113 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestHybridDisciplineTimeConstant(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	hd := NewHybridDiscipline(config.HybridConfig{}, 500000, logger)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(i int, interval time.Duration, offset time.Duration) float64 {
+		now := start.Add(time.Duration(i) * interval)
+		return hd.Sample(DisciplineInput{
+			Offset:    offset,
+			Jitter:    time.Millisecond,
+			Interval:  interval,
+			Timestamp: now,
+			Measured:  now,
+		})
+	}
+
+	// Смещения в пределах джиттера удлиняют контур
+	for i := 0; i < 40; i++ {
+		sample(i, 64*time.Second, 100*time.Microsecond)
+	}
+	status := hd.LoopStatus()
+	if status.Mode != LoopModePLL {
+		t.Errorf("mode = %s, want pll", status.Mode)
+	}
+	if want := 64 * time.Second << (hybridMinShift + 4); status.TimeConstant != want {
+		t.Errorf("time constant = %v, want %v", status.TimeConstant, want)
+	}
+
+	// С интервала fll_interval контур работает как FLL и оценивает частоту
+	// по скорости изменения смещения. Генератор спешит на 10 ppm.
+	hd = NewHybridDiscipline(config.HybridConfig{}, 500000, logger)
+	var offset, output float64
+	for i := 0; i < 30; i++ {
+		output = sample(i, 1024*time.Second, time.Duration(offset))
+		offset -= (10000 + output) * 1024
+	}
+	status = hd.LoopStatus()
+	if status.Mode != LoopModeFLL {
+		t.Errorf("mode = %s, want fll", status.Mode)
+	}
+	if math.Abs(status.Frequency+10000) > 10 {
+		t.Errorf("frequency = %.0f, want -10000", status.Frequency)
+	}
+	if math.Abs(offset) > float64(time.Millisecond) {
+		t.Errorf("offset = %v, want phase removed through frequency", time.Duration(offset))
+	}
+}
+
+func TestSimulationHybridLongPoll(t *testing.T) {
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, RandomWalk: 0.01, Seed: 1}
+	sources := []SimSourceConfig{{
+		Name:         "ntp",
+		Noise:        time.Millisecond,
+		Delay:        20 * time.Millisecond,
+		DelayJitter:  2 * time.Millisecond,
+		PollInterval: 64 * time.Second,
+		Seed:         1,
+	}}
+
+	run := func(algorithm string) *SimulationResult {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: algorithm}}
+		return newTestSimulation(t, cfg, oscillator, sources).Run(24 * time.Hour)
+	}
+
+	// Гибридный контур удлиняет постоянную времени по интервалу опроса,
+	// коэффициенты PID заданы на одно обновление и тоже следуют за ним
+	hybrid := run("hybrid").RMSOffset(12 * time.Hour)
+	pid := run("pid").RMSOffset(12 * time.Hour)
+	if hybrid > 5*time.Millisecond || pid > 5*time.Millisecond {
+		t.Errorf("RMS offset hybrid = %v, pid = %v", hybrid, pid)
+	}
+}
+
+func TestSimulationHybridFLL(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "hybrid"}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, Seed: 1}
+	sources := []SimSourceConfig{{
+		Name:         "ntp",
+		Noise:        time.Millisecond,
+		Delay:        20 * time.Millisecond,
+		PollInterval: 1024 * time.Second,
+		Seed:         1,
+	}}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+	result := sim.Run(48 * time.Hour)
+
+	status, ok := sim.Manager().GetLoopStatus()
+	if !ok {
+		t.Fatal("hybrid discipline does not report loop status")
+	}
+	if status.Mode != LoopModeFLL {
+		t.Errorf("mode = %s, want fll", status.Mode)
+	}
+	if math.Abs(status.Frequency+10000) > 1000 {
+		t.Errorf("frequency = %.0f, want -10000", status.Frequency)
+	}
+	if rms := result.RMSOffset(24 * time.Hour); rms > 5*time.Millisecond {
+		t.Errorf("RMS offset = %v", rms)
+	}
+}
@@ -0,0 +1,177 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Грубый источник должен определить секунду с запасом: hardpps
+	// подстраивает фазу только в пределах ±0.5 с
+	defaultKernelPPSLabelThreshold = 100 * time.Millisecond
+
+	kernelPPSFlags = unix.STA_PPSFREQ | unix.STA_PPSTIME
+)
+
+// KernelPPSStatus состояние дисциплины ядра по PPS и счетчики hardpps
+type KernelPPSStatus struct {
+	Enabled          bool          `json:"enabled"`
+	Active           bool          `json:"active"`
+	Source           string        `json:"source,omitempty"`
+	Reason           string        `json:"reason,omitempty"`
+	Signal           bool          `json:"signal"`          // STA_PPSSIGNAL
+	Jitter           time.Duration `json:"ppsjitter"`       // Джиттер PPS
+	Stability        float64       `json:"stabil"`          // Нестабильность частоты PPS, ppb
+	JitterCount      int64         `json:"jitcnt"`          // Превышения порога джиттера
+	CalibrationCount int64         `json:"calcnt"`          // Интервалы калибровки
+	ErrorCount       int64         `json:"errcnt"`          // Ошибки калибровки
+	StabilityCount   int64         `json:"stbcnt"`          // Превышения порога стабильности
+	JitterExceeded   bool          `json:"jitter_exceeded"` // STA_PPSJITTER
+	WanderExceeded   bool          `json:"wander_exceeded"` // STA_PPSWANDER
+	SignalError      bool          `json:"signal_error"`    // STA_PPSERROR
+}
+
+// KernelPPS включает дисциплину системных часов ядром по PPS (hardpps):
+// после того как грубый источник определил секунду, выставляются
+// STA_PPSFREQ и STA_PPSTIME, и частоту и фазу подстраивает ядро
+type KernelPPS struct {
+	mu sync.RWMutex
+
+	enabled        bool
+	labelThreshold time.Duration
+	adjtimex       func(*unix.Timex) (int, error)
+	status         KernelPPSStatus
+
+	logger *logrus.Logger
+}
+
+// NewKernelPPS создает управление hardpps. Если enabled равно false,
+// флаги ядра не изменяются.
+func NewKernelPPS(enabled bool, logger *logrus.Logger) *KernelPPS {
+	return &KernelPPS{
+		enabled:        enabled,
+		labelThreshold: defaultKernelPPSLabelThreshold,
+		adjtimex:       unix.Adjtimex,
+		status:         KernelPPSStatus{Enabled: enabled},
+		logger:         logger,
+	}
+}
+
+// Active возвращает true, если часы дисциплинирует ядро по PPS
+func (k *KernelPPS) Active() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.status.Active
+}
+
+// Update включает или выключает hardpps. ppsSource - имя привязанного к ядру
+// PPS источника ("" если его нет или он потерян), coarse - есть ли грубый
+// источник с измеренным смещением offset.
+func (k *KernelPPS) Update(ppsSource string, coarse bool, offset time.Duration) error {
+	if !k.enabled {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	labelled := coarse && math.Abs(float64(offset)) <= float64(k.labelThreshold)
+
+	switch {
+	case k.status.Active && ppsSource == "":
+		if err := k.setFlags(false); err != nil {
+			return err
+		}
+		k.deactivate("pps_lost")
+	case k.status.Active && coarse && !labelled:
+		// Грубый источник расходится с PPS больше порога: секунда помечена неверно
+		if err := k.setFlags(false); err != nil {
+			return err
+		}
+		k.deactivate("coarse_offset")
+	case !k.status.Active && ppsSource != "" && labelled:
+		if err := k.setFlags(true); err != nil {
+			return err
+		}
+		k.status.Active = true
+		k.status.Source = ppsSource
+		k.status.Reason = ""
+		k.logger.WithFields(logrus.Fields{
+			"source": ppsSource,
+			"offset": offset,
+		}).Info("Kernel PPS discipline enabled")
+	}
+
+	return k.readCounters()
+}
+
+// deactivate отмечает выключение hardpps
+func (k *KernelPPS) deactivate(reason string) {
+	k.logger.WithFields(logrus.Fields{
+		"source": k.status.Source,
+		"reason": reason,
+	}).Warn("Kernel PPS discipline disabled")
+
+	k.status.Active = false
+	k.status.Source = ""
+	k.status.Reason = reason
+}
+
+// setFlags выставляет или снимает STA_PPSFREQ и STA_PPSTIME
+func (k *KernelPPS) setFlags(enable bool) error {
+	var timex unix.Timex
+	if _, err := k.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to read kernel status: %w", err)
+	}
+
+	timex.Modes = unix.ADJ_STATUS
+	if enable {
+		timex.Status |= kernelPPSFlags
+	} else {
+		timex.Status &^= kernelPPSFlags
+	}
+
+	if _, err := k.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to set kernel PPS status: %w", err)
+	}
+	return nil
+}
+
+// readCounters читает счетчики hardpps ядра
+func (k *KernelPPS) readCounters() error {
+	var timex unix.Timex
+	if _, err := k.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to read kernel PPS counters: %w", err)
+	}
+
+	// Джиттер в микросекундах, либо в наносекундах при STA_NANO
+	jitter := time.Duration(timex.Jitter) * time.Microsecond
+	if timex.Status&unix.STA_NANO != 0 {
+		jitter = time.Duration(timex.Jitter)
+	}
+
+	k.status.Signal = timex.Status&unix.STA_PPSSIGNAL != 0
+	k.status.Jitter = jitter
+	k.status.Stability = float64(timex.Stabil) * 1000 / 65536 // 2^-16 ppm -> ppb
+	k.status.JitterCount = timex.Jitcnt
+	k.status.CalibrationCount = timex.Calcnt
+	k.status.ErrorCount = timex.Errcnt
+	k.status.StabilityCount = timex.Stbcnt
+	k.status.JitterExceeded = timex.Status&unix.STA_PPSJITTER != 0
+	k.status.WanderExceeded = timex.Status&unix.STA_PPSWANDER != 0
+	k.status.SignalError = timex.Status&unix.STA_PPSERROR != 0
+
+	return nil
+}
+
+// Status возвращает состояние hardpps
+func (k *KernelPPS) Status() KernelPPSStatus {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.status
+}
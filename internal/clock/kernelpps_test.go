@@ -0,0 +1,183 @@
+package clock
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// fakeKernelPPS подменяет adjtimex: хранит статус ядра и отдает счетчики hardpps
+type fakeKernelPPS struct {
+	timex    unix.Timex
+	writes   int
+	readErr  error
+	writeErr error
+}
+
+func (f *fakeKernelPPS) adjtimex(timex *unix.Timex) (int, error) {
+	if timex.Modes == 0 {
+		if f.readErr != nil {
+			return 0, f.readErr
+		}
+		*timex = f.timex
+		return 0, nil
+	}
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+	f.writes++
+	if timex.Modes&unix.ADJ_STATUS != 0 {
+		f.timex.Status = timex.Status
+	}
+	return 0, nil
+}
+
+func newTestKernelPPS(enabled bool, kernel *fakeKernelPPS) *KernelPPS {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	k := NewKernelPPS(enabled, logger)
+	k.adjtimex = kernel.adjtimex
+	return k
+}
+
+func TestKernelPPSUpdate(t *testing.T) {
+	kernel := &fakeKernelPPS{timex: unix.Timex{
+		Status: unix.STA_PLL | unix.STA_PPSSIGNAL | unix.STA_NANO,
+		Jitter: 1500,
+		Stabil: 65536,
+		Jitcnt: 2,
+		Calcnt: 10,
+		Errcnt: 1,
+		Stbcnt: 3,
+	}}
+	k := newTestKernelPPS(true, kernel)
+
+	steps := []struct {
+		name     string
+		pps      string
+		coarse   bool
+		offset   time.Duration
+		active   bool
+		reason   string
+		ppsFlags bool
+	}{
+		{name: "no coarse source", pps: "pps0"},
+		{name: "second not labelled", pps: "pps0", coarse: true, offset: 200 * time.Millisecond},
+		{name: "labelled", pps: "pps0", coarse: true, offset: -50 * time.Millisecond, active: true, ppsFlags: true},
+		{name: "coarse source lost", pps: "pps0", active: true, ppsFlags: true},
+		{name: "coarse offset", pps: "pps0", coarse: true, offset: 300 * time.Millisecond, reason: "coarse_offset"},
+		{name: "relabelled", pps: "pps0", coarse: true, offset: time.Millisecond, active: true, ppsFlags: true},
+		{name: "pps lost", coarse: true, offset: time.Millisecond, reason: "pps_lost"},
+	}
+
+	for _, step := range steps {
+		if err := k.Update(step.pps, step.coarse, step.offset); err != nil {
+			t.Fatalf("%s: Update() error = %v", step.name, err)
+		}
+		status := k.Status()
+		if status.Active != step.active || status.Reason != step.reason || k.Active() != step.active {
+			t.Errorf("%s: active = %v, reason = %q, want %v, %q", step.name, status.Active, status.Reason, step.active, step.reason)
+		}
+		if step.active && status.Source != step.pps {
+			t.Errorf("%s: source = %q, want %q", step.name, status.Source, step.pps)
+		}
+		if flags := kernel.timex.Status&kernelPPSFlags == kernelPPSFlags; flags != step.ppsFlags {
+			t.Errorf("%s: STA_PPSFREQ|STA_PPSTIME = %v, want %v", step.name, flags, step.ppsFlags)
+		}
+		if kernel.timex.Status&unix.STA_PLL == 0 {
+			t.Fatalf("%s: unrelated status bits cleared", step.name)
+		}
+	}
+	if kernel.writes != 4 {
+		t.Errorf("status writes = %d, want 4", kernel.writes)
+	}
+
+	// Джиттер в наносекундах при STA_NANO, stabil в 2^-16 ppm
+	status := k.Status()
+	if !status.Signal || status.Jitter != 1500*time.Nanosecond || status.Stability != 1000 {
+		t.Errorf("signal = %v, jitter = %v, stability = %v", status.Signal, status.Jitter, status.Stability)
+	}
+	if status.JitterCount != 2 || status.CalibrationCount != 10 || status.ErrorCount != 1 || status.StabilityCount != 3 {
+		t.Errorf("counters = %+v", status)
+	}
+
+	kernel.timex.Status = unix.STA_PLL | unix.STA_PPSJITTER | unix.STA_PPSWANDER | unix.STA_PPSERROR
+	if err := k.Update("", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	status = k.Status()
+	if status.Signal || status.Jitter != 1500*time.Microsecond || !status.JitterExceeded || !status.WanderExceeded || !status.SignalError {
+		t.Errorf("status = %+v, want microsecond jitter and error flags", status)
+	}
+}
+
+func TestKernelPPSDisabled(t *testing.T) {
+	kernel := &fakeKernelPPS{readErr: errors.New("adjtimex must not be called")}
+	k := newTestKernelPPS(false, kernel)
+
+	if err := k.Update("pps0", true, 0); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if status := k.Status(); status.Enabled || status.Active {
+		t.Errorf("status = %+v, want disabled", status)
+	}
+}
+
+func TestKernelPPSErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		kernel fakeKernelPPS
+		err    string
+	}{
+		{name: "read status", kernel: fakeKernelPPS{readErr: unix.EINVAL}, err: "failed to read kernel status"},
+		{name: "set status", kernel: fakeKernelPPS{writeErr: unix.EPERM}, err: "failed to set kernel PPS status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := tt.kernel
+			k := newTestKernelPPS(true, &kernel)
+
+			err := k.Update("pps0", true, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Update() error = %v, want %q", err, tt.err)
+			}
+			if k.Active() {
+				t.Error("kernel PPS must stay inactive when flags are not set")
+			}
+		})
+	}
+
+	// Ошибка чтения счетчиков не меняет состояние дисциплины
+	kernel := &fakeKernelPPS{}
+	k := newTestKernelPPS(true, kernel)
+	if err := k.Update("pps0", true, 0); err != nil {
+		t.Fatal(err)
+	}
+	kernel.readErr = unix.EINVAL
+	if err := k.Update("pps0", true, 0); err == nil || !strings.Contains(err.Error(), "failed to read kernel PPS counters") {
+		t.Errorf("Update() error = %v, want counters error", err)
+	}
+	if !k.Active() {
+		t.Error("kernel PPS deactivated by counters error")
+	}
+}
+
+func TestSimulationKernelPPSConfig(t *testing.T) {
+	// hardpps управляет только системными часами: у симулированных часов
+	// kernel_pps не включается даже вместе с kernel_sync
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{KernelSync: true, KernelPPS: true}}
+	sim := newTestSimulation(t, cfg, SimOscillatorConfig{Seed: 1}, simSources(1, "pps", time.Microsecond))
+	sim.Run(time.Minute)
+
+	if status := sim.Manager().GetStatistics().KernelPPS; status.Enabled || status.Active {
+		t.Errorf("kernel PPS = %+v, want disabled for simulated clock", status)
+	}
+}
@@ -0,0 +1,164 @@
+package clock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Ядро ограничивает maxerror значением NTP_PHASE_LIMIT
+	kernelMaxErrorLimit = 16 * time.Second
+)
+
+// KernelTimexStatus оценки ошибки, флаг синхронизации и TAI-UTC, которые
+// менеджер передает ядру через adjtimex
+type KernelTimexStatus struct {
+	Enabled      bool          `json:"enabled"`
+	Unsync       bool          `json:"unsync"`        // STA_UNSYNC
+	MaxError     time.Duration `json:"maxerror"`      // Граница ошибки (root distance)
+	EstError     time.Duration `json:"esterror"`      // Оценка ошибки (джиттер)
+	RootDistance time.Duration `json:"root_distance"` // Root distance системного источника
+	TAIOffset    int           `json:"tai_offset"`
+	TAISource    string        `json:"tai_source,omitempty"` // config, leapfile или sources
+	Updated      time.Time     `json:"updated,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// KernelTimex передает ядру maxerror, esterror, STA_UNSYNC и TAI-UTC, чтобы
+// приложения, читающие ntp_adjtime и CLOCK_TAI, видели актуальные данные
+type KernelTimex struct {
+	mu sync.RWMutex
+
+	enabled  bool
+	adjtimex func(*unix.Timex) (int, error)
+	status   KernelTimexStatus
+
+	logger *logrus.Logger
+}
+
+// NewKernelTimex создает управление состоянием ядра. Если enabled равно
+// false, значения только вычисляются для статистики.
+func NewKernelTimex(enabled bool, logger *logrus.Logger) *KernelTimex {
+	return &KernelTimex{
+		enabled:  enabled,
+		adjtimex: unix.Adjtimex,
+		status:   KernelTimexStatus{Enabled: enabled, Unsync: true},
+		logger:   logger,
+	}
+}
+
+// ParseTAIOffset разбирает ptp_tuning.phc.tai_offset: auto (или пустая
+// строка) означает TAI-UTC от источников и leap-seconds.list, число -
+// фиксированное значение
+func ParseTAIOffset(value string) (int, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "auto") {
+		return 0, false, nil
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, false, fmt.Errorf("invalid TAI offset %q: must be auto or a non-negative number of seconds", value)
+	}
+	return offset, true, nil
+}
+
+// Update передает ядру состояние синхронизации. maxError и estError равны
+// нулю, если оценок нет (часы не синхронизированы) - тогда maxerror
+// растет в ядре сам. taiOffset равен нулю, если TAI-UTC неизвестно.
+func (k *KernelTimex) Update(now time.Time, synced bool, maxError, estError, rootDistance time.Duration, taiOffset int, taiSource string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if maxError > kernelMaxErrorLimit {
+		maxError = kernelMaxErrorLimit
+	}
+	if estError > kernelMaxErrorLimit {
+		estError = kernelMaxErrorLimit
+	}
+
+	previous := k.status
+	k.status.Unsync = !synced
+	k.status.MaxError = maxError
+	k.status.EstError = estError
+	if rootDistance > 0 {
+		k.status.RootDistance = rootDistance
+	}
+	k.status.Updated = now
+	if taiOffset > 0 {
+		k.status.TAIOffset = taiOffset
+		k.status.TAISource = taiSource
+	}
+
+	if previous.Unsync != k.status.Unsync {
+		k.logger.WithFields(logrus.Fields{
+			"unsync":   k.status.Unsync,
+			"maxerror": maxError,
+		}).Info("Kernel synchronization status changed")
+	}
+	if taiOffset > 0 && previous.TAIOffset != taiOffset {
+		k.logger.WithFields(logrus.Fields{
+			"tai_offset": taiOffset,
+			"source":     taiSource,
+			"previous":   previous.TAIOffset,
+		}).Info("Kernel TAI offset updated")
+	}
+
+	if !k.enabled {
+		return nil
+	}
+
+	err := k.apply(maxError, estError, taiOffset)
+	k.status.Error = ""
+	if err != nil {
+		k.status.Error = err.Error()
+	}
+	return err
+}
+
+// apply записывает состояние в ядро, сохраняя остальные биты статуса
+func (k *KernelTimex) apply(maxError, estError time.Duration, taiOffset int) error {
+	var timex unix.Timex
+	if _, err := k.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to read kernel status: %w", err)
+	}
+	currentTAI := int(timex.Tai)
+
+	timex.Modes = unix.ADJ_STATUS
+	if k.status.Unsync {
+		timex.Status |= unix.STA_UNSYNC
+	} else {
+		timex.Status &^= unix.STA_UNSYNC
+	}
+
+	// Ядро хранит ошибки в микросекундах
+	if maxError > 0 {
+		timex.Modes |= unix.ADJ_MAXERROR | unix.ADJ_ESTERROR
+		timex.Maxerror = maxError.Microseconds()
+		timex.Esterror = estError.Microseconds()
+	}
+
+	// ADJ_TAI передает значение в поле constant
+	if taiOffset > 0 && taiOffset != currentTAI {
+		timex.Modes |= unix.ADJ_TAI
+		timex.Constant = int64(taiOffset)
+	}
+
+	if _, err := k.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to set kernel status: %w", err)
+	}
+	return nil
+}
+
+// Status возвращает последнее переданное ядру состояние
+func (k *KernelTimex) Status() KernelTimexStatus {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.status
+}
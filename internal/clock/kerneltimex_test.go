@@ -0,0 +1,136 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestKernelTimexUpdate(t *testing.T) {
+	kernel := unix.Timex{Status: unix.STA_UNSYNC | unix.STA_PLL, Tai: 36}
+	var writes []unix.Timex
+
+	k := NewKernelTimex(true, logrus.New())
+	k.adjtimex = func(timex *unix.Timex) (int, error) {
+		if timex.Modes == 0 {
+			*timex = kernel
+			return 0, nil
+		}
+		writes = append(writes, *timex)
+		if timex.Modes&unix.ADJ_STATUS != 0 {
+			kernel.Status = timex.Status
+		}
+		if timex.Modes&unix.ADJ_TAI != 0 {
+			kernel.Tai = int32(timex.Constant)
+		}
+		return 0, nil
+	}
+
+	now := time.Now()
+	if err := k.Update(now, true, 1500*time.Microsecond, 200*time.Microsecond, time.Millisecond, 37, "leapfile"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := writes[0]
+	if w.Modes != unix.ADJ_STATUS|unix.ADJ_MAXERROR|unix.ADJ_ESTERROR|unix.ADJ_TAI {
+		t.Errorf("modes = %#x", w.Modes)
+	}
+	if w.Maxerror != 1500 || w.Esterror != 200 || w.Constant != 37 {
+		t.Errorf("maxerror = %d, esterror = %d, tai = %d; want 1500, 200, 37", w.Maxerror, w.Esterror, w.Constant)
+	}
+	if kernel.Status != unix.STA_PLL {
+		t.Errorf("status = %#x, want STA_UNSYNC cleared and STA_PLL kept", kernel.Status)
+	}
+
+	// Без оценок ошибки и при известном ядру TAI меняется только статус
+	if err := k.Update(now, false, 0, 0, 0, 37, "leapfile"); err != nil {
+		t.Fatal(err)
+	}
+	if w := writes[1]; w.Modes != unix.ADJ_STATUS {
+		t.Errorf("modes = %#x, want ADJ_STATUS only", w.Modes)
+	}
+	if kernel.Status&unix.STA_UNSYNC == 0 {
+		t.Error("STA_UNSYNC not set for unsynchronized clock")
+	}
+
+	status := k.Status()
+	if !status.Unsync || status.RootDistance != time.Millisecond || status.TAIOffset != 37 || status.TAISource != "leapfile" {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestParseTAIOffset(t *testing.T) {
+	for _, value := range []string{"", "auto", "AUTO"} {
+		if _, fixed, err := ParseTAIOffset(value); err != nil || fixed {
+			t.Errorf("ParseTAIOffset(%q) = fixed %v, %v; want auto", value, fixed, err)
+		}
+	}
+	if offset, fixed, err := ParseTAIOffset("37"); err != nil || !fixed || offset != 37 {
+		t.Errorf("ParseTAIOffset(37) = %d, %v, %v", offset, fixed, err)
+	}
+	for _, value := range []string{"-1", "abc"} {
+		if _, _, err := ParseTAIOffset(value); err == nil {
+			t.Errorf("ParseTAIOffset(%q) accepted", value)
+		}
+	}
+}
+
+func TestSimulationKernelTimex(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{
+		Clock:     config.ClockConfig{Algorithm: "kalman"},
+		PTPTuning: config.PTPTuningConfig{PHC: config.PHCConfig{TAIOffset: "37"}},
+	}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, Seed: 1}
+	outage := SimOutage{Start: 30 * time.Minute, End: time.Hour}
+	sources := []SimSourceConfig{
+		{Name: "ntp", Noise: 20 * time.Microsecond, Delay: time.Millisecond, Outages: []SimOutage{outage}, Seed: 1},
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+
+	// До захвата часы не считаются синхронизированными
+	sim.Run(10 * time.Second)
+	if state := sim.Manager().GetState(); state != ClockStateSynchronizing {
+		t.Fatalf("state = %v, want synchronizing", state)
+	}
+	if !sim.Manager().GetStatistics().Kernel.Unsync {
+		t.Error("STA_UNSYNC cleared while synchronizing")
+	}
+
+	sim.Run(29*time.Minute - 10*time.Second)
+	if state := sim.Manager().GetState(); state != ClockStateLocked {
+		t.Fatalf("state = %v, want locked", state)
+	}
+	status := sim.Manager().GetStatistics().Kernel
+	if status.Enabled {
+		t.Error("kernel status enabled for simulated clock")
+	}
+	if status.Unsync {
+		t.Error("STA_UNSYNC set while synchronized")
+	}
+	// Root distance: задержка/2 плюс дисперсия источника
+	if status.RootDistance < 500*time.Microsecond || status.MaxError < status.RootDistance || status.MaxError > 2*time.Millisecond {
+		t.Errorf("root distance = %v, maxerror = %v", status.RootDistance, status.MaxError)
+	}
+	if status.EstError <= 0 || status.EstError > status.MaxError {
+		t.Errorf("esterror = %v, maxerror = %v", status.EstError, status.MaxError)
+	}
+	if status.TAIOffset != 37 || status.TAISource != "config" {
+		t.Errorf("TAI = %d from %q, want 37 from config", status.TAIOffset, status.TAISource)
+	}
+
+	// В holdover граница ошибки растет с оценкой ошибки модели
+	locked := status.MaxError
+	sim.Run(10 * time.Minute)
+	status = sim.Manager().GetStatistics().Kernel
+	if sim.Manager().GetState() != ClockStateHoldover {
+		t.Fatalf("state = %v, want holdover", sim.Manager().GetState())
+	}
+	if status.Unsync || status.MaxError <= locked {
+		t.Errorf("holdover: unsync = %v, maxerror = %v (locked %v)", status.Unsync, status.MaxError, locked)
+	}
+}
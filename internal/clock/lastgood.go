@@ -0,0 +1,124 @@
+package clock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLastGoodInterval = 10 * time.Minute
+)
+
+// LastGoodStatus состояние файла последнего достоверного времени для
+// статистики и API
+type LastGoodStatus struct {
+	Path      string    `json:"path"`
+	Time      time.Time `json:"time,omitempty"` // Последнее достоверное время
+	Restored  bool      `json:"restored"`
+	LastSaved time.Time `json:"last_saved,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// LastGoodFile хранит время, когда часы последний раз были захвачены
+// источниками. После перезапуска часы не переводятся раньше этого времени,
+// даже если источники согласны между собой: так неверный источник или
+// подмененный ответ не откатывает часы в прошлое.
+type LastGoodFile struct {
+	mu sync.RWMutex
+
+	path     string
+	interval time.Duration
+	status   LastGoodStatus
+}
+
+// NewLastGoodFile создает файл последнего достоверного времени с заданным
+// периодом сохранения
+func NewLastGoodFile(path string, interval time.Duration) *LastGoodFile {
+	if interval <= 0 {
+		interval = defaultLastGoodInterval
+	}
+	return &LastGoodFile{
+		path:     path,
+		interval: interval,
+		status:   LastGoodStatus{Path: path},
+	}
+}
+
+// Load читает сохраненное время
+func (f *LastGoodFile) Load() (time.Time, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read last good time file: %w", err)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time in last good time file: %w", err)
+	}
+
+	f.mu.Lock()
+	f.status.Restored = true
+	f.status.Time = t
+	f.mu.Unlock()
+
+	return t, nil
+}
+
+// Due возвращает true, если пора сохранить время
+func (f *LastGoodFile) Due(now time.Time) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return now.Sub(f.status.LastSaved) >= f.interval
+}
+
+// Save атомарно записывает время now
+func (f *LastGoodFile) Save(now time.Time) error {
+	err := f.write(now)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Неудачная попытка тоже откладывает следующую, чтобы не писать каждую секунду
+	f.status.LastSaved = now
+	if err != nil {
+		f.status.LastError = err.Error()
+		return err
+	}
+
+	f.status.Time = now
+	f.status.LastError = ""
+	return nil
+}
+
+// write записывает файл через временный файл и rename
+func (f *LastGoodFile) write(now time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create last good time file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintln(tmp, now.UTC().Format(time.RFC3339Nano)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write last good time file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write last good time file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace last good time file: %w", err)
+	}
+
+	return nil
+}
+
+// Status возвращает состояние файла
+func (f *LastGoodFile) Status() LastGoodStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.status
+}
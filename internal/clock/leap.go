@@ -0,0 +1,534 @@
+package clock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	LeapModeKernel = "kernel" // Секунду координации вставляет ядро (STA_INS/STA_DEL)
+	LeapModeSmear  = "smear"  // Линейное размазывание секунды частотой
+	LeapModeIgnore = "ignore" // Секунда координации отрабатывается как обычное смещение
+
+	defaultLeapSmearLength = 24 * time.Hour
+
+	// Разница между эпохами NTP (1900) и Unix (1970) в секундах
+	ntpUnixEpochOffset = 2208988800
+)
+
+// LeapEntry запись leap-seconds.list: с момента Time действует TAI-UTC = TAIOffset
+type LeapEntry struct {
+	Time      time.Time
+	TAIOffset int
+}
+
+// LeapSecondList таблица секунд координации IETF (leap-seconds.list)
+type LeapSecondList struct {
+	Entries []LeapEntry
+	Updated time.Time
+	Expires time.Time
+}
+
+// LoadLeapSecondList загружает leap-seconds.list из файла
+func LoadLeapSecondList(path string) (*LeapSecondList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open leap seconds file: %w", err)
+	}
+	defer f.Close()
+
+	return ParseLeapSecondList(f)
+}
+
+// ParseLeapSecondList разбирает таблицу в формате IETF leap-seconds.list
+func ParseLeapSecondList(r io.Reader) (*LeapSecondList, error) {
+	list := &LeapSecondList{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#@"):
+			expires, err := parseNTPSeconds(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid expiration: %w", lineNo, err)
+			}
+			list.Expires = expires
+			continue
+		case strings.HasPrefix(line, "#$"):
+			updated, err := parseNTPSeconds(strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid update time: %w", lineNo, err)
+			}
+			list.Updated = updated
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		}
+
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected NTP time and TAI-UTC offset", lineNo)
+		}
+
+		entryTime, err := parseNTPSeconds(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid NTP time: %w", lineNo, err)
+		}
+		offset, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid TAI-UTC offset: %w", lineNo, err)
+		}
+
+		list.Entries = append(list.Entries, LeapEntry{Time: entryTime, TAIOffset: offset})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read leap seconds list: %w", err)
+	}
+
+	if len(list.Entries) == 0 {
+		return nil, fmt.Errorf("leap seconds list has no entries")
+	}
+
+	return list, nil
+}
+
+// parseNTPSeconds переводит секунды эпохи NTP во время
+func parseNTPSeconds(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec-ntpUnixEpochOffset, 0).UTC(), nil
+}
+
+// Expired возвращает true, если срок действия таблицы истек
+func (l *LeapSecondList) Expired(now time.Time) bool {
+	return !l.Expires.IsZero() && now.After(l.Expires)
+}
+
+// TAIOffset возвращает TAI-UTC, действующее в момент t
+func (l *LeapSecondList) TAIOffset(t time.Time) int {
+	offset := 0
+	for _, e := range l.Entries {
+		if e.Time.After(t) {
+			break
+		}
+		offset = e.TAIOffset
+	}
+	return offset
+}
+
+// NextLeap возвращает ближайшую секунду координации после t: момент, с
+// которого действует новое TAI-UTC, и направление (+1 вставка, -1 удаление)
+func (l *LeapSecondList) NextLeap(t time.Time) (time.Time, int, bool) {
+	for i := 1; i < len(l.Entries); i++ {
+		if l.Entries[i].Time.After(t) {
+			return l.Entries[i].Time, l.Entries[i].TAIOffset - l.Entries[i-1].TAIOffset, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// leapEvent ожидаемая секунда координации
+type leapEvent struct {
+	time   time.Time // Начало суток после секунды координации (UTC)
+	delta  int       // +1 вставка, -1 удаление
+	source string    // file или sources
+}
+
+// LeapStatus состояние подсистемы секунд координации
+type LeapStatus struct {
+	Mode          string            `json:"mode"`
+	Pending       string            `json:"pending"`
+	LeapTime      time.Time         `json:"leap_time,omitempty"`
+	Source        string            `json:"source,omitempty"`
+	KernelArmed   string            `json:"kernel_armed"`
+	Smearing      bool              `json:"smearing"`
+	SmearOffset   time.Duration     `json:"smear_offset"`
+	TAIOffset     int               `json:"tai_offset"`
+	ListLoaded    bool              `json:"list_loaded"`
+	ListExpires   time.Time         `json:"list_expires,omitempty"`
+	Announcements map[string]string `json:"announcements"`
+}
+
+// LeapManager объединяет сведения о секундах координации из leap-seconds.list,
+// битов LI NTP, флагов Announce PTP и GNSS и отрабатывает их в ядре или
+// размазыванием частоты
+type LeapManager struct {
+	mu sync.RWMutex
+
+	mode        string
+	smearLength time.Duration
+	kernel      bool // Разрешено управлять флагами ядра
+	adjtimex    func(*unix.Timex) (int, error)
+	list        *LeapSecondList
+
+	announcements map[string]protocols.LeapIndicator
+	utcOffsets    map[string]int
+
+	event    *leapEvent
+	armed    protocols.LeapIndicator // Флаг, выставленный в ядре
+	disagree bool                    // Таблица и источники расходятся (для однократного лога)
+
+	logger *logrus.Logger
+}
+
+// NewLeapManager создает менеджер секунд координации
+func NewLeapManager(cfg config.ClockConfig, kernel bool, logger *logrus.Logger) *LeapManager {
+	lm := &LeapManager{
+		mode:          LeapModeKernel,
+		smearLength:   defaultLeapSmearLength,
+		kernel:        kernel,
+		adjtimex:      unix.Adjtimex,
+		announcements: make(map[string]protocols.LeapIndicator),
+		utcOffsets:    make(map[string]int),
+		logger:        logger,
+	}
+
+	if cfg.LeapSecMode != "" {
+		lm.mode = strings.ToLower(cfg.LeapSecMode)
+	}
+	if cfg.LeapSmearLength > 0 {
+		lm.smearLength = cfg.LeapSmearLength
+	}
+
+	if cfg.LeapSecFile != "" {
+		list, err := LoadLeapSecondList(cfg.LeapSecFile)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to load leap seconds list, using source announcements only")
+		} else {
+			lm.list = list
+			fields := logrus.Fields{
+				"file":       cfg.LeapSecFile,
+				"entries":    len(list.Entries),
+				"expires":    list.Expires,
+				"tai_offset": list.TAIOffset(time.Now()),
+			}
+			if list.Expired(time.Now()) {
+				logger.WithFields(fields).Warn("Leap seconds list has expired")
+			} else {
+				logger.WithFields(fields).Info("Leap seconds list loaded")
+			}
+		}
+	}
+
+	return lm
+}
+
+// Observe запоминает предупреждение и TAI-UTC источника. info равен nil,
+// если источник не дал измерения.
+func (lm *LeapManager) Observe(source string, info *protocols.TimeInfo) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if info == nil || info.Leap == protocols.LeapAlarm {
+		delete(lm.announcements, source)
+		delete(lm.utcOffsets, source)
+		return
+	}
+
+	lm.announcements[source] = info.Leap
+	if info.UTCOffset > 0 {
+		lm.utcOffsets[source] = info.UTCOffset
+	} else {
+		delete(lm.utcOffsets, source)
+	}
+}
+
+// Update объединяет сведения о секунде координации и при необходимости
+// выставляет или снимает флаг в ядре
+func (lm *LeapManager) Update(now time.Time) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.mode == LeapModeIgnore {
+		return nil
+	}
+
+	// Текущее событие действует до окончания размазывания
+	if lm.event != nil && !now.Before(lm.eventEnd(lm.event)) {
+		lm.logger.WithFields(logrus.Fields{
+			"leap_time": lm.event.time,
+			"delta":     lm.event.delta,
+		}).Info("Leap second completed")
+		lm.event = nil
+	}
+
+	if lm.event == nil || now.Before(lm.event.time) {
+		event := lm.mergeLocked(now)
+		if event != nil && (lm.event == nil || lm.event.delta != event.delta) {
+			lm.logger.WithFields(logrus.Fields{
+				"leap_time": event.time,
+				"delta":     event.delta,
+				"source":    event.source,
+				"mode":      lm.mode,
+			}).Warn("Leap second pending")
+		}
+		if event == nil && lm.event != nil {
+			lm.logger.WithField("leap_time", lm.event.time).Info("Pending leap second cancelled")
+		}
+		lm.event = event
+	}
+
+	if lm.mode == LeapModeKernel && lm.kernel {
+		return lm.armKernelLocked(now)
+	}
+
+	return nil
+}
+
+// mergeLocked определяет ожидаемую секунду координации в ближайшую полночь UTC
+func (lm *LeapManager) mergeLocked(now time.Time) *leapEvent {
+	midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	// Секунды координации добавляются только в конце месяца
+	announced := 0
+	if midnight.Day() == 1 {
+		announced = lm.sourceVoteLocked()
+	}
+
+	var fromFile *leapEvent
+	fileValid := lm.list != nil && !lm.list.Expired(now)
+	if fileValid {
+		if leapTime, delta, ok := lm.list.NextLeap(now); ok && leapTime.Equal(midnight) {
+			fromFile = &leapEvent{time: leapTime, delta: delta, source: "file"}
+		}
+	}
+
+	if fileValid {
+		fileDelta := 0
+		if fromFile != nil {
+			fileDelta = fromFile.delta
+		}
+		disagree := announced != fileDelta
+		if disagree && !lm.disagree {
+			lm.logger.WithFields(logrus.Fields{
+				"file":    fileDelta,
+				"sources": announced,
+			}).Warn("Leap second announcements disagree with leap seconds list, trusting the list")
+		}
+		lm.disagree = disagree
+		return fromFile
+	}
+
+	if announced != 0 {
+		return &leapEvent{time: midnight, delta: announced, source: "sources"}
+	}
+	return nil
+}
+
+// sourceVoteLocked возвращает решение большинства источников: +1, -1 или 0
+func (lm *LeapManager) sourceVoteLocked() int {
+	var insert, del int
+	for _, leap := range lm.announcements {
+		switch leap {
+		case protocols.LeapInsert:
+			insert++
+		case protocols.LeapDelete:
+			del++
+		}
+	}
+
+	total := len(lm.announcements)
+	switch {
+	case 2*insert > total:
+		return 1
+	case 2*del > total:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// eventEnd возвращает момент окончания отработки события
+func (lm *LeapManager) eventEnd(event *leapEvent) time.Time {
+	if lm.mode == LeapModeSmear {
+		return event.time.Add(lm.smearLength / 2)
+	}
+	return event.time
+}
+
+// armKernelLocked выставляет STA_INS/STA_DEL до секунды координации и снимает после
+func (lm *LeapManager) armKernelLocked(now time.Time) error {
+	desired := protocols.LeapNone
+	if lm.event != nil && now.Before(lm.event.time) {
+		if lm.event.delta > 0 {
+			desired = protocols.LeapInsert
+		} else {
+			desired = protocols.LeapDelete
+		}
+	}
+
+	if desired == lm.armed {
+		return nil
+	}
+
+	var timex unix.Timex
+	if _, err := lm.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to read kernel status: %w", err)
+	}
+
+	timex.Modes = unix.ADJ_STATUS
+	timex.Status &^= unix.STA_INS | unix.STA_DEL
+	switch desired {
+	case protocols.LeapInsert:
+		timex.Status |= unix.STA_INS
+	case protocols.LeapDelete:
+		timex.Status |= unix.STA_DEL
+	}
+
+	if _, err := lm.adjtimex(&timex); err != nil {
+		return fmt.Errorf("failed to set kernel leap status: %w", err)
+	}
+
+	lm.logger.WithFields(logrus.Fields{
+		"leap":     desired.String(),
+		"previous": lm.armed.String(),
+	}).Info("Kernel leap second status updated")
+	lm.armed = desired
+
+	return nil
+}
+
+// smearFraction возвращает долю размазанной секунды (0..1) и признак активного окна
+func (lm *LeapManager) smearFraction(now time.Time) (float64, bool) {
+	if lm.mode != LeapModeSmear || lm.event == nil {
+		return 0, false
+	}
+
+	start := lm.event.time.Add(-lm.smearLength / 2)
+	switch {
+	case now.Before(start):
+		return 0, false
+	case !now.Before(start.Add(lm.smearLength)):
+		return 1, false
+	}
+	return float64(now.Sub(start)) / float64(lm.smearLength), true
+}
+
+// OffsetCorrection возвращает поправку к измеренному смещению на время
+// размазывания: часы намеренно отстают от UTC источников на долю секунды
+func (lm *LeapManager) OffsetCorrection(now time.Time) time.Duration {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	fraction, active := lm.smearFraction(now)
+	if !active {
+		return 0
+	}
+
+	// До секунды координации источники еще не сделали шаг, после - уже сделали
+	correction := -float64(lm.event.delta) * fraction
+	if !now.Before(lm.event.time) {
+		correction += float64(lm.event.delta)
+	}
+	return time.Duration(correction * float64(time.Second))
+}
+
+// SmearFrequency возвращает добавку частоты в ppb на время размазывания
+func (lm *LeapManager) SmearFrequency(now time.Time) float64 {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	if _, active := lm.smearFraction(now); !active {
+		return 0
+	}
+	return -float64(lm.event.delta) * 1e9 / lm.smearLength.Seconds()
+}
+
+// TAIOffset возвращает текущее TAI-UTC из таблицы или от источников
+func (lm *LeapManager) TAIOffset(now time.Time) int {
+	offset, _ := lm.TAIOffsetSource(now)
+	return offset
+}
+
+// TAIOffsetSource возвращает текущее TAI-UTC и его происхождение:
+// leapfile (таблица leap-seconds.list) или sources (PTP, GNSS)
+func (lm *LeapManager) TAIOffsetSource(now time.Time) (int, string) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	offset := lm.taiOffsetLocked(now)
+	switch {
+	case offset == 0:
+		return 0, ""
+	case lm.list != nil && !lm.list.Expired(now):
+		return offset, "leapfile"
+	}
+	return offset, "sources"
+}
+
+func (lm *LeapManager) taiOffsetLocked(now time.Time) int {
+	if lm.list != nil && !lm.list.Expired(now) {
+		return lm.list.TAIOffset(now)
+	}
+
+	// Наиболее частое значение среди источников
+	counts := make(map[int]int)
+	best, bestCount := 0, 0
+	for _, offset := range lm.utcOffsets {
+		counts[offset]++
+		if counts[offset] > bestCount {
+			best, bestCount = offset, counts[offset]
+		}
+	}
+	return best
+}
+
+// Status возвращает состояние подсистемы секунд координации
+func (lm *LeapManager) Status(now time.Time) LeapStatus {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	status := LeapStatus{
+		Mode:          lm.mode,
+		Pending:       protocols.LeapNone.String(),
+		KernelArmed:   lm.armed.String(),
+		TAIOffset:     lm.taiOffsetLocked(now),
+		ListLoaded:    lm.list != nil,
+		Announcements: make(map[string]string, len(lm.announcements)),
+	}
+
+	if lm.list != nil {
+		status.ListExpires = lm.list.Expires
+	}
+	for source, leap := range lm.announcements {
+		status.Announcements[source] = leap.String()
+	}
+
+	if lm.event != nil {
+		status.Pending = protocols.LeapInsert.String()
+		if lm.event.delta < 0 {
+			status.Pending = protocols.LeapDelete.String()
+		}
+		status.LeapTime = lm.event.time
+		status.Source = lm.event.source
+
+		fraction, active := lm.smearFraction(now)
+		status.Smearing = active
+		if active {
+			status.SmearOffset = time.Duration(float64(lm.event.delta) * fraction * float64(time.Second))
+		}
+	}
+
+	return status
+}
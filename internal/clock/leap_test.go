@@ -0,0 +1,328 @@
+package clock
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+const testLeapFile = "testdata/leap-seconds.list"
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestParseLeapSecondList(t *testing.T) {
+	list, err := LoadLeapSecondList(testLeapFile)
+	if err != nil {
+		t.Fatalf("LoadLeapSecondList() error = %v", err)
+	}
+
+	want := []LeapEntry{
+		{Time: date(1972, time.January, 1, 0), TAIOffset: 10},
+		{Time: date(1972, time.July, 1, 0), TAIOffset: 11},
+		{Time: date(2017, time.January, 1, 0), TAIOffset: 37},
+		{Time: date(2030, time.January, 1, 0), TAIOffset: 38},
+		{Time: date(2030, time.July, 1, 0), TAIOffset: 37},
+	}
+	if len(list.Entries) != len(want) {
+		t.Fatalf("entries = %+v, want %d", list.Entries, len(want))
+	}
+	for i, e := range want {
+		if !list.Entries[i].Time.Equal(e.Time) || list.Entries[i].TAIOffset != e.TAIOffset {
+			t.Errorf("entry %d = %+v, want %+v", i, list.Entries[i], e)
+		}
+	}
+	if !list.Updated.Equal(date(2024, time.January, 1, 0)) {
+		t.Errorf("updated = %v", list.Updated)
+	}
+	if !list.Expires.Equal(date(2031, time.January, 1, 0)) {
+		t.Errorf("expires = %v", list.Expires)
+	}
+	if list.Expired(date(2030, time.December, 31, 0)) || !list.Expired(date(2031, time.January, 2, 0)) {
+		t.Error("unexpected expiration state")
+	}
+
+	tests := []struct {
+		at     time.Time
+		offset int
+		leap   time.Time
+		delta  int
+	}{
+		{at: date(1972, time.March, 1, 0), offset: 10, leap: date(1972, time.July, 1, 0), delta: 1},
+		{at: date(2024, time.June, 1, 0), offset: 37, leap: date(2030, time.January, 1, 0), delta: 1},
+		{at: date(2030, time.January, 1, 0), offset: 38, leap: date(2030, time.July, 1, 0), delta: -1},
+		{at: date(2030, time.August, 1, 0), offset: 37},
+	}
+	for _, tt := range tests {
+		if offset := list.TAIOffset(tt.at); offset != tt.offset {
+			t.Errorf("TAIOffset(%v) = %d, want %d", tt.at, offset, tt.offset)
+		}
+		leap, delta, ok := list.NextLeap(tt.at)
+		if ok != !tt.leap.IsZero() || !leap.Equal(tt.leap) || delta != tt.delta {
+			t.Errorf("NextLeap(%v) = %v, %d, %v, want %v, %d", tt.at, leap, delta, ok, tt.leap, tt.delta)
+		}
+	}
+}
+
+func TestParseLeapSecondListErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "empty", input: "# only comments\n#$\t3913056000\n", err: "no entries"},
+		{name: "missing offset", input: "2272060800\n", err: "line 1: expected NTP time"},
+		{name: "invalid time", input: "2272060800 10\nnow 11\n", err: "line 2: invalid NTP time"},
+		{name: "invalid offset", input: "2272060800 ten\n", err: "line 1: invalid TAI-UTC offset"},
+		{name: "invalid expiration", input: "#@ never\n2272060800 10\n", err: "line 1: invalid expiration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLeapSecondList(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseLeapSecondList() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func newTestLeapManager(cfg config.ClockConfig) *LeapManager {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return NewLeapManager(cfg, false, logger)
+}
+
+func TestLeapManagerFile(t *testing.T) {
+	lm := newTestLeapManager(config.ClockConfig{LeapSecFile: testLeapFile})
+
+	tests := []struct {
+		now     time.Time
+		pending string
+		leap    time.Time
+		tai     int
+	}{
+		// Секунда координации ожидается только в сутки перед ней
+		{now: date(2029, time.December, 30, 12), pending: protocols.LeapNone.String(), tai: 37},
+		{now: date(2029, time.December, 31, 12), pending: protocols.LeapInsert.String(), leap: date(2030, time.January, 1, 0), tai: 37},
+		{now: date(2030, time.January, 1, 0), pending: protocols.LeapNone.String(), tai: 38},
+		{now: date(2030, time.June, 30, 1), pending: protocols.LeapDelete.String(), leap: date(2030, time.July, 1, 0), tai: 38},
+		{now: date(2030, time.July, 1, 1), pending: protocols.LeapNone.String(), tai: 37},
+	}
+
+	for _, tt := range tests {
+		if err := lm.Update(tt.now); err != nil {
+			t.Fatalf("Update(%v) error = %v", tt.now, err)
+		}
+		status := lm.Status(tt.now)
+		if status.Pending != tt.pending || !status.LeapTime.Equal(tt.leap) || status.TAIOffset != tt.tai {
+			t.Errorf("%v: pending = %s at %v, tai = %d, want %s at %v, tai = %d",
+				tt.now, status.Pending, status.LeapTime, status.TAIOffset, tt.pending, tt.leap, tt.tai)
+		}
+		if tt.pending != protocols.LeapNone.String() && status.Source != "file" {
+			t.Errorf("%v: source = %q, want file", tt.now, status.Source)
+		}
+	}
+
+	// Таблица важнее источников, которые не объявили секунду
+	now := date(2029, time.December, 31, 12)
+	for _, source := range []string{"a", "b", "c"} {
+		lm.Observe(source, &protocols.TimeInfo{Leap: protocols.LeapNone, UTCOffset: 36})
+	}
+	if err := lm.Update(now); err != nil {
+		t.Fatal(err)
+	}
+	if status := lm.Status(now); status.Pending != protocols.LeapInsert.String() || status.TAIOffset != 37 {
+		t.Errorf("pending = %s, tai = %d, want insert from file", status.Pending, status.TAIOffset)
+	}
+	if offset, source := lm.TAIOffsetSource(now); offset != 37 || source != "leapfile" {
+		t.Errorf("TAIOffsetSource() = %d, %q, want 37 from leapfile", offset, source)
+	}
+
+	// После истечения таблицы решают источники
+	now = date(2031, time.June, 30, 12)
+	if err := lm.Update(now); err != nil {
+		t.Fatal(err)
+	}
+	if status := lm.Status(now); status.Pending != protocols.LeapNone.String() {
+		t.Errorf("pending = %s, want none with expired list", status.Pending)
+	}
+	if offset, source := lm.TAIOffsetSource(now); offset != 36 || source != "sources" {
+		t.Errorf("TAIOffsetSource() = %d, %q, want 36 from sources", offset, source)
+	}
+}
+
+func TestLeapManagerSources(t *testing.T) {
+	announce := func(lm *LeapManager, leaps ...protocols.LeapIndicator) {
+		for i, leap := range leaps {
+			lm.Observe(string(rune('a'+i)), &protocols.TimeInfo{Leap: leap})
+		}
+	}
+	insert, del, none := protocols.LeapInsert, protocols.LeapDelete, protocols.LeapNone
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		leaps   []protocols.LeapIndicator
+		pending protocols.LeapIndicator
+	}{
+		{name: "insert", now: date(2024, time.June, 30, 12), leaps: []protocols.LeapIndicator{insert, insert, none}, pending: insert},
+		{name: "delete", now: date(2024, time.December, 31, 12), leaps: []protocols.LeapIndicator{del, del}, pending: del},
+		{name: "minority", now: date(2024, time.June, 30, 12), leaps: []protocols.LeapIndicator{insert, none, none}, pending: none},
+		{name: "not month end", now: date(2024, time.June, 15, 12), leaps: []protocols.LeapIndicator{insert, insert}, pending: none},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := newTestLeapManager(config.ClockConfig{})
+			announce(lm, tt.leaps...)
+			if err := lm.Update(tt.now); err != nil {
+				t.Fatal(err)
+			}
+			status := lm.Status(tt.now)
+			if status.Pending != tt.pending.String() {
+				t.Fatalf("pending = %s, want %s", status.Pending, tt.pending)
+			}
+			if tt.pending != none && status.Source != "sources" {
+				t.Errorf("source = %q, want sources", status.Source)
+			}
+		})
+	}
+
+	// Источник без измерения снимает свое предупреждение
+	lm := newTestLeapManager(config.ClockConfig{})
+	now := date(2024, time.June, 30, 12)
+	announce(lm, insert)
+	if err := lm.Update(now); err != nil {
+		t.Fatal(err)
+	}
+	lm.Observe("a", nil)
+	if err := lm.Update(now); err != nil {
+		t.Fatal(err)
+	}
+	if status := lm.Status(now); status.Pending != none.String() {
+		t.Errorf("pending = %s, want cancelled", status.Pending)
+	}
+}
+
+func TestLeapManagerSmear(t *testing.T) {
+	lm := newTestLeapManager(config.ClockConfig{LeapSecFile: testLeapFile, LeapSecMode: LeapModeSmear})
+	leap := date(2030, time.January, 1, 0)
+
+	tests := []struct {
+		now        time.Time
+		correction time.Duration
+		smearing   bool
+	}{
+		{now: leap.Add(-13 * time.Hour), correction: 0},
+		{now: leap.Add(-6 * time.Hour), correction: -250 * time.Millisecond, smearing: true},
+		{now: leap.Add(6 * time.Hour), correction: 250 * time.Millisecond, smearing: true},
+		{now: leap.Add(12 * time.Hour), correction: 0},
+	}
+
+	for _, tt := range tests {
+		if err := lm.Update(tt.now); err != nil {
+			t.Fatal(err)
+		}
+		if correction := lm.OffsetCorrection(tt.now); correction != tt.correction {
+			t.Errorf("%v: correction = %v, want %v", tt.now, correction, tt.correction)
+		}
+		if status := lm.Status(tt.now); status.Smearing != tt.smearing {
+			t.Errorf("%v: smearing = %v, want %v", tt.now, status.Smearing, tt.smearing)
+		}
+		freq := lm.SmearFrequency(tt.now)
+		if want := -1e9 / (24 * time.Hour).Seconds(); tt.smearing && freq != want || !tt.smearing && freq != 0 {
+			t.Errorf("%v: smear frequency = %.1f ppb", tt.now, freq)
+		}
+	}
+}
+
+func TestLeapManagerKernel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// Ядро хранит статус; запись меняет только его
+	status := int32(unix.STA_PLL)
+	var writes int
+	var readErr, writeErr error
+	lm := NewLeapManager(config.ClockConfig{LeapSecFile: testLeapFile}, true, logger)
+	lm.adjtimex = func(timex *unix.Timex) (int, error) {
+		if timex.Modes == 0 {
+			if readErr != nil {
+				return 0, readErr
+			}
+			timex.Status = status
+			return 0, nil
+		}
+		if writeErr != nil {
+			return 0, writeErr
+		}
+		if timex.Modes != unix.ADJ_STATUS {
+			t.Fatalf("modes = %#x, want ADJ_STATUS", timex.Modes)
+		}
+		writes++
+		status = timex.Status
+		return 0, nil
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		armed  protocols.LeapIndicator
+		status int32
+		writes int
+	}{
+		{name: "insert", now: date(2029, time.December, 31, 12), armed: protocols.LeapInsert, status: unix.STA_INS, writes: 1},
+		{name: "already armed", now: date(2029, time.December, 31, 18), armed: protocols.LeapInsert, status: unix.STA_INS, writes: 1},
+		{name: "disarm after leap", now: date(2030, time.January, 1, 0), armed: protocols.LeapNone, writes: 2},
+		{name: "delete", now: date(2030, time.June, 30, 1), armed: protocols.LeapDelete, status: unix.STA_DEL, writes: 3},
+	}
+
+	for _, tt := range tests {
+		if err := lm.Update(tt.now); err != nil {
+			t.Fatalf("%s: Update() error = %v", tt.name, err)
+		}
+		if armed := lm.Status(tt.now).KernelArmed; armed != tt.armed.String() {
+			t.Errorf("%s: kernel armed = %s, want %s", tt.name, armed, tt.armed)
+		}
+		if got := status & (unix.STA_INS | unix.STA_DEL); got != tt.status {
+			t.Errorf("%s: leap status bits = %#x, want %#x", tt.name, got, tt.status)
+		}
+		if status&unix.STA_PLL == 0 {
+			t.Fatalf("%s: unrelated status bits cleared", tt.name)
+		}
+		if writes != tt.writes {
+			t.Errorf("%s: status writes = %d, want %d", tt.name, writes, tt.writes)
+		}
+	}
+
+	// Неудачная запись оставляет флаг прежним и повторяется при следующем обновлении
+	now := date(2030, time.July, 1, 1)
+	writeErr = unix.EPERM
+	if err := lm.Update(now); err == nil || !strings.Contains(err.Error(), "failed to set kernel leap status") {
+		t.Fatalf("Update() error = %v, want set status error", err)
+	}
+	if armed := lm.Status(now).KernelArmed; armed != protocols.LeapDelete.String() {
+		t.Errorf("kernel armed = %s after failed write, want delete", armed)
+	}
+
+	writeErr, readErr = nil, unix.EINVAL
+	if err := lm.Update(now); err == nil || !strings.Contains(err.Error(), "failed to read kernel status") {
+		t.Fatalf("Update() error = %v, want read status error", err)
+	}
+
+	readErr = nil
+	if err := lm.Update(now); err != nil {
+		t.Fatal(err)
+	}
+	if status&(unix.STA_INS|unix.STA_DEL) != 0 || lm.Status(now).KernelArmed != protocols.LeapNone.String() {
+		t.Errorf("status = %#x, want leap flags cleared on retry", status)
+	}
+}
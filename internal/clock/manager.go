@@ -10,102 +10,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/shiwatime/shiwatime/internal/config"
 	"github.com/shiwatime/shiwatime/internal/protocols"
-	"golang.org/x/sys/unix"
+	"github.com/shiwatime/shiwatime/internal/stability"
 )
 
-// ClockState представляет состояние системных часов
-type ClockState int
-
-const (
-	ClockStateUnknown ClockState = iota
-	ClockStateSynchronized
-	ClockStateUnsynchronized
-	ClockStateFreeRunning
-	ClockStateHoldover
-	ClockStateStepping
-	ClockStateSynchronizing
-)
-
-func (cs ClockState) String() string {
-	switch cs {
-	case ClockStateSynchronized:
-		return "synchronized"
-	case ClockStateUnsynchronized:
-		return "unsynchronized"
-	case ClockStateFreeRunning:
-		return "free_running"
-	case ClockStateHoldover:
-		return "holdover"
-	case ClockStateStepping:
-		return "stepping"
-	case ClockStateSynchronizing:
-		return "synchronizing"
-	default:
-		return "unknown"
-	}
-}
-
-// PIDController implements a PID controller for clock discipline
-type PIDController struct {
-	Kp, Ki, Kd       float64  // PID gains
-	integral         float64  // Integral term accumulator
-	prevError        float64  // Previous error for derivative
-	integralLimit    float64  // Integral windup limit
-	outputLimit      float64  // Output saturation limit
-	lastTime         time.Time
-}
-
-// NewPIDController creates a new PID controller
-func NewPIDController(kp, ki, kd, integralLimit, outputLimit float64) *PIDController {
-	return &PIDController{
-		Kp:            kp,
-		Ki:            ki, 
-		Kd:            kd,
-		integralLimit: integralLimit,
-		outputLimit:   outputLimit,
-		lastTime:      time.Now(),
-	}
-}
-
-// Update calculates PID controller output
-func (pid *PIDController) Update(error, dt float64) float64 {
-	// Proportional term
-	p := pid.Kp * error
-	
-	// Integral term with windup protection
-	pid.integral += error * dt
-	if pid.integral > pid.integralLimit {
-		pid.integral = pid.integralLimit
-	} else if pid.integral < -pid.integralLimit {
-		pid.integral = -pid.integralLimit
-	}
-	i := pid.Ki * pid.integral
-	
-	// Derivative term
-	d := 0.0
-	if dt > 0 {
-		d = pid.Kd * (error - pid.prevError) / dt
-	}
-	pid.prevError = error
-	
-	// Calculate output with saturation
-	output := p + i + d
-	if output > pid.outputLimit {
-		output = pid.outputLimit
-	} else if output < -pid.outputLimit {
-		output = -pid.outputLimit
-	}
-	
-	return output
-}
-
-// Reset resets the PID controller state
-func (pid *PIDController) Reset() {
-	pid.integral = 0
-	pid.prevError = 0
-	pid.lastTime = time.Now()
-}
-
 // Manager manages time sources and clock synchronization
 type Manager struct {
 	config        config.ShiwaTimeConfig
@@ -114,11 +21,26 @@ type Manager struct {
 	mu            sync.RWMutex
 	running       bool
 	sources       map[string]protocols.TimeSourceHandler
+	filters       map[string]SampleFilter // Фильтры измерений по источникам
 	selectedSource protocols.TimeSourceHandler // Currently selected time source
-	state         ClockState
 	
-	// PID controller state
-	pidController *PIDController
+	// Машина состояний часов и шина событий
+	states        *StateMachine
+	stateChanges  <-chan StateTransition // Подписка шины событий на переходы состояний
+	events        *EventBus
+	sourceUp      map[string]bool // Последнее известное подключение источников
+	gnssFix       map[string]bool // Наличие GNSS фикса у источников
+	leapPending   string
+	
+	// Выбор источников
+	selector      *SourceSelector
+	selection     map[string]SourceSelection
+	switching     *SwitchPolicy
+	tiers         map[string]SourceTier
+	
+	// Алгоритм дисциплины часов
+	discipline    Discipline
+	lastUpdate    time.Time
 	
 	// Statistics and filtering
 	offsetHistory    []time.Duration
@@ -129,6 +51,7 @@ type Manager struct {
 	// Clock discipline parameters
 	sigma            float64  // Allan deviation threshold
 	rho              float64  // Correlation threshold
+	stepPolicy       *StepPolicy
 	
 	// Frequency correction
 	freqOffset       float64  // Current frequency offset in ppb
@@ -137,36 +60,195 @@ type Manager struct {
 	// Kernel discipline
 	kernelSync       bool
 	
+	// Управляемые часы основного цикла и синхронизация часов между собой
+	target           ClockTarget
+	targets          []*TargetSync
+	
+	// Режим мониторинга (adjust_clock: false), nil если часы подстраиваются
+	monitor          *MonitorClock
+	
+	// Holdover
+	holdover         *HoldoverEstimator
+	lockThreshold    time.Duration
+	
+	// Температурная компенсация (nil, если датчик не настроен)
+	temperature      *TemperatureCompensator
+	
+	// Секунды координации
+	leap             *LeapManager
+	
+	// Сохранение частоты между перезапусками (nil, если не настроено)
+	drift            *DriftFile
+	
+	// Последнее достоверное время (nil, если last_good_file не задан)
+	lastGood         *LastGoodFile
+	
+	// Синхронизация RTC (nil, если не включена)
+	rtc              *RTCSync
+	
+	// Дисциплина ядра по PPS (hardpps)
+	kernelPPS        *KernelPPS
+	
+	// maxerror, esterror, STA_UNSYNC и TAI-UTC ядра; фиксированное TAI-UTC
+	// из ptp_tuning.phc.tai_offset (taiFixed)
+	kernelTimex      *KernelTimex
+	taiOffset        int
+	taiFixed         bool
+	
+	// Источник текущего времени (виртуальное время в симуляции)
+	now              func() time.Time
+	
+	// Время последних измерений источников и измерения, сделанные до step
+	sampleTimes      map[string]time.Time
+	staleSamples     map[string]time.Time
+	
+	// История измерений и выходов фильтров по источникам
+	histories        map[string]*SourceHistory
+	
+	// История остаточного смещения часов и маски MTIE для анализа стабильности
+	clockHistory     *SourceHistory
+	masks            []stability.Mask
+	
+	// Запись измерений и решений для shiwatime replay (nil, если не настроена)
+	recorder         *Recorder
+	recordStarted    bool
+	
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 // NewManager создает новый менеджер часов
 func NewManager(config config.ShiwaTimeConfig, logger *logrus.Logger) *Manager {
+	target, err := OpenClockTarget(config.Clock.Target)
+	if err != nil {
+		logger.WithError(err).Error("Failed to open clock target, disciplining system clock")
+		target = NewSystemClock()
+	}
+	
+	return newManager(config, target, time.Now, logger)
+}
+
+// newManager создает менеджер для заданных часов и источника времени
+func newManager(config config.ShiwaTimeConfig, target ClockTarget, now func() time.Time, logger *logrus.Logger) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	
-	// Initialize PID controller with default values
-	pidController := NewPIDController(
-		1.0,   // KP
-		0.1,   // KI  
-		0.01,  // KD
-		100.0, // Integrator limit
-		1000000, // 1 second output limit
-	)
+	clockConfig := config.Clock
 	
-	return &Manager{
+	discipline, err := NewDiscipline(clockConfig, logger)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid clock algorithm, falling back to PID")
+		discipline = NewPIDController(1.0, 0.1, 0.01, maxFrequencyPPB, maxFrequencyPPB)
+	}
+	
+	m := &Manager{
 		config:        config,
 		logger:        logger,
-		state:         ClockStateUnknown,
 		sources:       make(map[string]protocols.TimeSourceHandler),
-		pidController: pidController,
+		filters:       make(map[string]SampleFilter),
+		discipline:    discipline,
+		selector:      NewSourceSelector(clockConfig.Selection),
+		switching:     NewSwitchPolicy(clockConfig.Switch, logger),
+		tiers:         make(map[string]SourceTier),
+		events:        NewEventBus(logger),
+		sourceUp:      make(map[string]bool),
+		gnssFix:       make(map[string]bool),
+		leapPending:   protocols.LeapNone.String(),
+		selection:     make(map[string]SourceSelection),
 		filterWindow:  50,    // Default filter window
 		sigma:         1e-6,  // Default sigma threshold
 		rho:           0.8,   // Default rho threshold
+		stepPolicy:    NewStepPolicy(config.ClockSync, clockConfig, logger),
 		kernelSync:    true,  // Default kernel sync
+		holdover:      NewHoldoverEstimator(clockConfig.Holdover),
+		lockThreshold: defaultLockThreshold,
+		target:        target,
+		now:           now,
+		sampleTimes:   make(map[string]time.Time),
+		staleSamples:  make(map[string]time.Time),
+		histories:     make(map[string]*SourceHistory),
+		clockHistory:  NewSourceHistory(clockConfig.HistoryDepth),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
+	
+	masks, err := stability.ParseMasks(clockConfig.Stability.Masks)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid stability masks, MTIE is not checked")
+	}
+	m.masks = masks
+	
+	// Параметры из секции clock переопределяют значения по умолчанию
+	if clockConfig.FilterLength > 0 {
+		m.filterWindow = clockConfig.FilterLength
+	}
+	if clockConfig.SigmaThreshold > 0 {
+		m.sigma = clockConfig.SigmaThreshold
+	}
+	if clockConfig.RhoThreshold > 0 {
+		m.rho = clockConfig.RhoThreshold
+	}
+	if clockConfig.Holdover.LockThreshold > 0 {
+		m.lockThreshold = clockConfig.Holdover.LockThreshold
+	}
+	m.states = NewStateMachine(clockConfig.State, m.lockThreshold, now(), logger)
+	m.stateChanges, _ = m.states.Subscribe(stateHistorySize)
+	
+	// В режиме мониторинга решения дисциплины только записываются
+	if !config.ClockSync.AdjustClock {
+		m.monitor = NewMonitorClock(target, now, logger)
+		m.target = m.monitor
+		logger.WithField("target", target.Name()).Warn("adjust_clock is disabled, running in monitor mode without adjusting the clock")
+	}
+	
+	// Флаги секунды координации есть только у системных часов
+	_, systemTarget := m.target.(*SystemClock)
+	m.leap = NewLeapManager(clockConfig, m.kernelSync && systemTarget, logger)
+	m.kernelPPS = NewKernelPPS(clockConfig.KernelPPS && m.kernelSync && systemTarget, logger)
+	m.kernelTimex = NewKernelTimex(m.kernelSync && systemTarget, logger)
+	
+	taiOffset, taiFixed, err := ParseTAIOffset(config.PTPTuning.PHC.TAIOffset)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid tai_offset, using TAI offset from sources and leap seconds list")
+	}
+	m.taiOffset, m.taiFixed = taiOffset, taiFixed
+	
+	logger.WithField("target", target.Name()).Info("Clock target configured")
+	
+	if clockConfig.DriftFile != "" {
+		m.drift = NewDriftFile(clockConfig.DriftFile, clockConfig.DriftFileInterval)
+	}
+	if clockConfig.LastGoodFile != "" {
+		m.lastGood = NewLastGoodFile(clockConfig.LastGoodFile, clockConfig.LastGoodFileInterval)
+	}
+	
+	if clockConfig.Temperature.Sensor != "" {
+		m.temperature = NewTemperatureCompensator(clockConfig.Temperature, logger)
+		logger.WithField("sensor", clockConfig.Temperature.Sensor).Info("Temperature compensation enabled")
+	}
+	
+	if clockConfig.Recording.Path != "" {
+		recorder, err := NewRecorder(clockConfig.Recording, logger)
+		if err != nil {
+			logger.WithError(err).Error("Failed to open recording file, recording disabled")
+		} else {
+			m.recorder = recorder
+			logger.WithField("path", clockConfig.Recording.Path).Info("Recording samples and decisions")
+		}
+	}
+	
+	if config.SyncRTC.Enable {
+		if m.monitor != nil {
+			logger.Warn("RTC synchronization is disabled in monitor mode")
+		} else if systemTarget {
+			m.rtc = NewRTCSync(config.SyncRTC, m.kernelTimex, logger)
+		} else {
+			logger.WithField("target", target.Name()).Warn("RTC synchronization requires the system clock target, disabled")
+		}
+	}
+	
+	logger.WithField("algorithm", discipline.Name()).Info("Clock discipline configured")
+	
+	return m
 }
 
 // Start запускает менеджер часов
@@ -181,24 +263,39 @@ func (m *Manager) Start() error {
 	m.logger.Info("Starting clock manager")
 	m.running = true
 	
-	// Инициализируем источники времени (объединяем primary и secondary)
-	allSources := append(m.config.ClockSync.PrimaryClocks, m.config.ClockSync.SecondaryClocks...)
-	for i, sourceConfig := range allSources {
-		name := fmt.Sprintf("source_%d", i)
-		
-		handler, err := protocols.NewTimeSourceHandler(sourceConfig, m.logger)
-		if err != nil {
-			m.logger.WithError(err).Errorf("Failed to create handler for source %d", i)
-			continue
+	m.restoreFrequency()
+	m.restoreLastGood()
+	
+	// Инициализируем источники времени, сохраняя уровень каждого
+	for i, sourceConfig := range m.config.ClockSync.PrimaryClocks {
+		m.startSource(sourceConfig, SourceTierPrimary, i)
+	}
+	for i, sourceConfig := range m.config.ClockSync.SecondaryClocks {
+		m.startSource(sourceConfig, SourceTierSecondary, i)
+	}
+	
+	// Синхронизация часов между собой (как phc2sys)
+	if m.monitor != nil && len(m.config.Clock.Targets) > 0 {
+		m.logger.Warn("Clock targets are not synchronized in monitor mode")
+	}
+	for i, targetConfig := range m.config.Clock.Targets {
+		if m.monitor != nil {
+			break
 		}
-		
-		if err := handler.Start(); err != nil {
-			m.logger.WithError(err).Errorf("Failed to start source %d", i)
+		targetSync, err := NewTargetSync(targetConfig, m.config.Clock, m.logger)
+		if err != nil {
+			m.logger.WithError(err).Errorf("Failed to create clock target %d", i)
 			continue
 		}
-		
-		m.sources[name] = handler
-		m.logger.WithField("source", name).Info("Time source started")
+		m.targets = append(m.targets, targetSync)
+		go targetSync.Run(m.ctx)
+	}
+	
+	// RTC обновляется только от синхронизированных системных часов
+	if m.rtc != nil {
+		go m.rtc.Run(m.ctx, func() bool {
+			return m.GetState() == ClockStateLocked
+		})
 	}
 	
 	// Запускаем цикл синхронизации
@@ -207,6 +304,37 @@ func (m *Manager) Start() error {
 	return nil
 }
 
+// startSource создает и запускает источник времени уровня tier
+func (m *Manager) startSource(sourceConfig config.TimeSourceConfig, tier SourceTier, index int) {
+	name := config.SourceName(sourceConfig, string(tier), index)
+	logger := m.logger.WithFields(logrus.Fields{
+		"source": name,
+		"tier":   tier,
+	})
+	
+	handler, err := protocols.NewTimeSourceHandler(sourceConfig, m.logger)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create handler for source")
+		return
+	}
+	
+	filter, err := NewSampleFilter(sourceConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create sample filter for source")
+		return
+	}
+	
+	if err := handler.Start(); err != nil {
+		logger.WithError(err).Error("Failed to start source")
+		return
+	}
+	
+	m.sources[name] = handler
+	m.filters[name] = filter
+	m.tiers[name] = tier
+	logger.WithField("filter", filter.Name()).Info("Time source started")
+}
+
 // Stop останавливает менеджер часов
 func (m *Manager) Stop() error {
 	m.mu.Lock()
@@ -221,6 +349,11 @@ func (m *Manager) Stop() error {
 	m.cancel()
 	m.running = false
 	
+	m.saveFrequency(m.now())
+	if m.states.State() == ClockStateLocked {
+		m.saveLastGood(m.now())
+	}
+	
 	// Останавливаем все источники времени
 	for name, handler := range m.sources {
 		if err := handler.Stop(); err != nil {
@@ -228,14 +361,46 @@ func (m *Manager) Stop() error {
 		}
 	}
 	
+	for _, targetSync := range m.targets {
+		if err := targetSync.Close(); err != nil {
+			m.logger.WithError(err).WithField("target", targetSync.Name()).Error("Failed to close clock target")
+		}
+	}
+	m.targets = nil
+	
+	if m.recorder != nil {
+		if err := m.recorder.Close(); err != nil {
+			m.logger.WithError(err).Error("Failed to close recording file")
+		}
+	}
+	
 	return nil
 }
 
 // GetState возвращает текущее состояние часов
 func (m *Manager) GetState() ClockState {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.state
+	return m.states.State()
+}
+
+// GetStateStatus возвращает состояние машины состояний и критерии захвата
+func (m *Manager) GetStateStatus() StateStatus {
+	return m.states.Status(m.now())
+}
+
+// GetStateHistory возвращает журнал переходов машины состояний
+func (m *Manager) GetStateHistory() []StateTransition {
+	return m.states.History()
+}
+
+// SubscribeState подписывает на переходы машины состояний без опроса.
+// Канал ограничен buffer записями, функция отменяет подписку.
+func (m *Manager) SubscribeState(buffer int) (<-chan StateTransition, func()) {
+	return m.states.Subscribe(buffer)
+}
+
+// Events возвращает шину событий часов и источников
+func (m *Manager) Events() *EventBus {
+	return m.events
 }
 
 // GetSources возвращает источники времени
@@ -257,6 +422,127 @@ func (m *Manager) GetSelectedSource() protocols.TimeSourceHandler {
 	return m.selectedSource
 }
 
+// GetSelection возвращает статус каждого источника после алгоритма выбора
+func (m *Manager) GetSelection() map[string]SourceSelection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	selection := make(map[string]SourceSelection, len(m.selection))
+	for name, status := range m.selection {
+		selection[name] = status
+	}
+	return selection
+}
+
+// GetSourceHistory возвращает историю измерений источника в интервале
+// [from, to], усредненную по интервалам step (0 - без прореживания)
+func (m *Manager) GetSourceHistory(name string, from, to time.Time, step time.Duration) ([]SourceHistoryPoint, bool) {
+	m.mu.RLock()
+	_, exists := m.sources[name]
+	history := m.histories[name]
+	m.mu.RUnlock()
+	
+	if !exists {
+		return nil, false
+	}
+	if history == nil {
+		return []SourceHistoryPoint{}, true
+	}
+	return history.Query(from, to, step), true
+}
+
+// recordHistory добавляет измерение источника и выход его фильтра в историю
+func (m *Manager) recordHistory(name string, timestamp time.Time, info *protocols.TimeInfo, filtered FilterOutput) {
+	m.mu.Lock()
+	history, ok := m.histories[name]
+	if !ok {
+		history = NewSourceHistory(m.config.Clock.HistoryDepth)
+		m.histories[name] = history
+	}
+	m.mu.Unlock()
+	
+	history.Add(SourceHistoryPoint{
+		Timestamp:        timestamp,
+		Offset:           info.Offset,
+		Delay:            info.Delay,
+		Quality:          info.Quality,
+		FilterOffset:     filtered.Offset,
+		FilterDelay:      filtered.Delay,
+		FilterJitter:     filtered.Jitter,
+		FilterDispersion: filtered.Dispersion,
+	})
+}
+
+// GetStepHistory возвращает журнал шагов часов
+func (m *Manager) GetStepHistory() []StepRecord {
+	return m.stepPolicy.History()
+}
+
+// GetSwitchHistory возвращает журнал переключений системного источника
+func (m *Manager) GetSwitchHistory() []SwitchRecord {
+	return m.switching.History()
+}
+
+// GetTarget возвращает имя часов, которыми управляет основной цикл
+func (m *Manager) GetTarget() string {
+	return m.target.Name()
+}
+
+// GetTargets возвращает состояние синхронизации часов между собой
+func (m *Manager) GetTargets() []TargetStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	targets := make([]TargetStatus, 0, len(m.targets))
+	for _, targetSync := range m.targets {
+		targets = append(targets, targetSync.Status())
+	}
+	return targets
+}
+
+// GetMonitorStatus возвращает решения дисциплины в режиме мониторинга.
+// Второе значение false, если часы подстраиваются.
+func (m *Manager) GetMonitorStatus() (MonitorStatus, bool) {
+	if m.monitor == nil {
+		return MonitorStatus{}, false
+	}
+	return m.monitor.Status(), true
+}
+
+// GetAlgorithm возвращает имя текущего алгоритма дисциплины
+func (m *Manager) GetAlgorithm() string {
+	return m.discipline.Name()
+}
+
+// GetAdaptiveStatus возвращает состояние адаптивного контроллера,
+// если он выбран алгоритмом дисциплины
+func (m *Manager) GetAdaptiveStatus() (AdaptiveStatus, bool) {
+	adaptive, ok := m.discipline.(*AdaptiveDiscipline)
+	if !ok {
+		return AdaptiveStatus{}, false
+	}
+	return adaptive.Status(), true
+}
+
+// GetTemperatureStatus возвращает состояние температурной компенсации,
+// если датчик настроен
+func (m *Manager) GetTemperatureStatus() (TemperatureStatus, bool) {
+	if m.temperature == nil {
+		return TemperatureStatus{}, false
+	}
+	return m.temperature.Status(m.now()), true
+}
+
+// GetLoopStatus возвращает режим и постоянную времени контура, если
+// алгоритм дисциплины их сообщает
+func (m *Manager) GetLoopStatus() (LoopStatus, bool) {
+	provider, ok := m.discipline.(LoopStatusProvider)
+	if !ok {
+		return LoopStatus{}, false
+	}
+	return provider.LoopStatus(), true
+}
+
 // GetSourcesByPriority возвращает источники, разделенные на первичные и вторичные
 func (m *Manager) GetSourcesByPriority() (map[string]protocols.TimeSourceHandler, map[string]protocols.TimeSourceHandler) {
 	m.mu.RLock()
@@ -266,18 +552,27 @@ func (m *Manager) GetSourcesByPriority() (map[string]protocols.TimeSourceHandler
 	secondary := make(map[string]protocols.TimeSourceHandler)
 	
 	for name, handler := range m.sources {
-		config := handler.GetConfig()
-		// Use weight as priority indicator: higher weight = primary
-		if config.Weight >= 5 { // High weight sources (5+) are primary
-			primary[name] = handler
-		} else { // Lower weight sources (<5) are secondary
+		if m.tiers[name] == SourceTierSecondary {
 			secondary[name] = handler
+		} else {
+			primary[name] = handler
 		}
 	}
 	
 	return primary, secondary
 }
 
+// GetSourceTier возвращает уровень источника: primary или secondary
+func (m *Manager) GetSourceTier(name string) SourceTier {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	if m.tiers[name] == SourceTierSecondary {
+		return SourceTierSecondary
+	}
+	return SourceTierPrimary
+}
+
 // syncLoop основной цикл синхронизации
 func (m *Manager) syncLoop() {
 	ticker := time.NewTicker(time.Second)
@@ -297,23 +592,72 @@ func (m *Manager) syncLoop() {
 
 // synchronizeClock выполняет синхронизацию часов
 func (m *Manager) synchronizeClock() error {
-	source := m.selectBestSource()
-	if source == nil {
+	m.recordStart()
+	defer m.publishStateChanges()
+	result := m.selectSources()
+	
+	now := m.now()
+	if err := m.leap.Update(now); err != nil {
+		m.logger.WithError(err).Warn("Failed to update leap second status")
+	}
+	m.observeLeap(now)
+	
+	// PPS определяет только фазу секунды, номер секунды дает грубый источник
+	ppsSource := m.kernelPPSSource()
+	coarse := result != nil && result.Selected != ppsSource
+	coarseOffset := time.Duration(0)
+	if coarse {
+		coarseOffset = result.Offset
+	}
+	if err := m.kernelPPS.Update(ppsSource, coarse, coarseOffset); err != nil {
+		m.logger.WithError(err).Warn("Failed to update kernel PPS discipline")
+	}
+	
+	// Состояние ядра обновляется после отработки цикла, когда известно
+	// новое состояние часов
+	defer m.updateKernelTimex(result)
+	
+	if result == nil {
 		m.mu.Lock()
 		m.selectedSource = nil
-		m.state = ClockStateUnsynchronized
 		m.mu.Unlock()
-		return fmt.Errorf("no suitable time source available")
+		return m.runHoldover()
 	}
 	
 	// Update selected source
 	m.mu.Lock()
-	m.selectedSource = source
+	m.selectedSource = result.Handler
 	m.mu.Unlock()
 	
-	timeInfo, err := source.GetTimeInfo()
-	if err != nil {
-		return err
+	// Дисциплина работает по комбинированному смещению выживших источников
+	sample := *result.Info
+	timeInfo := &sample
+	timeInfo.Offset = result.Offset
+	timeInfo.Delay = result.Filter.Delay
+	if !result.Filter.Timestamp.IsZero() {
+		timeInfo.Timestamp = result.Filter.Timestamp
+	}
+	
+	// Во время размазывания секунды координации часы намеренно отличаются от UTC
+	timeInfo.Offset += m.leap.OffsetCorrection(now)
+	
+	// В режиме мониторинга смещение считается от виртуальных часов, к которым
+	// применены решения дисциплины
+	if m.monitor != nil {
+		measured := result.Filter.Timestamp
+		if measured.IsZero() {
+			measured = now
+		}
+		timeInfo.Offset -= m.monitor.Correction(measured)
+	}
+	
+	if m.holdover.Active() {
+		m.leaveHoldover(timeInfo.Offset)
+	}
+	
+	// Фильтр системного источника не выбрал нового измерения
+	if !result.Filter.Fresh {
+		return nil
 	}
 	
 	// Обновляем статистику
@@ -321,47 +665,353 @@ func (m *Manager) synchronizeClock() error {
 	
 	// Проверяем нужно ли делать step или adjustment
 	offset := timeInfo.Offset
-	stepThreshold := 500 * time.Millisecond // Default threshold
 	
-	if math.Abs(float64(offset)) > float64(stepThreshold) {
-		return m.stepClock(offset)
+	action, reason := m.stepPolicy.Decide(offset, m.stepEvidence(result, offset))
+	switch action {
+	case StepActionRefuse:
+		record := StepRecord{
+			Timestamp: m.now(),
+			Action:    action,
+			Offset:    offset,
+			Reason:    reason,
+			Source:    result.Selected,
+		}
+		m.stepPolicy.Record(record)
+		m.record(Record{
+			Type:       RecordAdjustment,
+			Time:       record.Timestamp,
+			Source:     result.Selected,
+			Adjustment: &RecordedAdjustment{Action: string(action), Offset: offset, Reason: reason},
+		})
+		m.events.Publish(Event{
+			Type:      EventStepRejected,
+			Timestamp: record.Timestamp,
+			Source:    result.Selected,
+			Message:   fmt.Sprintf("Clock step by %v rejected: %s", offset, reason),
+			Data:      record,
+		})
+		return fmt.Errorf("offset %v refused: %s", offset, reason)
+	case StepActionStep:
+		return m.stepClock(offset, reason, result.Selected)
 	}
 	
-	// Используем PID контроллер для плавной подстройки
-	return m.adjustClockPID(offset)
+	if reason != "" {
+		m.logger.WithFields(logrus.Fields{
+			"offset": offset,
+			"reason": reason,
+		}).Debug("Offset above step threshold, slewing")
+	}
+	
+	// Используем алгоритм дисциплины для плавной подстройки
+	return m.adjustClock(timeInfo, result.Filter.Jitter)
 }
 
-// selectBestSource выбирает лучший источник времени
-func (m *Manager) selectBestSource() protocols.TimeSourceHandler {
+// stepEvidence считает пригодные источники, смещения которых согласны с
+// комбинированным в пределах step_agreement, и время часов после шага
+func (m *Manager) stepEvidence(result *SelectionResult, offset time.Duration) StepEvidence {
+	agreement := m.config.Clock.StepAgreement
+	if agreement <= 0 {
+		agreement = defaultStepAgreement
+	}
+	
+	now := m.now()
+	evidence := StepEvidence{Target: m.clockTime(now).Add(offset)}
+	
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
-	var bestHandler protocols.TimeSourceHandler
-	var bestScore float64
+	for name, source := range result.Sources {
+		switch source.Status {
+		case SelectionSelected, SelectionCandidate, SelectionTruechimer, SelectionStandby:
+		default:
+			continue
+		}
+		if (source.Offset - result.Offset).Abs() > agreement {
+			continue
+		}
+		evidence.Agreeing++
+		if handler, ok := m.sources[name]; ok && handler.GetConfig().Trust {
+			evidence.Trusted = true
+		}
+	}
+	return evidence
+}
+
+// clockTime возвращает показание управляемых часов. В режиме мониторинга
+// это виртуальные часы, к которым применены решения дисциплины.
+func (m *Manager) clockTime(now time.Time) time.Time {
+	if m.monitor != nil {
+		return now.Add(m.monitor.Correction(now))
+	}
+	return now
+}
+
+// updateKernelTimex передает ядру границу ошибки выбранной цепочки
+// источников, флаг синхронизации и TAI-UTC
+func (m *Manager) updateKernelTimex(result *SelectionResult) {
+	now := m.now()
+	state := m.states.State()
+	// Пока часы не захвачены, их время недостоверно: STA_UNSYNC снимается
+	// только в locked и в holdover после захвата
+	synced := state == ClockStateLocked || state == ClockStateHoldover
+	
+	// Граница ошибки - root distance системного источника плюс остаточное
+	// смещение часов, оценка ошибки - джиттер фильтра и выбора
+	var maxError, estError, rootDistance time.Duration
+	switch {
+	case result != nil:
+		rootDistance = result.Sources[result.Selected].RootDistance
+		maxError = rootDistance + time.Duration(math.Abs(float64(result.Offset)))
+		estError = time.Duration(math.Hypot(float64(result.Filter.Jitter), float64(result.Jitter)))
+	case state == ClockStateHoldover:
+		// В holdover к последней root distance добавляется накопленная ошибка модели
+		maxError = m.kernelTimex.Status().RootDistance + m.holdover.Status(now).EstimatedError
+		estError = m.kernelTimex.Status().EstError
+	}
+	
+	taiOffset, taiSource := m.taiOffset, "config"
+	if !m.taiFixed {
+		taiOffset, taiSource = m.leap.TAIOffsetSource(now)
+	}
+	
+	if err := m.kernelTimex.Update(now, synced, maxError, estError, rootDistance, taiOffset, taiSource); err != nil {
+		m.logger.WithError(err).Warn("Failed to update kernel time status")
+	}
+}
+
+// selectSources опрашивает источники и выбирает системный источник
+// алгоритмом пересечения, кластеризации и комбинирования
+func (m *Manager) selectSources() *SelectionResult {
+	m.mu.RLock()
+	samples := make([]SourceSample, 0, len(m.sources))
+	filters := make([]SampleFilter, 0, len(m.sources))
+	for name, handler := range m.sources {
+		samples = append(samples, SourceSample{Name: name, Tier: m.tiers[name], Handler: handler})
+		filters = append(filters, m.filters[name])
+	}
+	m.mu.RUnlock()
 	
-	for _, handler := range m.sources {
-		status := handler.GetStatus()
+	// Источники опрашиваются без блокировки: NTP запрос идет по сети
+	for i := range samples {
+		status := samples[i].Handler.GetStatus()
+		m.observeSource(samples[i].Name, samples[i].Handler, status.Connected)
 		if !status.Connected {
 			continue
 		}
 		
-		timeInfo, err := handler.GetTimeInfo()
+		timeInfo, err := samples[i].Handler.GetTimeInfo()
 		if err != nil {
 			continue
 		}
 		
-		// Простой scoring algorithm
-		score := float64(timeInfo.Quality)
-		config := handler.GetConfig()
-		score *= float64(config.Weight)
+		// Источник сообщает, что сам не синхронизирован (LI = 3)
+		if timeInfo.Leap == protocols.LeapAlarm {
+			continue
+		}
+		
+		timestamp := timeInfo.Timestamp
+		if timestamp.IsZero() {
+			timestamp = m.now()
+		}
+		
+		// Измерение сделано до step и содержит старое смещение
+		m.mu.Lock()
+		stale, ok := m.staleSamples[samples[i].Name]
+		if ok && stale.Equal(timestamp) {
+			m.mu.Unlock()
+			continue
+		}
+		delete(m.staleSamples, samples[i].Name)
+		previous, seen := m.sampleTimes[samples[i].Name]
+		m.sampleTimes[samples[i].Name] = timestamp
+		m.mu.Unlock()
+		
+		samples[i].Info = timeInfo
+		samples[i].Filter = filters[i].Add(FilterSample{
+			Offset:    timeInfo.Offset,
+			Delay:     timeInfo.Delay,
+			Precision: precisionToDuration(timeInfo.Precision),
+			Timestamp: timestamp,
+		})
 		
-		if score > bestScore {
-			bestScore = score
-			bestHandler = handler
+		// Источник может вернуть то же измерение при следующем опросе
+		if !seen || !previous.Equal(timestamp) {
+			m.recordHistory(samples[i].Name, timestamp, timeInfo, samples[i].Filter)
+			m.recordSample(samples[i], timestamp)
 		}
 	}
 	
-	return bestHandler
+	for _, sample := range samples {
+		m.leap.Observe(sample.Name, sample.Info)
+	}
+	
+	// Решение выбора пишется в запись после снятия m.mu, чтобы файловый
+	// ввод-вывод не задерживал другие обращения к менеджеру
+	var selection *Record
+	defer func() {
+		if selection != nil {
+			m.record(*selection)
+		}
+	}()
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	result := m.selector.Select(samples)
+	m.selection = result.Sources
+	
+	// Гистерезис: системный источник меняется не при каждом пересчете метрик
+	previous := m.switching.Current()
+	peer := m.switching.Choose(result, m.now())
+	if current := m.switching.Current(); current != previous {
+		m.publishSwitch()
+	}
+	if peer == "" {
+		result.clearPeer()
+		selection = m.selectionRecord(result, "")
+		return nil
+	}
+	result.SetPeer(peer)
+	selection = m.selectionRecord(result, peer)
+	
+	m.logger.WithFields(logrus.Fields{
+		"selected":  result.Selected,
+		"survivors": result.Survivors,
+		"offset":    result.Offset,
+		"jitter":    result.Jitter,
+	}).Debug("Source selection completed")
+	
+	return result
+}
+
+// observeSource публикует события подключения источника и потери GNSS фикса
+func (m *Manager) observeSource(name string, handler protocols.TimeSourceHandler, connected bool) {
+	now := m.now()
+	
+	m.mu.Lock()
+	wasUp := m.sourceUp[name]
+	m.sourceUp[name] = connected
+	m.mu.Unlock()
+	
+	if connected != wasUp {
+		m.record(Record{Type: RecordSource, Time: now, Source: name, Connected: &connected})
+	}
+	
+	switch {
+	case connected && !wasUp:
+		m.events.Publish(Event{
+			Type:      EventSourceUp,
+			Timestamp: now,
+			Source:    name,
+			Message:   fmt.Sprintf("Time source %s connected", name),
+		})
+	case !connected && wasUp:
+		m.events.Publish(Event{
+			Type:      EventSourceDown,
+			Timestamp: now,
+			Source:    name,
+			Message:   fmt.Sprintf("Time source %s disconnected", name),
+		})
+	}
+	
+	if !connected {
+		return
+	}
+	
+	// Источники без GNSS всегда сообщают FixType 0 и события не порождают
+	gnss := handler.GetGNSSInfo()
+	fix := gnss.FixType > 0
+	
+	m.mu.Lock()
+	hadFix := m.gnssFix[name]
+	m.gnssFix[name] = fix
+	m.mu.Unlock()
+	
+	if hadFix && !fix {
+		m.events.Publish(Event{
+			Type:      EventGNSSFixLost,
+			Timestamp: now,
+			Source:    name,
+			Message:   fmt.Sprintf("GNSS receiver %s lost fix", name),
+			Data:      gnss,
+		})
+	}
+}
+
+// publishSwitch публикует смену системного источника. Вызывается под m.mu.
+func (m *Manager) publishSwitch() {
+	history := m.switching.History()
+	if len(history) == 0 {
+		return
+	}
+	record := history[len(history)-1]
+	
+	message := fmt.Sprintf("System source %s selected: %s", record.To, record.Reason)
+	if record.To == "" {
+		message = fmt.Sprintf("System source %s lost: %s", record.From, record.Reason)
+	}
+	
+	m.events.Publish(Event{
+		Type:      EventSourceSelected,
+		Timestamp: record.Timestamp,
+		Source:    record.To,
+		Message:   message,
+		Data:      record,
+	})
+}
+
+// publishStateChanges публикует в шину событий переходы машины состояний,
+// накопленные за цикл синхронизации
+func (m *Manager) publishStateChanges() {
+	for {
+		select {
+		case transition := <-m.stateChanges:
+			m.events.Publish(Event{
+				Type:      EventStateChange,
+				Timestamp: transition.Timestamp,
+				Message:   fmt.Sprintf("Clock state changed from %s to %s: %s", transition.From, transition.To, transition.Reason),
+				Data:      transition,
+			})
+		default:
+			return
+		}
+	}
+}
+
+// observeLeap публикует появление ожидаемой секунды координации
+func (m *Manager) observeLeap(now time.Time) {
+	status := m.leap.Status(now)
+	
+	m.mu.Lock()
+	previous := m.leapPending
+	m.leapPending = status.Pending
+	m.mu.Unlock()
+	
+	if status.Pending == previous || status.Pending == protocols.LeapNone.String() {
+		return
+	}
+	
+	m.events.Publish(Event{
+		Type:      EventLeapArmed,
+		Timestamp: now,
+		Message:   fmt.Sprintf("Leap second %s armed for %s", status.Pending, status.LeapTime.Format(time.RFC3339)),
+		Data:      status,
+	})
+}
+
+// kernelPPSSource возвращает имя подключенного PPS источника, привязанного
+// к hardpps ядра, или пустую строку
+func (m *Manager) kernelPPSSource() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	for name, handler := range m.sources {
+		pps, ok := handler.(protocols.KernelPPSSource)
+		if ok && pps.KernelPPSBound() && handler.GetStatus().Connected {
+			return name
+		}
+	}
+	return ""
 }
 
 // updateStatistics обновляет статистику времени
@@ -390,102 +1040,447 @@ func (m *Manager) updateStatistics(info *protocols.TimeInfo) {
 	if len(m.jitterHistory) > m.filterWindow {
 		m.jitterHistory = m.jitterHistory[1:]
 	}
+	
+	m.clockHistory.Add(SourceHistoryPoint{
+		Timestamp: m.now(),
+		Offset:    info.Offset,
+		Delay:     info.Delay,
+		Quality:   info.Quality,
+	})
 }
 
-// stepClock делает step системных часов
-func (m *Manager) stepClock(offset time.Duration) error {
-	m.logger.WithField("offset", offset).Info("Stepping system clock")
+// stepClock делает step системных часов и записывает его в журнал шагов
+func (m *Manager) stepClock(offset time.Duration, reason, source string) error {
+	record := StepRecord{
+		Timestamp: m.now(),
+		Action:    StepActionStep,
+		Offset:    offset,
+		Reason:    reason,
+		Source:    source,
+		Monitor:   m.monitor != nil,
+	}
 	
 	if m.kernelSync {
-		// Use adjtimex to step the clock
-		var timex unix.Timex
-		timex.Modes = unix.ADJ_SETOFFSET
-		
-		if offset >= 0 {
-			timex.Time.Sec = int64(offset / time.Second)
-			timex.Time.Usec = int64((offset % time.Second) / time.Microsecond)
-		} else {
-			negOffset := -offset
-			timex.Time.Sec = -int64(negOffset / time.Second)
-			timex.Time.Usec = -int64((negOffset % time.Second) / time.Microsecond)
-		}
-		
-		_, err := unix.Adjtimex(&timex)
-		if err != nil {
-			return fmt.Errorf("failed to step clock: %w", err)
+		if err := m.target.Step(offset); err != nil {
+			record.Error = err.Error()
+			m.stepPolicy.Record(record)
+			return err
 		}
 	}
 	
-	m.state = ClockStateStepping
-	m.pidController.Reset() // Reset PID after step
+	m.stepPolicy.Record(record)
+	m.record(Record{
+		Type:       RecordAdjustment,
+		Time:       record.Timestamp,
+		Source:     source,
+		Adjustment: &RecordedAdjustment{Action: string(StepActionStep), Offset: offset, Reason: reason},
+	})
+	message := fmt.Sprintf("Clock stepped by %v: %s", offset, reason)
+	if record.Monitor {
+		message = fmt.Sprintf("Clock would be stepped by %v: %s", offset, reason)
+	}
+	m.events.Publish(Event{
+		Type:      EventStep,
+		Timestamp: record.Timestamp,
+		Source:    source,
+		Message:   message,
+		Data:      record,
+	})
+	
+	m.states.Step(record.Timestamp, offset)
+	m.discipline.Reset() // Reset discipline after step
+	m.lastUpdate = time.Time{}
+	
+	// Измерения до step содержат старое смещение. В режиме мониторинга
+	// шаг учтен в виртуальной поправке, и измерения остаются верными.
+	if m.monitor != nil {
+		return nil
+	}
+	m.mu.Lock()
+	for _, filter := range m.filters {
+		filter.Reset()
+	}
+	for name, timestamp := range m.sampleTimes {
+		m.staleSamples[name] = timestamp
+	}
+	m.mu.Unlock()
 	
 	return nil
 }
 
-// adjustClockPID подстраивает часы используя PID контроллер
-func (m *Manager) adjustClockPID(offset time.Duration) error {
-	now := time.Now()
-	dt := now.Sub(m.pidController.lastTime).Seconds()
-	m.pidController.lastTime = now
-	
-	if dt <= 0 {
-		return nil
+// adjustClock подстраивает частоту часов выбранным алгоритмом дисциплины
+func (m *Manager) adjustClock(timeInfo *protocols.TimeInfo, jitter time.Duration) error {
+	now := m.now()
+	interval := time.Duration(0)
+	if !m.lastUpdate.IsZero() {
+		interval = now.Sub(m.lastUpdate)
+	}
+	m.lastUpdate = now
+	
+	input := DisciplineInput{
+		Offset:    timeInfo.Offset,
+		Delay:     timeInfo.Delay,
+		Jitter:    jitter,
+		Quality:   timeInfo.Quality,
+		Interval:  interval,
+		Timestamp: now,
+		Measured:  timeInfo.Timestamp,
 	}
 	
-	// Convert offset to seconds for PID calculation
-	errorSeconds := float64(offset) / float64(time.Second)
+	// Calculate frequency adjustment in ppb
+	freqAdjustment := m.discipline.Sample(input)
 	
-	// Calculate PID output (frequency adjustment in ppb)
-	freqAdjustment := m.pidController.Update(errorSeconds, dt)
+	// Температурная поправка добавляется к частоте дисциплины, поэтому
+	// дисциплина и модель holdover ведут только ее остаток
+	compensation := m.temperatureCorrection(now)
+	applied := freqAdjustment + compensation
 	
-	// Apply frequency adjustment
-	if m.kernelSync {
-		err := m.adjustKernelFrequency(freqAdjustment)
+	if m.kernelPPS.Active() {
+		// Частоту подстраивает ядро по PPS, модель holdover учится на ней
+		freq, err := m.target.Frequency()
 		if err != nil {
 			return err
 		}
+		freqAdjustment = freq - compensation
+		applied = freq
+	} else if m.kernelSync {
+		// Размазывание секунды координации добавляется поверх частоты
+		// дисциплины и не попадает в модель holdover
+		applied = freqAdjustment + compensation + m.leap.SmearFrequency(now)
+		if err := m.adjustKernelFrequency(applied); err != nil {
+			return err
+		}
+	}
+	m.record(Record{
+		Type:       RecordAdjustment,
+		Time:       now,
+		Adjustment: &RecordedAdjustment{Action: "slew", Offset: timeInfo.Offset, Frequency: applied},
+	})
+	
+	// Пока часы захвачены, обучаем модель частоты для holdover
+	locked := math.Abs(float64(timeInfo.Offset)) <= float64(m.lockThreshold)
+	if locked {
+		m.holdover.Learn(now, freqAdjustment, timeInfo.Offset)
+		if m.temperature != nil {
+			m.temperature.Learn(now, freqAdjustment+compensation)
+		}
+		if m.drift != nil && m.drift.Due(now) {
+			m.saveFrequency(now)
+		}
+		if m.lastGood != nil && m.lastGood.Due(now) && m.states.State() == ClockStateLocked {
+			m.saveLastGood(now)
+		}
 	}
 	
-	m.freqOffset = freqAdjustment
-	m.state = ClockStateSynchronizing
+	m.mu.Lock()
+	m.freqOffset = freqAdjustment + compensation
+	m.freqDrift = m.holdover.Drift()
+	m.mu.Unlock()
+	
+	m.states.Sample(now, timeInfo.Offset)
 	
 	m.logger.WithFields(logrus.Fields{
-		"offset":           offset,
+		"algorithm":        m.discipline.Name(),
+		"offset":           timeInfo.Offset,
 		"freq_adjustment":  freqAdjustment,
-		"error_seconds":    errorSeconds,
-		"dt":               dt,
-	}).Debug("PID clock adjustment")
+		"interval":         interval,
+	}).Debug("Clock frequency adjustment")
 	
 	return nil
 }
 
-// adjustKernelFrequency подстраивает частоту ядра
-func (m *Manager) adjustKernelFrequency(ppb float64) error {
-	var timex unix.Timex
-	timex.Modes = unix.ADJ_FREQUENCY
+// runHoldover удерживает частоту часов по выученной модели, когда нет
+// ни одного пригодного источника
+func (m *Manager) runHoldover() error {
+	now := m.now()
+	
+	if m.states.State() != ClockStateHoldover {
+		// Модель не обучена, часы не были захвачены или holdover уже исчерпан
+		if m.states.Lost(now, m.holdover.Ready()) != ClockStateHoldover {
+			return fmt.Errorf("no suitable time source available")
+		}
+		m.holdover.Enter(now)
+		m.logger.WithFields(logrus.Fields{
+			"frequency": m.holdover.Frequency(now),
+			"drift":     m.holdover.Drift(),
+		}).Warn("All time sources lost, entering holdover")
+	}
 	
-	// Convert ppb to kernel frequency units (2^-16 ppm)
-	timex.Freq = int64(ppb * 65536 / 1000000)
+	status := m.holdover.Status(now)
+	if status.Expired {
+		m.logger.WithFields(logrus.Fields{
+			"duration":        status.Duration,
+			"estimated_error": status.EstimatedError,
+			"max_duration":    status.MaxDuration,
+			"max_error":       status.MaxError,
+		}).Error("Holdover budget exhausted, clock is free running")
+		
+		m.holdover.Expire(now)
+		m.states.Expire(now, status.EstimatedError)
+		return fmt.Errorf("holdover expired after %v", status.Duration)
+	}
 	
-	_, err := unix.Adjtimex(&timex)
-	if err != nil {
-		return fmt.Errorf("failed to adjust kernel frequency: %w", err)
+	// Модель holdover не знает о температуре, поправка по текущей
+	// температуре продолжает действовать
+	freq := m.holdover.Frequency(now) + m.temperatureCorrection(now)
+	if m.kernelSync && !m.kernelPPS.Active() {
+		applied := freq + m.leap.SmearFrequency(now)
+		if err := m.adjustKernelFrequency(applied); err != nil {
+			return err
+		}
+		m.record(Record{
+			Type:       RecordAdjustment,
+			Time:       now,
+			Adjustment: &RecordedAdjustment{Action: "holdover", Frequency: applied},
+		})
 	}
 	
+	m.mu.Lock()
+	m.freqOffset = freq
+	m.mu.Unlock()
+	
+	m.logger.WithFields(logrus.Fields{
+		"frequency":       freq,
+		"duration":        status.Duration,
+		"estimated_error": status.EstimatedError,
+	}).Debug("Holdover frequency applied")
+	
 	return nil
 }
 
+// leaveHoldover завершает holdover при появлении источника и сравнивает
+// оценку накопленной ошибки с фактическим смещением
+func (m *Manager) leaveHoldover(offset time.Duration) {
+	duration, estimated := m.holdover.Exit(m.now())
+	
+	m.logger.WithFields(logrus.Fields{
+		"duration":        duration,
+		"estimated_error": estimated,
+		"actual_offset":   offset,
+	}).Info("Time source recovered, leaving holdover")
+}
+
+// restoreFrequency восстанавливает частоту из drift файла, чтобы после
+// перезапуска часы не уходили до повторного захвата
+func (m *Manager) restoreFrequency() {
+	if m.drift == nil {
+		return
+	}
+	
+	freq, freqErr, err := m.drift.Load()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to restore frequency from drift file")
+		return
+	}
+	
+	if m.kernelSync {
+		if err := m.adjustKernelFrequency(freq); err != nil {
+			m.logger.WithError(err).Warn("Failed to apply restored frequency")
+			return
+		}
+	}
+	if setter, ok := m.discipline.(FrequencySetter); ok {
+		setter.SetFrequency(freq)
+	}
+	m.freqOffset = freq
+	
+	m.logger.WithFields(logrus.Fields{
+		"file":            m.config.Clock.DriftFile,
+		"frequency":       freq,
+		"frequency_error": freqErr,
+	}).Info("Frequency restored from drift file")
+}
+
+// saveFrequency сохраняет выученную частоту в drift файл, если модель обучена
+func (m *Manager) saveFrequency(now time.Time) {
+	if m.drift == nil || !m.holdover.Ready() {
+		return
+	}
+	
+	freq, freqErr := m.holdover.Model()
+	if err := m.drift.Save(freq, freqErr, now); err != nil {
+		m.logger.WithError(err).Warn("Failed to save drift file")
+		return
+	}
+	
+	m.logger.WithFields(logrus.Fields{
+		"frequency":       freq,
+		"frequency_error": freqErr,
+	}).Debug("Frequency saved to drift file")
+}
+
+// restoreLastGood читает последнее достоверное время, раньше которого
+// часы не переводятся
+func (m *Manager) restoreLastGood() {
+	if m.lastGood == nil {
+		return
+	}
+	
+	lastGood, err := m.lastGood.Load()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to restore last good time")
+		return
+	}
+	m.stepPolicy.SetLastGood(lastGood)
+	
+	m.logger.WithFields(logrus.Fields{
+		"file": m.config.Clock.LastGoodFile,
+		"time": lastGood,
+	}).Info("Last good time restored, clock will not be stepped before it")
+}
+
+// saveLastGood сохраняет время захваченных часов как последнее достоверное
+func (m *Manager) saveLastGood(now time.Time) {
+	if m.lastGood == nil {
+		return
+	}
+	
+	lastGood := m.clockTime(now)
+	if err := m.lastGood.Save(lastGood); err != nil {
+		m.logger.WithError(err).Warn("Failed to save last good time")
+		return
+	}
+	m.stepPolicy.SetLastGood(lastGood)
+}
+
+// recordStart пишет состояние менеджера перед первым циклом записи
+func (m *Manager) recordStart() {
+	if m.recorder == nil || m.recordStarted {
+		return
+	}
+	m.recordStarted = true
+	
+	m.mu.RLock()
+	freq := m.freqOffset
+	m.mu.RUnlock()
+	
+	m.record(Record{
+		Type: RecordStart,
+		Time: m.now(),
+		Start: &RecordedStart{
+			Algorithm: m.discipline.Name(),
+			Monitor:   m.monitor != nil,
+			Frequency: freq,
+		},
+	})
+}
+
+// recordSample пишет новое измерение источника
+func (m *Manager) recordSample(sample SourceSample, timestamp time.Time) {
+	if m.recorder == nil {
+		return
+	}
+	
+	info := sample.Info
+	m.record(Record{
+		Type:   RecordSample,
+		Time:   m.now(),
+		Source: sample.Name,
+		Sample: &RecordedSample{
+			Type:           sample.Handler.GetConfig().Type,
+			Tier:           sample.Tier,
+			Timestamp:      timestamp,
+			Offset:         info.Offset,
+			Delay:          info.Delay,
+			Quality:        info.Quality,
+			Stratum:        info.Stratum,
+			Precision:      info.Precision,
+			RootDelay:      info.RootDelay,
+			RootDispersion: info.RootDispersion,
+			Leap:           info.Leap,
+			UTCOffset:      info.UTCOffset,
+		},
+	})
+}
+
+// selectionRecord возвращает запись решения выбора источников или nil,
+// если запись выключена. Вызывается под m.mu.
+func (m *Manager) selectionRecord(result *SelectionResult, peer string) *Record {
+	if m.recorder == nil {
+		return nil
+	}
+	
+	selection := &RecordedSelection{
+		Selected: peer,
+		Status:   make(map[string]SelectionStatus, len(result.Sources)),
+	}
+	for name, source := range result.Sources {
+		selection.Status[name] = source.Status
+	}
+	if peer != "" {
+		selection.Offset = result.Offset
+		selection.Jitter = result.Jitter
+		selection.Survivors = result.Survivors
+	}
+	return &Record{Type: RecordSelection, Time: m.now(), Selection: selection}
+}
+
+// record пишет запись, если запись включена
+func (m *Manager) record(record Record) {
+	if m.recorder != nil {
+		m.recorder.Write(record)
+	}
+}
+
+// setFrequency задает поправку частоты часов и оценку частоты дисциплины,
+// как после восстановления из drift файла
+func (m *Manager) setFrequency(ppb float64) {
+	_ = m.target.AdjustFrequency(ppb)
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if setter, ok := m.discipline.(FrequencySetter); ok {
+		setter.SetFrequency(ppb)
+	}
+	m.freqOffset = ppb
+}
+
+// temperatureCorrection читает датчик температуры, если подошел период
+// чтения, и возвращает упреждающую поправку частоты
+func (m *Manager) temperatureCorrection(now time.Time) float64 {
+	if m.temperature == nil {
+		return 0
+	}
+	if temperature, ok := m.temperature.Update(now); ok {
+		m.record(Record{Type: RecordTemperature, Time: now, Temperature: &temperature})
+	}
+	return m.temperature.Correction(now)
+}
+
+// adjustKernelFrequency подстраивает частоту управляемых часов
+func (m *Manager) adjustKernelFrequency(ppb float64) error {
+	return m.target.AdjustFrequency(ppb)
+}
+
 // GetStatistics возвращает статистику часов
 func (m *Manager) GetStatistics() ClockStatistics {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
+	now := m.now()
 	stats := ClockStatistics{
-		State:         m.state,
+		State:         m.states.State(),
 		FreqOffset:    m.freqOffset,
 		FreqDrift:     m.freqDrift,
 		KernelSync:    m.kernelSync,
 		SourceCount:   len(m.sources),
+		Holdover:      m.holdover.Status(now),
+		Leap:          m.leap.Status(now),
+	}
+	
+	if m.drift != nil {
+		stats.Drift = m.drift.Status()
+	}
+	if m.lastGood != nil {
+		stats.LastGood = m.lastGood.Status()
+	}
+	if m.rtc != nil {
+		stats.RTC = m.rtc.Status()
+	}
+	stats.KernelPPS = m.kernelPPS.Status()
+	stats.Kernel = m.kernelTimex.Status()
+	if m.monitor != nil {
+		stats.Monitor = m.monitor.Status()
 	}
 	
 	if len(m.offsetHistory) > 0 {
@@ -502,8 +1497,10 @@ func (m *Manager) GetStatistics() ClockStatistics {
 		stats.MeanJitter = m.calculateMean(m.jitterHistory)
 	}
 	
-	stats.AllanDeviation = m.calculateAllanDeviation()
-	stats.Stable = len(m.offsetHistory) > 10 && stats.AllanDeviation < m.sigma
+	// ADEV остаточного смещения на наименьшем τ
+	clockStability := analyzeHistory(m.clockHistory, m.lastStep(), nil)
+	stats.AllanDeviation = clockStability.ADEV()
+	stats.Stable = clockStability.Samples > 10 && len(clockStability.Points) > 0 && stats.AllanDeviation < m.sigma
 	
 	return stats
 }
@@ -549,27 +1546,6 @@ func (m *Manager) calculateMin(values []time.Duration) time.Duration {
 	return min
 }
 
-func (m *Manager) calculateAllanDeviation() float64 {
-	if len(m.offsetHistory) < 3 {
-		return 0
-	}
-	
-	n := len(m.offsetHistory)
-	sum := 0.0
-	
-	for i := 0; i < n-2; i++ {
-		x1 := float64(m.offsetHistory[i])
-		x2 := float64(m.offsetHistory[i+1])
-		x3 := float64(m.offsetHistory[i+2])
-		
-		diff := (x3 - 2*x2 + x1) / 2.0
-		sum += diff * diff
-	}
-	
-	variance := sum / float64(n-2)
-	return math.Sqrt(variance / 2.0)
-}
-
 // ClockStatistics содержит статистику работы часов
 type ClockStatistics struct {
 	State           ClockState    `json:"state"`
@@ -586,5 +1562,29 @@ type ClockStatistics struct {
 	MeanJitter      time.Duration `json:"mean_jitter"`
 	AllanDeviation  float64       `json:"allan_deviation"`
 	Stable          bool          `json:"stable"`
+	
+	// Holdover
+	Holdover        HoldoverStatus `json:"holdover"`
+	
+	// Leap seconds
+	Leap            LeapStatus     `json:"leap"`
+	
+	// Drift file
+	Drift           DriftStatus    `json:"drift"`
+	
+	// Last good time file
+	LastGood        LastGoodStatus `json:"last_good"`
+	
+	// RTC
+	RTC             RTCStatus      `json:"rtc"`
+	
+	// Kernel PPS
+	KernelPPS       KernelPPSStatus `json:"kernel_pps"`
+	
+	// maxerror, esterror, STA_UNSYNC и TAI-UTC ядра
+	Kernel          KernelTimexStatus `json:"kernel"`
+	
+	// Режим мониторинга
+	Monitor         MonitorStatus   `json:"monitor"`
 }
 
@@ -603,6 +603,14 @@ func (bo *BayesianOptimizer) Update(input *OptimizationInput, output *Optimizati
 // GaussianProcess представляет гауссовский процесс
 type GaussianProcess struct {
 	mu sync.RWMutex
+	
+	// Обученная модель (Fit): точки, разложение Холецкого матрицы ядра,
+	// веса и нормировка значений
+	points [][]float64
+	chol   *mat.Cholesky
+	alpha  *mat.VecDense
+	mean   float64
+	scale  float64
 }
 
 // NewGaussianProcess создает новый гауссовский процесс
@@ -0,0 +1,423 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// Число случайных кандидатов, среди которых байесовский оптимизатор
+	// выбирает точку с максимальным ожидаемым улучшением
+	bayesianCandidates = 512
+
+	gpLengthScale = 0.25 // Масштаб ядра в нормированном пространстве параметров
+	gpNoise       = 1e-4 // Шум наблюдений (симуляция почти детерминирована)
+	eiExploration = 0.01 // Запас ξ ожидаемого улучшения
+)
+
+// ParameterRange диапазон параметра поиска. Диапазон с Min == Max
+// фиксирует параметр, Log включает поиск в логарифмическом масштабе.
+type ParameterRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Log bool    `json:"log"`
+}
+
+// ParameterSpace пространство поиска параметров дисциплины
+type ParameterSpace struct {
+	KP           ParameterRange `json:"kp"`
+	KI           ParameterRange `json:"ki"`
+	KD           ParameterRange `json:"kd"`
+	FilterLength ParameterRange `json:"filter_length"`
+}
+
+// DefaultParameterSpace возвращает пространство поиска для алгоритма
+// дисциплины. У PID и PI ищутся коэффициенты, у Калмана - усиление фазы,
+// у остальных алгоритмов - только длина фильтра измерений.
+func DefaultParameterSpace(algorithm string) ParameterSpace {
+	space := ParameterSpace{FilterLength: ParameterRange{Min: 1, Max: 32}}
+	switch strings.ToLower(algorithm) {
+	case "", "pid":
+		space.KP = ParameterRange{Min: 0.005, Max: 1, Log: true}
+		space.KI = ParameterRange{Min: 0.00001, Max: 0.25, Log: true}
+		space.KD = ParameterRange{Min: 0, Max: 0.5}
+	case "pi":
+		space.KP = ParameterRange{Min: 0.005, Max: 1, Log: true}
+		space.KI = ParameterRange{Min: 0.00001, Max: 0.25, Log: true}
+	case "kalman":
+		space.KP = ParameterRange{Min: 0.05, Max: 1, Log: true}
+	}
+	return space
+}
+
+// ranges возвращает диапазоны в порядке координат нормированного вектора
+func (s ParameterSpace) ranges() []ParameterRange {
+	return []ParameterRange{s.KP, s.KI, s.KD, s.FilterLength}
+}
+
+// decode переводит точку единичного куба в параметры
+func (s ParameterSpace) decode(x []float64) OptimizationParameters {
+	values := make([]float64, 4)
+	for i, r := range s.ranges() {
+		values[i] = r.decode(x[i])
+	}
+	return OptimizationParameters{
+		KP:           values[0],
+		KI:           values[1],
+		KD:           values[2],
+		FilterLength: int(math.Round(values[3])),
+	}
+}
+
+// encode переводит параметры в точку единичного куба
+func (s ParameterSpace) encode(p OptimizationParameters) []float64 {
+	values := []float64{p.KP, p.KI, p.KD, float64(p.FilterLength)}
+	x := make([]float64, 4)
+	for i, r := range s.ranges() {
+		x[i] = r.encode(values[i])
+	}
+	return x
+}
+
+// random возвращает случайную точку единичного куба
+func (s ParameterSpace) random(rng *rand.Rand) []float64 {
+	x := make([]float64, 4)
+	for i := range x {
+		x[i] = rng.Float64()
+	}
+	return x
+}
+
+// clamp возвращает параметры, ограниченные пространством поиска
+func (s ParameterSpace) clamp(p OptimizationParameters) OptimizationParameters {
+	return s.decode(s.encode(p))
+}
+
+func (r ParameterRange) decode(u float64) float64 {
+	u = math.Max(0, math.Min(1, u))
+	if r.Max <= r.Min {
+		return r.Min
+	}
+	if r.Log && r.Min > 0 {
+		return r.Min * math.Pow(r.Max/r.Min, u)
+	}
+	return r.Min + (r.Max-r.Min)*u
+}
+
+func (r ParameterRange) encode(v float64) float64 {
+	if r.Max <= r.Min {
+		return 0
+	}
+	var u float64
+	if r.Log && r.Min > 0 {
+		u = math.Log(math.Max(v, r.Min)/r.Min) / math.Log(r.Max/r.Min)
+	} else {
+		u = (v - r.Min) / (r.Max - r.Min)
+	}
+	return math.Max(0, math.Min(1, u))
+}
+
+// ParameterObjective стоимость параметров на реальных данных (меньше - лучше)
+type ParameterObjective func(params OptimizationParameters) float64
+
+// SearchConfig настройки поиска параметров
+type SearchConfig struct {
+	Strategy string // genetic, bayesian или ensemble (оба, лучший результат)
+	Budget   int    // Число вычислений стоимости
+	Seed     int64
+}
+
+// SearchResult лучшие найденные параметры
+type SearchResult struct {
+	Parameters  OptimizationParameters `json:"parameters"`
+	Cost        float64                `json:"cost"`
+	Optimizer   string                 `json:"optimizer"`
+	Evaluations int                    `json:"evaluations"`
+}
+
+// GetSearchStrategies возвращает стратегии поиска параметров
+func GetSearchStrategies() []string {
+	return []string{"genetic", "bayesian", "ensemble"}
+}
+
+// Search ищет параметры дисциплины с минимальной стоимостью objective.
+// В отличие от OptimizeParameters, который оценивает параметры по
+// эвристикам, здесь каждая точка оценивается на реальных данных (например,
+// повтором записанной трассы в симуляции). initial - точки, которые
+// вычисляются первыми (например, текущая конфигурация), поэтому результат
+// не хуже них.
+func (mo *MLOptimizer) Search(cfg SearchConfig, space ParameterSpace, objective ParameterObjective, initial ...OptimizationParameters) (*SearchResult, error) {
+	if cfg.Budget < 1 {
+		return nil, fmt.Errorf("search budget must be positive")
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	var result *SearchResult
+	switch strings.ToLower(cfg.Strategy) {
+	case "genetic":
+		result = mo.geneticAlgorithm.Search(space, objective, cfg.Budget, rng, initial)
+	case "bayesian":
+		result = mo.bayesianOptimizer.Search(space, objective, cfg.Budget, rng, initial)
+	case "", "ensemble":
+		genetic := mo.geneticAlgorithm.Search(space, objective, cfg.Budget/2, rng, initial)
+		bayesian := mo.bayesianOptimizer.Search(space, objective, cfg.Budget-cfg.Budget/2, rng, initial)
+		result = genetic
+		if bayesian.Cost < genetic.Cost {
+			result = bayesian
+		}
+		result.Evaluations = genetic.Evaluations + bayesian.Evaluations
+	default:
+		return nil, fmt.Errorf("unknown search strategy: %s", cfg.Strategy)
+	}
+
+	mo.logger.WithField("optimizer", result.Optimizer).
+		WithField("cost", result.Cost).
+		WithField("evaluations", result.Evaluations).
+		Debug("Parameter search finished")
+	return result, nil
+}
+
+// Search ищет параметры генетическим алгоритмом: турнирный отбор,
+// равномерное скрещивание и мутации текущей популяции, где
+// приспособленность - стоимость со знаком минус
+func (ga *GeneticAlgorithm) Search(space ParameterSpace, objective ParameterObjective, budget int, rng *rand.Rand, initial []OptimizationParameters) *SearchResult {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	result := &SearchResult{Cost: math.Inf(1), Optimizer: "genetic_algorithm"}
+	evaluate := func(individual *GeneticIndividual) {
+		*individual.Parameters = space.clamp(*individual.Parameters)
+		cost := objective(*individual.Parameters)
+		individual.Fitness = -cost
+		result.Evaluations++
+		if cost < result.Cost {
+			result.Cost = cost
+			result.Parameters = *individual.Parameters
+		}
+	}
+
+	size := budget / 4
+	if size < 4 {
+		size = 4
+	}
+	if size > budget {
+		size = budget
+	}
+	population := make([]*GeneticIndividual, 0, size)
+	for i := 0; i < size; i++ {
+		params := space.decode(space.random(rng))
+		if i < len(initial) {
+			params = initial[i]
+		}
+		individual := &GeneticIndividual{Parameters: &params}
+		evaluate(individual)
+		population = append(population, individual)
+	}
+	ga.population = population
+
+	for result.Evaluations < budget {
+		offspring := ga.crossover(ga.selection())
+		if len(offspring) == 0 {
+			// Популяция слишком мала для скрещивания: случайная особь
+			params := space.decode(space.random(rng))
+			offspring = []*GeneticIndividual{{Parameters: &params}}
+		}
+		ga.mutation(offspring)
+
+		if remaining := budget - result.Evaluations; len(offspring) > remaining {
+			offspring = offspring[:remaining]
+		}
+		for _, child := range offspring {
+			evaluate(child)
+		}
+		ga.updatePopulation(offspring)
+	}
+	return result
+}
+
+// Search ищет параметры байесовской оптимизацией: гауссовский процесс
+// аппроксимирует логарифм стоимости, следующая точка выбирается по
+// максимуму ожидаемого улучшения
+func (bo *BayesianOptimizer) Search(space ParameterSpace, objective ParameterObjective, budget int, rng *rand.Rand, initial []OptimizationParameters) *SearchResult {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	result := &SearchResult{Cost: math.Inf(1), Optimizer: "bayesian_optimization"}
+	var points [][]float64
+	var values []float64
+	evaluate := func(x []float64) {
+		params := space.decode(x)
+		cost := objective(params)
+		result.Evaluations++
+		if cost < result.Cost {
+			result.Cost = cost
+			result.Parameters = params
+		}
+
+		points = append(points, space.encode(params))
+		values = append(values, math.Log(math.Max(cost, 1e-12)))
+		bo.history = append(bo.history, &BayesianEvaluation{
+			Parameters:  &params,
+			Performance: -cost,
+			Timestamp:   time.Now(),
+		})
+	}
+
+	// Начальный план: заданные точки и случайные
+	warmup := budget / 4
+	if warmup < 3 {
+		warmup = 3
+	}
+	for i := 0; i < warmup && result.Evaluations < budget; i++ {
+		if i < len(initial) {
+			evaluate(space.encode(initial[i]))
+			continue
+		}
+		evaluate(space.random(rng))
+	}
+
+	for result.Evaluations < budget {
+		if err := bo.gaussianProcess.Fit(points, values); err != nil {
+			evaluate(space.random(rng))
+			continue
+		}
+		best := values[0]
+		for _, v := range values[1:] {
+			best = math.Min(best, v)
+		}
+		evaluate(bo.acquisitionFunction.Maximize(bo.gaussianProcess, space, best, rng, space.encode(result.Parameters)))
+	}
+	return result
+}
+
+// Fit обучает гауссовский процесс с RBF ядром на точках единичного куба
+func (gp *GaussianProcess) Fit(points [][]float64, values []float64) error {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+
+	n := len(points)
+	if n == 0 {
+		return fmt.Errorf("no observations")
+	}
+
+	// Значения нормируются: среднее 0, СКО 1
+	gp.mean, gp.scale = meanStd(values)
+	if gp.scale == 0 {
+		gp.scale = 1
+	}
+	y := mat.NewVecDense(n, nil)
+	for i, v := range values {
+		y.SetVec(i, (v-gp.mean)/gp.scale)
+	}
+
+	k := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			v := rbfKernel(points[i], points[j])
+			if i == j {
+				v += gpNoise
+			}
+			k.SetSym(i, j, v)
+		}
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(k); !ok {
+		return fmt.Errorf("kernel matrix is not positive definite")
+	}
+	var alpha mat.VecDense
+	if err := chol.SolveVecTo(&alpha, y); err != nil {
+		return fmt.Errorf("failed to solve for weights: %w", err)
+	}
+
+	gp.points = points
+	gp.chol = &chol
+	gp.alpha = &alpha
+	return nil
+}
+
+// Predict возвращает апостериорное среднее и СКО в точке x
+func (gp *GaussianProcess) Predict(x []float64) (float64, float64) {
+	gp.mu.RLock()
+	defer gp.mu.RUnlock()
+
+	if gp.chol == nil {
+		return 0, 1
+	}
+	n := len(gp.points)
+	kx := mat.NewVecDense(n, nil)
+	for i, p := range gp.points {
+		kx.SetVec(i, rbfKernel(p, x))
+	}
+
+	mean := mat.Dot(kx, gp.alpha)
+	var v mat.VecDense
+	if err := gp.chol.SolveVecTo(&v, kx); err != nil {
+		return gp.mean + gp.scale*mean, gp.scale
+	}
+	variance := math.Max(1+gpNoise-mat.Dot(kx, &v), 1e-12)
+	return gp.mean + gp.scale*mean, gp.scale * math.Sqrt(variance)
+}
+
+// rbfKernel ядро гауссовского процесса
+func rbfKernel(a, b []float64) float64 {
+	var d2 float64
+	for i := range a {
+		d := a[i] - b[i]
+		d2 += d * d
+	}
+	return math.Exp(-d2 / (2 * gpLengthScale * gpLengthScale))
+}
+
+// ExpectedImprovement ожидаемое улучшение минимума best в точке x
+func (af *AcquisitionFunction) ExpectedImprovement(gp *GaussianProcess, x []float64, best float64) float64 {
+	mean, std := gp.Predict(x)
+	if std <= 0 {
+		return 0
+	}
+	improvement := best - mean - eiExploration
+	z := improvement / std
+	cdf := 0.5 * math.Erfc(-z/math.Sqrt2)
+	pdf := math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+	return improvement*cdf + std*pdf
+}
+
+// Maximize выбирает среди случайных кандидатов и окрестности лучшей точки
+// точку с максимальным ожидаемым улучшением
+func (af *AcquisitionFunction) Maximize(gp *GaussianProcess, space ParameterSpace, best float64, rng *rand.Rand, incumbent []float64) []float64 {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+
+	type candidate struct {
+		x  []float64
+		ei float64
+	}
+	candidates := make([]candidate, 0, bayesianCandidates)
+	for i := 0; i < bayesianCandidates; i++ {
+		var x []float64
+		if i%4 == 0 {
+			// Локальный поиск вокруг текущего лучшего
+			x = make([]float64, len(incumbent))
+			for j := range x {
+				x[j] = math.Max(0, math.Min(1, incumbent[j]+0.05*rng.NormFloat64()))
+			}
+		} else {
+			x = space.random(rng)
+		}
+		candidates = append(candidates, candidate{x: x, ei: af.ExpectedImprovement(gp, x, best)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ei > candidates[j].ei
+	})
+	return candidates[0].x
+}
@@ -0,0 +1,139 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MonitorStatus решения дисциплины в режиме мониторинга (adjust_clock: false)
+type MonitorStatus struct {
+	Enabled    bool          `json:"enabled"`
+	Action     string        `json:"action,omitempty"`    // Последнее решение: step или slew
+	Timestamp  time.Time     `json:"timestamp,omitempty"` // Время последнего решения
+	Step       time.Duration `json:"step,omitempty"`      // Последний шаг, который был бы сделан
+	Frequency  float64       `json:"frequency"`           // Частота, которая была бы выставлена, ppb
+	Correction time.Duration `json:"correction"`          // Накопленная поправка фазы виртуальных часов
+	Steps      int           `json:"steps"`
+}
+
+// MonitorClock часы режима мониторинга: шаги и поправки частоты не
+// применяются к часам, а накапливаются в виртуальной поправке фазы.
+// Менеджер вычитает ее из измеренного смещения, поэтому дисциплина
+// работает в замкнутом контуре, как если бы ее решения применялись,
+// а реальными часами в это время может управлять chrony или ntpd.
+type MonitorClock struct {
+	mu sync.Mutex
+
+	clock ClockTarget // Наблюдаемые часы, только для чтения
+	now   func() time.Time
+
+	frequency  float64 // ppb
+	correction time.Duration
+	updated    time.Time
+	status     MonitorStatus
+
+	logger *logrus.Logger
+}
+
+// NewMonitorClock создает часы режима мониторинга поверх clock
+func NewMonitorClock(clock ClockTarget, now func() time.Time, logger *logrus.Logger) *MonitorClock {
+	return &MonitorClock{
+		clock:   clock,
+		now:     now,
+		updated: now(),
+		status:  MonitorStatus{Enabled: true},
+		logger:  logger,
+	}
+}
+
+// Name возвращает имя наблюдаемых часов
+func (c *MonitorClock) Name() string {
+	return c.clock.Name() + " (monitor)"
+}
+
+// Now читает наблюдаемые часы
+func (c *MonitorClock) Now() (time.Time, error) {
+	return c.clock.Now()
+}
+
+// AdjustFrequency запоминает частоту, которая была бы выставлена
+func (c *MonitorClock) AdjustFrequency(ppb float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.advance(now)
+	c.frequency = ppb
+	c.status.Action = "slew"
+	c.status.Timestamp = now
+
+	c.logger.WithField("frequency", ppb).Debug("Monitor mode: would slew clock")
+	return nil
+}
+
+// Frequency возвращает частоту, которая была бы выставлена
+func (c *MonitorClock) Frequency() (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frequency, nil
+}
+
+// Step добавляет шаг к виртуальной поправке фазы
+func (c *MonitorClock) Step(offset time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.advance(now)
+	c.correction += offset
+	c.status.Action = "step"
+	c.status.Timestamp = now
+	c.status.Step = offset
+	c.status.Steps++
+
+	c.logger.WithField("offset", offset).Debug("Monitor mode: would step clock")
+	return nil
+}
+
+// MaxFrequency возвращает предел поправки частоты наблюдаемых часов
+func (c *MonitorClock) MaxFrequency() float64 {
+	return c.clock.MaxFrequency()
+}
+
+// Close закрывает наблюдаемые часы
+func (c *MonitorClock) Close() error {
+	return c.clock.Close()
+}
+
+// Correction возвращает поправку фазы на момент измерения at: на столько
+// часы ушли бы вперед, если бы решения дисциплины применялись. Выбранное
+// фильтром измерение может быть старше последнего решения, поэтому поправка
+// экстраполируется от него с текущей частотой.
+func (c *MonitorClock) Correction(at time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.correction + time.Duration(float64(at.Sub(c.updated))*c.frequency/1e9)
+}
+
+// advance интегрирует поправку частоты до момента now
+func (c *MonitorClock) advance(now time.Time) {
+	if dt := now.Sub(c.updated); dt > 0 {
+		c.correction += time.Duration(float64(dt) * c.frequency / 1e9)
+	}
+	c.updated = now
+}
+
+// Status возвращает последние решения дисциплины
+func (c *MonitorClock) Status() MonitorStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(c.now())
+	status := c.status
+	status.Frequency = c.frequency
+	status.Correction = c.correction
+	return status
+}
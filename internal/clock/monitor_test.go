@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestSimulationMonitorMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	cfg := config.ShiwaTimeConfig{
+		ClockSync: config.ClockSyncConfig{AdjustClock: false},
+		Clock:     config.ClockConfig{Algorithm: "kalman"},
+	}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 20000, InitialOffset: 3 * time.Second, Seed: 3}
+
+	sim, err := NewSimulation(cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond), logger)
+	if err != nil {
+		t.Fatalf("NewSimulation() error = %v", err)
+	}
+	result := sim.Run(time.Hour)
+
+	// Часы не подстраиваются: смещение растет с собственной частотой генератора
+	want := 3*time.Second + time.Duration(20000*time.Hour.Seconds())
+	if offset := sim.Clock().Offset(); offset < want-time.Millisecond || offset > want+time.Millisecond {
+		t.Errorf("clock offset = %v, want untouched %v", offset, want)
+	}
+
+	if len(result.Steps) != 1 || !result.Steps[0].Monitor {
+		t.Fatalf("steps = %+v, want one monitor-only step", result.Steps)
+	}
+
+	monitor, ok := sim.Manager().GetMonitorStatus()
+	if !ok {
+		t.Fatal("monitor status not reported")
+	}
+	if monitor.Steps != 1 || monitor.Action != "slew" {
+		t.Errorf("monitor = %+v, want 1 step and slew as last action", monitor)
+	}
+
+	// Виртуальные часы с примененными решениями совпадают с истиной
+	if residual := monitor.Correction + sim.Clock().Offset(); residual > 50*time.Microsecond || residual < -50*time.Microsecond {
+		t.Errorf("virtual clock error = %v, want ~0", residual)
+	}
+	if residual := monitor.Frequency + sim.Clock().NaturalFrequency(); residual > 200 || residual < -200 {
+		t.Errorf("would-slew frequency = %.1f ppb, want ~%.1f", monitor.Frequency, -sim.Clock().NaturalFrequency())
+	}
+	if state := sim.Manager().GetState(); state != ClockStateLocked {
+		t.Errorf("state = %v, want %v", state, ClockStateLocked)
+	}
+}
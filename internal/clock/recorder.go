@@ -0,0 +1,311 @@
+package clock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+const (
+	defaultRecordingMaxSize  = 64 << 20
+	defaultRecordingMaxFiles = 4
+)
+
+// RecordType тип записи
+type RecordType string
+
+const (
+	RecordStart       RecordType = "start"       // Запуск менеджера
+	RecordSource      RecordType = "source"      // Изменение доступности источника
+	RecordSample      RecordType = "sample"      // Новое измерение источника
+	RecordSelection   RecordType = "selection"   // Решение выбора источников (раз за цикл)
+	RecordAdjustment  RecordType = "adjustment"  // Подстройка, step, отказ или holdover
+	RecordTemperature RecordType = "temperature" // Показание датчика температуры
+)
+
+// Record запись журнала измерений и решений. Заполнено поле, которое
+// соответствует типу записи.
+type Record struct {
+	Type   RecordType `json:"type"`
+	Time   time.Time  `json:"time"`
+	Source string     `json:"source,omitempty"`
+
+	Start       *RecordedStart      `json:"start,omitempty"`
+	Connected   *bool               `json:"connected,omitempty"`
+	Sample      *RecordedSample     `json:"sample,omitempty"`
+	Selection   *RecordedSelection  `json:"selection,omitempty"`
+	Adjustment  *RecordedAdjustment `json:"adjustment,omitempty"`
+	Temperature *float64            `json:"temperature,omitempty"` // °C
+}
+
+// RecordedStart состояние менеджера при запуске записи
+type RecordedStart struct {
+	Algorithm string  `json:"algorithm"`
+	Monitor   bool    `json:"monitor,omitempty"` // Часы не подстраивались (adjust_clock: false)
+	Frequency float64 `json:"frequency"`         // Поправка частоты часов, ppb
+}
+
+// RecordedSample измерение источника
+type RecordedSample struct {
+	Type           string                  `json:"type"`
+	Tier           SourceTier              `json:"tier,omitempty"`
+	Timestamp      time.Time               `json:"timestamp"`
+	Offset         time.Duration           `json:"offset"`
+	Delay          time.Duration           `json:"delay"`
+	Quality        int                     `json:"quality,omitempty"`
+	Stratum        int                     `json:"stratum,omitempty"`
+	Precision      int                     `json:"precision,omitempty"`
+	RootDelay      time.Duration           `json:"root_delay,omitempty"`
+	RootDispersion time.Duration           `json:"root_dispersion,omitempty"`
+	Leap           protocols.LeapIndicator `json:"leap,omitempty"`
+	UTCOffset      int                     `json:"utc_offset,omitempty"`
+}
+
+// RecordedSelection решение выбора источников
+type RecordedSelection struct {
+	Selected  string                     `json:"selected,omitempty"`
+	Offset    time.Duration              `json:"offset,omitempty"`
+	Jitter    time.Duration              `json:"jitter,omitempty"`
+	Survivors int                        `json:"survivors,omitempty"`
+	Status    map[string]SelectionStatus `json:"status,omitempty"`
+}
+
+// RecordedAdjustment решение по часам: slew (подстройка частоты), step,
+// refuse (отказ политики шага) или holdover
+type RecordedAdjustment struct {
+	Action    string        `json:"action"`
+	Offset    time.Duration `json:"offset,omitempty"`
+	Frequency float64       `json:"frequency,omitempty"` // Примененная поправка частоты, ppb
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// Recorder пишет записи в JSONL файл и ротирует его по размеру: path,
+// path.1 (предыдущий), ..., path.N
+type Recorder struct {
+	mu sync.Mutex
+
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	w      io.Writer
+	file   *os.File
+	size   int64
+	failed bool
+	closed bool // После Close записи отбрасываются, файл не открывается заново
+
+	logger *logrus.Logger
+}
+
+// NewRecorder открывает файл записи для дописывания
+func NewRecorder(cfg config.RecordingConfig, logger *logrus.Logger) (*Recorder, error) {
+	r := &Recorder{
+		path:     cfg.Path,
+		maxSize:  cfg.MaxSize,
+		maxFiles: cfg.MaxFiles,
+		logger:   logger,
+	}
+	if r.maxSize <= 0 {
+		r.maxSize = defaultRecordingMaxSize
+	}
+	if r.maxFiles <= 0 {
+		r.maxFiles = defaultRecordingMaxFiles
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newWriterRecorder создает запись в w без ротации
+func newWriterRecorder(w io.Writer, logger *logrus.Logger) *Recorder {
+	return &Recorder{w: w, logger: logger}
+}
+
+func (r *Recorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat recording file: %w", err)
+	}
+	r.file = file
+	r.w = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate сдвигает ротированные файлы и открывает новый файл записи
+func (r *Recorder) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close recording file: %w", err)
+	}
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil {
+				return fmt.Errorf("failed to rotate recording file: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate recording file: %w", err)
+	}
+	return r.open()
+}
+
+// Write дописывает запись. Ошибки записи не останавливают синхронизацию и
+// попадают в лог один раз до следующей успешной записи.
+func (r *Recorder) Write(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Цикл синхронизации может дописать запись после остановки менеджера
+	if r.closed {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err == nil {
+		line = append(line, '\n')
+		err = r.write(line)
+	}
+	if err != nil {
+		if !r.failed {
+			r.logger.WithError(err).Warn("Failed to write recording")
+		}
+		r.failed = true
+		return
+	}
+	r.failed = false
+}
+
+func (r *Recorder) write(line []byte) error {
+	if r.w == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	if r.file != nil && r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			r.w, r.file = nil, nil
+			return err
+		}
+	}
+	n, err := r.w.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+// Close закрывает файл записи
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.w = nil, nil
+	return err
+}
+
+// ReadRecording читает записи JSONL
+func ReadRecording(reader io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	return records, nil
+}
+
+// ReadRecordingFiles читает запись path вместе с ротированными файлами
+// path.N ... path.1 в хронологическом порядке
+func ReadRecordingFiles(path string) ([]Record, error) {
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, name := range append(rotated, path) {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) && name != path {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open recording: %w", err)
+		}
+		part, err := ReadRecording(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		records = append(records, part...)
+	}
+	return records, nil
+}
+
+// rotatedFiles возвращает ротированные файлы записи от старых к новым
+func rotatedFiles(path string) ([]string, error) {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording files: %w", err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording files: %w", err)
+	}
+
+	base := filepath.Base(path) + "."
+	indexes := make(map[int]string)
+	var keys []int
+	for _, name := range names {
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(name, base))
+		if err != nil || index < 1 {
+			continue
+		}
+		indexes[index] = path + "." + strconv.Itoa(index)
+		keys = append(keys, index)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	files := make([]string, len(keys))
+	for i, key := range keys {
+		files[i] = indexes[key]
+	}
+	return files, nil
+}
@@ -0,0 +1,471 @@
+package clock
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+// ReplayClock виртуальные часы повтора записи. Время идет по записям, а
+// расхождение с записанными часами набирается из разницы частот и шагов
+// повторяемой дисциплины и записанных решений.
+type ReplayClock struct {
+	mu sync.Mutex
+
+	now        time.Time
+	frequency  float64 // Частота повторяемой дисциплины, ppb
+	recorded   float64 // Частота записанных часов, ppb
+	divergence float64 // Повторяемые часы минус записанные, ns
+	monitor    bool    // Записанные часы не подстраивались
+}
+
+// NewReplayClock создает часы повтора, начиная с момента start
+func NewReplayClock(start time.Time) *ReplayClock {
+	return &ReplayClock{now: start}
+}
+
+// Name возвращает имя часов
+func (c *ReplayClock) Name() string {
+	return "replay"
+}
+
+// Now возвращает время повторяемых часов
+func (c *ReplayClock) Now() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now.Add(time.Duration(c.divergence)), nil
+}
+
+// Time возвращает время записи, на котором находится повтор
+func (c *ReplayClock) Time() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AdjustFrequency задает частоту повторяемых часов
+func (c *ReplayClock) AdjustFrequency(ppb float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frequency = ppb
+	return nil
+}
+
+// Frequency возвращает частоту повторяемых часов
+func (c *ReplayClock) Frequency() (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frequency, nil
+}
+
+// Step сдвигает повторяемые часы
+func (c *ReplayClock) Step(offset time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.divergence += float64(offset)
+	return nil
+}
+
+// MaxFrequency возвращает максимальную поправку частоты
+func (c *ReplayClock) MaxFrequency() float64 {
+	return maxFrequencyPPB
+}
+
+// Close ничего не делает
+func (c *ReplayClock) Close() error {
+	return nil
+}
+
+// Divergence возвращает расхождение повторяемых часов с записанными
+func (c *ReplayClock) Divergence() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.divergence)
+}
+
+// advance продвигает время повтора до t
+func (c *ReplayClock) advance(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dt := t.Sub(c.now).Seconds(); dt > 0 {
+		c.divergence += (c.frequency - c.recorded) * dt
+		c.now = t
+	}
+}
+
+// start применяет состояние записанного менеджера при запуске. В режиме
+// мониторинга записанные часы не подстраивались, и их частота - нулевая.
+func (c *ReplayClock) start(start RecordedStart) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.monitor = start.Monitor
+	c.recorded = 0
+	if !c.monitor {
+		c.recorded = start.Frequency
+	}
+}
+
+// recordAdjustment применяет записанное решение к записанным часам
+func (c *ReplayClock) recordAdjustment(adjustment RecordedAdjustment) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.monitor {
+		return
+	}
+	switch adjustment.Action {
+	case string(StepActionStep):
+		c.divergence -= float64(adjustment.Offset)
+	case "slew", "holdover":
+		c.recorded = adjustment.Frequency
+	}
+}
+
+// ReplaySource источник повтора: отдает записанные измерения, пересчитанные
+// к повторяемым часам
+type ReplaySource struct {
+	mu sync.RWMutex
+
+	name       string
+	source     config.TimeSourceConfig
+	info       *protocols.TimeInfo
+	connected  bool
+	registered bool // Добавлен в менеджер
+}
+
+// setSample запоминает записанное измерение. Смещение считается от
+// повторяемых часов, которые отличаются от записанных на divergence.
+func (s *ReplaySource) setSample(sample RecordedSample, divergence time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.info = &protocols.TimeInfo{
+		Timestamp:      sample.Timestamp,
+		Offset:         sample.Offset - divergence,
+		Delay:          sample.Delay,
+		Quality:        sample.Quality,
+		Stratum:        sample.Stratum,
+		Precision:      sample.Precision,
+		RootDelay:      sample.RootDelay,
+		RootDispersion: sample.RootDispersion,
+		Leap:           sample.Leap,
+		UTCOffset:      sample.UTCOffset,
+	}
+	s.connected = true
+}
+
+// setConnected задает доступность источника
+func (s *ReplaySource) setConnected(connected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = connected
+}
+
+// Start ничего не делает: измерения подает повтор
+func (s *ReplaySource) Start() error {
+	return nil
+}
+
+// Stop ничего не делает
+func (s *ReplaySource) Stop() error {
+	return nil
+}
+
+// GetTimeInfo возвращает последнее записанное измерение
+func (s *ReplaySource) GetTimeInfo() (*protocols.TimeInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.info == nil {
+		return nil, fmt.Errorf("no recorded measurements from source %s", s.name)
+	}
+	info := *s.info
+	return &info, nil
+}
+
+// GetStatus возвращает записанную доступность источника
+func (s *ReplaySource) GetStatus() protocols.ConnectionStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return protocols.ConnectionStatus{Connected: s.connected}
+}
+
+// GetConfig возвращает конфигурацию источника
+func (s *ReplaySource) GetConfig() config.TimeSourceConfig {
+	return s.source
+}
+
+// GetGNSSInfo возвращает пустую GNSS информацию
+func (s *ReplaySource) GetGNSSInfo() protocols.GNSSStatus {
+	return protocols.GNSSStatus{}
+}
+
+// ReplayMismatch цикл, в котором повтор выбрал другой системный источник
+type ReplayMismatch struct {
+	Time     time.Time `json:"time"`
+	Recorded string    `json:"recorded"`
+	Replayed string    `json:"replayed"`
+}
+
+// ReplayResult сравнение повтора записи с записанными решениями
+type ReplayResult struct {
+	Records           int              `json:"records"`
+	Cycles            int              `json:"cycles"`
+	Span              time.Duration    `json:"span"`
+	RecordedAlgorithm string           `json:"recorded_algorithm"`
+	Algorithm         string           `json:"algorithm"`
+	Mismatches        []ReplayMismatch `json:"mismatches"`
+	RecordedSteps     int              `json:"recorded_steps"`
+	ReplayedSteps     int              `json:"replayed_steps"`
+	RecordedRMS       time.Duration    `json:"recorded_rms"` // СКО смещения в записанных подстройках
+	ReplayedRMS       time.Duration    `json:"replayed_rms"`
+	MaxDivergence     time.Duration    `json:"max_divergence"` // Наибольшее расхождение часов повтора с записанными
+	FinalDivergence   time.Duration    `json:"final_divergence"`
+	FinalFrequency    float64          `json:"final_frequency"`
+	Replayed          []Record         `json:"-"` // Записи повтора в формате записи
+}
+
+// replayer состояние повтора записи
+type replayer struct {
+	cfg     config.ShiwaTimeConfig
+	clock   *ReplayClock
+	manager *Manager
+	sources map[string]*ReplaySource
+	logger  *logrus.Logger
+}
+
+// Replay повторяет запись через выбор источников и дисциплину из cfg (по
+// умолчанию - записанную) в виртуальном времени. Каждая записанная запись
+// выбора запускает цикл синхронизации, поэтому решения повтора
+// сравниваются с записанными цикл за циклом.
+func Replay(records []Record, cfg config.ShiwaTimeConfig, logger *logrus.Logger) (*ReplayResult, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("recording is empty")
+	}
+
+	// Без явного алгоритма повторяется записанная дисциплина
+	if cfg.Clock.Algorithm == "" {
+		for _, record := range records {
+			if record.Type == RecordStart && record.Start != nil {
+				cfg.Clock.Algorithm = record.Start.Algorithm
+				break
+			}
+		}
+	}
+	if _, err := NewDiscipline(cfg.Clock, logger); err != nil {
+		return nil, err
+	}
+
+	cfg = replayConfig(cfg)
+	var replayed bytes.Buffer
+	clock := NewReplayClock(records[0].Time)
+	r := &replayer{
+		cfg:     cfg,
+		clock:   clock,
+		manager: newManager(cfg, clock, clock.Time, logger),
+		sources: make(map[string]*ReplaySource),
+		logger:  logger,
+	}
+	r.manager.recorder = newWriterRecorder(&replayed, logger)
+
+	// Датчик температуры отдает записанные показания, прочитанные в тот же
+	// момент записи
+	if r.manager.temperature != nil {
+		temperatures := make(map[int64]float64)
+		for _, record := range records {
+			if record.Type == RecordTemperature && record.Temperature != nil {
+				temperatures[record.Time.UnixNano()] = *record.Temperature
+			}
+		}
+		r.manager.temperature.read = func() (float64, error) {
+			temperature, ok := temperatures[clock.Time().UnixNano()]
+			if !ok {
+				return 0, fmt.Errorf("no recorded temperature at %s", clock.Time().Format(time.RFC3339Nano))
+			}
+			return temperature, nil
+		}
+	}
+
+	result := &ReplayResult{
+		Records:   len(records),
+		Span:      records[len(records)-1].Time.Sub(records[0].Time),
+		Algorithm: r.manager.discipline.Name(),
+	}
+
+	var selections []Record
+	var recordedOffsets []time.Duration
+	started := false
+	for _, record := range records {
+		clock.advance(record.Time)
+
+		switch record.Type {
+		case RecordStart:
+			if record.Start == nil {
+				continue
+			}
+			// Повтор начинается с частоты записанного менеджера
+			if !started {
+				result.RecordedAlgorithm = record.Start.Algorithm
+				r.manager.setFrequency(record.Start.Frequency)
+				started = true
+			}
+			clock.start(*record.Start)
+		case RecordSource:
+			if record.Connected != nil {
+				r.source(record.Source).setConnected(*record.Connected)
+			}
+		case RecordSample:
+			if record.Sample != nil {
+				source := r.source(record.Source)
+				r.register(source, *record.Sample)
+				source.setSample(*record.Sample, clock.Divergence())
+			}
+		case RecordSelection:
+			// Расхождение сравнивается в начале цикла, когда обе стороны
+			// применили решения предыдущего цикла
+			if divergence := clock.Divergence(); math.Abs(float64(divergence)) > math.Abs(float64(result.MaxDivergence)) {
+				result.MaxDivergence = divergence
+			}
+			selections = append(selections, record)
+			_ = r.manager.synchronizeClock()
+			result.Cycles++
+		case RecordAdjustment:
+			if record.Adjustment == nil {
+				continue
+			}
+			clock.recordAdjustment(*record.Adjustment)
+			switch record.Adjustment.Action {
+			case string(StepActionStep):
+				result.RecordedSteps++
+			case "slew":
+				recordedOffsets = append(recordedOffsets, record.Adjustment.Offset)
+			}
+		}
+
+	}
+
+	output, err := ReadRecording(&replayed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replayed records: %w", err)
+	}
+	result.Replayed = output
+
+	var replayedOffsets []time.Duration
+	cycle := 0
+	for _, record := range output {
+		switch {
+		case record.Type == RecordSelection && record.Selection != nil:
+			if cycle < len(selections) && selections[cycle].Selection != nil {
+				recorded := selections[cycle].Selection.Selected
+				if recorded != record.Selection.Selected {
+					result.Mismatches = append(result.Mismatches, ReplayMismatch{
+						Time:     record.Time,
+						Recorded: recorded,
+						Replayed: record.Selection.Selected,
+					})
+				}
+			}
+			cycle++
+		case record.Type == RecordAdjustment && record.Adjustment != nil:
+			switch record.Adjustment.Action {
+			case string(StepActionStep):
+				result.ReplayedSteps++
+			case "slew":
+				replayedOffsets = append(replayedOffsets, record.Adjustment.Offset)
+			}
+		}
+	}
+
+	result.RecordedRMS = rmsDuration(recordedOffsets)
+	result.ReplayedRMS = rmsDuration(replayedOffsets)
+	result.FinalDivergence = clock.Divergence()
+	result.FinalFrequency, _ = clock.Frequency()
+	return result, nil
+}
+
+// source возвращает источник повтора, создавая его при первом упоминании
+func (r *replayer) source(name string) *ReplaySource {
+	source, ok := r.sources[name]
+	if !ok {
+		source = &ReplaySource{name: name}
+		r.sources[name] = source
+	}
+	return source
+}
+
+// register добавляет источник в менеджер при первом измерении, когда
+// известен его протокол. Фильтр и вес берутся из источника конфигурации с
+// тем же именем.
+func (r *replayer) register(source *ReplaySource, sample RecordedSample) {
+	if source.registered {
+		return
+	}
+	source.registered = true
+
+	sourceConfig, tier, ok := r.configSource(source.name)
+	if !ok {
+		sourceConfig = config.TimeSourceConfig{Type: sample.Type, Name: source.name, Weight: 1}
+		tier = sample.Tier
+	}
+	source.source = sourceConfig
+
+	filter, err := NewSampleFilter(sourceConfig)
+	if err != nil {
+		r.logger.WithError(err).WithField("source", source.name).Warn("Invalid sample filter, replaying without filter")
+		filter = NewPassthroughFilter()
+	}
+
+	r.manager.mu.Lock()
+	r.manager.sources[source.name] = source
+	r.manager.filters[source.name] = filter
+	r.manager.tiers[source.name] = tier
+	r.manager.mu.Unlock()
+}
+
+// configSource ищет источник конфигурации по имени записи
+func (r *replayer) configSource(name string) (config.TimeSourceConfig, SourceTier, bool) {
+	for i, source := range r.cfg.ClockSync.PrimaryClocks {
+		if config.SourceName(source, string(SourceTierPrimary), i) == name {
+			return source, SourceTierPrimary, true
+		}
+	}
+	for i, source := range r.cfg.ClockSync.SecondaryClocks {
+		if config.SourceName(source, string(SourceTierSecondary), i) == name {
+			return source, SourceTierSecondary, true
+		}
+	}
+	return config.TimeSourceConfig{}, "", false
+}
+
+// Summary возвращает текстовую сводку повтора
+func (r *ReplayResult) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Replayed %d records over %v: %d cycles\n", r.Records, r.Span, r.Cycles)
+	fmt.Fprintf(&b, "Algorithm:  recorded %s, replayed %s\n", r.RecordedAlgorithm, r.Algorithm)
+	fmt.Fprintf(&b, "Steps:      recorded %d, replayed %d\n", r.RecordedSteps, r.ReplayedSteps)
+	fmt.Fprintf(&b, "RMS offset: recorded %v, replayed %v\n", r.RecordedRMS, r.ReplayedRMS)
+	fmt.Fprintf(&b, "Divergence: max %v, final %v (replayed minus recorded clock)\n", r.MaxDivergence, r.FinalDivergence)
+	fmt.Fprintf(&b, "Selection:  %d of %d cycles differ\n", len(r.Mismatches), r.Cycles)
+	return b.String()
+}
+
+// rmsDuration возвращает СКО длительностей от нуля
+func rmsDuration(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v) * float64(v)
+	}
+	return time.Duration(math.Sqrt(sum / float64(len(values))))
+}
@@ -0,0 +1,175 @@
+package clock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// recordSimulation прогоняет симуляцию с записью и возвращает запись
+func recordSimulation(t *testing.T, cfg config.ShiwaTimeConfig, duration time.Duration) []Record {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "shiwatime.rec")
+	cfg.Clock.Recording = config.RecordingConfig{Path: path}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 20000, RandomWalk: 0.05, InitialOffset: 2 * time.Second, Seed: 1}
+	sources := []SimSourceConfig{
+		{
+			Name:         "ntp_a",
+			Noise:        200 * time.Microsecond,
+			Delay:        10 * time.Millisecond,
+			DelayJitter:  time.Millisecond,
+			PollInterval: 16 * time.Second,
+			Outages:      []SimOutage{{Start: 30 * time.Minute, End: 40 * time.Minute}},
+			Seed:         1,
+		},
+		{
+			Name:         "ntp_b",
+			Noise:        time.Millisecond,
+			Bias:         500 * time.Microsecond,
+			Delay:        20 * time.Millisecond,
+			DelayJitter:  2 * time.Millisecond,
+			PollInterval: 16 * time.Second,
+			Tier:         SourceTierSecondary,
+			Seed:         2,
+		},
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+	sim.Run(duration)
+	if err := sim.Manager().recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	records, err := ReadRecordingFiles(path)
+	if err != nil {
+		t.Fatalf("ReadRecordingFiles() error = %v", err)
+	}
+	return records
+}
+
+func TestReplayReproducesRecording(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "pid"}}
+	records := recordSimulation(t, cfg, 2*time.Hour)
+
+	counts := make(map[RecordType]int)
+	for _, record := range records {
+		counts[record.Type]++
+	}
+	if counts[RecordStart] != 1 || counts[RecordSelection] != 7200 || counts[RecordSample] == 0 || counts[RecordSource] < 3 {
+		t.Fatalf("record counts = %v", counts)
+	}
+
+	// Та же конфигурация повторяет записанные решения без расхождений
+	result, err := Replay(records, cfg, logger)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if result.Cycles != 7200 || len(result.Mismatches) != 0 {
+		t.Errorf("cycles = %d, mismatches = %v", result.Cycles, result.Mismatches)
+	}
+	if result.RecordedSteps != 1 || result.ReplayedSteps != result.RecordedSteps {
+		t.Errorf("steps recorded = %d, replayed = %d", result.RecordedSteps, result.ReplayedSteps)
+	}
+	if result.MaxDivergence.Abs() > time.Microsecond {
+		t.Errorf("max divergence = %v", result.MaxDivergence)
+	}
+	if result.ReplayedRMS != result.RecordedRMS {
+		t.Errorf("RMS offset recorded = %v, replayed = %v", result.RecordedRMS, result.ReplayedRMS)
+	}
+
+	// Другая дисциплина работает по тем же измерениям, пересчитанным к
+	// своим часам, и тоже удерживает их
+	cfg.Clock.Algorithm = "kalman"
+	result, err = Replay(records, cfg, logger)
+	if err != nil {
+		t.Fatalf("Replay(kalman) error = %v", err)
+	}
+	if result.Algorithm != "kalman" || result.RecordedAlgorithm != "pid" || result.Cycles != 7200 {
+		t.Errorf("algorithm = %s, recorded = %s, cycles = %d", result.Algorithm, result.RecordedAlgorithm, result.Cycles)
+	}
+	if result.MaxDivergence == 0 || result.ReplayedRMS > 2*result.RecordedRMS {
+		t.Errorf("max divergence = %v, RMS offset = %v", result.MaxDivergence, result.ReplayedRMS)
+	}
+}
+
+func TestRecorderRotation(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	path := filepath.Join(t.TempDir(), "shiwatime.rec")
+	recorder, err := NewRecorder(config.RecordingConfig{Path: path, MaxSize: 512, MaxFiles: 2}, logger)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 40; i++ {
+		connected := i%2 == 0
+		recorder.Write(Record{Type: RecordSource, Time: start.Add(time.Duration(i) * time.Second), Source: fmt.Sprintf("s%d", i), Connected: &connected})
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("rotated file missing: %v", err)
+		}
+		if info.Size() > 512 {
+			t.Errorf("%s size = %d, want at most 512", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 kept beyond max_files", path)
+	}
+
+	// Ротированные файлы читаются по порядку, старые записи отброшены
+	records, err := ReadRecordingFiles(path)
+	if err != nil {
+		t.Fatalf("ReadRecordingFiles() error = %v", err)
+	}
+	if len(records) == 0 || len(records) >= 40 || records[len(records)-1].Source != "s39" {
+		t.Fatalf("read %d records", len(records))
+	}
+	for i := 1; i < len(records); i++ {
+		if !records[i].Time.After(records[i-1].Time) {
+			t.Fatalf("records out of order at %d", i)
+		}
+	}
+}
+
+func TestRecorderWriteAfterClose(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	path := filepath.Join(t.TempDir(), "shiwatime.rec")
+	recorder, err := NewRecorder(config.RecordingConfig{Path: path}, logger)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Запоздавшая запись цикла синхронизации не открывает файл заново
+	connected := true
+	recorder.Write(Record{Type: RecordSource, Time: simulationEpoch, Source: "late", Connected: &connected})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("recording file reopened after Close: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
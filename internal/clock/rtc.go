@@ -0,0 +1,208 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+const (
+	RTCModeWrite  = "write"  // Системное время периодически записывается в RTC
+	RTCModeKernel = "kernel" // 11-минутный режим ядра (STA_UNSYNC снимает KernelTimex)
+
+	defaultRTCInterval = 11 * time.Minute
+)
+
+// RTCStatus состояние синхронизации RTC
+type RTCStatus struct {
+	Enabled    bool          `json:"enabled"`
+	Device     string        `json:"device"`
+	Mode       string        `json:"mode"`
+	Interval   time.Duration `json:"interval"`
+	Writes     uint64        `json:"writes"`
+	LastWrite  time.Time     `json:"last_write,omitempty"`
+	LastOffset time.Duration `json:"last_offset"` // Смещение RTC - система перед последней записью
+	DriftPPM   float64       `json:"drift_ppm"`   // Уход RTC между записями, ppm (> 0 - RTC спешит)
+	LastError  string        `json:"last_error,omitempty"`
+}
+
+// RTCSync периодически переносит время дисциплинированных системных
+// часов в RTC и измеряет уход RTC между записями
+type RTCSync struct {
+	mu sync.RWMutex
+
+	device   string
+	mode     string
+	interval time.Duration
+	status   RTCStatus
+
+	// Состоянием ядра в режиме kernel управляет KernelTimex
+	kernel       *KernelTimex
+	kernelSynced bool // STA_UNSYNC снят, ядро записывает RTC само
+
+	logger *logrus.Logger
+}
+
+// NewRTCSync создает синхронизацию RTC по секции synchronise_rtc
+func NewRTCSync(cfg config.SyncRTCConfig, kernel *KernelTimex, logger *logrus.Logger) *RTCSync {
+	r := &RTCSync{
+		device:   cfg.Device,
+		mode:     strings.ToLower(cfg.Mode),
+		interval: defaultRTCInterval,
+		kernel:   kernel,
+		logger:   logger,
+	}
+
+	if r.device == "" {
+		r.device = protocols.DefaultRTCDevice
+	}
+	if r.mode == "" {
+		r.mode = RTCModeWrite
+	}
+	if r.mode == RTCModeKernel && !kernel.Status().Enabled {
+		logger.Warn("Kernel RTC mode requires clock kernel_sync, RTC will not be updated")
+	}
+	if cfg.ClockInterval != "" {
+		interval, err := config.ParseDuration(cfg.ClockInterval)
+		if err != nil || interval <= 0 {
+			logger.WithField("clock_interval", cfg.ClockInterval).Warn("Invalid RTC clock_interval, using default")
+		} else {
+			r.interval = interval
+		}
+	}
+
+	r.status = RTCStatus{
+		Enabled:  true,
+		Device:   r.device,
+		Mode:     r.mode,
+		Interval: r.interval,
+	}
+
+	return r
+}
+
+// Run выполняет синхронизацию RTC, пока synchronized сообщает, что
+// системные часы синхронизированы
+func (r *RTCSync) Run(ctx context.Context, synchronized func() bool) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.logger.WithFields(logrus.Fields{
+		"device":   r.device,
+		"mode":     r.mode,
+		"interval": r.interval,
+	}).Info("RTC synchronization started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !synchronized() {
+				continue
+			}
+
+			var err error
+			if r.mode == RTCModeKernel {
+				err = r.checkKernelSync()
+			} else {
+				err = r.write()
+			}
+
+			r.mu.Lock()
+			if err != nil {
+				r.status.LastError = err.Error()
+			} else {
+				r.status.LastError = ""
+			}
+			r.mu.Unlock()
+
+			if err != nil {
+				r.logger.WithError(err).Warn("RTC synchronization failed")
+			}
+		}
+	}
+}
+
+// write измеряет уход RTC и записывает в него системное время
+func (r *RTCSync) write() error {
+	dev, err := protocols.OpenRTCDevice(r.device)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	offset, err := protocols.MeasureRTCOffset(dev)
+	if err != nil {
+		return err
+	}
+
+	if err := protocols.WriteRTC(dev); err != nil {
+		return err
+	}
+
+	r.recordWrite(time.Now(), offset)
+	return nil
+}
+
+// recordWrite учитывает запись в RTC, перед которой RTC отличался от
+// системных часов на offset
+func (r *RTCSync) recordWrite(now time.Time, offset time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// После записи смещение RTC равно нулю, поэтому уход - это смещение,
+	// набранное с предыдущей записи
+	if !r.status.LastWrite.IsZero() {
+		elapsed := now.Sub(r.status.LastWrite).Seconds()
+		if elapsed > 0 {
+			r.status.DriftPPM = offset.Seconds() / elapsed * 1e6
+		}
+	}
+	r.status.LastOffset = offset
+	r.status.LastWrite = now
+	r.status.Writes++
+
+	r.logger.WithFields(logrus.Fields{
+		"device":    r.device,
+		"offset":    offset,
+		"drift_ppm": r.status.DriftPPM,
+	}).Debug("RTC updated from system clock")
+}
+
+// checkKernelSync проверяет, что KernelTimex снял STA_UNSYNC: тогда ядро
+// само записывает системное время в RTC каждые 11 минут. Флаг меняет только
+// KernelTimex по состоянию часов, иначе запись отсюда расходилась бы с ним.
+func (r *RTCSync) checkKernelSync() error {
+	status := r.kernel.Status()
+	if !status.Enabled {
+		return fmt.Errorf("kernel RTC mode requires clock kernel_sync")
+	}
+	if status.Error != "" {
+		return fmt.Errorf("kernel status not updated: %s", status.Error)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	synced := !status.Unsync
+	if synced && !r.kernelSynced {
+		r.status.LastWrite = status.Updated
+		r.logger.Info("Kernel 11-minute RTC mode enabled")
+	}
+	r.kernelSynced = synced
+	return nil
+}
+
+// Status возвращает состояние синхронизации RTC
+func (r *RTCSync) Status() RTCStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
@@ -0,0 +1,126 @@
+package clock
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestRTCSyncDrift(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	r := NewRTCSync(config.SyncRTCConfig{ClockInterval: "11m"}, NewKernelTimex(false, logger), logger)
+	if status := r.Status(); status.Mode != RTCModeWrite || status.Interval != 11*time.Minute || status.Device != "/dev/rtc0" {
+		t.Fatalf("status = %+v, want write mode every 11m on /dev/rtc0", status)
+	}
+
+	// Уход считается по смещению, набранному RTC с предыдущей записи
+	steps := []struct {
+		at     time.Duration
+		offset time.Duration // RTC - система перед записью
+		drift  float64       // ppm
+	}{
+		// Первая запись исправляет начальную ошибку RTC, уход еще неизвестен
+		{at: 0, offset: 5 * time.Second},
+		{at: 11 * time.Minute, offset: 66 * time.Millisecond, drift: 100},
+		{at: 22 * time.Minute, offset: -33 * time.Millisecond, drift: -50},
+		// Без прошедшего времени уход не пересчитывается
+		{at: 22 * time.Minute, offset: time.Millisecond, drift: -50},
+	}
+
+	for i, step := range steps {
+		now := simulationEpoch.Add(step.at)
+		r.recordWrite(now, step.offset)
+
+		status := r.Status()
+		if math.Abs(status.DriftPPM-step.drift) > 1e-9 {
+			t.Errorf("write %d: drift = %.3f ppm, want %.3f", i, status.DriftPPM, step.drift)
+		}
+		if status.LastOffset != step.offset || !status.LastWrite.Equal(now) || status.Writes != uint64(i+1) {
+			t.Errorf("write %d: status = %+v", i, status)
+		}
+	}
+}
+
+func TestRTCSyncKernelMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// STA_UNSYNC в ядре меняет только KernelTimex
+	kernel := unix.Timex{Status: unix.STA_UNSYNC | unix.STA_PLL}
+	var writes int
+	var writeErr error
+	k := NewKernelTimex(true, logger)
+	k.adjtimex = func(timex *unix.Timex) (int, error) {
+		if timex.Modes == 0 {
+			*timex = kernel
+			return 0, nil
+		}
+		if writeErr != nil {
+			return 0, writeErr
+		}
+		writes++
+		kernel.Status = timex.Status
+		return 0, nil
+	}
+	r := NewRTCSync(config.SyncRTCConfig{Mode: "Kernel"}, k, logger)
+
+	steps := []struct {
+		name      string
+		synced    bool
+		update    bool // KernelTimex обновлен по состоянию часов
+		lastWrite time.Duration
+	}{
+		{name: "not yet synchronized"},
+		{name: "locked", synced: true, update: true, lastWrite: time.Minute},
+		{name: "still locked", synced: true, update: true, lastWrite: time.Minute},
+		{name: "unsynchronized", update: true, lastWrite: time.Minute},
+		{name: "locked again", synced: true, update: true, lastWrite: 4 * time.Minute},
+	}
+
+	for i, step := range steps {
+		now := simulationEpoch.Add(time.Duration(i) * time.Minute)
+		if step.update {
+			if err := k.Update(now, step.synced, 0, 0, 0, 0, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		before := writes
+		if err := r.checkKernelSync(); err != nil {
+			t.Fatalf("%s: checkKernelSync() error = %v", step.name, err)
+		}
+		if writes != before {
+			t.Errorf("%s: RTC sync wrote kernel status", step.name)
+		}
+		if unsync := kernel.Status&unix.STA_UNSYNC != 0; unsync == step.synced {
+			t.Errorf("%s: STA_UNSYNC = %v, want %v", step.name, unsync, !step.synced)
+		}
+
+		status := r.Status()
+		if step.lastWrite == 0 && !status.LastWrite.IsZero() || step.lastWrite > 0 && !status.LastWrite.Equal(simulationEpoch.Add(step.lastWrite)) {
+			t.Errorf("%s: last write = %v, want epoch + %v", step.name, status.LastWrite, step.lastWrite)
+		}
+	}
+
+	// Ошибка записи состояния ядра видна и в синхронизации RTC
+	writeErr = unix.EPERM
+	if err := k.Update(simulationEpoch.Add(time.Hour), true, 0, 0, 0, 0, ""); err == nil {
+		t.Fatal("KernelTimex.Update() error = nil, want EPERM")
+	}
+	if err := r.checkKernelSync(); err == nil || !strings.Contains(err.Error(), "kernel status not updated") {
+		t.Errorf("checkKernelSync() error = %v, want kernel status error", err)
+	}
+
+	// Без kernel_sync ядро не управляется, и режим kernel не работает
+	disabled := NewRTCSync(config.SyncRTCConfig{Mode: RTCModeKernel}, NewKernelTimex(false, logger), logger)
+	if err := disabled.checkKernelSync(); err == nil || !strings.Contains(err.Error(), "requires clock kernel_sync") {
+		t.Errorf("checkKernelSync() error = %v, want kernel_sync required", err)
+	}
+}
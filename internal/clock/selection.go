@@ -0,0 +1,428 @@
+package clock
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+const (
+	defaultSelectionMinDistance  = time.Millisecond
+	defaultSelectionMaxDistance  = 1500 * time.Millisecond // MAXDIST из RFC 5905
+	defaultSelectionMinSurvivors = 3                       // NMIN из RFC 5905
+)
+
+// SelectionStatus статус источника после алгоритма выбора
+type SelectionStatus string
+
+const (
+	SelectionUnusable    SelectionStatus = "unusable"    // Нет измерения или слишком большое root distance
+	SelectionFalseticker SelectionStatus = "falseticker" // Интервал не пересекается с пересечением большинства
+	SelectionTruechimer  SelectionStatus = "truechimer"  // Прошел пересечение, отброшен кластеризацией
+	SelectionCandidate   SelectionStatus = "candidate"   // Участвует в комбинировании смещения
+	SelectionSelected    SelectionStatus = "selected"    // Системный источник (system peer)
+	SelectionStandby     SelectionStatus = "standby"     // Secondary источник в резерве, пока пригоден primary
+)
+
+// SourceSample отфильтрованное измерение источника, передаваемое в
+// алгоритм выбора. Info равен nil, если источник не дал измерения.
+type SourceSample struct {
+	Name    string
+	Tier    SourceTier
+	Handler protocols.TimeSourceHandler
+	Info    *protocols.TimeInfo
+	Filter  FilterOutput
+}
+
+// tier возвращает уровень источника, по умолчанию primary
+func (s SourceSample) tier() SourceTier {
+	if s.Tier == "" {
+		return SourceTierPrimary
+	}
+	return s.Tier
+}
+
+// SourceSelection результат выбора для одного источника
+type SourceSelection struct {
+	Status       SelectionStatus `json:"status"`
+	Offset       time.Duration   `json:"offset"`
+	RootDistance time.Duration   `json:"root_distance"`
+	Jitter       time.Duration   `json:"jitter"`
+	Dispersion   time.Duration   `json:"dispersion"`
+	Weight       float64         `json:"weight"`
+}
+
+// SelectionResult результат алгоритма выбора источников
+type SelectionResult struct {
+	Selected  string                      // Имя системного источника
+	Handler   protocols.TimeSourceHandler // Обработчик системного источника
+	Info      *protocols.TimeInfo         // Измерение системного источника
+	Filter    FilterOutput                // Результат фильтра системного источника
+	Offset    time.Duration               // Комбинированное смещение выживших источников
+	Jitter    time.Duration               // Джиттер выбора (разброс выживших)
+	Survivors int
+	Sources   map[string]SourceSelection
+
+	survivors []*selectionCandidate // Выжившие в порядке метрики
+}
+
+// selectionCandidate рабочее состояние источника внутри алгоритма
+type selectionCandidate struct {
+	sample       SourceSample
+	offset       float64 // ns
+	rootDistance float64 // ns
+	jitter       float64 // ns
+	dispersion   float64 // ns
+	metric       float64
+}
+
+// SourceSelector выбирает источники по алгоритму NTPv4: пересечение
+// Марзулло отсеивает falsetickers, кластеризация удаляет выбросы, а
+// комбинирование усредняет смещения выживших с весами 1/root distance.
+type SourceSelector struct {
+	minDistance  time.Duration
+	maxDistance  time.Duration
+	minSurvivors int
+}
+
+// NewSourceSelector создает селектор источников
+func NewSourceSelector(cfg config.SelectionConfig) *SourceSelector {
+	s := &SourceSelector{
+		minDistance:  defaultSelectionMinDistance,
+		maxDistance:  defaultSelectionMaxDistance,
+		minSurvivors: defaultSelectionMinSurvivors,
+	}
+
+	if cfg.MinDistance > 0 {
+		s.minDistance = cfg.MinDistance
+	}
+	if cfg.MaxDistance > 0 {
+		s.maxDistance = cfg.MaxDistance
+	}
+	if cfg.MinSurvivors > 0 {
+		s.minSurvivors = cfg.MinSurvivors
+	}
+
+	return s
+}
+
+// Select выполняет выбор по уровням: secondary источники используются,
+// только если ни один primary не пригоден. Если ни один источник не
+// пригоден, Handler результата равен nil.
+func (s *SourceSelector) Select(samples []SourceSample) *SelectionResult {
+	var primary, secondary []SourceSample
+	for _, sample := range samples {
+		if sample.tier() == SourceTierSecondary {
+			secondary = append(secondary, sample)
+		} else {
+			primary = append(primary, sample)
+		}
+	}
+
+	result := s.selectTier(primary)
+	if result.Handler == nil && len(secondary) > 0 {
+		fallback := s.selectTier(secondary)
+		for name, selection := range result.Sources {
+			fallback.Sources[name] = selection
+		}
+		return fallback
+	}
+
+	for _, sample := range secondary {
+		if sample.Info == nil {
+			result.Sources[sample.Name] = SourceSelection{Status: SelectionUnusable}
+			continue
+		}
+		c := s.newCandidate(sample)
+		if c.rootDistance > float64(s.maxDistance) {
+			result.Sources[sample.Name] = c.selection(SelectionUnusable, 0)
+			continue
+		}
+		result.Sources[sample.Name] = c.selection(SelectionStandby, 0)
+	}
+
+	return result
+}
+
+// selectTier выполняет пересечение, кластеризацию и комбинирование
+// источников одного уровня
+func (s *SourceSelector) selectTier(samples []SourceSample) *SelectionResult {
+	result := &SelectionResult{
+		Sources: make(map[string]SourceSelection, len(samples)),
+	}
+
+	var candidates []*selectionCandidate
+	for _, sample := range samples {
+		if sample.Info == nil {
+			result.Sources[sample.Name] = SourceSelection{Status: SelectionUnusable}
+			continue
+		}
+
+		c := s.newCandidate(sample)
+		if c.rootDistance > float64(s.maxDistance) {
+			result.Sources[sample.Name] = c.selection(SelectionUnusable, 0)
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+
+	truechimers := s.intersect(candidates, result)
+	if len(truechimers) == 0 {
+		return result
+	}
+
+	survivors := s.cluster(truechimers, result)
+	s.combine(survivors, result)
+
+	return result
+}
+
+// newCandidate вычисляет root distance источника по результату его фильтра
+func (s *SourceSelector) newCandidate(sample SourceSample) *selectionCandidate {
+	info := sample.Info
+	filter := sample.Filter
+
+	distance := float64(filter.Delay)/2 +
+		float64(info.RootDelay)/2 +
+		float64(info.RootDispersion) +
+		float64(filter.Dispersion) +
+		float64(filter.Jitter)
+	if distance < float64(s.minDistance) {
+		distance = float64(s.minDistance)
+	}
+
+	return &selectionCandidate{
+		sample:       sample,
+		offset:       float64(filter.Offset),
+		rootDistance: distance,
+		jitter:       float64(filter.Jitter),
+		dispersion:   float64(filter.Dispersion),
+		metric:       float64(info.Stratum)*float64(s.maxDistance) + distance,
+	}
+}
+
+// selection формирует запись о статусе источника
+func (c *selectionCandidate) selection(status SelectionStatus, weight float64) SourceSelection {
+	return SourceSelection{
+		Status:       status,
+		Offset:       time.Duration(c.offset),
+		RootDistance: time.Duration(c.rootDistance),
+		Jitter:       time.Duration(c.jitter),
+		Dispersion:   time.Duration(c.dispersion),
+		Weight:       weight,
+	}
+}
+
+// intersect находит пересечение интервалов [offset-λ, offset+λ], которому
+// удовлетворяет большинство источников (алгоритм Марзулло, RFC 5905 A.5.5.1)
+func (s *SourceSelector) intersect(candidates []*selectionCandidate, result *SelectionResult) []*selectionCandidate {
+	n := len(candidates)
+	if n == 0 {
+		return nil
+	}
+
+	type endpoint struct {
+		edge float64
+		kind int // +1 нижняя граница, 0 середина, -1 верхняя граница
+	}
+
+	endpoints := make([]endpoint, 0, 3*n)
+	for _, c := range candidates {
+		endpoints = append(endpoints,
+			endpoint{edge: c.offset - c.rootDistance, kind: +1},
+			endpoint{edge: c.offset, kind: 0},
+			endpoint{edge: c.offset + c.rootDistance, kind: -1},
+		)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].edge == endpoints[j].edge {
+			return endpoints[i].kind > endpoints[j].kind
+		}
+		return endpoints[i].edge < endpoints[j].edge
+	})
+
+	var low, high float64
+	found := false
+	for allow := 0; 2*allow < n; allow++ {
+		midpoints := 0
+
+		chime := 0
+		low = math.Inf(1)
+		for _, e := range endpoints {
+			chime += e.kind
+			if chime >= n-allow {
+				low = e.edge
+				break
+			}
+			if e.kind == 0 {
+				midpoints++
+			}
+		}
+
+		chime = 0
+		high = math.Inf(-1)
+		for i := len(endpoints) - 1; i >= 0; i-- {
+			e := endpoints[i]
+			chime -= e.kind
+			if chime >= n-allow {
+				high = e.edge
+				break
+			}
+			if e.kind == 0 {
+				midpoints++
+			}
+		}
+
+		if midpoints > allow {
+			continue
+		}
+		if high >= low {
+			found = true
+			break
+		}
+	}
+
+	var truechimers []*selectionCandidate
+	for _, c := range candidates {
+		if found && c.offset-c.rootDistance <= high && c.offset+c.rootDistance >= low {
+			truechimers = append(truechimers, c)
+			continue
+		}
+		result.Sources[c.sample.Name] = c.selection(SelectionFalseticker, 0)
+	}
+
+	return truechimers
+}
+
+// cluster удаляет источники с наибольшим джиттером выбора, пока он
+// превышает джиттер самих источников (RFC 5905 A.5.5.2)
+func (s *SourceSelector) cluster(truechimers []*selectionCandidate, result *SelectionResult) []*selectionCandidate {
+	survivors := append([]*selectionCandidate(nil), truechimers...)
+	sort.Slice(survivors, func(i, j int) bool {
+		// При равной метрике порядок, а с ним системный источник и сумма
+		// комбинирования, не зависят от порядка опроса источников
+		if survivors[i].metric == survivors[j].metric {
+			return survivors[i].sample.Name < survivors[j].sample.Name
+		}
+		return survivors[i].metric < survivors[j].metric
+	})
+
+	for len(survivors) > s.minSurvivors {
+		maxSelJitter, worst := -1.0, 0
+		minPeerJitter := math.Inf(1)
+
+		for i, c := range survivors {
+			selJitter := selectionJitter(survivors, c)
+			if selJitter > maxSelJitter {
+				maxSelJitter = selJitter
+				worst = i
+			}
+			if c.jitter < minPeerJitter {
+				minPeerJitter = c.jitter
+			}
+		}
+
+		if maxSelJitter <= minPeerJitter {
+			break
+		}
+
+		pruned := survivors[worst]
+		result.Sources[pruned.sample.Name] = pruned.selection(SelectionTruechimer, 0)
+		survivors = append(survivors[:worst], survivors[worst+1:]...)
+	}
+
+	return survivors
+}
+
+// selectionJitter среднеквадратичное отклонение смещений остальных выживших
+// от смещения источника c
+func selectionJitter(survivors []*selectionCandidate, c *selectionCandidate) float64 {
+	if len(survivors) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, other := range survivors {
+		diff := other.offset - c.offset
+		sum += diff * diff
+	}
+	return math.Sqrt(sum / float64(len(survivors)-1))
+}
+
+// combine усредняет смещения выживших с весами 1/root distance, умноженными
+// на вес источника из конфигурации (RFC 5905 A.5.5.3)
+func (s *SourceSelector) combine(survivors []*selectionCandidate, result *SelectionResult) {
+	var sumWeight, sumOffset float64
+	weights := make([]float64, len(survivors))
+
+	for i, c := range survivors {
+		weight := 1 / c.rootDistance
+		if configWeight := c.sample.Handler.GetConfig().Weight; configWeight > 0 {
+			weight *= float64(configWeight)
+		}
+		weights[i] = weight
+		sumWeight += weight
+		sumOffset += weight * c.offset
+	}
+
+	// Системный источник - выживший с наименьшей метрикой
+	peer := survivors[0]
+
+	for i, c := range survivors {
+		status := SelectionCandidate
+		if c == peer {
+			status = SelectionSelected
+		}
+		result.Sources[c.sample.Name] = c.selection(status, weights[i]/sumWeight)
+	}
+
+	result.Offset = time.Duration(sumOffset / sumWeight)
+	result.Survivors = len(survivors)
+	result.survivors = survivors
+	result.setPeer(peer)
+}
+
+// SetPeer делает системным источником выжившего с именем name. Возвращает
+// false, если такого выжившего нет.
+func (r *SelectionResult) SetPeer(name string) bool {
+	for _, c := range r.survivors {
+		if c.sample.Name == name {
+			r.setPeer(c)
+			return true
+		}
+	}
+	return false
+}
+
+// clearPeer снимает выбор системного источника, комбинированное смещение
+// при этом не используется
+func (r *SelectionResult) clearPeer() {
+	if selection, ok := r.Sources[r.Selected]; ok {
+		selection.Status = SelectionCandidate
+		r.Sources[r.Selected] = selection
+	}
+	r.Selected = ""
+	r.Handler = nil
+	r.Info = nil
+}
+
+// setPeer обновляет системный источник и статусы выживших
+func (r *SelectionResult) setPeer(peer *selectionCandidate) {
+	if previous, ok := r.Sources[r.Selected]; ok && r.Selected != peer.sample.Name {
+		previous.Status = SelectionCandidate
+		r.Sources[r.Selected] = previous
+	}
+	if selection, ok := r.Sources[peer.sample.Name]; ok {
+		selection.Status = SelectionSelected
+		r.Sources[peer.sample.Name] = selection
+	}
+
+	r.Selected = peer.sample.Name
+	r.Handler = peer.sample.Handler
+	r.Info = peer.sample.Info
+	r.Filter = peer.sample.Filter
+	r.Jitter = time.Duration(selectionJitter(r.survivors, peer))
+}
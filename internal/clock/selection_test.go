@@ -0,0 +1,142 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+// testSource источник для выбора: смещение и root distance
+type testSource struct {
+	name     string
+	offset   time.Duration
+	distance time.Duration
+}
+
+// selectionSamples создает измерения источников, root distance которых
+// равно половине задержки фильтра
+func selectionSamples(t *testing.T, sources []testSource) []SourceSample {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	samples := make([]SourceSample, len(sources))
+	for i, source := range sources {
+		handler, err := protocols.NewMockHandler(config.TimeSourceConfig{Type: "mock", Name: source.name, Weight: 1}, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples[i] = SourceSample{
+			Name:    source.name,
+			Handler: handler,
+			Info:    &protocols.TimeInfo{Offset: source.offset, Stratum: 1},
+			Filter:  FilterOutput{Offset: source.offset, Delay: 2 * source.distance},
+		}
+	}
+	return samples
+}
+
+func TestSourceSelectorSelect(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name     string
+		sources  []testSource
+		selected string
+		offset   time.Duration
+		status   map[string]SelectionStatus
+	}{
+		{
+			name:     "single source",
+			sources:  []testSource{{"a", 5 * ms, 2 * ms}},
+			selected: "a",
+			offset:   5 * ms,
+			status:   map[string]SelectionStatus{"a": SelectionSelected},
+		},
+		{
+			name:     "minority falseticker",
+			sources:  []testSource{{"a", 0, 2 * ms}, {"b", ms, 2 * ms}, {"c", 50 * ms, 2 * ms}},
+			selected: "a",
+			offset:   ms / 2,
+			status:   map[string]SelectionStatus{"a": SelectionSelected, "b": SelectionCandidate, "c": SelectionFalseticker},
+		},
+		{
+			name: "two falsetickers of five",
+			sources: []testSource{
+				{"a", 10 * ms, 2 * ms}, {"b", 11 * ms, 2 * ms}, {"c", 12 * ms, 2 * ms},
+				{"d", -40 * ms, 2 * ms}, {"e", 90 * ms, 2 * ms},
+			},
+			selected: "a",
+			offset:   11 * ms,
+			status: map[string]SelectionStatus{
+				"a": SelectionSelected, "b": SelectionCandidate, "c": SelectionCandidate,
+				"d": SelectionFalseticker, "e": SelectionFalseticker,
+			},
+		},
+		{
+			name:    "majority falsetickers",
+			sources: []testSource{{"a", 0, 2 * ms}, {"b", 30 * ms, 2 * ms}, {"c", 60 * ms, 2 * ms}},
+			status:  map[string]SelectionStatus{"a": SelectionFalseticker, "b": SelectionFalseticker, "c": SelectionFalseticker},
+		},
+		{
+			name:    "disjoint pair",
+			sources: []testSource{{"a", 0, 2 * ms}, {"b", 100 * ms, 2 * ms}},
+			status:  map[string]SelectionStatus{"a": SelectionFalseticker, "b": SelectionFalseticker},
+		},
+		{
+			// Веса 1/root distance: 1 и 1/3, смещение (0·1 + 0.5·1/3) / (4/3)
+			name:     "weighted combine",
+			sources:  []testSource{{"near", 0, ms}, {"far", ms / 2, 3 * ms}},
+			selected: "near",
+			offset:   ms / 8,
+			status:   map[string]SelectionStatus{"near": SelectionSelected, "far": SelectionCandidate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := NewSourceSelector(config.SelectionConfig{})
+			result := selector.Select(selectionSamples(t, tt.sources))
+
+			if result.Selected != tt.selected {
+				t.Errorf("selected = %q, want %q", result.Selected, tt.selected)
+			}
+			if (result.Handler == nil) != (tt.selected == "") {
+				t.Errorf("handler = %v, want handler only with a selected source", result.Handler)
+			}
+			if tt.selected != "" {
+				if diff := result.Offset - tt.offset; diff < -time.Microsecond || diff > time.Microsecond {
+					t.Errorf("combined offset = %v, want %v", result.Offset, tt.offset)
+				}
+			}
+			for name, want := range tt.status {
+				if got := result.Sources[name].Status; got != want {
+					t.Errorf("%s status = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceSelectorOrderIndependent(t *testing.T) {
+	ms := time.Millisecond
+	sources := []testSource{{"a", 300 * time.Microsecond, 2 * ms}, {"b", -ms, 2 * ms}, {"c", 700 * time.Microsecond, 2 * ms}}
+	reversed := []testSource{sources[2], sources[1], sources[0]}
+
+	selector := NewSourceSelector(config.SelectionConfig{})
+	first := selector.Select(selectionSamples(t, sources))
+	second := selector.Select(selectionSamples(t, reversed))
+
+	// При равных метриках системный источник - первый по имени, а
+	// комбинированное смещение совпадает до наносекунды
+	if first.Selected != "a" || second.Selected != "a" {
+		t.Errorf("selected = %q and %q, want a", first.Selected, second.Selected)
+	}
+	if first.Offset != second.Offset {
+		t.Errorf("combined offset = %v and %v", first.Offset, second.Offset)
+	}
+}
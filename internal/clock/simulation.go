@@ -0,0 +1,531 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
+)
+
+const (
+	defaultSimulationStep        = time.Second
+	defaultSimSourcePollInterval = time.Second
+	defaultSimSourcePrecision    = -20
+)
+
+// simulationEpoch начало виртуального времени: симуляция не зависит от
+// системных часов и дает одинаковый результат при каждом запуске
+var simulationEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SimTemperatureStep скачок температуры генератора в момент At от начала симуляции
+type SimTemperatureStep struct {
+	At          time.Duration
+	Temperature float64 // °C
+}
+
+// SimPhasePoint собственная фаза генератора в момент At от начала симуляции
+type SimPhasePoint struct {
+	At    time.Duration
+	Phase float64 // Смещение свободно бегущих часов от истинного времени, ns
+}
+
+// SimOscillatorConfig параметры моделируемого генератора
+type SimOscillatorConfig struct {
+	FrequencyOffset        float64              // Собственный уход частоты, ppb (> 0 - часы спешат)
+	RandomWalk             float64              // Случайное блуждание частоты, ppb/√s
+	InitialOffset          time.Duration        // Начальное смещение часов от истинного времени
+	Temperature            float64              // Начальная (опорная) температура, °C
+	TemperatureCoefficient float64              // Чувствительность частоты к температуре, ppb/°C
+	TemperatureSteps       []SimTemperatureStep // Скачки температуры
+	Seed                   int64
+
+	// Записанная собственная фаза генератора (например, восстановленная из
+	// трассы смещений и частоты). Если задана, фаза между точками
+	// интерполируется линейно, а FrequencyOffset, RandomWalk и температура
+	// не используются.
+	Phase []SimPhasePoint
+}
+
+// SimClock моделируемые часы с генератором, управляемые как ClockTarget.
+// Время идет только при вызове Advance.
+type SimClock struct {
+	mu sync.RWMutex
+
+	cfg   SimOscillatorConfig
+	rng   *rand.Rand
+	steps []SimTemperatureStep
+
+	elapsed     time.Duration // Истинное время от начала симуляции
+	phase       float64       // Смещение часов от истинного времени, ns
+	wander      float64       // Накопленное случайное блуждание, ppb
+	temperature float64
+	freqAdj     float64 // Поправка частоты от дисциплины, ppb
+}
+
+// NewSimClock создает моделируемые часы
+func NewSimClock(cfg SimOscillatorConfig) *SimClock {
+	steps := append([]SimTemperatureStep(nil), cfg.TemperatureSteps...)
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].At < steps[j].At
+	})
+	cfg.Phase = append([]SimPhasePoint(nil), cfg.Phase...)
+	sort.Slice(cfg.Phase, func(i, j int) bool {
+		return cfg.Phase[i].At < cfg.Phase[j].At
+	})
+
+	c := &SimClock{
+		cfg:         cfg,
+		rng:         rand.New(rand.NewSource(cfg.Seed)),
+		steps:       steps,
+		phase:       float64(cfg.InitialOffset),
+		temperature: cfg.Temperature,
+	}
+	if len(cfg.Phase) > 0 {
+		c.phase += c.recordedPhase(0)
+	}
+	return c
+}
+
+// Name возвращает имя часов
+func (c *SimClock) Name() string {
+	return "simulated"
+}
+
+// Now возвращает время моделируемых часов
+func (c *SimClock) Now() (time.Time, error) {
+	return c.LocalTime(), nil
+}
+
+// LocalTime возвращает время моделируемых часов
+func (c *SimClock) LocalTime() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return simulationEpoch.Add(c.elapsed + time.Duration(c.phase))
+}
+
+// TrueTime возвращает истинное время симуляции
+func (c *SimClock) TrueTime() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return simulationEpoch.Add(c.elapsed)
+}
+
+// Elapsed возвращает истинное время от начала симуляции
+func (c *SimClock) Elapsed() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.elapsed
+}
+
+// Offset возвращает смещение часов от истинного времени (часы - истина)
+func (c *SimClock) Offset() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Duration(c.phase)
+}
+
+// Temperature возвращает текущую температуру генератора
+func (c *SimClock) Temperature() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.temperature
+}
+
+// NaturalFrequency возвращает уход генератора без поправки дисциплины, ppb
+func (c *SimClock) NaturalFrequency() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.naturalFrequency()
+}
+
+func (c *SimClock) naturalFrequency() float64 {
+	return c.cfg.FrequencyOffset + c.wander +
+		c.cfg.TemperatureCoefficient*(c.temperature-c.cfg.Temperature)
+}
+
+// AdjustFrequency устанавливает поправку частоты
+func (c *SimClock) AdjustFrequency(ppb float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.freqAdj = clampFrequency(ppb, maxFrequencyPPB)
+	return nil
+}
+
+// Frequency возвращает текущую поправку частоты
+func (c *SimClock) Frequency() (float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.freqAdj, nil
+}
+
+// Step сдвигает часы на offset
+func (c *SimClock) Step(offset time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.phase += float64(offset)
+	return nil
+}
+
+// MaxFrequency возвращает предел поправки частоты
+func (c *SimClock) MaxFrequency() float64 {
+	return maxFrequencyPPB
+}
+
+// Close ничего не делает для моделируемых часов
+func (c *SimClock) Close() error {
+	return nil
+}
+
+// Advance продвигает истинное время на dt: применяет скачки температуры,
+// случайное блуждание частоты и набегает фазу
+func (c *SimClock) Advance(dt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.elapsed += dt
+	for len(c.steps) > 0 && c.steps[0].At <= c.elapsed {
+		c.temperature = c.steps[0].Temperature
+		c.steps = c.steps[1:]
+	}
+
+	seconds := dt.Seconds()
+	if len(c.cfg.Phase) > 0 {
+		c.phase += c.recordedPhase(c.elapsed) - c.recordedPhase(c.elapsed-dt) + c.freqAdj*seconds
+		return
+	}
+	if c.cfg.RandomWalk > 0 {
+		c.wander += c.cfg.RandomWalk * math.Sqrt(seconds) * c.rng.NormFloat64()
+	}
+
+	// ppb * s = ns
+	c.phase += (c.naturalFrequency() + c.freqAdj) * seconds
+}
+
+// recordedPhase интерполирует записанную фазу генератора в момент elapsed.
+// За пределами записи фаза продолжается с частотой крайнего интервала.
+func (c *SimClock) recordedPhase(elapsed time.Duration) float64 {
+	points := c.cfg.Phase
+	if len(points) == 1 {
+		return points[0].Phase
+	}
+
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].At > elapsed
+	})
+	if i == 0 {
+		i = 1
+	}
+	if i == len(points) {
+		i = len(points) - 1
+	}
+
+	a, b := points[i-1], points[i]
+	if b.At == a.At {
+		return b.Phase
+	}
+	frac := float64(elapsed-a.At) / float64(b.At-a.At)
+	return a.Phase + (b.Phase-a.Phase)*frac
+}
+
+// SimOutage интервал недоступности источника от начала симуляции
+type SimOutage struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// SimSourceConfig параметры моделируемого источника времени
+type SimSourceConfig struct {
+	Name         string
+	Type         string        // Протокол для выбора фильтра (ntp, ptp, pps, ...)
+	Tier         SourceTier    // primary (по умолчанию) или secondary
+	Trust        bool          // Источнику достаточно одного для step
+	Noise        time.Duration // СКО шума измерения смещения
+	Bias         time.Duration // Постоянная ошибка источника (например, асимметрия)
+	Delay        time.Duration // Задержка до источника
+	DelayJitter  time.Duration // СКО вариации задержки
+	Stratum      int
+	PollInterval time.Duration
+	FilterLength int // Длина фильтра измерений (0 - по умолчанию для протокола)
+	Outages      []SimOutage
+	Seed         int64
+}
+
+// SimSource моделируемый источник времени: измеряет смещение SimClock от
+// истинного времени с шумом, постоянной ошибкой и задержкой
+type SimSource struct {
+	mu sync.RWMutex
+
+	cfg    SimSourceConfig
+	source config.TimeSourceConfig
+	clock  *SimClock
+	rng    *rand.Rand
+
+	info     *protocols.TimeInfo
+	lastPoll time.Duration
+	polled   bool
+	status   protocols.ConnectionStatus
+}
+
+// NewSimSource создает моделируемый источник для часов clock
+func NewSimSource(cfg SimSourceConfig, clock *SimClock) *SimSource {
+	if cfg.Type == "" {
+		cfg.Type = "ntp"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultSimSourcePollInterval
+	}
+	if cfg.Stratum == 0 {
+		cfg.Stratum = 1
+	}
+
+	return &SimSource{
+		cfg:    cfg,
+		source: config.TimeSourceConfig{Type: cfg.Type, Host: cfg.Name, Weight: 1, FilterLength: cfg.FilterLength, Trust: cfg.Trust},
+		clock:  clock,
+		rng:    rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// available проверяет, что источник не находится в интервале недоступности
+func (s *SimSource) available(elapsed time.Duration) bool {
+	for _, outage := range s.cfg.Outages {
+		if elapsed >= outage.Start && elapsed < outage.End {
+			return false
+		}
+	}
+	return true
+}
+
+// Poll выполняет измерение, если наступило время опроса источника
+func (s *SimSource) Poll() {
+	elapsed := s.clock.Elapsed()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.available(elapsed) {
+		s.status.Connected = false
+		return
+	}
+	if s.polled && elapsed-s.lastPoll < s.cfg.PollInterval {
+		return
+	}
+	s.polled = true
+	s.lastPoll = elapsed
+
+	delay := s.cfg.Delay + time.Duration(math.Abs(s.rng.NormFloat64())*float64(s.cfg.DelayJitter))
+	noise := time.Duration(s.rng.NormFloat64() * float64(s.cfg.Noise))
+	local := s.clock.LocalTime()
+
+	s.info = &protocols.TimeInfo{
+		Timestamp:      local,
+		Offset:         -s.clock.Offset() + s.cfg.Bias + noise,
+		Delay:          delay,
+		Quality:        100,
+		Stratum:        s.cfg.Stratum,
+		Precision:      defaultSimSourcePrecision,
+		RootDispersion: s.cfg.Noise,
+	}
+	s.status.Connected = true
+	s.status.LastActivity = local
+	s.status.PacketsRx++
+}
+
+// Start ничего не делает: источник опрашивает симуляция
+func (s *SimSource) Start() error {
+	return nil
+}
+
+// Stop ничего не делает
+func (s *SimSource) Stop() error {
+	return nil
+}
+
+// GetTimeInfo возвращает последнее измерение
+func (s *SimSource) GetTimeInfo() (*protocols.TimeInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.info == nil {
+		return nil, fmt.Errorf("no measurements from simulated source %s", s.cfg.Name)
+	}
+	info := *s.info
+	return &info, nil
+}
+
+// GetStatus возвращает статус источника
+func (s *SimSource) GetStatus() protocols.ConnectionStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// GetConfig возвращает конфигурацию источника
+func (s *SimSource) GetConfig() config.TimeSourceConfig {
+	return s.source
+}
+
+// GetGNSSInfo возвращает пустую GNSS информацию
+func (s *SimSource) GetGNSSInfo() protocols.GNSSStatus {
+	return protocols.GNSSStatus{}
+}
+
+// SimPoint состояние симуляции после очередного шага
+type SimPoint struct {
+	Elapsed     time.Duration `json:"elapsed"`
+	Offset      time.Duration `json:"offset"`      // Истинное смещение часов (часы - истина)
+	Frequency   float64       `json:"frequency"`   // Поправка частоты дисциплины, ppb
+	Temperature float64       `json:"temperature"` // °C
+	State       ClockState    `json:"state"`
+}
+
+// SimulationResult траектория часов за время симуляции
+type SimulationResult struct {
+	Points   []SimPoint     `json:"points"`
+	Steps    []StepRecord   `json:"steps"`
+	Switches []SwitchRecord `json:"switches"`
+}
+
+// RMSOffset возвращает СКО истинного смещения начиная с момента from
+func (r *SimulationResult) RMSOffset(from time.Duration) time.Duration {
+	var sum float64
+	var n int
+	for _, p := range r.Points {
+		if p.Elapsed < from {
+			continue
+		}
+		sum += float64(p.Offset) * float64(p.Offset)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(sum / float64(n)))
+}
+
+// MaxOffset возвращает максимальное по модулю истинное смещение начиная с from
+func (r *SimulationResult) MaxOffset(from time.Duration) time.Duration {
+	var max time.Duration
+	for _, p := range r.Points {
+		if p.Elapsed < from {
+			continue
+		}
+		abs := p.Offset
+		if abs < 0 {
+			abs = -abs
+		}
+		if abs > max {
+			max = abs
+		}
+	}
+	return max
+}
+
+// Final возвращает последнюю точку траектории
+func (r *SimulationResult) Final() SimPoint {
+	if len(r.Points) == 0 {
+		return SimPoint{}
+	}
+	return r.Points[len(r.Points)-1]
+}
+
+// Simulation детерминированная симуляция менеджера часов в виртуальном
+// времени: моделируемый генератор, моделируемые источники и настоящие
+// фильтры, выбор источников, политика шага и дисциплина
+type Simulation struct {
+	clock   *SimClock
+	sources []*SimSource
+	manager *Manager
+	step    time.Duration
+}
+
+// NewSimulation создает симуляцию менеджера с конфигурацией cfg
+func NewSimulation(cfg config.ShiwaTimeConfig, oscillator SimOscillatorConfig, sources []SimSourceConfig, logger *logrus.Logger) (*Simulation, error) {
+	clock := NewSimClock(oscillator)
+
+	sim := &Simulation{
+		clock:   clock,
+		manager: newManager(cfg, clock, clock.LocalTime, logger),
+		step:    defaultSimulationStep,
+	}
+
+	for i, sourceConfig := range sources {
+		if sourceConfig.Name == "" {
+			sourceConfig.Name = fmt.Sprintf("sim_%d", i)
+		}
+		if _, exists := sim.manager.sources[sourceConfig.Name]; exists {
+			return nil, fmt.Errorf("duplicate simulated source name: %s", sourceConfig.Name)
+		}
+
+		source := NewSimSource(sourceConfig, clock)
+		filter, err := NewSampleFilter(source.GetConfig())
+		if err != nil {
+			return nil, err
+		}
+
+		sim.sources = append(sim.sources, source)
+		sim.manager.sources[sourceConfig.Name] = source
+		sim.manager.filters[sourceConfig.Name] = filter
+		sim.manager.tiers[sourceConfig.Name] = sourceConfig.Tier
+	}
+
+	// Датчик температурной компенсации показывает температуру генератора
+	if sim.manager.temperature != nil {
+		sim.manager.temperature.read = func() (float64, error) {
+			return clock.Temperature(), nil
+		}
+	}
+
+	return sim, nil
+}
+
+// Clock возвращает моделируемые часы
+func (s *Simulation) Clock() *SimClock {
+	return s.clock
+}
+
+// Manager возвращает менеджер часов под симуляцией
+func (s *Simulation) Manager() *Manager {
+	return s.manager
+}
+
+// SetFrequency задает поправку частоты часов и оценку частоты дисциплины,
+// как после восстановления из drift файла
+func (s *Simulation) SetFrequency(ppb float64) {
+	s.manager.setFrequency(ppb)
+}
+
+// Run продвигает симуляцию на duration шагами по секунде, выполняя цикл
+// синхронизации менеджера на каждом шаге
+func (s *Simulation) Run(duration time.Duration) *SimulationResult {
+	result := &SimulationResult{}
+
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += s.step {
+		s.clock.Advance(s.step)
+		for _, source := range s.sources {
+			source.Poll()
+		}
+
+		// Ошибки цикла (нет источников, отказ политики шага) - часть сценария
+		_ = s.manager.synchronizeClock()
+
+		freq, _ := s.clock.Frequency()
+		result.Points = append(result.Points, SimPoint{
+			Elapsed:     s.clock.Elapsed(),
+			Offset:      s.clock.Offset(),
+			Frequency:   freq,
+			Temperature: s.clock.Temperature(),
+			State:       s.manager.GetState(),
+		})
+	}
+
+	result.Steps = s.manager.GetStepHistory()
+	result.Switches = s.manager.GetSwitchHistory()
+	return result
+}
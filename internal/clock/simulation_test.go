@@ -0,0 +1,353 @@
+package clock
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func newTestSimulation(t *testing.T, cfg config.ShiwaTimeConfig, oscillator SimOscillatorConfig, sources []SimSourceConfig) *Simulation {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// Загрузчик конфигурации по умолчанию включает adjust_clock
+	cfg.ClockSync.AdjustClock = true
+
+	sim, err := NewSimulation(cfg, oscillator, sources, logger)
+	if err != nil {
+		t.Fatalf("NewSimulation() error = %v", err)
+	}
+	return sim
+}
+
+// simSources создает n одинаковых источников с независимым шумом
+func simSources(n int, typ string, noise time.Duration, outages ...SimOutage) []SimSourceConfig {
+	sources := make([]SimSourceConfig, n)
+	for i := range sources {
+		sources[i] = SimSourceConfig{
+			Type:    typ,
+			Noise:   noise,
+			Delay:   time.Millisecond,
+			Outages: outages,
+			Seed:    int64(i + 1),
+		}
+	}
+	return sources
+}
+
+// meanFrequency возвращает среднюю поправку частоты начиная с from
+func meanFrequency(result *SimulationResult, from time.Duration) float64 {
+	var sum float64
+	var n int
+	for _, p := range result.Points {
+		if p.Elapsed >= from {
+			sum += p.Frequency
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func TestSimulationDeterministic(t *testing.T) {
+	oscillator := SimOscillatorConfig{FrequencyOffset: 5000, RandomWalk: 0.5, Seed: 3}
+	run := func() *SimulationResult {
+		sim := newTestSimulation(t, config.ShiwaTimeConfig{}, oscillator, simSources(3, "ntp", 100*time.Microsecond))
+		return sim.Run(10 * time.Minute)
+	}
+
+	first, second := run(), run()
+	for i := range first.Points {
+		if first.Points[i] != second.Points[i] {
+			t.Fatalf("point %d differs: %+v != %+v", i, first.Points[i], second.Points[i])
+		}
+	}
+}
+
+func TestSimulationConvergence(t *testing.T) {
+	type convergenceCase struct {
+		name      string
+		algorithm string
+		source    string
+		maxRMS    time.Duration
+	}
+
+	// Каждый алгоритм на каждом типе источника: 3 источника с шумом 50 мкс,
+	// генератор уходит на 20 ppm, начальное смещение ниже порога step
+	algorithms := []struct {
+		name   string
+		maxRMS time.Duration
+	}{
+		{name: "pid", maxRMS: 25 * time.Microsecond},
+		{name: "pi", maxRMS: 25 * time.Microsecond},
+		{name: "kalman", maxRMS: 10 * time.Microsecond},
+		{name: "hybrid", maxRMS: 10 * time.Microsecond},
+		{name: "adaptive", maxRMS: 10 * time.Microsecond},
+	}
+	var tests []convergenceCase
+	for _, algorithm := range algorithms {
+		for _, source := range []string{"ntp", "ptp", "pps"} {
+			tests = append(tests, convergenceCase{
+				name:      algorithm.name + "_" + source,
+				algorithm: algorithm.name,
+				source:    source,
+				maxRMS:    algorithm.maxRMS,
+			})
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: tt.algorithm}}
+			oscillator := SimOscillatorConfig{
+				FrequencyOffset: 20000,
+				RandomWalk:      0.1,
+				InitialOffset:   200 * time.Millisecond,
+				Seed:            7,
+			}
+
+			sim := newTestSimulation(t, cfg, oscillator, simSources(3, tt.source, 50*time.Microsecond))
+			result := sim.Run(2 * time.Hour)
+
+			if rms := result.RMSOffset(90 * time.Minute); rms > tt.maxRMS {
+				t.Errorf("RMS offset after lock = %v, want <= %v", rms, tt.maxRMS)
+			}
+			if state := result.Final().State; state != ClockStateLocked {
+				t.Errorf("final state = %v, want %v", state, ClockStateLocked)
+			}
+			if len(result.Steps) != 0 {
+				t.Errorf("steps = %d, want 0 for offset below step threshold", len(result.Steps))
+			}
+
+			// Дисциплина компенсирует собственный уход генератора
+			if residual := meanFrequency(result, 90*time.Minute) + sim.Clock().NaturalFrequency(); residual > 200 || residual < -200 {
+				t.Errorf("residual frequency = %.1f ppb, want ~0", residual)
+			}
+		})
+	}
+}
+
+func TestSimulationHoldover(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman"}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: -15000, RandomWalk: 0.05, Seed: 11}
+	outage := SimOutage{Start: time.Hour, End: 90 * time.Minute}
+
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond, outage))
+	result := sim.Run(2 * time.Hour)
+
+	var holdover, maxError time.Duration
+	for _, p := range result.Points {
+		if p.Elapsed <= outage.Start+time.Minute || p.Elapsed >= outage.End {
+			continue
+		}
+		if p.State != ClockStateHoldover {
+			t.Fatalf("state at %v = %v, want %v", p.Elapsed, p.State, ClockStateHoldover)
+		}
+		holdover += time.Second
+		abs := p.Offset
+		if abs < 0 {
+			abs = -abs
+		}
+		if abs > maxError {
+			maxError = abs
+		}
+	}
+
+	if holdover == 0 {
+		t.Fatal("clock never entered holdover")
+	}
+	// Без модели частоты часы ушли бы на 15 ppm * 30 мин = 27 мс
+	if maxError > time.Millisecond {
+		t.Errorf("max holdover error = %v, want <= 1ms", maxError)
+	}
+	if state := result.Final().State; state != ClockStateLocked {
+		t.Errorf("state after recovery = %v, want %v", state, ClockStateLocked)
+	}
+	if rms := result.RMSOffset(outage.End + 10*time.Minute); rms > 20*time.Microsecond {
+		t.Errorf("RMS offset after recovery = %v, want <= 20µs", rms)
+	}
+}
+
+func TestSimulationHoldoverExpiry(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{
+		Algorithm: "kalman",
+		Holdover:  config.HoldoverConfig{MaxDuration: 10 * time.Minute},
+	}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: -15000, RandomWalk: 0.05, Seed: 11}
+	outage := SimOutage{Start: time.Hour, End: 90 * time.Minute}
+
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond, outage))
+	result := sim.Run(80 * time.Minute)
+
+	// После исчерпания бюджета holdover не активен и не накапливает
+	// время и ошибку свободного хода
+	if state := result.Final().State; state != ClockStateFreeRunning {
+		t.Fatalf("state = %v, want %v", state, ClockStateFreeRunning)
+	}
+	status := sim.Manager().GetStatistics().Holdover
+	if status.Active || !status.Expired {
+		t.Errorf("holdover = %+v, want expired and inactive", status)
+	}
+	if status.Duration < 10*time.Minute || status.Duration > 11*time.Minute {
+		t.Errorf("holdover duration = %v, want frozen at ~10m", status.Duration)
+	}
+}
+
+func TestSimulationTemperatureStep(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman"}}
+	oscillator := SimOscillatorConfig{
+		FrequencyOffset:        3000,
+		Temperature:            25,
+		TemperatureCoefficient: 100,
+		TemperatureSteps:       []SimTemperatureStep{{At: 30 * time.Minute, Temperature: 35}},
+		Seed:                   5,
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+	result := sim.Run(time.Hour)
+
+	natural := sim.Clock().NaturalFrequency()
+	if natural != 4000 {
+		t.Fatalf("natural frequency = %.1f ppb, want 4000", natural)
+	}
+
+	// Скачок частоты на 1 ppm отрабатывается без потери захвата
+	if max := result.MaxOffset(30 * time.Minute); max > time.Millisecond {
+		t.Errorf("max offset after temperature step = %v, want <= 1ms", max)
+	}
+	if state := result.Final().State; state != ClockStateLocked {
+		t.Errorf("final state = %v, want %v", state, ClockStateLocked)
+	}
+	if residual := meanFrequency(result, 50*time.Minute) + natural; residual > 100 || residual < -100 {
+		t.Errorf("residual frequency after temperature step = %.1f ppb, want ~0", residual)
+	}
+}
+
+func TestSimulationStep(t *testing.T) {
+	oscillator := SimOscillatorConfig{FrequencyOffset: 1000, InitialOffset: 10 * time.Second, Seed: 1}
+
+	t.Run("startup", func(t *testing.T) {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman"}}
+		sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+		result := sim.Run(30 * time.Minute)
+
+		if len(result.Steps) != 1 {
+			t.Fatalf("steps = %d, want exactly 1", len(result.Steps))
+		}
+		step := result.Steps[0]
+		if step.Action != StepActionStep || step.Reason != "startup" {
+			t.Errorf("step = %s/%s, want step/startup", step.Action, step.Reason)
+		}
+		if step.Offset > -9*time.Second || step.Offset < -11*time.Second {
+			t.Errorf("step offset = %v, want ~-10s", step.Offset)
+		}
+		if rms := result.RMSOffset(15 * time.Minute); rms > 50*time.Microsecond {
+			t.Errorf("RMS offset after step = %v, want <= 50µs", rms)
+		}
+	})
+
+	t.Run("panic_threshold", func(t *testing.T) {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{PanicThreshold: 5 * time.Second}}
+		sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+		result := sim.Run(time.Minute)
+
+		if len(result.Steps) == 0 {
+			t.Fatal("expected refused offset in step history")
+		}
+		for _, record := range result.Steps {
+			if record.Action != StepActionRefuse || record.Reason != "panic_threshold" {
+				t.Errorf("record = %s/%s, want refuse/panic_threshold", record.Action, record.Reason)
+			}
+		}
+		if offset := result.Final().Offset; offset < 9*time.Second {
+			t.Errorf("offset = %v, clock must not be adjusted", offset)
+		}
+	})
+
+	t.Run("quorum", func(t *testing.T) {
+		run := func(trust bool) (*SimulationResult, int) {
+			sources := simSources(1, "ntp", 50*time.Microsecond)
+			sources[0].Trust = trust
+			sim := newTestSimulation(t, config.ShiwaTimeConfig{}, oscillator, sources)
+			sub := sim.Manager().Events().Subscribe(ParseEventFilter("step_rejected", ""), 256)
+			defer sub.Close()
+			result := sim.Run(time.Minute)
+			return result, len(sub.C)
+		}
+
+		// Один источник без trust не может ни шагнуть часы, ни увести их
+		// подстройкой частоты после окна makestep; каждый отказ - тревога
+		result, alarms := run(false)
+		if len(result.Steps) != 1 || result.Steps[0].Action != StepActionRefuse || result.Steps[0].Reason != "no_quorum" {
+			t.Fatalf("steps = %+v, want refuse/no_quorum", result.Steps)
+		}
+		if result.Steps[0].Count <= defaultMakeStepLimit {
+			t.Errorf("refusals = %d, want refusals beyond the makestep window", result.Steps[0].Count)
+		}
+		if alarms != result.Steps[0].Count {
+			t.Errorf("step_rejected events = %d, refusals = %d", alarms, result.Steps[0].Count)
+		}
+		final := result.Final()
+		if final.Offset < 9*time.Second || final.Frequency != 0 {
+			t.Errorf("offset = %v, frequency = %.0f ppb, clock must not be adjusted", final.Offset, final.Frequency)
+		}
+
+		// Источнику с trust подтверждение не нужно
+		result, alarms = run(true)
+		if len(result.Steps) != 1 || result.Steps[0].Action != StepActionStep || alarms != 0 {
+			t.Errorf("steps = %+v, alarms = %d, want one step", result.Steps, alarms)
+		}
+	})
+
+	t.Run("last_good", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "last_good")
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman", LastGoodFile: path, LastGoodFileInterval: time.Minute}}
+
+		// Часы спешат на 10 с, а сохраненное время еще позже: шаг назад отвергается
+		future := simulationEpoch.Add(time.Hour)
+		if err := os.WriteFile(path, []byte(future.Format(time.RFC3339Nano)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+		sim.Manager().restoreLastGood()
+		result := sim.Run(time.Minute)
+		if len(result.Steps) == 0 {
+			t.Fatal("expected refused step in step history")
+		}
+		for _, record := range result.Steps {
+			if record.Action != StepActionRefuse || record.Reason != "before_last_good" {
+				t.Errorf("record = %s/%s, want refuse/before_last_good", record.Action, record.Reason)
+			}
+		}
+
+		// Захваченные часы сохраняют время, и шаг после него разрешен
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		sim = newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond))
+		result = sim.Run(30 * time.Minute)
+		if len(result.Steps) != 1 || result.Steps[0].Action != StepActionStep {
+			t.Fatalf("steps = %+v, want one step", result.Steps)
+		}
+		status := sim.Manager().GetStatistics().LastGood
+		if status.LastError != "" || status.Time.Before(simulationEpoch.Add(25*time.Minute)) {
+			t.Errorf("last good status = %+v", status)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err != nil || !saved.Equal(status.Time) {
+			t.Errorf("saved last good time = %q, %v", data, err)
+		}
+	})
+}
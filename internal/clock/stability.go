@@ -0,0 +1,81 @@
+package clock
+
+import (
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/stability"
+)
+
+// StabilityReport характеристики стабильности дисциплинированных часов и
+// каждого источника
+type StabilityReport struct {
+	Clock     stability.Result            `json:"clock"`
+	Sources   map[string]stability.Result `json:"sources"`
+	Timestamp time.Time                   `json:"timestamp"`
+}
+
+// analyzeHistory вычисляет характеристики стабильности по смещениям истории,
+// измеренным после since
+func analyzeHistory(history *SourceHistory, since time.Time, masks []stability.Mask) stability.Result {
+	if history == nil {
+		return stability.Analyze(nil, 0)
+	}
+
+	points := history.Query(since, time.Time{}, 0)
+	timestamps := make([]time.Time, len(points))
+	offsets := make([]time.Duration, len(points))
+	for i, point := range points {
+		timestamps[i] = point.Timestamp
+		offsets[i] = point.Offset
+	}
+	return stability.AnalyzeSamples(timestamps, offsets, masks...)
+}
+
+// GetStability возвращает характеристики стабильности. Для источников
+// анализируется история их смещений относительно локальных часов, для
+// часов - остаточное смещение от системного источника после дисциплины.
+// Step часов разрывает фазу, поэтому учитываются измерения после него.
+func (m *Manager) GetStability() StabilityReport {
+	since := m.lastStep()
+
+	m.mu.RLock()
+	histories := make(map[string]*SourceHistory, len(m.sources))
+	for name := range m.sources {
+		histories[name] = m.histories[name]
+	}
+	m.mu.RUnlock()
+
+	report := StabilityReport{
+		Clock:     analyzeHistory(m.clockHistory, since, m.masks),
+		Sources:   make(map[string]stability.Result, len(histories)),
+		Timestamp: m.now(),
+	}
+	for name, history := range histories {
+		report.Sources[name] = analyzeHistory(history, since, m.masks)
+	}
+	return report
+}
+
+// GetSourceStability возвращает характеристики стабильности источника
+func (m *Manager) GetSourceStability(name string) (stability.Result, bool) {
+	m.mu.RLock()
+	_, exists := m.sources[name]
+	history := m.histories[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return stability.Result{}, false
+	}
+	return analyzeHistory(history, m.lastStep(), m.masks), true
+}
+
+// lastStep возвращает время последнего step часов
+func (m *Manager) lastStep() time.Time {
+	history := m.stepPolicy.History()
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Action == StepActionStep {
+			return history[i].Timestamp
+		}
+	}
+	return time.Time{}
+}
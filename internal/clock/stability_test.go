@@ -0,0 +1,56 @@
+package clock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestSimulationStability(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{
+		Algorithm: "kalman",
+		Stability: config.StabilityConfig{Masks: []string{"g8272_prtc_a"}},
+	}}
+	oscillator := SimOscillatorConfig{Seed: 1}
+	sources := []SimSourceConfig{
+		{Name: "ntp", Noise: 20 * time.Microsecond, Delay: time.Millisecond, Seed: 1},
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+	sim.Run(time.Hour)
+	report := sim.Manager().GetStability()
+
+	source, ok := report.Sources["ntp"]
+	if !ok {
+		t.Fatal("no stability for ntp")
+	}
+	if len(source.Points) < 8 || len(report.Clock.Points) < 8 {
+		t.Fatalf("points: source %d, clock %d, want >= 8", len(source.Points), len(report.Clock.Points))
+	}
+
+	// Белый шум фазы: ADEV(τ0) = √3·σx/τ0, дальше спадает как 1/τ
+	want := math.Sqrt(3) * 20e-6 / source.Tau0.Seconds()
+	if adev := source.ADEV(); math.Abs(adev-want)/want > 0.3 {
+		t.Errorf("source ADEV(τ0) = %g, want ~%g", adev, want)
+	}
+	if source.Points[4].ADEV > source.Points[0].ADEV/4 {
+		t.Errorf("ADEV at %v = %g, not falling from %g", source.Points[4].Tau, source.Points[4].ADEV, source.Points[0].ADEV)
+	}
+
+	// MTIE не убывает с ростом τ, а 20 µs шума не укладываются в маску PRTC-A
+	for i := 1; i < len(report.Clock.Points); i++ {
+		if report.Clock.Points[i].MTIE < report.Clock.Points[i-1].MTIE {
+			t.Errorf("clock MTIE decreases at %v", report.Clock.Points[i].Tau)
+		}
+	}
+	if len(report.Clock.Masks) != 1 || report.Clock.Masks[0].Pass {
+		t.Errorf("clock masks = %+v, want failed g8272_prtc_a", report.Clock.Masks)
+	}
+
+	stats := sim.Manager().GetStatistics()
+	if stats.AllanDeviation != report.Clock.ADEV() {
+		t.Errorf("statistics ADEV = %g, want %g", stats.AllanDeviation, report.Clock.ADEV())
+	}
+}
@@ -0,0 +1,335 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultStateLockTime = time.Minute
+	defaultStateMaxADEV  = 1e-4
+	stateADEVSamples     = 16
+	stateHistorySize     = 100
+)
+
+// ClockState представляет состояние системных часов
+type ClockState int
+
+const (
+	ClockStateFreeRunning ClockState = iota
+	ClockStateSynchronizing
+	ClockStateLocked
+	ClockStateHoldover
+)
+
+func (cs ClockState) String() string {
+	switch cs {
+	case ClockStateFreeRunning:
+		return "free_running"
+	case ClockStateSynchronizing:
+		return "synchronizing"
+	case ClockStateLocked:
+		return "locked"
+	case ClockStateHoldover:
+		return "holdover"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText сериализует состояние его именем
+func (cs ClockState) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+// StateTransition запись перехода машины состояний часов
+type StateTransition struct {
+	Timestamp time.Time     `json:"timestamp"`
+	From      ClockState    `json:"from"`
+	To        ClockState    `json:"to"`
+	Reason    string        `json:"reason"`
+	Offset    time.Duration `json:"offset"`
+	Duration  time.Duration `json:"duration"` // Время в предыдущем состоянии
+}
+
+// StateStatus состояние машины для статистики и API
+type StateStatus struct {
+	State           ClockState    `json:"state"`
+	Since           time.Time     `json:"since"`
+	TimeInState     time.Duration `json:"time_in_state"`
+	ADEV            float64       `json:"adev"`
+	LockThreshold   time.Duration `json:"lock_threshold"`
+	UnlockThreshold time.Duration `json:"unlock_threshold"`
+	LockTime        time.Duration `json:"lock_time"`
+	MaxADEV         float64       `json:"max_adev"`
+}
+
+// stateSample измерение смещения, примененное дисциплиной
+type stateSample struct {
+	timestamp time.Time
+	offset    time.Duration
+}
+
+// StateMachine машина состояний часов:
+// FreeRunning -> Synchronizing -> Locked -> Holdover -> FreeRunning.
+// В Synchronizing часы переходят из FreeRunning или Holdover с первым
+// измерением и после каждого step. В Locked - когда смещение держится в
+// пределах lock_threshold не меньше lock_time, а ADEV измерений не выше
+// max_adev; обратно в Synchronizing - при смещении больше unlock_threshold.
+// При потере источников захваченные часы с обученной моделью частоты
+// уходят в Holdover, остальные - в FreeRunning, как и по истечении holdover.
+type StateMachine struct {
+	mu sync.RWMutex
+
+	lockThreshold   time.Duration
+	unlockThreshold time.Duration
+	lockTime        time.Duration
+	maxADEV         float64
+
+	state   ClockState
+	since   time.Time
+	inside  time.Time // Начало непрерывного интервала в пределах lock_threshold
+	samples []stateSample
+
+	history     []StateTransition
+	subscribers map[chan StateTransition]struct{}
+	logger      *logrus.Logger
+}
+
+// NewStateMachine создает машину состояний из секции clock.state.
+// lockThreshold - порог захвата из clock.holdover.
+func NewStateMachine(cfg config.StateConfig, lockThreshold time.Duration, now time.Time, logger *logrus.Logger) *StateMachine {
+	s := &StateMachine{
+		lockThreshold:   lockThreshold,
+		unlockThreshold: 2 * lockThreshold,
+		lockTime:        defaultStateLockTime,
+		maxADEV:         defaultStateMaxADEV,
+		state:           ClockStateFreeRunning,
+		since:           now,
+		subscribers:     make(map[chan StateTransition]struct{}),
+		logger:          logger,
+	}
+
+	if cfg.UnlockThreshold > lockThreshold {
+		s.unlockThreshold = cfg.UnlockThreshold
+	}
+	if cfg.LockTime > 0 {
+		s.lockTime = cfg.LockTime
+	}
+	if cfg.MaxADEV > 0 {
+		s.maxADEV = cfg.MaxADEV
+	}
+
+	return s
+}
+
+// Sample учитывает измерение смещения, по которому подстроена частота
+func (s *StateMachine) Sample(now time.Time, offset time.Duration) ClockState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, stateSample{timestamp: now, offset: offset})
+	if len(s.samples) > stateADEVSamples {
+		s.samples = s.samples[1:]
+	}
+
+	abs := time.Duration(math.Abs(float64(offset)))
+	if abs > s.lockThreshold {
+		s.inside = time.Time{}
+	} else if s.inside.IsZero() {
+		s.inside = now
+	}
+
+	switch s.state {
+	case ClockStateFreeRunning:
+		s.transition(now, ClockStateSynchronizing, "source_acquired", offset)
+	case ClockStateHoldover:
+		s.transition(now, ClockStateSynchronizing, "source_recovered", offset)
+	case ClockStateSynchronizing:
+		if s.inside.IsZero() || now.Sub(s.inside) < s.lockTime {
+			break
+		}
+		if adev := s.adev(); len(s.samples) >= 3 && adev <= s.maxADEV {
+			s.transition(now, ClockStateLocked, "locked", offset)
+		}
+	case ClockStateLocked:
+		if abs > s.unlockThreshold {
+			s.transition(now, ClockStateSynchronizing, "offset_exceeded", offset)
+		}
+	}
+
+	return s.state
+}
+
+// Step отмечает step часов: захват нужно подтвердить заново
+func (s *StateMachine) Step(now time.Time, offset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = nil
+	s.inside = time.Time{}
+	if s.state != ClockStateSynchronizing {
+		s.transition(now, ClockStateSynchronizing, "step", offset)
+	}
+}
+
+// Lost отмечает потерю всех источников. Захваченные часы с обученной
+// моделью частоты (holdoverReady) переходят в Holdover, остальные - в
+// FreeRunning. Возвращает новое состояние.
+func (s *StateMachine) Lost(now time.Time, holdoverReady bool) ClockState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = nil
+	s.inside = time.Time{}
+
+	switch {
+	case s.state == ClockStateLocked && holdoverReady:
+		s.transition(now, ClockStateHoldover, "sources_lost", 0)
+	case s.state == ClockStateSynchronizing || s.state == ClockStateLocked:
+		s.transition(now, ClockStateFreeRunning, "sources_lost", 0)
+	}
+
+	return s.state
+}
+
+// Expire отмечает исчерпание бюджета holdover
+func (s *StateMachine) Expire(now time.Time, estimated time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == ClockStateHoldover {
+		s.transition(now, ClockStateFreeRunning, "holdover_expired", estimated)
+	}
+}
+
+// transition выполняет переход, записывает его и рассылает подписчикам
+func (s *StateMachine) transition(now time.Time, to ClockState, reason string, offset time.Duration) {
+	record := StateTransition{
+		Timestamp: now,
+		From:      s.state,
+		To:        to,
+		Reason:    reason,
+		Offset:    offset,
+		Duration:  now.Sub(s.since),
+	}
+
+	s.state = to
+	s.since = now
+
+	s.history = append(s.history, record)
+	if len(s.history) > stateHistorySize {
+		s.history = s.history[1:]
+	}
+
+	fields := logrus.Fields{
+		"from":     record.From,
+		"to":       record.To,
+		"reason":   reason,
+		"offset":   offset,
+		"duration": record.Duration,
+	}
+	switch to {
+	case ClockStateSynchronizing, ClockStateLocked:
+		s.logger.WithFields(fields).Info("Clock state changed")
+	default:
+		s.logger.WithFields(fields).Warn("Clock state changed")
+	}
+
+	// Медленный подписчик не задерживает цикл синхронизации
+	for ch := range s.subscribers {
+		select {
+		case ch <- record:
+		default:
+			s.logger.WithField("to", to).Debug("State subscriber buffer full, transition dropped")
+		}
+	}
+}
+
+// adev возвращает ADEV (τ = интервал измерений) по последним смещениям
+func (s *StateMachine) adev() float64 {
+	if len(s.samples) < 3 {
+		return 0
+	}
+
+	freqs := make([]float64, 0, len(s.samples)-1)
+	for i := 1; i < len(s.samples); i++ {
+		dt := s.samples[i].timestamp.Sub(s.samples[i-1].timestamp).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		freqs = append(freqs, (s.samples[i].offset-s.samples[i-1].offset).Seconds()/dt)
+	}
+	if len(freqs) < 2 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := 1; i < len(freqs); i++ {
+		diff := freqs[i] - freqs[i-1]
+		sum += diff * diff
+	}
+	return math.Sqrt(sum / float64(2*(len(freqs)-1)))
+}
+
+// Subscribe подписывает на переходы состояний. Канал ограничен buffer
+// записями: если подписчик не успевает, переходы для него теряются.
+// Возвращаемая функция отменяет подписку и закрывает канал.
+func (s *StateMachine) Subscribe(buffer int) (<-chan StateTransition, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	ch := make(chan StateTransition, buffer)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// State возвращает текущее состояние
+func (s *StateMachine) State() ClockState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Status возвращает состояние и критерии захвата
+func (s *StateMachine) Status(now time.Time) StateStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return StateStatus{
+		State:           s.state,
+		Since:           s.since,
+		TimeInState:     now.Sub(s.since),
+		ADEV:            s.adev(),
+		LockThreshold:   s.lockThreshold,
+		UnlockThreshold: s.unlockThreshold,
+		LockTime:        s.lockTime,
+		MaxADEV:         s.maxADEV,
+	}
+}
+
+// History возвращает журнал переходов
+func (s *StateMachine) History() []StateTransition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make([]StateTransition, len(s.history))
+	copy(history, s.history)
+	return history
+}
@@ -0,0 +1,148 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestStateMachineTransitions(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	start := simulationEpoch
+	s := NewStateMachine(config.StateConfig{LockTime: 20 * time.Second}, time.Millisecond, start, logger)
+	transitions, unsubscribe := s.Subscribe(16)
+
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	// Смещение сходится: захват только после lock_time в пределах порога,
+	// когда переходный процесс вышел из окна ADEV
+	s.Sample(at(1), 50*time.Millisecond)
+	for i := 2; i <= 21; i++ {
+		s.Sample(at(i), 100*time.Microsecond)
+	}
+	if state := s.State(); state != ClockStateSynchronizing {
+		t.Fatalf("state before lock_time = %v, want %v", state, ClockStateSynchronizing)
+	}
+	s.Sample(at(22), 100*time.Microsecond)
+	if state := s.State(); state != ClockStateLocked {
+		t.Fatalf("state after lock_time = %v, want %v", state, ClockStateLocked)
+	}
+
+	// Смещение между lock_threshold и unlock_threshold захват не сбрасывает
+	s.Sample(at(23), 1500*time.Microsecond)
+	if state := s.State(); state != ClockStateLocked {
+		t.Fatalf("state below unlock_threshold = %v, want %v", state, ClockStateLocked)
+	}
+	s.Sample(at(24), 3*time.Millisecond)
+
+	s.Lost(at(25), true)
+	s.Expire(at(30), 2*time.Millisecond)
+	s.Sample(at(31), 0)
+	s.Step(at(32), time.Second)
+	s.Lost(at(33), true)
+
+	want := []struct {
+		from, to ClockState
+		reason   string
+	}{
+		{ClockStateFreeRunning, ClockStateSynchronizing, "source_acquired"},
+		{ClockStateSynchronizing, ClockStateLocked, "locked"},
+		{ClockStateLocked, ClockStateSynchronizing, "offset_exceeded"},
+		{ClockStateSynchronizing, ClockStateFreeRunning, "sources_lost"},
+		{ClockStateFreeRunning, ClockStateSynchronizing, "source_acquired"},
+		{ClockStateSynchronizing, ClockStateFreeRunning, "sources_lost"},
+	}
+
+	unsubscribe()
+	var got []StateTransition
+	for transition := range transitions {
+		got = append(got, transition)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("transitions = %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].From != w.from || got[i].To != w.to || got[i].Reason != w.reason {
+			t.Errorf("transition %d = %v -> %v (%s), want %v -> %v (%s)",
+				i, got[i].From, got[i].To, got[i].Reason, w.from, w.to, w.reason)
+		}
+	}
+	if history := s.History(); len(history) != len(got) {
+		t.Errorf("history = %d transitions, want %d", len(history), len(got))
+	}
+}
+
+func TestStateMachineADEV(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	start := simulationEpoch
+	s := NewStateMachine(config.StateConfig{LockTime: 5 * time.Second, MaxADEV: 1e-6}, time.Millisecond, start, logger)
+
+	// Смещение в пределах порога, но частота скачет на 500 ppm
+	for i := 1; i <= 30; i++ {
+		offset := 500 * time.Microsecond
+		if i%2 == 0 {
+			offset = -offset
+		}
+		s.Sample(start.Add(time.Duration(i)*time.Second), offset)
+	}
+	if state := s.State(); state != ClockStateSynchronizing {
+		t.Errorf("state with unstable offset = %v, want %v", state, ClockStateSynchronizing)
+	}
+	if adev := s.Status(start).ADEV; adev < 1e-4 {
+		t.Errorf("ADEV = %g, want >= 1e-4", adev)
+	}
+}
+
+func TestSimulationStateTransitions(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman"}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: -15000, RandomWalk: 0.05, Seed: 11}
+	outage := SimOutage{Start: time.Hour, End: 90 * time.Minute}
+
+	sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond, outage))
+	transitions, unsubscribe := sim.Manager().SubscribeState(16)
+	defer unsubscribe()
+	sub := sim.Manager().Events().Subscribe(EventFilter{Types: []EventType{EventStateChange}}, 16)
+	defer sub.Close()
+	sim.Run(2 * time.Hour)
+
+	want := []ClockState{
+		ClockStateSynchronizing,
+		ClockStateLocked,
+		ClockStateHoldover,
+		ClockStateSynchronizing,
+		ClockStateLocked,
+	}
+	// Шина событий получает те же переходы, что и подписчики машины состояний
+	for i, w := range want {
+		select {
+		case transition := <-transitions:
+			if transition.To != w {
+				t.Fatalf("transition %d to %v (%s), want %v", i, transition.To, transition.Reason, w)
+			}
+		default:
+			t.Fatalf("transitions = %d, want %d", i, len(want))
+		}
+		select {
+		case event := <-sub.C:
+			if transition := event.Data.(StateTransition); transition.To != w {
+				t.Errorf("event %d to %v, want %v", i, transition.To, w)
+			}
+		default:
+			t.Fatalf("state_change events = %d, want %d", i, len(want))
+		}
+	}
+	select {
+	case transition := <-transitions:
+		t.Errorf("unexpected transition %v -> %v (%s)", transition.From, transition.To, transition.Reason)
+	case event := <-sub.C:
+		t.Errorf("unexpected event: %s", event.Message)
+	default:
+	}
+}
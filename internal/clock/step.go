@@ -0,0 +1,211 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultStepThreshold = 500 * time.Millisecond
+	defaultMakeStepLimit = 3   // Как makestep в chrony: step только в первых обновлениях
+	defaultStepQuorum    = 2   // Step подтверждают хотя бы два независимых источника
+	defaultStepAgreement = 100 * time.Millisecond
+	stepHistorySize      = 100
+)
+
+// StepAction решение политики шага для очередного смещения
+type StepAction string
+
+const (
+	StepActionSlew   StepAction = "slew"   // Плавная подстройка дисциплиной
+	StepActionStep   StepAction = "step"   // Шаг часов
+	StepActionRefuse StepAction = "refuse" // Смещение отвергнуто, часы не трогаем
+)
+
+// StepRecord запись журнала шагов
+type StepRecord struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Action    StepAction    `json:"action"`
+	Offset    time.Duration `json:"offset"`
+	Reason    string        `json:"reason"`
+	Source    string        `json:"source,omitempty"`
+	Update    uint64        `json:"update"`
+	Count     int           `json:"count"`
+	Error     string        `json:"error,omitempty"`
+	Monitor   bool          `json:"monitor,omitempty"` // Режим мониторинга: шаг не применен
+}
+
+// StepEvidence подтверждение шага источниками
+type StepEvidence struct {
+	Agreeing int       // Число пригодных источников, согласных со смещением
+	Trusted  bool      // Среди согласных есть источник с trust
+	Target   time.Time // Время часов после шага
+}
+
+// StepPolicy единая политика шага часов: step разрешен только для смещений
+// выше step_threshold в первых makestep_limit обновлениях, смещения выше
+// step_limit не шагаются, а выше panic_threshold отвергаются полностью.
+// Смещение выше step_threshold должны подтвердить step_quorum согласных
+// источников или один источник с trust - и для шага, и для плавной
+// подстройки после окна makestep. Часы не переводятся раньше последнего
+// достоверного времени.
+type StepPolicy struct {
+	mu sync.RWMutex
+
+	threshold     time.Duration
+	limit         time.Duration
+	panic         time.Duration
+	makeStepLimit int // 0 - step запрещен, < 0 - разрешен всегда
+	quorum        int
+	lastGood      time.Time
+
+	updates uint64
+	history []StepRecord
+	logger  *logrus.Logger
+}
+
+// NewStepPolicy создает политику шага из настроек clock_sync и clock
+func NewStepPolicy(clockSync config.ClockSyncConfig, clock config.ClockConfig, logger *logrus.Logger) *StepPolicy {
+	p := &StepPolicy{
+		threshold:     defaultStepThreshold,
+		panic:         clock.PanicThreshold,
+		makeStepLimit: defaultMakeStepLimit,
+		quorum:        defaultStepQuorum,
+		logger:        logger,
+	}
+
+	if clock.StepThreshold > 0 {
+		p.threshold = clock.StepThreshold
+	}
+	// Без makestep_limit действует окно по умолчанию, 0 запрещает step
+	if clock.MakeStepLimit != nil {
+		p.makeStepLimit = *clock.MakeStepLimit
+	}
+	if clock.StepQuorum > 0 {
+		p.quorum = clock.StepQuorum
+	}
+	if clockSync.StepLimit != "" {
+		limit, err := config.ParseDuration(clockSync.StepLimit)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid step_limit, steps are not limited")
+		} else {
+			p.limit = limit
+		}
+	}
+
+	return p
+}
+
+// SetLastGood задает последнее достоверное время: шаг на более раннее
+// время отвергается
+func (p *StepPolicy) SetLastGood(t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.After(p.lastGood) {
+		p.lastGood = t
+	}
+}
+
+// Decide учитывает очередное обновление часов и решает, что делать со смещением
+func (p *StepPolicy) Decide(offset time.Duration, evidence StepEvidence) (StepAction, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.updates++
+
+	action, reason := p.decide(offset)
+	if action == StepActionRefuse || reason == "" {
+		return action, reason
+	}
+
+	// Смещение выше step_threshold: шаг или плавная подстройка после окна
+	// makestep. Без подтверждения смещение отвергается, иначе один неверный
+	// источник уводил бы часы подстройкой частоты.
+	switch {
+	case evidence.Agreeing < p.quorum && !evidence.Trusted:
+		// Неподтвержденное смещение не расходует окно makestep: шаг остается
+		// возможным, когда подключатся другие источники
+		p.updates--
+		return StepActionRefuse, "no_quorum"
+	case action == StepActionStep && !p.lastGood.IsZero() && evidence.Target.Before(p.lastGood):
+		return StepActionRefuse, "before_last_good"
+	}
+	return action, reason
+}
+
+// decide применяет пороги к смещению. Вызывается под p.mu.
+func (p *StepPolicy) decide(offset time.Duration) (StepAction, string) {
+	abs := offset
+	if abs < 0 {
+		abs = -abs
+	}
+
+	switch {
+	case p.panic > 0 && abs > p.panic:
+		return StepActionRefuse, "panic_threshold"
+	case abs <= p.threshold:
+		return StepActionSlew, ""
+	case p.limit > 0 && abs > p.limit:
+		return StepActionRefuse, "step_limit"
+	case p.makeStepLimit >= 0 && p.updates > uint64(p.makeStepLimit):
+		return StepActionSlew, "makestep_window_expired"
+	case p.makeStepLimit < 0:
+		return StepActionStep, "step_threshold"
+	default:
+		return StepActionStep, "startup"
+	}
+}
+
+// Record добавляет шаг или отказ в журнал шагов. Повторные отказы по
+// той же причине объединяются в одну запись со счетчиком.
+func (p *StepPolicy) Record(record StepRecord) {
+	p.mu.Lock()
+	record.Update = p.updates
+	record.Count = 1
+	if n := len(p.history); n > 0 && record.Action == StepActionRefuse {
+		last := &p.history[n-1]
+		if last.Action == StepActionRefuse && last.Reason == record.Reason {
+			record.Count = last.Count + 1
+			*last = record
+			p.mu.Unlock()
+			return
+		}
+	}
+	p.history = append(p.history, record)
+	if len(p.history) > stepHistorySize {
+		p.history = p.history[1:]
+	}
+	p.mu.Unlock()
+
+	fields := logrus.Fields{
+		"action": record.Action,
+		"offset": record.Offset,
+		"reason": record.Reason,
+		"source": record.Source,
+		"update": record.Update,
+	}
+
+	switch {
+	case record.Error != "":
+		p.logger.WithFields(fields).WithField("error", record.Error).Error("Clock step failed")
+	case record.Action == StepActionRefuse:
+		p.logger.WithFields(fields).Error("Clock offset refused by step policy")
+	case record.Monitor:
+		p.logger.WithFields(fields).Warn("System clock would be stepped (monitor mode)")
+	default:
+		p.logger.WithFields(fields).Warn("System clock stepped")
+	}
+}
+
+// History возвращает журнал шагов
+func (p *StepPolicy) History() []StepRecord {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	history := make([]StepRecord, len(p.history))
+	copy(history, p.history)
+	return history
+}
@@ -0,0 +1,223 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// stepDecision ожидаемое решение политики шага для очередного смещения
+type stepDecision struct {
+	offset   time.Duration
+	evidence StepEvidence
+	action   StepAction
+	reason   string
+}
+
+// stepPolicyCase последовательность решений политики шага с одними настройками
+type stepPolicyCase struct {
+	name      string
+	clockSync config.ClockSyncConfig
+	clock     config.ClockConfig
+	lastGood  time.Time
+	decisions []stepDecision
+}
+
+// makeStepLimit возвращает явно заданный makestep_limit
+func makeStepLimit(n int) *int {
+	return &n
+}
+
+func runStepPolicyCases(t *testing.T, tests []stepPolicyCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetLevel(logrus.PanicLevel)
+
+			p := NewStepPolicy(tt.clockSync, tt.clock, logger)
+			if !tt.lastGood.IsZero() {
+				p.SetLastGood(tt.lastGood)
+			}
+			for i, d := range tt.decisions {
+				action, reason := p.Decide(d.offset, d.evidence)
+				if action != d.action || reason != d.reason {
+					t.Errorf("decision %d (%v) = %s/%q, want %s/%q", i, d.offset, action, reason, d.action, d.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestStepPolicyDecide(t *testing.T) {
+	// Все смещения подтверждены кворумом: проверяются только пороги и окно
+	quorum := StepEvidence{Agreeing: 2}
+
+	runStepPolicyCases(t, []stepPolicyCase{
+		{
+			name: "below threshold",
+			decisions: []stepDecision{
+				{offset: 100 * time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: -500 * time.Millisecond, evidence: quorum, action: StepActionSlew},
+			},
+		},
+		{
+			name: "startup step",
+			decisions: []stepDecision{
+				{offset: -10 * time.Second, evidence: quorum, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			name:  "custom threshold",
+			clock: config.ClockConfig{StepThreshold: 2 * time.Second},
+			decisions: []stepDecision{
+				{offset: time.Second, evidence: quorum, action: StepActionSlew},
+				{offset: 3 * time.Second, evidence: quorum, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			name: "makestep window expired",
+			decisions: []stepDecision{
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: 2 * time.Second, evidence: quorum, action: StepActionStep, reason: "startup"},
+				{offset: 2 * time.Second, evidence: quorum, action: StepActionSlew, reason: "makestep_window_expired"},
+			},
+		},
+		{
+			name:  "step always allowed",
+			clock: config.ClockConfig{MakeStepLimit: makeStepLimit(-1)},
+			decisions: []stepDecision{
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: 2 * time.Second, evidence: quorum, action: StepActionStep, reason: "step_threshold"},
+			},
+		},
+		{
+			// Как makestep 0 в chrony: окна нет с первого обновления
+			name:  "step never allowed",
+			clock: config.ClockConfig{MakeStepLimit: makeStepLimit(0)},
+			decisions: []stepDecision{
+				{offset: 2 * time.Second, evidence: quorum, action: StepActionSlew, reason: "makestep_window_expired"},
+				{offset: 10 * time.Second, evidence: quorum, action: StepActionSlew, reason: "makestep_window_expired"},
+			},
+		},
+		{
+			name:      "step limit",
+			clockSync: config.ClockSyncConfig{StepLimit: "5s"},
+			decisions: []stepDecision{
+				{offset: 10 * time.Second, evidence: quorum, action: StepActionRefuse, reason: "step_limit"},
+				{offset: -3 * time.Second, evidence: quorum, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			// После окна makestep смещение выше step_limit не убирается
+			// подстройкой частоты, а отвергается
+			name:      "step limit after window",
+			clockSync: config.ClockSyncConfig{StepLimit: "5s"},
+			clock:     config.ClockConfig{MakeStepLimit: makeStepLimit(1)},
+			decisions: []stepDecision{
+				{offset: time.Millisecond, evidence: quorum, action: StepActionSlew},
+				{offset: 10 * time.Second, evidence: quorum, action: StepActionRefuse, reason: "step_limit"},
+				{offset: 3 * time.Second, evidence: quorum, action: StepActionSlew, reason: "makestep_window_expired"},
+			},
+		},
+		{
+			name:  "panic threshold",
+			clock: config.ClockConfig{PanicThreshold: time.Minute, MakeStepLimit: makeStepLimit(1)},
+			decisions: []stepDecision{
+				{offset: -2 * time.Minute, evidence: quorum, action: StepActionRefuse, reason: "panic_threshold"},
+				{offset: 2 * time.Minute, evidence: quorum, action: StepActionRefuse, reason: "panic_threshold"},
+			},
+		},
+	})
+}
+
+func TestStepPolicyRecord(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	p := NewStepPolicy(config.ClockSyncConfig{StepLimit: "5s"}, config.ClockConfig{PanicThreshold: time.Minute}, logger)
+	quorum := StepEvidence{Agreeing: 2}
+	for i := 0; i < 3; i++ {
+		action, reason := p.Decide(10*time.Second, quorum)
+		p.Record(StepRecord{Action: action, Offset: 10 * time.Second, Reason: reason})
+	}
+	action, reason := p.Decide(2*time.Second, quorum)
+	if action != StepActionSlew {
+		t.Fatalf("decision = %s/%s, want slew after makestep window", action, reason)
+	}
+	action, reason = p.Decide(2*time.Minute, quorum)
+	p.Record(StepRecord{Action: action, Offset: 2 * time.Minute, Reason: reason})
+
+	// Повторные отказы по одной причине объединяются в одну запись
+	history := p.History()
+	if len(history) != 2 {
+		t.Fatalf("history = %+v, want 2 records", history)
+	}
+	if history[0].Reason != "step_limit" || history[0].Count != 3 || history[0].Update != 3 {
+		t.Errorf("record = %+v, want step_limit x3 at update 3", history[0])
+	}
+	if history[1].Reason != "panic_threshold" || history[1].Count != 1 || history[1].Update != 5 {
+		t.Errorf("record = %+v, want panic_threshold x1 at update 5", history[1])
+	}
+}
+
+func TestStepPolicyQuorum(t *testing.T) {
+	quorum := StepEvidence{Agreeing: 2}
+	single := StepEvidence{Agreeing: 1}
+	trusted := StepEvidence{Agreeing: 1, Trusted: true}
+
+	runStepPolicyCases(t, []stepPolicyCase{
+		{
+			name: "trusted source",
+			decisions: []stepDecision{
+				{offset: 10 * time.Second, evidence: trusted, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			name:  "custom quorum",
+			clock: config.ClockConfig{StepQuorum: 3},
+			decisions: []stepDecision{
+				{offset: 10 * time.Second, evidence: quorum, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: StepEvidence{Agreeing: 3}, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			// Единственный источник без trust не шагает и не уводит часы
+			// подстройкой, а окно makestep ждет подтверждения
+			name: "no quorum keeps window open",
+			decisions: []stepDecision{
+				{offset: 10 * time.Second, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: 10 * time.Second, evidence: quorum, action: StepActionStep, reason: "startup"},
+			},
+		},
+		{
+			name: "no quorum after window",
+			decisions: []stepDecision{
+				{offset: time.Millisecond, evidence: single, action: StepActionSlew},
+				{offset: time.Millisecond, evidence: single, action: StepActionSlew},
+				{offset: time.Millisecond, evidence: single, action: StepActionSlew},
+				{offset: -3 * time.Hour, evidence: single, action: StepActionRefuse, reason: "no_quorum"},
+				{offset: -3 * time.Hour, evidence: trusted, action: StepActionSlew, reason: "makestep_window_expired"},
+				{offset: time.Millisecond, evidence: single, action: StepActionSlew},
+			},
+		},
+		{
+			name:     "before last good",
+			lastGood: simulationEpoch,
+			decisions: []stepDecision{
+				{offset: 10 * time.Second, evidence: StepEvidence{Agreeing: 2, Target: simulationEpoch.Add(-time.Second)}, action: StepActionRefuse, reason: "before_last_good"},
+				{offset: 10 * time.Second, evidence: StepEvidence{Agreeing: 2, Target: simulationEpoch.Add(time.Second)}, action: StepActionStep, reason: "startup"},
+			},
+		},
+	})
+}
@@ -0,0 +1,222 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultSwitchMinMargin     = 0.2
+	defaultSwitchMinHoldTime   = time.Minute
+	defaultSwitchFailoverDelay = 30 * time.Second
+	switchHistorySize          = 100
+)
+
+// SourceTier уровень источника: primary_clocks или secondary_clocks
+type SourceTier string
+
+const (
+	SourceTierPrimary   SourceTier = "primary"
+	SourceTierSecondary SourceTier = "secondary"
+)
+
+// SwitchRecord запись журнала переключений системного источника
+type SwitchRecord struct {
+	Timestamp time.Time  `json:"timestamp"`
+	From      string     `json:"from,omitempty"`
+	FromTier  SourceTier `json:"from_tier,omitempty"`
+	To        string     `json:"to,omitempty"`
+	ToTier    SourceTier `json:"to_tier,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
+// SwitchPolicy выбирает системный источник среди выживших с гистерезисом:
+// текущий источник сохраняется, пока лучший не обгонит его на min_margin
+// root distance (плюс prefer_current) и не пройдет min_hold_time с
+// последнего переключения. Secondary источники используются только после
+// того, как primary недоступны дольше failover_delay.
+type SwitchPolicy struct {
+	mu sync.RWMutex
+
+	minMargin     float64
+	minHoldTime   time.Duration
+	preferCurrent time.Duration
+	failoverDelay time.Duration
+
+	current     string
+	currentTier SourceTier
+	since       time.Time
+	primaryLost time.Time // Начало ожидания восстановления primary
+
+	history []SwitchRecord
+	logger  *logrus.Logger
+}
+
+// NewSwitchPolicy создает политику переключения из секции clock.switch
+func NewSwitchPolicy(cfg config.SwitchConfig, logger *logrus.Logger) *SwitchPolicy {
+	p := &SwitchPolicy{
+		minMargin:     defaultSwitchMinMargin,
+		minHoldTime:   defaultSwitchMinHoldTime,
+		preferCurrent: cfg.PreferCurrent,
+		failoverDelay: defaultSwitchFailoverDelay,
+		logger:        logger,
+	}
+
+	if cfg.MinMargin > 0 {
+		p.minMargin = cfg.MinMargin
+	}
+	if cfg.MinHoldTime > 0 {
+		p.minHoldTime = cfg.MinHoldTime
+	}
+	if cfg.FailoverDelay > 0 {
+		p.failoverDelay = cfg.FailoverDelay
+	}
+
+	return p
+}
+
+// Choose выбирает системный источник среди выживших результата выбора.
+// Пустая строка означает, что системного источника нет: выживших нет или
+// идет ожидание восстановления primary перед переходом на secondary.
+func (p *SwitchPolicy) Choose(result *SelectionResult, now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var primary, secondary []*selectionCandidate
+	for _, c := range result.survivors {
+		if c.sample.Tier == SourceTierSecondary {
+			secondary = append(secondary, c)
+		} else {
+			primary = append(primary, c)
+		}
+	}
+
+	pool := primary
+	if len(primary) > 0 {
+		p.primaryLost = time.Time{}
+	} else {
+		pool = secondary
+
+		// Поэтапный переход: сначала ждем восстановления primary
+		if p.current != "" && p.currentTier != SourceTierSecondary && len(secondary) > 0 {
+			if p.primaryLost.IsZero() {
+				p.primaryLost = now
+				p.logger.WithFields(logrus.Fields{
+					"source": p.current,
+					"delay":  p.failoverDelay,
+				}).Warn("Primary sources lost, waiting before failover to secondary")
+			}
+			if now.Sub(p.primaryLost) < p.failoverDelay {
+				return ""
+			}
+		}
+	}
+
+	if len(pool) == 0 {
+		if p.current != "" {
+			p.switchTo(nil, "no_survivors", now)
+		}
+		return ""
+	}
+
+	// Выжившие отсортированы по метрике, лучший - первый
+	best := pool[0]
+
+	var current *selectionCandidate
+	for _, c := range pool {
+		if c.sample.Name == p.current {
+			current = c
+			break
+		}
+	}
+
+	switch {
+	case current == best:
+	case current == nil:
+		p.switchTo(best, p.lostReason(result, best), now)
+	case now.Sub(p.since) < p.minHoldTime:
+		// Текущий источник еще не отработал минимальное время
+	case best.metric < current.metric-current.rootDistance*p.minMargin-float64(p.preferCurrent):
+		p.switchTo(best, "better_source", now)
+	}
+
+	return p.current
+}
+
+// lostReason объясняет, почему текущий источник больше не выбирается
+func (p *SwitchPolicy) lostReason(result *SelectionResult, best *selectionCandidate) string {
+	switch {
+	case p.current == "" && len(p.history) == 0:
+		return "initial"
+	case p.current == "":
+		return "recovered"
+	case p.currentTier == SourceTierSecondary && best.sample.Tier != SourceTierSecondary:
+		return "primary_restored"
+	case p.currentTier != SourceTierSecondary && best.sample.Tier == SourceTierSecondary:
+		return "failover_to_secondary"
+	}
+
+	if status, ok := result.Sources[p.current]; ok && status.Status != SelectionCandidate && status.Status != SelectionSelected {
+		return "current_" + string(status.Status)
+	}
+	return "current_lost"
+}
+
+// switchTo переключает системный источник и записывает переключение
+func (p *SwitchPolicy) switchTo(c *selectionCandidate, reason string, now time.Time) {
+	record := SwitchRecord{
+		Timestamp: now,
+		From:      p.current,
+		FromTier:  p.currentTier,
+		Reason:    reason,
+	}
+
+	p.current, p.currentTier = "", ""
+	if c != nil {
+		p.current = c.sample.Name
+		p.currentTier = c.sample.tier()
+		record.To = p.current
+		record.ToTier = p.currentTier
+	}
+	p.since = now
+	p.primaryLost = time.Time{}
+
+	p.history = append(p.history, record)
+	if len(p.history) > switchHistorySize {
+		p.history = p.history[1:]
+	}
+
+	fields := logrus.Fields{
+		"from":      record.From,
+		"from_tier": record.FromTier,
+		"to":        record.To,
+		"to_tier":   record.ToTier,
+		"reason":    reason,
+	}
+	switch reason {
+	case "initial", "recovered", "primary_restored", "better_source":
+		p.logger.WithFields(fields).Info("System source switched")
+	default:
+		p.logger.WithFields(fields).Warn("System source switched")
+	}
+}
+
+// Current возвращает имя текущего системного источника
+func (p *SwitchPolicy) Current() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current
+}
+
+// History возвращает журнал переключений
+func (p *SwitchPolicy) History() []SwitchRecord {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	history := make([]SwitchRecord, len(p.history))
+	copy(history, p.history)
+	return history
+}
@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestSwitchHysteresis(t *testing.T) {
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, RandomWalk: 0.1, Seed: 2}
+	sources := []SimSourceConfig{
+		{Name: "ntp1", Noise: 150 * time.Microsecond, Delay: time.Millisecond, DelayJitter: 300 * time.Microsecond, Seed: 1},
+		{Name: "ntp2", Noise: 150 * time.Microsecond, Delay: time.Millisecond, DelayJitter: 300 * time.Microsecond, Seed: 2},
+		{Name: "ntp3", Noise: 150 * time.Microsecond, Delay: time.Millisecond, DelayJitter: 300 * time.Microsecond, Seed: 3},
+	}
+
+	run := func(sw config.SwitchConfig) []SwitchRecord {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "kalman", Switch: sw}}
+		sim := newTestSimulation(t, cfg, oscillator, sources)
+		return sim.Run(time.Hour).Switches
+	}
+
+	flapping := run(config.SwitchConfig{MinMargin: 1e-9, MinHoldTime: time.Nanosecond})
+	sticky := run(config.SwitchConfig{})
+
+	if len(flapping) < 50 {
+		t.Fatalf("switches without hysteresis = %d, scenario does not flap", len(flapping))
+	}
+	if len(sticky) > 10 {
+		t.Errorf("switches with hysteresis = %d, want <= 10 (without: %d)", len(sticky), len(flapping))
+	}
+	if sticky[0].Reason != "initial" {
+		t.Errorf("first switch reason = %q, want initial", sticky[0].Reason)
+	}
+	for i, record := range sticky[1:] {
+		if record.Reason != "better_source" {
+			t.Errorf("switch reason = %q, want better_source", record.Reason)
+		}
+		if held := record.Timestamp.Sub(sticky[i].Timestamp); held < defaultSwitchMinHoldTime {
+			t.Errorf("source held for %v, want >= %v", held, defaultSwitchMinHoldTime)
+		}
+	}
+}
+
+func TestSwitchStagedFailover(t *testing.T) {
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{
+		Algorithm: "kalman",
+		Switch:    config.SwitchConfig{FailoverDelay: time.Minute},
+	}}
+	oscillator := SimOscillatorConfig{FrequencyOffset: 10000, Seed: 4}
+	outage := SimOutage{Start: 30 * time.Minute, End: 40 * time.Minute}
+	sources := []SimSourceConfig{
+		{Name: "gnss", Type: "pps", Noise: 10 * time.Microsecond, Outages: []SimOutage{outage}, Seed: 1},
+		{Name: "ntp", Tier: SourceTierSecondary, Noise: 20 * time.Microsecond, Delay: time.Millisecond, Seed: 2},
+	}
+
+	sim := newTestSimulation(t, cfg, oscillator, sources)
+	result := sim.Run(time.Hour)
+
+	want := []struct {
+		to     string
+		reason string
+		at     time.Duration
+	}{
+		{to: "gnss", reason: "initial", at: 0},
+		{to: "ntp", reason: "failover_to_secondary", at: outage.Start + time.Minute},
+		{to: "gnss", reason: "primary_restored", at: outage.End},
+	}
+
+	if len(result.Switches) != len(want) {
+		t.Fatalf("switches = %+v, want %d", result.Switches, len(want))
+	}
+	start := result.Switches[0].Timestamp
+	for i, w := range want {
+		got := result.Switches[i]
+		if got.To != w.to || got.Reason != w.reason {
+			t.Errorf("switch %d = %s/%s, want %s/%s", i, got.To, got.Reason, w.to, w.reason)
+		}
+		if at := got.Timestamp.Sub(start); at < w.at-5*time.Second || at > w.at+5*time.Second {
+			t.Errorf("switch %d at %v, want ~%v", i, at, w.at)
+		}
+	}
+
+	// После восстановления primary secondary снова в резерве
+	if status := sim.Manager().GetSelection()["ntp"].Status; status != SelectionStandby {
+		t.Errorf("secondary status = %s, want %s", status, SelectionStandby)
+	}
+
+	// До перехода на secondary часы удерживаются по модели частоты
+	for _, p := range result.Points {
+		if p.Elapsed > outage.Start+5*time.Second && p.Elapsed < outage.Start+55*time.Second && p.State != ClockStateHoldover {
+			t.Fatalf("state at %v = %v, want %v", p.Elapsed, p.State, ClockStateHoldover)
+		}
+	}
+}
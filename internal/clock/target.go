@@ -0,0 +1,261 @@
+package clock
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/shiwatime/shiwatime/internal/protocols"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Число чтений часов на измерение смещения (phc2sys -N)
+	defaultOffsetSamples = 5
+)
+
+// ClockTarget часы, которыми управляет дисциплина: системные часы
+// (CLOCK_REALTIME) или аппаратные часы PHC (/dev/ptpN)
+type ClockTarget interface {
+	// Name возвращает имя часов
+	Name() string
+
+	// Now читает текущее время часов
+	Now() (time.Time, error)
+
+	// AdjustFrequency устанавливает поправку частоты в ppb
+	AdjustFrequency(ppb float64) error
+
+	// Frequency возвращает текущую поправку частоты в ppb
+	Frequency() (float64, error)
+
+	// Step сдвигает часы на offset
+	Step(offset time.Duration) error
+
+	// MaxFrequency возвращает предел поправки частоты в ppb
+	MaxFrequency() float64
+
+	// Close освобождает устройство часов
+	Close() error
+}
+
+// OpenClockTarget открывает часы по имени: system (CLOCK_REALTIME),
+// путь к устройству /dev/ptpN или имя сетевого интерфейса с PHC
+func OpenClockTarget(spec string) (ClockTarget, error) {
+	switch strings.ToLower(spec) {
+	case "", "system", "realtime", "clock_realtime":
+		return NewSystemClock(), nil
+	}
+
+	device := spec
+	if !strings.HasPrefix(spec, "/") {
+		var err error
+		device, err = phcDeviceForInterface(spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return OpenPHCClock(device)
+}
+
+// phcDeviceForInterface находит PHC сетевого интерфейса через sysfs
+func phcDeviceForInterface(iface string) (string, error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/sys/class/net/%s/device/ptp", iface))
+	if err != nil {
+		return "", fmt.Errorf("interface %s has no PHC: %w", iface, err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "ptp") {
+			return "/dev/" + entry.Name(), nil
+		}
+	}
+
+	return "", fmt.Errorf("interface %s has no PHC", iface)
+}
+
+// posixClock часы, управляемые через clock_adjtime
+type posixClock struct {
+	name         string
+	clockID      int32
+	maxFreq      float64 // ppb
+	clockAdjtime func(int32, *unix.Timex) (int, error)
+}
+
+// Name возвращает имя часов
+func (c *posixClock) Name() string {
+	return c.name
+}
+
+// Now читает текущее время часов
+func (c *posixClock) Now() (time.Time, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(c.clockID, &ts); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read %s: %w", c.name, err)
+	}
+	return time.Unix(ts.Sec, ts.Nsec), nil
+}
+
+// AdjustFrequency устанавливает поправку частоты (ADJ_FREQUENCY)
+func (c *posixClock) AdjustFrequency(ppb float64) error {
+	var timex unix.Timex
+	timex.Modes = unix.ADJ_FREQUENCY
+
+	// Частота ядра в единицах 2^-16 ppm
+	timex.Freq = int64(clampFrequency(ppb, c.maxFreq) * 65536 / 1000)
+
+	if _, err := c.clockAdjtime(c.clockID, &timex); err != nil {
+		return fmt.Errorf("failed to adjust %s frequency: %w", c.name, err)
+	}
+	return nil
+}
+
+// Frequency возвращает текущую поправку частоты
+func (c *posixClock) Frequency() (float64, error) {
+	var timex unix.Timex
+	if _, err := c.clockAdjtime(c.clockID, &timex); err != nil {
+		return 0, fmt.Errorf("failed to read %s frequency: %w", c.name, err)
+	}
+	return float64(timex.Freq) * 1000 / 65536, nil
+}
+
+// Step сдвигает часы на offset (ADJ_SETOFFSET)
+func (c *posixClock) Step(offset time.Duration) error {
+	// ADJ_SETOFFSET требует нормализованного времени: 0 <= nsec < 1s
+	var timex unix.Timex
+	timex.Modes = unix.ADJ_SETOFFSET | unix.ADJ_NANO
+
+	sec := int64(offset / time.Second)
+	nsec := int64(offset % time.Second)
+	if nsec < 0 {
+		sec--
+		nsec += int64(time.Second)
+	}
+	timex.Time.Sec = sec
+	timex.Time.Usec = nsec
+
+	if _, err := c.clockAdjtime(c.clockID, &timex); err != nil {
+		return fmt.Errorf("failed to step %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// MaxFrequency возвращает предел поправки частоты
+func (c *posixClock) MaxFrequency() float64 {
+	return c.maxFreq
+}
+
+// SystemClock системные часы CLOCK_REALTIME
+type SystemClock struct {
+	posixClock
+}
+
+// NewSystemClock создает цель для системных часов
+func NewSystemClock() *SystemClock {
+	return &SystemClock{posixClock{
+		name:         "system",
+		clockID:      unix.CLOCK_REALTIME,
+		maxFreq:      maxFrequencyPPB,
+		clockAdjtime: unix.ClockAdjtime,
+	}}
+}
+
+// Close ничего не делает для системных часов
+func (c *SystemClock) Close() error {
+	return nil
+}
+
+// PHCClock аппаратные часы сетевой карты (/dev/ptpN)
+type PHCClock struct {
+	posixClock
+	fd   int
+	caps protocols.PHCCapabilities
+}
+
+// OpenPHCClock открывает PHC и читает его возможности
+func OpenPHCClock(device string) (*PHCClock, error) {
+	fd, err := unix.Open(device, unix.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PHC device %s: %w", device, err)
+	}
+
+	c := &PHCClock{
+		posixClock: posixClock{
+			name:         device,
+			clockID:      fdToClockID(fd),
+			maxFreq:      maxFrequencyPPB,
+			clockAdjtime: unix.ClockAdjtime,
+		},
+		fd: fd,
+	}
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL,
+		uintptr(fd),
+		uintptr(protocols.PTP_CLOCK_GETCAPS),
+		uintptr(unsafe.Pointer(&c.caps)))
+	if errno != 0 {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to get PHC capabilities of %s: %w", device, errno)
+	}
+	if c.caps.MaxAdj > 0 {
+		c.maxFreq = float64(c.caps.MaxAdj)
+	}
+
+	return c, nil
+}
+
+// Capabilities возвращает возможности PHC
+func (c *PHCClock) Capabilities() protocols.PHCCapabilities {
+	return c.caps
+}
+
+// Close закрывает устройство PHC
+func (c *PHCClock) Close() error {
+	if c.fd < 0 {
+		return nil
+	}
+	err := unix.Close(c.fd)
+	c.fd = -1
+	return err
+}
+
+// fdToClockID формирует динамический clockid из дескриптора (FD_TO_CLOCKID)
+func fdToClockID(fd int) int32 {
+	return int32((^fd << 3) | 3)
+}
+
+// MeasureOffset измеряет смещение source - target чтением target, source,
+// target подряд. Из samples попыток берется попытка с наименьшей задержкой
+// чтения, как в phc2sys.
+func MeasureOffset(source, target ClockTarget, samples int) (offset, delay time.Duration, err error) {
+	if samples <= 0 {
+		samples = defaultOffsetSamples
+	}
+
+	delay = -1
+	for i := 0; i < samples; i++ {
+		before, err := target.Now()
+		if err != nil {
+			return 0, 0, err
+		}
+		sourceTime, err := source.Now()
+		if err != nil {
+			return 0, 0, err
+		}
+		after, err := target.Now()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		d := after.Sub(before)
+		if delay < 0 || d < delay {
+			delay = d
+			offset = sourceTime.Sub(before.Add(d / 2))
+		}
+	}
+
+	return offset, delay, nil
+}
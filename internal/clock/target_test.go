@@ -0,0 +1,153 @@
+package clock
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakeClockTarget часы с заданным временем: каждое чтение возвращает
+// следующее значение reads, а после их окончания - время now
+type fakeClockTarget struct {
+	name      string
+	now       time.Time
+	reads     []time.Time
+	maxFreq   float64
+	freq      float64
+	steps     []time.Duration
+	adjusts   int
+	adjustErr error
+}
+
+func (c *fakeClockTarget) Name() string {
+	return c.name
+}
+
+func (c *fakeClockTarget) Now() (time.Time, error) {
+	if len(c.reads) > 0 {
+		t := c.reads[0]
+		c.reads = c.reads[1:]
+		return t, nil
+	}
+	return c.now, nil
+}
+
+func (c *fakeClockTarget) AdjustFrequency(ppb float64) error {
+	if c.adjustErr != nil {
+		return c.adjustErr
+	}
+	c.adjusts++
+	c.freq = ppb
+	return nil
+}
+
+func (c *fakeClockTarget) Frequency() (float64, error) {
+	return c.freq, nil
+}
+
+func (c *fakeClockTarget) Step(offset time.Duration) error {
+	c.steps = append(c.steps, offset)
+	c.now = c.now.Add(offset)
+	return nil
+}
+
+func (c *fakeClockTarget) MaxFrequency() float64 {
+	return c.maxFreq
+}
+
+func (c *fakeClockTarget) Close() error {
+	return nil
+}
+
+func TestMeasureOffset(t *testing.T) {
+	at := func(d time.Duration) time.Time {
+		return simulationEpoch.Add(d)
+	}
+
+	// Чтения target, source, target для каждой попытки; наименьшая
+	// задержка у второй попытки, и смещение берется от середины ее окна
+	target := &fakeClockTarget{name: "target", reads: []time.Time{
+		at(0), at(30 * time.Microsecond),
+		at(100 * time.Microsecond), at(110 * time.Microsecond),
+		at(200 * time.Microsecond), at(220 * time.Microsecond),
+	}}
+	source := &fakeClockTarget{name: "source", reads: []time.Time{
+		at(time.Millisecond),
+		at(time.Millisecond + 105*time.Microsecond - 2*time.Microsecond),
+		at(time.Millisecond),
+	}}
+
+	offset, delay, err := MeasureOffset(source, target, 3)
+	if err != nil {
+		t.Fatalf("MeasureOffset() error = %v", err)
+	}
+	if delay != 10*time.Microsecond {
+		t.Errorf("delay = %v, want 10µs", delay)
+	}
+	if offset != time.Millisecond-2*time.Microsecond {
+		t.Errorf("offset = %v, want 998µs", offset)
+	}
+}
+
+func TestPosixClockStep(t *testing.T) {
+	tests := []struct {
+		offset time.Duration
+		sec    int64
+		nsec   int64
+	}{
+		{offset: 1500 * time.Millisecond, sec: 1, nsec: 500000000},
+		{offset: -1500 * time.Millisecond, sec: -2, nsec: 500000000},
+		{offset: -time.Nanosecond, sec: -1, nsec: 999999999},
+		{offset: -2 * time.Second, sec: -2, nsec: 0},
+	}
+
+	for _, tt := range tests {
+		var got unix.Timex
+		c := &posixClock{name: "test", clockAdjtime: func(clockID int32, timex *unix.Timex) (int, error) {
+			got = *timex
+			return 0, nil
+		}}
+		if err := c.Step(tt.offset); err != nil {
+			t.Fatalf("Step(%v) error = %v", tt.offset, err)
+		}
+
+		// ADJ_SETOFFSET требует 0 <= nsec < 1s
+		if got.Modes != unix.ADJ_SETOFFSET|unix.ADJ_NANO {
+			t.Errorf("Step(%v) modes = %#x", tt.offset, got.Modes)
+		}
+		if got.Time.Sec != tt.sec || int64(got.Time.Usec) != tt.nsec {
+			t.Errorf("Step(%v) = %ds %dns, want %ds %dns", tt.offset, got.Time.Sec, got.Time.Usec, tt.sec, tt.nsec)
+		}
+	}
+
+	c := &posixClock{name: "test", clockAdjtime: func(int32, *unix.Timex) (int, error) {
+		return 0, unix.EPERM
+	}}
+	if err := c.Step(time.Second); !errors.Is(err, unix.EPERM) {
+		t.Errorf("Step() error = %v, want EPERM", err)
+	}
+}
+
+func TestPosixClockFrequency(t *testing.T) {
+	var kernelFreq int64
+	c := &posixClock{name: "test", maxFreq: 1000, clockAdjtime: func(clockID int32, timex *unix.Timex) (int, error) {
+		if timex.Modes&unix.ADJ_FREQUENCY != 0 {
+			kernelFreq = timex.Freq
+		}
+		timex.Freq = kernelFreq
+		return 0, nil
+	}}
+
+	// Поправка ограничивается пределом часов, частота ядра в 2^-16 ppm
+	if err := c.AdjustFrequency(-5000); err != nil {
+		t.Fatal(err)
+	}
+	if kernelFreq != -1000*65536/1000 {
+		t.Errorf("kernel frequency = %d, want %d", kernelFreq, -1000*65536/1000)
+	}
+	if freq, err := c.Frequency(); err != nil || freq != -1000 {
+		t.Errorf("Frequency() = %v, %v, want -1000", freq, err)
+	}
+}
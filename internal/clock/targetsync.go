@@ -0,0 +1,244 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+const (
+	defaultTargetInterval      = time.Second
+	defaultTargetStepThreshold = 20 * time.Microsecond // Как phc2sys -F
+)
+
+// TargetStatus состояние синхронизации одних часов от других
+type TargetStatus struct {
+	Name       string        `json:"name"`
+	Clock      string        `json:"clock"`
+	Source     string        `json:"source"`
+	Algorithm  string        `json:"algorithm"`
+	Offset     time.Duration `json:"offset"`
+	Delay      time.Duration `json:"delay"`
+	Frequency  float64       `json:"frequency"`
+	Updates    uint64        `json:"updates"`
+	Steps      uint64        `json:"steps"`
+	LastUpdate time.Time     `json:"last_update"`
+	LastError  string        `json:"last_error,omitempty"`
+}
+
+// TargetSync синхронизирует ведомые часы от ведущих так же, как phc2sys:
+// смещение измеряется чтением обоих часов, а дисциплина подстраивает
+// частоту ведомых часов через clock_adjtime
+type TargetSync struct {
+	name          string
+	clock         ClockTarget
+	source        ClockTarget
+	offset        time.Duration
+	interval      time.Duration
+	samples       int
+	stepThreshold time.Duration
+	discipline    Discipline
+
+	mu         sync.RWMutex
+	status     TargetStatus
+	lastUpdate time.Time
+
+	logger *logrus.Logger
+}
+
+// NewTargetSync открывает ведущие и ведомые часы и создает синхронизацию
+func NewTargetSync(cfg config.ClockTargetConfig, clockConfig config.ClockConfig, logger *logrus.Logger) (*TargetSync, error) {
+	discipline, err := NewDiscipline(targetDisciplineConfig(cfg, clockConfig), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	clock, err := OpenClockTarget(cfg.Clock)
+	if err != nil {
+		return nil, err
+	}
+	source, err := OpenClockTarget(cfg.Source)
+	if err != nil {
+		clock.Close()
+		return nil, err
+	}
+
+	return newTargetSync(cfg, discipline, clock, source, logger), nil
+}
+
+// targetDisciplineConfig возвращает настройки дисциплины цели: заданные
+// коэффициенты цели переопределяют общие, остальное берется из секции clock
+func targetDisciplineConfig(cfg config.ClockTargetConfig, clockConfig config.ClockConfig) config.ClockConfig {
+	disciplineConfig := clockConfig
+	disciplineConfig.Algorithm = cfg.Algorithm
+	if disciplineConfig.Algorithm == "" {
+		disciplineConfig.Algorithm = "pi"
+	}
+	if cfg.KP != 0 {
+		disciplineConfig.KP = cfg.KP
+	}
+	if cfg.KI != 0 {
+		disciplineConfig.KI = cfg.KI
+	}
+	if cfg.KD != 0 {
+		disciplineConfig.KD = cfg.KD
+	}
+	return disciplineConfig
+}
+
+// newTargetSync создает синхронизацию уже открытых часов
+func newTargetSync(cfg config.ClockTargetConfig, discipline Discipline, clock, source ClockTarget, logger *logrus.Logger) *TargetSync {
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("%s->%s", source.Name(), clock.Name())
+	}
+
+	t := &TargetSync{
+		name:          name,
+		clock:         clock,
+		source:        source,
+		offset:        cfg.Offset,
+		interval:      defaultTargetInterval,
+		samples:       cfg.Samples,
+		stepThreshold: defaultTargetStepThreshold,
+		discipline:    discipline,
+		logger:        logger,
+	}
+
+	if cfg.Interval > 0 {
+		t.interval = cfg.Interval
+	}
+	if cfg.StepThreshold > 0 {
+		t.stepThreshold = cfg.StepThreshold
+	}
+
+	t.status = TargetStatus{
+		Name:      name,
+		Clock:     clock.Name(),
+		Source:    source.Name(),
+		Algorithm: discipline.Name(),
+	}
+
+	return t
+}
+
+// Name возвращает имя синхронизации
+func (t *TargetSync) Name() string {
+	return t.name
+}
+
+// Run выполняет цикл синхронизации до отмены контекста
+func (t *TargetSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	t.logger.WithFields(logrus.Fields{
+		"target":   t.name,
+		"clock":    t.clock.Name(),
+		"source":   t.source.Name(),
+		"interval": t.interval,
+	}).Info("Clock target synchronization started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.update(); err != nil {
+				t.mu.Lock()
+				t.status.LastError = err.Error()
+				t.mu.Unlock()
+				t.logger.WithError(err).WithField("target", t.name).Debug("Clock target update failed")
+			}
+		}
+	}
+}
+
+// update измеряет смещение и подстраивает ведомые часы
+func (t *TargetSync) update() error {
+	measured, delay, err := MeasureOffset(t.source, t.clock, t.samples)
+	if err != nil {
+		return err
+	}
+	offset := measured + t.offset
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.Offset = offset
+	t.status.Delay = delay
+	t.status.LastError = ""
+
+	// Step допускается только при первом измерении (phc2sys -F)
+	if t.status.Updates == 0 && math.Abs(float64(offset)) > float64(t.stepThreshold) {
+		if err := t.clock.Step(offset); err != nil {
+			return err
+		}
+		t.status.Steps++
+		t.status.Updates++
+		t.discipline.Reset()
+		t.lastUpdate = time.Time{}
+
+		t.logger.WithFields(logrus.Fields{
+			"target": t.name,
+			"offset": offset,
+		}).Warn("Clock target stepped")
+		return nil
+	}
+
+	interval := time.Duration(0)
+	if !t.lastUpdate.IsZero() {
+		interval = now.Sub(t.lastUpdate)
+	}
+	t.lastUpdate = now
+
+	freq := t.discipline.Sample(DisciplineInput{
+		Offset:    offset,
+		Delay:     delay,
+		Jitter:    delay / 2,
+		Quality:   255,
+		Interval:  interval,
+		Timestamp: now,
+	})
+	freq = clampFrequency(freq, t.clock.MaxFrequency())
+
+	if err := t.clock.AdjustFrequency(freq); err != nil {
+		return err
+	}
+
+	t.status.Frequency = freq
+	t.status.Updates++
+	t.status.LastUpdate = now
+
+	t.logger.WithFields(logrus.Fields{
+		"target":    t.name,
+		"offset":    offset,
+		"delay":     delay,
+		"frequency": freq,
+	}).Debug("Clock target adjusted")
+
+	return nil
+}
+
+// Status возвращает состояние синхронизации
+func (t *TargetSync) Status() TargetStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status
+}
+
+// Close закрывает устройства часов
+func (t *TargetSync) Close() error {
+	errClock := t.clock.Close()
+	if err := t.source.Close(); err != nil {
+		return err
+	}
+	return errClock
+}
@@ -0,0 +1,116 @@
+package clock
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func newTestTargetSync(t *testing.T, cfg config.ClockTargetConfig, clock, source ClockTarget) *TargetSync {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	discipline, err := NewDiscipline(targetDisciplineConfig(cfg, config.ClockConfig{}), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTargetSync(cfg, discipline, clock, source, logger)
+}
+
+func TestTargetSyncUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration // Смещение ведомых часов при первом измерении
+		steps  int
+	}{
+		{name: "step on first update", offset: -time.Millisecond, steps: 1},
+		{name: "below step threshold", offset: -10 * time.Microsecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeClockTarget{name: "source", now: simulationEpoch}
+			clock := &fakeClockTarget{name: "clock", now: simulationEpoch.Add(tt.offset), maxFreq: 1000}
+			ts := newTestTargetSync(t, config.ClockTargetConfig{}, clock, source)
+
+			if err := ts.update(); err != nil {
+				t.Fatalf("update() error = %v", err)
+			}
+			if len(clock.steps) != tt.steps {
+				t.Fatalf("steps = %v, want %d", clock.steps, tt.steps)
+			}
+			if tt.steps > 0 && (clock.steps[0] != -tt.offset || clock.adjusts != 0) {
+				t.Errorf("step = %v with %d frequency adjustments, want %v only", clock.steps[0], clock.adjusts, -tt.offset)
+			}
+
+			// Дальше любое смещение убирается только подстройкой частоты,
+			// которая ограничена пределом часов
+			clock.now = simulationEpoch.Add(-time.Second)
+			for i := 0; i < 3; i++ {
+				if err := ts.update(); err != nil {
+					t.Fatalf("update() error = %v", err)
+				}
+			}
+			if len(clock.steps) != tt.steps {
+				t.Errorf("steps = %v, want no step after first update", clock.steps)
+			}
+			if math.Abs(clock.freq) != clock.maxFreq {
+				t.Errorf("frequency = %.1f ppb, want clamped to ±%.0f", clock.freq, clock.maxFreq)
+			}
+
+			status := ts.Status()
+			if status.Updates != 4 || status.Steps != uint64(tt.steps) || status.Offset != time.Second {
+				t.Errorf("status = %+v, want 4 updates, %d steps, 1s offset", status, tt.steps)
+			}
+			if status.Frequency != clock.freq || status.Name != "source->clock" || status.Algorithm != "pi" {
+				t.Errorf("status = %+v", status)
+			}
+		})
+	}
+}
+
+func TestTargetSyncAdjustError(t *testing.T) {
+	source := &fakeClockTarget{name: "source", now: simulationEpoch}
+	clock := &fakeClockTarget{name: "clock", now: simulationEpoch, maxFreq: 1000, adjustErr: unix.EPERM}
+	ts := newTestTargetSync(t, config.ClockTargetConfig{Name: "phc"}, clock, source)
+
+	if err := ts.update(); !errors.Is(err, unix.EPERM) {
+		t.Fatalf("update() error = %v, want EPERM", err)
+	}
+	if status := ts.Status(); status.Updates != 0 || status.Name != "phc" {
+		t.Errorf("status = %+v, want no counted update", status)
+	}
+}
+
+func TestTargetDisciplineConfig(t *testing.T) {
+	clockConfig := config.ClockConfig{Algorithm: "pid", KP: 0.5, KI: 0.01, KD: 0.1}
+
+	tests := []struct {
+		name       string
+		target     config.ClockTargetConfig
+		algorithm  string
+		kp, ki, kd float64
+	}{
+		{name: "inherit gains", algorithm: "pi", kp: 0.5, ki: 0.01, kd: 0.1},
+		{name: "override kp", target: config.ClockTargetConfig{Algorithm: "pid", KP: 0.7}, algorithm: "pid", kp: 0.7, ki: 0.01, kd: 0.1},
+		{name: "override all", target: config.ClockTargetConfig{KP: 0.2, KI: 0.02, KD: 0.3}, algorithm: "pi", kp: 0.2, ki: 0.02, kd: 0.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := targetDisciplineConfig(tt.target, clockConfig)
+			if cfg.Algorithm != tt.algorithm || cfg.KP != tt.kp || cfg.KI != tt.ki || cfg.KD != tt.kd {
+				t.Errorf("config = %s kp=%v ki=%v kd=%v, want %s kp=%v ki=%v kd=%v",
+					cfg.Algorithm, cfg.KP, cfg.KI, cfg.KD, tt.algorithm, tt.kp, tt.ki, tt.kd)
+			}
+		})
+	}
+}
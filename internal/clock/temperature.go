@@ -0,0 +1,293 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	defaultTemperatureInterval = 10 * time.Second
+	defaultTemperatureBinWidth = 0.5 // °C
+	defaultTemperatureMinSpan  = 2.0 // °C
+
+	// Число измерений, после которого среднее интервала температур
+	// становится скользящим и следует за старением генератора
+	temperatureBinMemory = 256
+)
+
+// temperatureBin средняя частота генератора в интервале температур
+type temperatureBin struct {
+	frequency float64 // ppb
+	count     int
+}
+
+// TemperatureStatus состояние температурной компенсации для API
+type TemperatureStatus struct {
+	Sensor      string    `json:"sensor"`
+	Temperature float64   `json:"temperature"` // Последнее показание датчика, °C
+	Updated     time.Time `json:"updated,omitempty"`
+	Ready       bool      `json:"ready"`
+	Bins        int       `json:"bins"`
+	Low         float64   `json:"low"`         // Нижняя изученная температура, °C
+	High        float64   `json:"high"`        // Верхняя изученная температура, °C
+	Reference   float64   `json:"reference"`   // Температура, при которой поправка нулевая, °C
+	Coefficient float64   `json:"coefficient"` // Наклон кривой при текущей температуре, ppb/°C
+	Correction  float64   `json:"correction"`  // Текущая упреждающая поправка, ppb
+	Error       string    `json:"error,omitempty"`
+}
+
+// TemperatureCompensator модель зависимости частоты генератора от
+// температуры. Пока часы захвачены, частота, выданная часам, усредняется
+// по интервалам температур, и по средним подбирается полином второй
+// степени. Поправка - разница кривой при текущей температуре и при
+// температуре, на которой модель была готова впервые, поэтому дисциплина
+// и модель holdover ведут только не зависящую от температуры часть частоты.
+type TemperatureCompensator struct {
+	mu sync.RWMutex
+
+	sensor   string
+	read     func() (float64, error)
+	interval time.Duration
+	binWidth float64
+	minSpan  float64
+
+	temperature float64
+	updated     time.Time
+	readErr     error
+
+	bins      map[int]*temperatureBin
+	ready     bool
+	low       float64
+	high      float64
+	center    float64   // Центр изученного диапазона, от него считается полином
+	coeffs    []float64 // Коэффициенты полинома по возрастанию степени
+	reference float64
+
+	logger *logrus.Logger
+}
+
+// NewTemperatureCompensator создает модель с датчиком cfg.Sensor
+func NewTemperatureCompensator(cfg config.TemperatureConfig, logger *logrus.Logger) *TemperatureCompensator {
+	tc := &TemperatureCompensator{
+		sensor:   cfg.Sensor,
+		interval: defaultTemperatureInterval,
+		binWidth: defaultTemperatureBinWidth,
+		minSpan:  defaultTemperatureMinSpan,
+		bins:     make(map[int]*temperatureBin),
+		logger:   logger,
+	}
+	tc.read = func() (float64, error) {
+		return ReadTemperatureSensor(tc.sensor)
+	}
+
+	if cfg.Interval > 0 {
+		tc.interval = cfg.Interval
+	}
+	if cfg.BinWidth > 0 {
+		tc.binWidth = cfg.BinWidth
+	}
+	if cfg.MinSpan > 0 {
+		tc.minSpan = cfg.MinSpan
+	}
+	return tc
+}
+
+// ReadTemperatureSensor читает датчик sysfs: hwmon temp*_input и
+// thermal_zone*/temp содержат температуру в миллиградусах Цельсия
+func ReadTemperatureSensor(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temperature sensor: %w", err)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature sensor value %q: %w", strings.TrimSpace(string(data)), err)
+	}
+	return value / 1000, nil
+}
+
+// Update читает датчик, если подошел период чтения, и возвращает новое
+// показание
+func (tc *TemperatureCompensator) Update(now time.Time) (float64, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.updated.IsZero() && now.Sub(tc.updated) < tc.interval {
+		return 0, false
+	}
+
+	temperature, err := tc.read()
+	if err != nil {
+		if tc.readErr == nil {
+			tc.logger.WithError(err).WithField("sensor", tc.sensor).Warn("Failed to read temperature sensor")
+		}
+		tc.readErr = err
+		return 0, false
+	}
+	tc.readErr = nil
+	tc.temperature = temperature
+	tc.updated = now
+	return temperature, true
+}
+
+// valid проверяет, что показание датчика свежее. Вызывается под tc.mu.
+func (tc *TemperatureCompensator) valid(now time.Time) bool {
+	return !tc.updated.IsZero() && tc.readErr == nil && now.Sub(tc.updated) <= 3*tc.interval
+}
+
+// Learn добавляет частоту, выданную часам в захваченном состоянии при
+// текущей температуре
+func (tc *TemperatureCompensator) Learn(now time.Time, frequency float64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.valid(now) {
+		return
+	}
+
+	index := int(math.Floor(tc.temperature / tc.binWidth))
+	bin, ok := tc.bins[index]
+	if !ok {
+		bin = &temperatureBin{}
+		tc.bins[index] = bin
+	}
+	if bin.count < temperatureBinMemory {
+		bin.count++
+	}
+	bin.frequency += (frequency - bin.frequency) / float64(bin.count)
+
+	tc.fit()
+}
+
+// fit подбирает полином по средним интервалов температур. Вызывается под tc.mu.
+func (tc *TemperatureCompensator) fit() {
+	indexes := make([]int, 0, len(tc.bins))
+	for index := range tc.bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	if len(indexes) < 2 {
+		return
+	}
+
+	low := (float64(indexes[0]) + 0.5) * tc.binWidth
+	high := (float64(indexes[len(indexes)-1]) + 0.5) * tc.binWidth
+	span := high - low
+	if span < tc.minSpan {
+		return
+	}
+
+	// Кривизна оценивается, только когда диапазон покрывает хотя бы три интервала
+	degree := 1
+	if len(indexes) >= 3 && span >= 2*tc.minSpan {
+		degree = 2
+	}
+
+	center := (low + high) / 2
+	design := mat.NewDense(len(indexes), degree+1, nil)
+	values := mat.NewVecDense(len(indexes), nil)
+	for row, index := range indexes {
+		x := (float64(index)+0.5)*tc.binWidth - center
+		for col := 0; col <= degree; col++ {
+			design.Set(row, col, math.Pow(x, float64(col)))
+		}
+		values.SetVec(row, tc.bins[index].frequency)
+	}
+
+	var solution mat.VecDense
+	if err := solution.SolveVec(design, values); err != nil {
+		return
+	}
+
+	tc.low, tc.high, tc.center = low, high, center
+	tc.coeffs = make([]float64, degree+1)
+	for i := range tc.coeffs {
+		tc.coeffs[i] = solution.AtVec(i)
+	}
+
+	// Поправка начинает действовать с нуля при текущей температуре
+	if !tc.ready {
+		tc.ready = true
+		tc.reference = tc.temperature
+		tc.logger.WithFields(logrus.Fields{
+			"low":       low,
+			"high":      high,
+			"reference": tc.reference,
+		}).Info("Temperature compensation model ready")
+	}
+}
+
+// curve возвращает частоту модели при температуре t. За пределами
+// изученного диапазона кривая продолжается касательной. Вызывается под tc.mu.
+func (tc *TemperatureCompensator) curve(t float64) float64 {
+	edge := math.Max(tc.low, math.Min(tc.high, t))
+	return tc.polynomial(edge) + tc.slope(edge)*(t-edge)
+}
+
+func (tc *TemperatureCompensator) polynomial(t float64) float64 {
+	x := t - tc.center
+	var value float64
+	for i := len(tc.coeffs) - 1; i >= 0; i-- {
+		value = value*x + tc.coeffs[i]
+	}
+	return value
+}
+
+func (tc *TemperatureCompensator) slope(t float64) float64 {
+	x := t - tc.center
+	var value float64
+	for i := len(tc.coeffs) - 1; i >= 1; i-- {
+		value = value*x + float64(i)*tc.coeffs[i]
+	}
+	return value
+}
+
+// Correction возвращает упреждающую поправку частоты в ppb при последнем
+// показании датчика или 0, если модель не готова или датчик не читается
+func (tc *TemperatureCompensator) Correction(now time.Time) float64 {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return tc.correction(now)
+}
+
+func (tc *TemperatureCompensator) correction(now time.Time) float64 {
+	if !tc.ready || !tc.valid(now) {
+		return 0
+	}
+	return tc.curve(tc.temperature) - tc.curve(tc.reference)
+}
+
+// Status возвращает состояние компенсации на момент now
+func (tc *TemperatureCompensator) Status(now time.Time) TemperatureStatus {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+
+	status := TemperatureStatus{
+		Sensor:      tc.sensor,
+		Temperature: tc.temperature,
+		Updated:     tc.updated,
+		Ready:       tc.ready,
+		Bins:        len(tc.bins),
+	}
+	if tc.readErr != nil {
+		status.Error = tc.readErr.Error()
+	}
+	if tc.ready {
+		status.Low, status.High = tc.low, tc.high
+		status.Reference = tc.reference
+		edge := math.Max(tc.low, math.Min(tc.high, tc.temperature))
+		status.Coefficient = tc.slope(edge)
+		status.Correction = tc.correction(now)
+	}
+	return status
+}
@@ -0,0 +1,128 @@
+package clock
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestTemperatureCompensator(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// Датчик hwmon в миллиградусах
+	sensor := filepath.Join(t.TempDir(), "temp1_input")
+	setTemperature := func(celsius float64) {
+		value := strconv.Itoa(int(celsius * 1000))
+		if err := os.WriteFile(sensor, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTemperature(25)
+	if temperature, err := ReadTemperatureSensor(sensor); err != nil || temperature != 25 {
+		t.Fatalf("ReadTemperatureSensor() = %v, %v", temperature, err)
+	}
+
+	// Частота генератора - парабола по температуре
+	curve := func(celsius float64) float64 {
+		return 3000 + 150*(celsius-25) - 4*(celsius-25)*(celsius-25)
+	}
+
+	tc := NewTemperatureCompensator(config.TemperatureConfig{Sensor: sensor, Interval: time.Second}, logger)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, celsius := range []float64{25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35} {
+		setTemperature(celsius)
+		for i := 0; i < 20; i++ {
+			now = now.Add(time.Second)
+			if _, ok := tc.Update(now); !ok {
+				t.Fatalf("sensor not read at %v", now)
+			}
+			tc.Learn(now, curve(celsius))
+		}
+	}
+
+	status := tc.Status(now)
+	if !status.Ready || status.Bins != 11 {
+		t.Fatalf("status = %+v, want ready model over 11 bins", status)
+	}
+
+	// Поправка отсчитывается от температуры, при которой модель стала готова
+	for _, celsius := range []float64{25, 30, 35, 38} {
+		setTemperature(celsius)
+		now = now.Add(time.Second)
+		tc.Update(now)
+		want := curve(celsius) - curve(status.Reference)
+		if celsius > 35 {
+			// За изученным диапазоном кривая продолжается касательной
+			want = curve(35) + (150-8*10)*(celsius-35) - curve(status.Reference)
+		}
+		if got := tc.Correction(now); math.Abs(got-want) > 20 {
+			t.Errorf("correction at %.0f°C = %.0f ppb, want %.0f", celsius, got, want)
+		}
+	}
+
+	// Ошибка датчика отключает поправку
+	if err := os.WriteFile(sensor, []byte("n/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	tc.Update(now)
+	if got := tc.Correction(now); got != 0 {
+		t.Errorf("correction with failed sensor = %.0f, want 0", got)
+	}
+	if status := tc.Status(now); status.Error == "" {
+		t.Error("sensor error not reported")
+	}
+}
+
+func TestSimulationTemperatureHoldover(t *testing.T) {
+	// Корпус нагревается и остывает, пока часы захвачены, а в holdover
+	// температура поднимается на 6 °C
+	var steps []SimTemperatureStep
+	for i, celsius := range []float64{27, 29, 31, 33, 31, 29, 27, 25, 27, 29, 31, 29, 27, 25} {
+		steps = append(steps, SimTemperatureStep{At: time.Duration(i+1) * 15 * time.Minute, Temperature: celsius})
+	}
+	outage := SimOutage{Start: 4 * time.Hour, End: 5 * time.Hour}
+	steps = append(steps, SimTemperatureStep{At: outage.Start + 5*time.Minute, Temperature: 31})
+
+	oscillator := SimOscillatorConfig{
+		FrequencyOffset:        3000,
+		Temperature:            25,
+		TemperatureCoefficient: 200,
+		TemperatureSteps:       steps,
+		Seed:                   3,
+	}
+
+	holdoverError := func(sensor string) (time.Duration, *Simulation) {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{
+			Algorithm:   "kalman",
+			Holdover:    config.HoldoverConfig{MaxError: time.Second},
+			Temperature: config.TemperatureConfig{Sensor: sensor},
+		}}
+		sim := newTestSimulation(t, cfg, oscillator, simSources(3, "ntp", 50*time.Microsecond, outage))
+		result := sim.Run(outage.End)
+		return result.MaxOffset(outage.Start), sim
+	}
+
+	// Без компенсации частота holdover отстает на 1.2 ppm
+	uncompensated, _ := holdoverError("")
+	compensated, sim := holdoverError("sim")
+
+	status, ok := sim.Manager().GetTemperatureStatus()
+	if !ok || !status.Ready {
+		t.Fatalf("temperature status = %+v, want ready model", status)
+	}
+	// Поправка частоты компенсирует уход генератора, поэтому наклон обратный
+	if math.Abs(status.Coefficient+200) > 40 {
+		t.Errorf("learned coefficient = %.0f ppb/°C, want -200", status.Coefficient)
+	}
+	if compensated > time.Millisecond || compensated*4 > uncompensated {
+		t.Errorf("max holdover offset compensated = %v, uncompensated = %v", compensated, uncompensated)
+	}
+}
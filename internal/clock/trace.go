@@ -0,0 +1,218 @@
+package clock
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TracePoint измерение записанной трассы: смещение от источника и поправка
+// частоты, которая действовала после измерения
+type TracePoint struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Offset    time.Duration `json:"offset"`          // Смещение источника (источник - часы), ns
+	Frequency float64       `json:"frequency"`       // Поправка частоты, ppb
+	Delay     time.Duration `json:"delay,omitempty"` // Задержка до источника, ns
+}
+
+// ReadTrace читает трассу в формате CSV (timestamp,offset,frequency[,delay])
+// или JSON lines. Время в RFC3339, смещение и задержка - в наносекундах или
+// строкой длительности (1.5ms), частота - в ppb. Строка заголовка CSV и
+// комментарии (#) пропускаются. Точки сортируются по времени.
+func ReadTrace(r io.Reader) ([]TracePoint, error) {
+	reader := bufio.NewReader(r)
+	first, err := firstSignificantByte(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []TracePoint
+	if first == '{' {
+		points, err = readTraceJSON(reader)
+	} else {
+		points, err = readTraceCSV(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(points) < 2 {
+		return nil, fmt.Errorf("trace has %d samples, need at least 2", len(points))
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+	return points, nil
+}
+
+// firstSignificantByte возвращает первый непробельный символ, не извлекая его
+func firstSignificantByte(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return 0, fmt.Errorf("trace is empty")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read trace: %w", err)
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+func readTraceJSON(reader io.Reader) ([]TracePoint, error) {
+	var points []TracePoint
+	decoder := json.NewDecoder(reader)
+	for {
+		var point TracePoint
+		err := decoder.Decode(&point)
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trace sample %d: %w", len(points)+1, err)
+		}
+		points = append(points, point)
+	}
+}
+
+func readTraceCSV(reader io.Reader) ([]TracePoint, error) {
+	records := csv.NewReader(reader)
+	records.Comment = '#'
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+
+	var points []TracePoint
+	for line := 1; ; line++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trace: %w", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("trace line %d: want timestamp,offset,frequency[,delay]", line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "timestamp") {
+			continue
+		}
+
+		point, err := parseTraceRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", line, err)
+		}
+		points = append(points, point)
+	}
+}
+
+func parseTraceRecord(record []string) (TracePoint, error) {
+	var point TracePoint
+	var err error
+
+	if point.Timestamp, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(record[0])); err != nil {
+		return point, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if point.Offset, err = parseTraceDuration(record[1]); err != nil {
+		return point, fmt.Errorf("invalid offset: %w", err)
+	}
+	if point.Frequency, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64); err != nil {
+		return point, fmt.Errorf("invalid frequency: %w", err)
+	}
+	if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+		if point.Delay, err = parseTraceDuration(record[3]); err != nil {
+			return point, fmt.Errorf("invalid delay: %w", err)
+		}
+	}
+	return point, nil
+}
+
+// parseTraceDuration разбирает наносекунды или строку длительности
+func parseTraceDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if ns, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(ns), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// TracePhase восстанавливает собственную фазу генератора по трассе.
+// Смещение часов от источника равно -offset, а фаза, набранная поправками
+// частоты, вычитается: остается фаза свободно бегущих часов, к которой
+// симуляция добавит поправки проверяемой дисциплины. Шум измерений при
+// этом становится частью фазы генератора.
+func TracePhase(trace []TracePoint) []SimPhasePoint {
+	if len(trace) == 0 {
+		return nil
+	}
+
+	start := trace[0].Timestamp
+	phase := make([]SimPhasePoint, len(trace))
+	var corrected float64 // Фаза, набранная поправками частоты, ns
+	for i, point := range trace {
+		if i > 0 {
+			// Поправка частоты действует до следующего измерения
+			corrected += trace[i-1].Frequency * point.Timestamp.Sub(trace[i-1].Timestamp).Seconds()
+		}
+		phase[i] = SimPhasePoint{
+			At:    point.Timestamp.Sub(start),
+			Phase: -float64(point.Offset) - corrected,
+		}
+	}
+	return phase
+}
+
+// TraceSource возвращает параметры моделируемого источника, который
+// измеряет часы с интервалом и задержкой записанной трассы
+func TraceSource(trace []TracePoint) SimSourceConfig {
+	var intervals []time.Duration
+	var delays []float64
+	for i, point := range trace {
+		if i > 0 {
+			if interval := point.Timestamp.Sub(trace[i-1].Timestamp); interval > 0 {
+				intervals = append(intervals, interval)
+			}
+		}
+		if point.Delay > 0 {
+			delays = append(delays, float64(point.Delay))
+		}
+	}
+
+	// Трасса - единственный источник повтора, поэтому шаги подтверждает она одна
+	source := SimSourceConfig{Name: "trace", Trust: true, Seed: 1}
+	if len(intervals) > 0 {
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i] < intervals[j]
+		})
+		source.PollInterval = intervals[len(intervals)/2].Round(time.Second)
+	}
+	if len(delays) > 0 {
+		mean, std := meanStd(delays)
+		source.Delay = time.Duration(mean)
+		source.DelayJitter = time.Duration(std)
+	}
+	return source
+}
+
+// meanStd возвращает среднее и СКО значений
+func meanStd(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
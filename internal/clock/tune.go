@@ -0,0 +1,216 @@
+package clock
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/stability"
+)
+
+const (
+	defaultTuneBudget   = 40
+	defaultTuneStrategy = "ensemble"
+)
+
+// TuneConfig настройки подбора параметров дисциплины по записанной трассе
+type TuneConfig struct {
+	Strategy string        // Стратегия поиска: genetic, bayesian, ensemble
+	Budget   int           // Число повторов трассы в симуляции
+	Settle   time.Duration // Начало трассы, не учитываемое в оценке (по умолчанию четверть трассы)
+	Seed     int64
+}
+
+// TraceScore качество дисциплины при повторе трассы
+type TraceScore struct {
+	RMS       time.Duration     `json:"rms"`
+	MaxOffset time.Duration     `json:"max_offset"`
+	MTIE      []stability.Point `json:"mtie"`
+	Steps     int               `json:"steps"`
+}
+
+// MaxMTIE возвращает MTIE на наибольшем интервале наблюдения
+func (s TraceScore) MaxMTIE() (time.Duration, time.Duration) {
+	if len(s.MTIE) == 0 {
+		return 0, 0
+	}
+	last := s.MTIE[len(s.MTIE)-1]
+	return last.Tau, time.Duration(last.MTIE * 1e9)
+}
+
+// TuneResult результат подбора параметров дисциплины
+type TuneResult struct {
+	Algorithm    string                 `json:"algorithm"`
+	Samples      int                    `json:"samples"`
+	Span         time.Duration          `json:"span"`
+	PollInterval time.Duration          `json:"poll_interval"`
+	Parameters   OptimizationParameters `json:"parameters"`
+	Optimizer    string                 `json:"optimizer"`
+	Evaluations  int                    `json:"evaluations"`
+	Baseline     TraceScore             `json:"baseline"` // Текущая конфигурация
+	Tuned        TraceScore             `json:"tuned"`
+}
+
+// replayConfig возвращает конфигурацию для повтора в симуляции: часы
+// подстраиваются, а drift файл, RTC, файл записи и файл последнего
+// достоверного времени не трогаются
+func replayConfig(cfg config.ShiwaTimeConfig) config.ShiwaTimeConfig {
+	cfg.ClockSync.AdjustClock = true
+	cfg.Clock.DriftFile = ""
+	cfg.Clock.LastGoodFile = ""
+	cfg.SyncRTC.Enable = false
+	cfg.Clock.Recording = config.RecordingConfig{}
+	return cfg
+}
+
+// ReplayTrace повторяет трассу в симуляции с дисциплиной из cfg и длиной
+// фильтра измерений filterLength (0 - по умолчанию). Генератор воспроизводит
+// собственную фазу из трассы, начальная частота берется из первой точки,
+// как при восстановлении из drift файла. Оценка учитывает время после settle.
+func ReplayTrace(trace []TracePoint, cfg config.ShiwaTimeConfig, filterLength int, settle time.Duration, logger *logrus.Logger) (TraceScore, error) {
+	if len(trace) < 2 {
+		return TraceScore{}, fmt.Errorf("trace has %d samples, need at least 2", len(trace))
+	}
+	span := trace[len(trace)-1].Timestamp.Sub(trace[0].Timestamp)
+	if settle >= span {
+		return TraceScore{}, fmt.Errorf("settle time %v is not shorter than trace span %v", settle, span)
+	}
+
+	source := TraceSource(trace)
+	source.FilterLength = filterLength
+	sim, err := NewSimulation(replayConfig(cfg), SimOscillatorConfig{Phase: TracePhase(trace)}, []SimSourceConfig{source}, logger)
+	if err != nil {
+		return TraceScore{}, err
+	}
+	sim.SetFrequency(trace[0].Frequency)
+	result := sim.Run(span)
+
+	score := TraceScore{
+		RMS:       result.RMSOffset(settle),
+		MaxOffset: result.MaxOffset(settle),
+		Steps:     len(result.Steps),
+	}
+	var phase []float64
+	for _, point := range result.Points {
+		if point.Elapsed >= settle {
+			phase = append(phase, float64(point.Offset)/1e9)
+		}
+	}
+	score.MTIE = stability.Analyze(phase, defaultSimulationStep).Points
+	return score, nil
+}
+
+// Tune подбирает коэффициенты дисциплины cfg.Clock.Algorithm и длину
+// фильтра измерений, повторяя трассу в симуляции для каждой точки поиска.
+// Стоимость точки - СКО смещения после settle.
+func Tune(trace []TracePoint, cfg config.ShiwaTimeConfig, tuneConfig TuneConfig, logger *logrus.Logger) (*TuneResult, error) {
+	if len(trace) < 2 {
+		return nil, fmt.Errorf("trace has %d samples, need at least 2", len(trace))
+	}
+	if tuneConfig.Budget <= 0 {
+		tuneConfig.Budget = defaultTuneBudget
+	}
+	if tuneConfig.Strategy == "" {
+		tuneConfig.Strategy = defaultTuneStrategy
+	}
+	span := trace[len(trace)-1].Timestamp.Sub(trace[0].Timestamp)
+	if tuneConfig.Settle <= 0 {
+		tuneConfig.Settle = span / 4
+	}
+
+	algorithm := strings.ToLower(cfg.Clock.Algorithm)
+	if algorithm == "" {
+		algorithm = "pid"
+	}
+	cfg.Clock.Algorithm = algorithm
+	if _, err := NewDiscipline(cfg.Clock, logger); err != nil {
+		return nil, err
+	}
+
+	baseline, err := ReplayTrace(trace, cfg, 0, tuneConfig.Settle, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Поиск начинается с текущей конфигурации, поэтому результат не хуже нее
+	kp, ki, kd := disciplineGains(cfg.Clock)
+	current := OptimizationParameters{KP: kp, KI: ki, KD: kd, FilterLength: defaultNTPFilterStages}
+
+	objective := func(params OptimizationParameters) float64 {
+		candidate := cfg
+		candidate.Clock.KP, candidate.Clock.KI, candidate.Clock.KD = params.KP, params.KI, params.KD
+		score, err := ReplayTrace(trace, candidate, params.FilterLength, tuneConfig.Settle, logger)
+		if err != nil {
+			return math.Inf(1)
+		}
+		return float64(score.RMS)
+	}
+
+	optimizer := NewMLOptimizer(logger)
+	search, err := optimizer.Search(SearchConfig{
+		Strategy: tuneConfig.Strategy,
+		Budget:   tuneConfig.Budget,
+		Seed:     tuneConfig.Seed,
+	}, DefaultParameterSpace(algorithm), objective, current)
+	if err != nil {
+		return nil, err
+	}
+
+	best := cfg
+	best.Clock.KP, best.Clock.KI, best.Clock.KD = search.Parameters.KP, search.Parameters.KI, search.Parameters.KD
+	tuned, err := ReplayTrace(trace, best, search.Parameters.FilterLength, tuneConfig.Settle, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TuneResult{
+		Algorithm:    algorithm,
+		Samples:      len(trace),
+		Span:         span,
+		PollInterval: TraceSource(trace).PollInterval,
+		Parameters:   search.Parameters,
+		Optimizer:    search.Optimizer,
+		Evaluations:  search.Evaluations,
+		Baseline:     baseline,
+		Tuned:        tuned,
+	}, nil
+}
+
+// ConfigSnippet возвращает фрагмент конфигурации с найденными параметрами
+func (r *TuneResult) ConfigSnippet() string {
+	var b strings.Builder
+	tau, mtie := r.Tuned.MaxMTIE()
+	baseTau, baseMTIE := r.Baseline.MaxMTIE()
+
+	fmt.Fprintf(&b, "# shiwatime tune: %d samples over %v, poll %v, %s (%d evaluations)\n",
+		r.Samples, r.Span, r.PollInterval, r.Optimizer, r.Evaluations)
+	fmt.Fprintf(&b, "# tuned:   RMS %v, max %v, MTIE(%v) %v\n", r.Tuned.RMS, r.Tuned.MaxOffset, tau, mtie)
+	fmt.Fprintf(&b, "# current: RMS %v, max %v, MTIE(%v) %v\n", r.Baseline.RMS, r.Baseline.MaxOffset, baseTau, baseMTIE)
+	b.WriteString("shiwatime:\n")
+	b.WriteString("  clock:\n")
+	fmt.Fprintf(&b, "    algorithm: %s\n", r.Algorithm)
+
+	space := DefaultParameterSpace(r.Algorithm)
+	for _, gain := range []struct {
+		name  string
+		value float64
+		space ParameterRange
+	}{
+		{"kp", r.Parameters.KP, space.KP},
+		{"ki", r.Parameters.KI, space.KI},
+		{"kd", r.Parameters.KD, space.KD},
+	} {
+		if gain.space.Max > gain.space.Min {
+			fmt.Fprintf(&b, "    %s: %s\n", gain.name, strconv.FormatFloat(gain.value, 'g', 4, 64))
+		}
+	}
+
+	b.WriteString("# Sample filter length of the traced source\n")
+	b.WriteString("# (clock_sync.primary_clocks[].filter_length):\n")
+	fmt.Fprintf(&b, "#   filter_length: %d\n", r.Parameters.FilterLength)
+	return b.String()
+}
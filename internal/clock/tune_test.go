@@ -0,0 +1,120 @@
+package clock
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// syntheticTrace записывает смещения свободно бегущего генератора
+func syntheticTrace(n int, interval time.Duration, freq float64, noise time.Duration, seed int64) []TracePoint {
+	rng := rand.New(rand.NewSource(seed))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trace := make([]TracePoint, n)
+	for i := range trace {
+		elapsed := time.Duration(i) * interval
+		phase := freq * elapsed.Seconds()
+		trace[i] = TracePoint{
+			Timestamp: start.Add(elapsed),
+			Offset:    -time.Duration(phase) + time.Duration(rng.NormFloat64()*float64(noise)),
+			Delay:     time.Millisecond + time.Duration(rng.Float64()*float64(noise)),
+		}
+	}
+	return trace
+}
+
+func TestReadTrace(t *testing.T) {
+	csvTrace := `# записано shiwatime
+timestamp,offset,frequency,delay
+2024-01-01T00:00:16Z,-1.5ms,-4990.5,1ms
+2024-01-01T00:00:00Z,2000,-5000,
+`
+	trace, err := ReadTrace(strings.NewReader(csvTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) != 2 || trace[0].Offset != 2*time.Microsecond || trace[1].Offset != -1500*time.Microsecond {
+		t.Fatalf("trace = %+v", trace)
+	}
+	if trace[1].Frequency != -4990.5 || trace[1].Delay != time.Millisecond || trace[0].Delay != 0 {
+		t.Errorf("trace = %+v", trace)
+	}
+
+	jsonTrace := `{"timestamp":"2024-01-01T00:00:00Z","offset":2000,"frequency":-5000}
+{"timestamp":"2024-01-01T00:00:16Z","offset":-1500000,"frequency":-4990.5,"delay":1000000}
+`
+	fromJSON, err := ReadTrace(strings.NewReader(jsonTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range trace {
+		if !fromJSON[i].Timestamp.Equal(trace[i].Timestamp) || fromJSON[i].Offset != trace[i].Offset ||
+			fromJSON[i].Frequency != trace[i].Frequency || fromJSON[i].Delay != trace[i].Delay {
+			t.Errorf("JSON sample %d = %+v, CSV %+v", i, fromJSON[i], trace[i])
+		}
+	}
+
+	if _, err := ReadTrace(strings.NewReader("timestamp,offset\n2024-01-01T00:00:00Z,0\n")); err == nil {
+		t.Error("trace without frequency accepted")
+	}
+}
+
+func TestReplayTraceReconstructsPhase(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// Часы были захвачены: нулевые смещения при поправке -5000 ppb. Повтор
+	// с той же начальной частотой не должен уводить часы.
+	trace := syntheticTrace(3600/16, 16*time.Second, 0, 0, 1)
+	for i := range trace {
+		trace[i].Frequency = -5000
+	}
+
+	cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "pid"}}
+	score, err := ReplayTrace(trace, cfg, 0, 0, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.RMS > time.Microsecond || score.Steps != 0 {
+		t.Errorf("RMS = %v, steps = %d; want locked clock", score.RMS, score.Steps)
+	}
+	if len(score.MTIE) == 0 {
+		t.Error("no MTIE points")
+	}
+}
+
+func TestTune(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	trace := syntheticTrace(4*3600/16, 16*time.Second, 5000, time.Millisecond, 1)
+
+	for _, strategy := range []string{"genetic", "bayesian"} {
+		cfg := config.ShiwaTimeConfig{Clock: config.ClockConfig{Algorithm: "pid"}}
+		result, err := Tune(trace, cfg, TuneConfig{Strategy: strategy, Budget: 16, Seed: 1}, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Evaluations != 16 {
+			t.Errorf("%s: evaluations = %d, want 16", strategy, result.Evaluations)
+		}
+		// Текущая конфигурация - первая точка поиска
+		if result.Tuned.RMS > result.Baseline.RMS {
+			t.Errorf("%s: tuned RMS %v worse than current %v", strategy, result.Tuned.RMS, result.Baseline.RMS)
+		}
+
+		snippet := result.ConfigSnippet()
+		for _, want := range []string{"algorithm: pid", "kp:", "ki:", "kd:", "filter_length:", "MTIE"} {
+			if !strings.Contains(snippet, want) {
+				t.Errorf("%s: snippet has no %q:\n%s", strategy, want, snippet)
+			}
+		}
+	}
+
+	if _, err := Tune(trace, config.ShiwaTimeConfig{}, TuneConfig{Strategy: "random"}, logger); err == nil {
+		t.Error("unknown strategy accepted")
+	}
+}
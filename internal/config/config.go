@@ -16,6 +16,7 @@ type Config struct {
 type ShiwaTimeConfig struct {
 	Config     ConfigPaths      `yaml:"config"`
 	ClockSync  ClockSyncConfig  `yaml:"clock_sync"`
+	Clock      ClockConfig      `yaml:"clock"`
 	PTPTuning  PTPTuningConfig  `yaml:"ptp_tuning"`
 	SyncRTC    SyncRTCConfig    `yaml:"synchronise_rtc"`
 	PTPSquared PTPSquaredConfig `yaml:"ptpsquared"`
@@ -39,6 +40,7 @@ type ClockSyncConfig struct {
 
 // TimeSourceConfig конфигурация источника времени
 type TimeSourceConfig struct {
+	Name       string `yaml:"name" json:"name"` // Имя источника в API, CLI и логах
 	Type       string `yaml:"type" json:"type"`
 	Host       string `yaml:"host" json:"host"`
 	Port       int    `yaml:"port" json:"port"`
@@ -96,6 +98,11 @@ type TimeSourceConfig struct {
 	PollingInterval time.Duration `yaml:"polling_interval" json:"polling_interval"`
 	PollingBurst    int           `yaml:"polling_burst" json:"polling_burst"`
 	
+	// Фильтр измерений: ntp, lucky, none (по умолчанию по протоколу)
+	Filter           string  `yaml:"filter" json:"filter"`
+	FilterLength     int     `yaml:"filter_length" json:"filter_length"`
+	FilterPercentile float64 `yaml:"filter_percentile" json:"filter_percentile"`
+	
 	// Quality thresholds
 	MaxOffset     time.Duration `yaml:"max_offset" json:"max_offset"`
 	MaxDelay      time.Duration `yaml:"max_delay" json:"max_delay"`
@@ -109,9 +116,13 @@ type TimeSourceConfig struct {
 	Options      map[string]string `yaml:"options" json:"options"`
 }
 
+// ClockAlgorithms алгоритмы дисциплины часов, которые создает
+// clock.NewDiscipline. Проверка конфигурации и clock используют один список
+var ClockAlgorithms = []string{"pi", "pid", "kalman", "adaptive", "hybrid"}
+
 // ClockConfig конфигурация системных часов  
 type ClockConfig struct {
-	Algorithm     string        `yaml:"algorithm" json:"algorithm"`
+	Algorithm     string        `yaml:"algorithm" json:"algorithm"` // pi, pid, kalman, adaptive, hybrid
 	Disciplining  string        `yaml:"disciplining" json:"disciplining"`
 	
 	// Source selection parameters
@@ -123,16 +134,47 @@ type ClockConfig struct {
 	MaxAdjustment   time.Duration `yaml:"max_adjustment" json:"max_adjustment"`
 	StepThreshold   time.Duration `yaml:"step_threshold" json:"step_threshold"`
 	PanicThreshold  time.Duration `yaml:"panic_threshold" json:"panic_threshold"`
+	MakeStepLimit   *int          `yaml:"makestep_limit" json:"makestep_limit"` // Step только в первых N обновлениях, 0 - никогда, -1 - всегда
+	StepQuorum      int           `yaml:"step_quorum" json:"step_quorum"`       // Число согласных источников для step, достаточно одного с trust
+	StepAgreement   time.Duration `yaml:"step_agreement" json:"step_agreement"` // Допустимое расхождение смещений согласных источников
 	
 	// PID controller parameters (for advanced clock control)
-	KP            float64 `yaml:"kp" json:"kp"`               // Proportional gain
-	KI            float64 `yaml:"ki" json:"ki"`               // Integral gain  
+	KP            float64 `yaml:"kp" json:"kp"`               // Proportional gain per update
+	KI            float64 `yaml:"ki" json:"ki"`               // Integral gain per update
 	KD            float64 `yaml:"kd" json:"kd"`               // Derivative gain
-	Integrator    float64 `yaml:"integrator" json:"integrator"` // Integrator limit
+	Integrator    float64 `yaml:"integrator" json:"integrator"` // Integrator limit, ppb
+	
+	// Защитный контур адаптивного контроллера (algorithm: adaptive)
+	Adaptive      AdaptiveGuardConfig `yaml:"adaptive" json:"adaptive"`
+	
+	// Гибридная PLL/FLL дисциплина (algorithm: hybrid)
+	Hybrid        HybridConfig `yaml:"hybrid" json:"hybrid"`
+	
+	// Выбор источников (пересечение, кластеризация, комбинирование)
+	Selection     SelectionConfig `yaml:"selection" json:"selection"`
+	
+	// Переключение системного источника (гистерезис)
+	Switch        SwitchConfig `yaml:"switch" json:"switch"`
+	
+	// Holdover при потере всех источников
+	Holdover      HoldoverConfig `yaml:"holdover" json:"holdover"`
+	
+	// Температурная компенсация частоты генератора
+	Temperature   TemperatureConfig `yaml:"temperature" json:"temperature"`
+	
+	// Критерии переходов машины состояний часов
+	State         StateConfig `yaml:"state" json:"state"`
+	
+	// Анализ стабильности (ADEV, MDEV, TDEV, MTIE)
+	Stability     StabilityConfig `yaml:"stability" json:"stability"`
+	
+	// Запись измерений и решений для повтора (shiwatime replay)
+	Recording     RecordingConfig `yaml:"recording" json:"recording"`
 	
 	// Statistics and filtering
 	StatisticsLength int           `yaml:"statistics_length" json:"statistics_length"`
 	FilterLength     int           `yaml:"filter_length" json:"filter_length"`
+	HistoryDepth     int           `yaml:"history_depth" json:"history_depth"` // Глубина истории измерений каждого источника
 	SigmaThreshold   float64       `yaml:"sigma_threshold" json:"sigma_threshold"`
 	RhoThreshold     float64       `yaml:"rho_threshold" json:"rho_threshold"`
 	
@@ -149,6 +191,98 @@ type ClockConfig struct {
 	LeapSecFile      string `yaml:"leapsecfile" json:"leapsecfile"`
 	LeapSecMode      string `yaml:"leapsec_mode" json:"leapsec_mode"`
 	LeapSmearLength  time.Duration `yaml:"leap_smear_length" json:"leap_smear_length"`
+	
+	// Drift файл: выученная частота сохраняется между перезапусками
+	DriftFile         string        `yaml:"driftfile" json:"driftfile"`
+	DriftFileInterval time.Duration `yaml:"driftfile_interval" json:"driftfile_interval"`
+	
+	// Последнее достоверное время: step на более раннее время отвергается
+	LastGoodFile         string        `yaml:"last_good_file" json:"last_good_file"`
+	LastGoodFileInterval time.Duration `yaml:"last_good_file_interval" json:"last_good_file_interval"`
+	
+	// Управляемые часы
+	Target           string              `yaml:"target" json:"target"`   // Часы основного цикла: system, /dev/ptpN или интерфейс
+	Targets          []ClockTargetConfig `yaml:"targets" json:"targets"` // Часы, синхронизируемые от других часов (как phc2sys)
+}
+
+// ClockTargetConfig настройки синхронизации одних часов от других (как phc2sys)
+type ClockTargetConfig struct {
+	Name          string        `yaml:"name" json:"name"`
+	Clock         string        `yaml:"clock" json:"clock"`                   // Ведомые часы: system, /dev/ptpN или интерфейс
+	Source        string        `yaml:"source" json:"source"`                 // Ведущие часы: system, /dev/ptpN или интерфейс
+	Offset        time.Duration `yaml:"offset" json:"offset"`                 // Ведомые часы = ведущие + offset (например, -37s для TAI -> UTC)
+	Interval      time.Duration `yaml:"interval" json:"interval"`             // Период измерений
+	Samples       int           `yaml:"samples" json:"samples"`               // Число чтений часов на измерение
+	StepThreshold time.Duration `yaml:"step_threshold" json:"step_threshold"` // Step при первом измерении выше порога
+	Algorithm     string        `yaml:"algorithm" json:"algorithm"`
+	KP            float64       `yaml:"kp" json:"kp"`
+	KI            float64       `yaml:"ki" json:"ki"`
+	KD            float64       `yaml:"kd" json:"kd"`
+}
+
+// AdaptiveGuardConfig настройки защитного контура адаптивного контроллера
+type AdaptiveGuardConfig struct {
+	MinConfidence   float64 `yaml:"min_confidence" json:"min_confidence"`     // Минимальная уверенность (0-1)
+	MaxDivergence   float64 `yaml:"max_divergence" json:"max_divergence"`     // Максимальное расхождение с оценкой частоты PID, ppb
+	RecoverySamples int     `yaml:"recovery_samples" json:"recovery_samples"` // Измерений до возврата из PID
+}
+
+// HybridConfig настройки гибридной PLL/FLL дисциплины
+type HybridConfig struct {
+	FLLInterval time.Duration `yaml:"fll_interval" json:"fll_interval"` // Интервал опроса, с которого подстраивается только частота
+}
+
+// RecordingConfig настройки записи измерений источников, решений выбора и
+// подстроек часов в ротируемый JSONL файл для shiwatime replay
+type RecordingConfig struct {
+	Path     string `yaml:"path" json:"path"`           // Файл записи, пустой путь отключает запись
+	MaxSize  int64  `yaml:"max_size" json:"max_size"`   // Размер файла в байтах, после которого он ротируется
+	MaxFiles int    `yaml:"max_files" json:"max_files"` // Число хранимых ротированных файлов
+}
+
+// SelectionConfig настройки алгоритма выбора источников NTPv4
+type SelectionConfig struct {
+	MinDistance  time.Duration `yaml:"min_distance" json:"min_distance"`   // Минимальное root distance источника
+	MaxDistance  time.Duration `yaml:"max_distance" json:"max_distance"`   // Источники с большим root distance не используются
+	MinSurvivors int           `yaml:"min_survivors" json:"min_survivors"` // Кластеризация не сокращает выживших ниже этого числа
+}
+
+// SwitchConfig настройки переключения системного источника
+type SwitchConfig struct {
+	MinMargin     float64       `yaml:"min_margin" json:"min_margin"`         // Доля root distance текущего источника, на которую должен быть лучше новый
+	MinHoldTime   time.Duration `yaml:"min_hold_time" json:"min_hold_time"`   // Минимальное время на источнике до переключения на лучший
+	PreferCurrent time.Duration `yaml:"prefer_current" json:"prefer_current"` // Бонус текущему источнику в root distance
+	FailoverDelay time.Duration `yaml:"failover_delay" json:"failover_delay"` // Ожидание восстановления primary перед переходом на secondary
+}
+
+// HoldoverConfig настройки режима holdover
+type HoldoverConfig struct {
+	LockThreshold  time.Duration `yaml:"lock_threshold" json:"lock_threshold"`   // Смещение, ниже которого часы считаются захваченными
+	LearningWindow int           `yaml:"learning_window" json:"learning_window"` // Число измерений для оценки частоты и дрейфа
+	MaxDuration    time.Duration `yaml:"max_duration" json:"max_duration"`       // Максимальная длительность holdover
+	MaxError       time.Duration `yaml:"max_error" json:"max_error"`             // Допустимая оценка накопленной ошибки
+}
+
+// TemperatureConfig настройки температурной компенсации: зависимость
+// частоты генератора от температуры изучается, пока часы захвачены, и
+// применяется упреждающей поправкой, в том числе в holdover
+type TemperatureConfig struct {
+	Sensor   string        `yaml:"sensor" json:"sensor"`       // Файл датчика sysfs в миллиградусах (hwmon temp*_input, thermal_zone*/temp), пустой путь отключает компенсацию
+	Interval time.Duration `yaml:"interval" json:"interval"`   // Период чтения датчика
+	BinWidth float64       `yaml:"bin_width" json:"bin_width"` // Ширина интервала температур модели, °C
+	MinSpan  float64       `yaml:"min_span" json:"min_span"`   // Диапазон изученных температур, с которого применяется поправка, °C
+}
+
+// StateConfig критерии переходов машины состояний часов
+type StateConfig struct {
+	LockTime        time.Duration `yaml:"lock_time" json:"lock_time"`               // Время в пределах lock_threshold до перехода в locked
+	UnlockThreshold time.Duration `yaml:"unlock_threshold" json:"unlock_threshold"` // Смещение, при котором захват теряется
+	MaxADEV         float64       `yaml:"max_adev" json:"max_adev"`                 // Допустимая ADEV смещения для захвата
+}
+
+// StabilityConfig настройки анализа стабильности
+type StabilityConfig struct {
+	Masks []string `yaml:"masks" json:"masks"` // Маски MTIE для проверки: g811_prc, g8272_prtc_a, g8272_prtc_b
 }
 
 // PTPTuningConfig настройки тонкой настройки PTP
@@ -197,6 +331,8 @@ type PHCConfig struct {
 type SyncRTCConfig struct {
 	Enable        bool   `yaml:"enable,omitempty"`
 	ClockInterval string `yaml:"clock_interval,omitempty"`
+	Device        string `yaml:"device,omitempty"` // RTC устройство, по умолчанию /dev/rtc0
+	Mode          string `yaml:"mode,omitempty"`   // write - запись в RTC, kernel - 11-минутный режим ядра
 }
 
 // CLIConfig настройки CLI интерфейса
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 	
 	"gopkg.in/yaml.v3"
+	"github.com/shiwatime/shiwatime/internal/stability"
 )
 
 // LoadConfig загружает конфигурацию из файла
@@ -28,7 +30,7 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 
 	// Парсим YAML напрямую
-	var config Config
+	config := newConfig()
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
@@ -46,7 +48,7 @@ func LoadConfig(configPath string) (*Config, error) {
 
 // LoadConfigFromBytes загружает конфигурацию из байтов
 func LoadConfigFromBytes(data []byte) (*Config, error) {
-	var config Config
+	config := newConfig()
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
@@ -59,6 +61,14 @@ func LoadConfigFromBytes(data []byte) (*Config, error) {
 	return &config, nil
 }
 
+// newConfig возвращает конфигурацию со значениями по умолчанию, которые
+// нельзя отличить от явно заданного нуля после разбора YAML
+func newConfig() Config {
+	var config Config
+	config.ShiwaTime.ClockSync.AdjustClock = true // Timebeat default
+	return config
+}
+
 // validateConfig проверяет корректность конфигурации
 func validateConfig(config *Config) error {
 	// Проверяем наличие источников времени
@@ -67,26 +77,54 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("at least one time source (primary or secondary) must be configured")
 	}
 
-	// Проверяем корректность протоколов
-	for i, source := range config.ShiwaTime.ClockSync.PrimaryClocks {
-		if err := validateTimeSource(source, fmt.Sprintf("primary_clocks[%d]", i)); err != nil {
-			return err
-		}
-	}
-
-	for i, source := range config.ShiwaTime.ClockSync.SecondaryClocks {
-		if err := validateTimeSource(source, fmt.Sprintf("secondary_clocks[%d]", i)); err != nil {
-			return err
+	// Проверяем корректность протоколов и уникальность имен
+	names := make(map[string]string)
+	tiers := []struct {
+		tier    string
+		sources []TimeSourceConfig
+	}{
+		{"primary", config.ShiwaTime.ClockSync.PrimaryClocks},
+		{"secondary", config.ShiwaTime.ClockSync.SecondaryClocks},
+	}
+	for _, t := range tiers {
+		for i, source := range t.sources {
+			context := fmt.Sprintf("%s_clocks[%d]", t.tier, i)
+			if err := validateTimeSource(source, context); err != nil {
+				return err
+			}
+
+			name := SourceName(source, t.tier, i)
+			if other, exists := names[name]; exists {
+				return fmt.Errorf("%s: source name '%s' is already used by %s", context, name, other)
+			}
+			names[name] = context
 		}
 	}
 
 	// Проверяем step_limit
 	if config.ShiwaTime.ClockSync.StepLimit != "" {
-		if _, err := parseDuration(config.ShiwaTime.ClockSync.StepLimit); err != nil {
+		if _, err := ParseDuration(config.ShiwaTime.ClockSync.StepLimit); err != nil {
 			return fmt.Errorf("invalid step_limit format: %w", err)
 		}
 	}
 
+	// Проверяем синхронизацию RTC
+	if err := validateSyncRTC(config.ShiwaTime.SyncRTC); err != nil {
+		return err
+	}
+
+	// Проверяем настройки дисциплины часов
+	if err := validateClockConfig(config.ShiwaTime.Clock); err != nil {
+		return err
+	}
+
+	// TAI-UTC для ядра: auto или фиксированное число секунд
+	if taiOffset := strings.TrimSpace(config.ShiwaTime.PTPTuning.PHC.TAIOffset); taiOffset != "" && !strings.EqualFold(taiOffset, "auto") {
+		if offset, err := strconv.Atoi(taiOffset); err != nil || offset < 0 {
+			return fmt.Errorf("ptp_tuning: tai_offset must be auto or a non-negative number of seconds, got '%s'", taiOffset)
+		}
+	}
+
 	// Проверяем настройки CLI
 	if config.ShiwaTime.CLI.Enable {
 		if config.ShiwaTime.CLI.BindPort <= 0 || config.ShiwaTime.CLI.BindPort > 65535 {
@@ -104,10 +142,151 @@ func validateConfig(config *Config) error {
 	return nil
 }
 
+// validateClockConfig проверяет корректность секции clock
+func validateClockConfig(clock ClockConfig) error {
+	if clock.Algorithm != "" {
+		if !containsFold(ClockAlgorithms, clock.Algorithm) {
+			return fmt.Errorf("clock: unsupported algorithm '%s', supported: %s",
+				clock.Algorithm, strings.Join(ClockAlgorithms, ", "))
+		}
+	}
+
+	if clock.KP < 0 || clock.KI < 0 || clock.KD < 0 {
+		return fmt.Errorf("clock: kp, ki and kd must not be negative")
+	}
+
+	if clock.Adaptive.MinConfidence < 0 || clock.Adaptive.MinConfidence > 1 {
+		return fmt.Errorf("clock: adaptive.min_confidence must be between 0 and 1")
+	}
+
+	if clock.Hybrid.FLLInterval < 0 {
+		return fmt.Errorf("clock: hybrid.fll_interval must not be negative")
+	}
+
+	if clock.Selection.MinDistance < 0 || clock.Selection.MaxDistance < 0 || clock.Selection.MinSurvivors < 0 {
+		return fmt.Errorf("clock: selection min_distance, max_distance and min_survivors must not be negative")
+	}
+
+	if clock.Switch.MinMargin < 0 || clock.Switch.MinMargin >= 1 {
+		return fmt.Errorf("clock: switch.min_margin must be in [0, 1)")
+	}
+	if clock.Switch.MinHoldTime < 0 || clock.Switch.PreferCurrent < 0 || clock.Switch.FailoverDelay < 0 {
+		return fmt.Errorf("clock: switch min_hold_time, prefer_current and failover_delay must not be negative")
+	}
+	
+	if clock.Holdover.LockThreshold < 0 || clock.Holdover.MaxDuration < 0 || clock.Holdover.MaxError < 0 {
+		return fmt.Errorf("clock: holdover lock_threshold, max_duration and max_error must not be negative")
+	}
+	if clock.Holdover.LearningWindow < 0 {
+		return fmt.Errorf("clock: holdover.learning_window must not be negative")
+	}
+	if clock.State.LockTime < 0 || clock.State.UnlockThreshold < 0 || clock.State.MaxADEV < 0 {
+		return fmt.Errorf("clock: state lock_time, unlock_threshold and max_adev must not be negative")
+	}
+	if clock.State.UnlockThreshold > 0 && clock.State.UnlockThreshold < clock.Holdover.LockThreshold {
+		return fmt.Errorf("clock: state.unlock_threshold must not be below holdover.lock_threshold")
+	}
+
+	if clock.FilterLength < 0 {
+		return fmt.Errorf("clock: filter_length must not be negative")
+	}
+	if clock.HistoryDepth < 0 {
+		return fmt.Errorf("clock: history_depth must not be negative")
+	}
+	if clock.Temperature.Interval < 0 || clock.Temperature.BinWidth < 0 || clock.Temperature.MinSpan < 0 {
+		return fmt.Errorf("clock: temperature interval, bin_width and min_span must not be negative")
+	}
+	if clock.Recording.MaxSize < 0 || clock.Recording.MaxFiles < 0 {
+		return fmt.Errorf("clock: recording max_size and max_files must not be negative")
+	}
+	if _, err := stability.ParseMasks(clock.Stability.Masks); err != nil {
+		return fmt.Errorf("clock: stability: %w", err)
+	}
+
+	if clock.StepThreshold < 0 || clock.PanicThreshold < 0 {
+		return fmt.Errorf("clock: step_threshold and panic_threshold must not be negative")
+	}
+
+	if clock.StepQuorum < 0 || clock.StepAgreement < 0 || clock.LastGoodFileInterval < 0 {
+		return fmt.Errorf("clock: step_quorum, step_agreement and last_good_file_interval must not be negative")
+	}
+
+	if clock.MakeStepLimit != nil && *clock.MakeStepLimit < -1 {
+		return fmt.Errorf("clock: makestep_limit must be -1 (always), 0 (never) or a number of updates")
+	}
+
+	switch strings.ToLower(clock.LeapSecMode) {
+	case "", "kernel", "smear", "ignore":
+	default:
+		return fmt.Errorf("clock: unsupported leapsec_mode '%s', supported: kernel, smear, ignore", clock.LeapSecMode)
+	}
+	if clock.DriftFileInterval < 0 {
+		return fmt.Errorf("clock: driftfile_interval must not be negative")
+	}
+	if clock.LeapSmearLength < 0 {
+		return fmt.Errorf("clock: leap_smear_length must not be negative")
+	}
+
+	for i, target := range clock.Targets {
+		context := fmt.Sprintf("clock.targets[%d]", i)
+		if target.Clock == "" || target.Source == "" {
+			return fmt.Errorf("%s: clock and source are required", context)
+		}
+		if target.Clock == target.Source {
+			return fmt.Errorf("%s: clock and source must be different", context)
+		}
+		if target.Interval < 0 || target.StepThreshold < 0 || target.Samples < 0 {
+			return fmt.Errorf("%s: interval, samples and step_threshold must not be negative", context)
+		}
+		if target.Algorithm != "" && !containsFold(ClockAlgorithms, target.Algorithm) {
+			return fmt.Errorf("%s: unsupported algorithm '%s', supported: %s",
+				context, target.Algorithm, strings.Join(ClockAlgorithms, ", "))
+		}
+	}
+
+	return nil
+}
+
+// validateSyncRTC проверяет корректность секции synchronise_rtc
+func validateSyncRTC(rtc SyncRTCConfig) error {
+	switch strings.ToLower(rtc.Mode) {
+	case "", "write", "kernel":
+	default:
+		return fmt.Errorf("synchronise_rtc: unsupported mode '%s', supported: write, kernel", rtc.Mode)
+	}
+
+	if rtc.ClockInterval != "" {
+		interval, err := ParseDuration(rtc.ClockInterval)
+		if err != nil {
+			return fmt.Errorf("synchronise_rtc: invalid clock_interval: %w", err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("synchronise_rtc: clock_interval must be positive")
+		}
+	}
+
+	return nil
+}
+
+// containsFold проверяет наличие значения в списке без учета регистра
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // validateTimeSource проверяет корректность конфигурации источника времени
 func validateTimeSource(source TimeSourceConfig, context string) error {
-	supportedProtocols := []string{"ptp", "ntp", "pps", "nmea", "phc", "timecard", "mock"}
+	supportedProtocols := []string{"ptp", "ntp", "pps", "nmea", "phc", "timecard", "rtc", "mock"}
 	
+	// Имя используется в URL /api/v1/sources/:id
+	if strings.ContainsAny(source.Name, "/?# \t") {
+		return fmt.Errorf("%s: name '%s' must not contain '/', '?', '#' or spaces", context, source.Name)
+	}
+
 	// Проверяем тип протокола
 	if source.Type == "" {
 		return fmt.Errorf("%s: type is required", context)
@@ -125,6 +304,19 @@ func validateTimeSource(source TimeSourceConfig, context string) error {
 			context, source.Type, strings.Join(supportedProtocols, ", "))
 	}
 
+	// Проверяем фильтр измерений
+	switch strings.ToLower(source.Filter) {
+	case "", "ntp", "lucky", "none":
+	default:
+		return fmt.Errorf("%s: unsupported filter '%s', supported: ntp, lucky, none", context, source.Filter)
+	}
+	if source.FilterLength < 0 {
+		return fmt.Errorf("%s: filter_length must not be negative", context)
+	}
+	if source.FilterPercentile < 0 || source.FilterPercentile > 1 {
+		return fmt.Errorf("%s: filter_percentile must be between 0 and 1", context)
+	}
+
 	// Протокол-специфичная валидация
 	switch source.Type {
 	case "ptp":
@@ -156,11 +348,6 @@ func validateTimeSource(source TimeSourceConfig, context string) error {
 // setDefaults устанавливает значения по умолчанию
 func setDefaults(config *Config) {
 	// Значения по умолчанию для ShiwaTime
-	if config.ShiwaTime.ClockSync.AdjustClock == false && 
-		config.ShiwaTime.ClockSync.StepLimit == "" {
-		config.ShiwaTime.ClockSync.AdjustClock = true // Timebeat default
-	}
-
 	if config.ShiwaTime.ClockSync.StepLimit == "" {
 		config.ShiwaTime.ClockSync.StepLimit = "15m"
 	}
@@ -207,6 +394,11 @@ func setDefaults(config *Config) {
 		setTimeSourceDefaults(&config.ShiwaTime.ClockSync.SecondaryClocks[i])
 	}
 
+	// Значения по умолчанию для дисциплины часов
+	if config.ShiwaTime.Clock.Algorithm == "" {
+		config.ShiwaTime.Clock.Algorithm = "pid"
+	}
+
 	// PTP Tuning значения по умолчанию
 	if config.ShiwaTime.PTPTuning.PTPStandard == "" {
 		config.ShiwaTime.PTPTuning.PTPStandard = "1588-2008"
@@ -216,6 +408,15 @@ func setDefaults(config *Config) {
 	}
 }
 
+// SourceName возвращает имя источника: name из конфигурации или
+// primary_N / secondary_N по списку и позиции в нем
+func SourceName(source TimeSourceConfig, tier string, index int) string {
+	if source.Name != "" {
+		return source.Name
+	}
+	return fmt.Sprintf("%s_%d", tier, index)
+}
+
 // setTimeSourceDefaults устанавливает значения по умолчанию для источника времени
 func setTimeSourceDefaults(source *TimeSourceConfig) {
 	switch source.Type {
@@ -243,8 +444,8 @@ func setTimeSourceDefaults(source *TimeSourceConfig) {
 	}
 }
 
-// parseDuration парсит строку длительности
-func parseDuration(s string) (time.Duration, error) {
+// ParseDuration парсит строку длительности
+func ParseDuration(s string) (time.Duration, error) {
 	// Поддерживаем различные форматы: 15m, 30s, 1h, 2d
 	if strings.HasSuffix(s, "d") {
 		// Обрабатываем дни
@@ -345,5 +345,33 @@ func (c *Client) SetupIndexTemplates() error {
 		return err
 	}
 	
+	// Шаблон для событий шины часов
+	eventMappings := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"@timestamp": map[string]interface{}{
+				"type": "date",
+			},
+			"event_type": map[string]interface{}{
+				"type": "keyword",
+			},
+			"source_id": map[string]interface{}{
+				"type": "keyword",
+			},
+			"clock_state": map[string]interface{}{
+				"type": "keyword",
+			},
+			"previous_state": map[string]interface{}{
+				"type": "keyword",
+			},
+			"message": map[string]interface{}{
+				"type": "text",
+			},
+		},
+	}
+	
+	if err := c.CreateIndexTemplate("shiwatime-event", "shiwatime_event-*", eventMappings); err != nil {
+		return err
+	}
+	
 	return nil
 }
\ No newline at end of file
@@ -34,6 +34,8 @@ func NewTimeSourceHandler(config config.TimeSourceConfig, logger *logrus.Logger)
 		return NewTimecardHandler(config, logger)
 	case "ocp_timecard":
 		return NewOCPTimecardHandler(config, logger)
+	case "rtc":
+		return NewRTCHandler(config, logger)
 	case "mock":
 		return NewMockHandler(config, logger)
 	case "timesource":
@@ -54,6 +56,7 @@ func GetSupportedProtocols() []string {
 		"nmea",
 		"timecard",
 		"ocp_timecard",
+		"rtc",
 		"mock",
 		"timesource",
 	}
@@ -88,6 +91,8 @@ func GetProtocolDescription(protocol string) string {
 		return "Timecard - специализированные карты точного времени"
 	case "ocp_timecard":
 		return "OCP Timecard - карты точного времени OCP Time Appliance Project"
+	case "rtc":
+		return "RTC - аппаратные часы реального времени, резерв при загрузке"
 	case "mock":
 		return "Mock - тестовый источник времени"
 	case "timesource":
@@ -158,6 +163,8 @@ func ValidateConfig(config config.TimeSourceConfig) error {
 		if config.OscillatorType == "" {
 			config.OscillatorType = "timebeat-rb-ql" // default
 		}
+	case "rtc":
+		// По умолчанию используется /dev/rtc0
 	case "timesource":
 		// TimeSource не требует специальной валидации, так как является универсальным обработчиком
 	}
@@ -207,6 +214,8 @@ func GetDefaultConfig(protocol string) config.TimeSourceConfig {
 		// Default timecard config
 	case "ocp_timecard":
 		// Default ocp_timecard config
+	case "rtc":
+		cfg.Device = DefaultRTCDevice
 	case "timesource":
 		// Default timesource config
 	}
@@ -15,6 +15,12 @@ type TimeInfo struct {
 	Quality   int           // Качество источника (0-255)
 	Stratum   int           // Stratum для NTP
 	Precision int           // Точность источника
+	RootDelay      time.Duration // Задержка до первичного источника (NTP)
+	RootDispersion time.Duration // Дисперсия до первичного источника (NTP)
+	
+	// Секунда координации
+	Leap      LeapIndicator // Предупреждение о секунде координации
+	UTCOffset int           // TAI-UTC в секундах, 0 - неизвестно
 
 	// GNSS/Position related (optional)
 	Latitude  float64 // градусы
@@ -24,6 +30,31 @@ type TimeInfo struct {
 	SatellitesUsed int // используемые спутники
 }
 
+// LeapIndicator предупреждение о секунде координации (значения как у NTP LI)
+type LeapIndicator int
+
+const (
+	LeapNone   LeapIndicator = iota // Нет предупреждения
+	LeapInsert                      // Последняя минута суток содержит 61 секунду
+	LeapDelete                      // Последняя минута суток содержит 59 секунд
+	LeapAlarm                       // Источник не синхронизирован
+)
+
+func (li LeapIndicator) String() string {
+	switch li {
+	case LeapNone:
+		return "none"
+	case LeapInsert:
+		return "insert"
+	case LeapDelete:
+		return "delete"
+	case LeapAlarm:
+		return "alarm"
+	default:
+		return "unknown"
+	}
+}
+
 // TimeSourceHandler интерфейс обработчика источника времени
 type TimeSourceHandler interface {
 	// Start запускает обработчик
@@ -176,6 +207,12 @@ type PPSHandler interface {
 	DisablePulseOutput() error
 }
 
+// KernelPPSSource источник PPS, который может быть привязан к hardpps ядра
+type KernelPPSSource interface {
+	// KernelPPSBound возвращает true, если устройство привязано к hardpps
+	KernelPPSBound() bool
+}
+
 // NMEAHandler интерфейс для NMEA обработчика
 type NMEAHandler interface {
 	TimeSourceHandler
@@ -164,8 +164,8 @@ func (h *ntpHandler) GetTimeInfo() (*TimeInfo, error) {
 	h.status.PacketsTx++
 	h.status.LastError = nil
 	h.stratum = int(resp.Stratum)
-	h.rootDelay = ntpToTime(resp.RootDelay, 0).Sub(time.Unix(0, 0))
-	h.rootDispersion = ntpToTime(resp.RootDispersion, 0).Sub(time.Unix(0, 0))
+	h.rootDelay = ntpShortToDuration(resp.RootDelay)
+	h.rootDispersion = ntpShortToDuration(resp.RootDispersion)
 	h.mu.Unlock()
 	
 	// Вычисляем времена
@@ -191,6 +191,9 @@ func (h *ntpHandler) GetTimeInfo() (*TimeInfo, error) {
 		Quality:   quality,
 		Stratum:   int(resp.Stratum),
 		Precision: int(resp.Precision),
+		RootDelay:      ntpShortToDuration(resp.RootDelay),
+		RootDispersion: ntpShortToDuration(resp.RootDispersion),
+		Leap:           LeapIndicator(resp.Settings >> 6),
 	}
 	
 	h.logger.WithFields(logrus.Fields{
@@ -286,6 +289,8 @@ func (h *ntpHandler) ParseResponse(data []byte) (*TimeInfo, error) {
 		Quality:   255 - int(resp.Stratum)*10,
 		Stratum:   int(resp.Stratum),
 		Precision: int(resp.Precision),
+		RootDelay:      ntpShortToDuration(resp.RootDelay),
+		RootDispersion: ntpShortToDuration(resp.RootDispersion),
 	}
 	
 	return info, nil
@@ -387,4 +392,9 @@ func ntpToTime(sec, frac uint32) time.Time {
 	unixNano := int64(frac) * 1e9 / (1 << 32)
 	
 	return time.Unix(unixSec, unixNano)
+}
+
+// ntpShortToDuration конвертирует NTP short format (16.16) в длительность
+func ntpShortToDuration(v uint32) time.Duration {
+	return time.Duration(int64(v) * int64(time.Second) >> 16)
 }
\ No newline at end of file
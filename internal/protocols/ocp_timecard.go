@@ -31,6 +31,7 @@ type ocpTimecardHandler struct {
 	lastOffset   time.Duration
 	gnssStatus   GNSSStatus
 	position     Position
+	utcOffset    int // TAI-UTC от GNSS приемника
 	
 	// OCP specific
 	ocpDevice    int
@@ -167,6 +168,7 @@ func (h *ocpTimecardHandler) GetTimeInfo() (*TimeInfo, error) {
 	h.mu.RLock()
 	ppsTime := h.lastPPSTime
 	offset := h.lastOffset
+	utcOffset := h.utcOffset
 	ppsValid := !ppsTime.IsZero()
 	h.mu.RUnlock()
 
@@ -194,6 +196,7 @@ func (h *ocpTimecardHandler) GetTimeInfo() (*TimeInfo, error) {
 		Altitude:  h.position.Altitude,
 		FixType:   h.gnssStatus.FixType,
 		SatellitesUsed: h.gnssStatus.SatellitesUsed,
+		UTCOffset: utcOffset,
 	}, nil
 }
 
@@ -405,6 +408,7 @@ func (h *ocpTimecardHandler) readSysfs() (time.Time, uint64, bool, error) {
 
 	// Читаем позицию GNSS если доступна
 	h.readGNSSPosition()
+	h.readUTCOffset()
 
 	return ppsTime, ppsCnt, gnssFix, nil
 }
@@ -436,6 +440,18 @@ func (h *ocpTimecardHandler) readGNSSPosition() {
 	}
 }
 
+// readUTCOffset читает TAI-UTC, полученное картой от GNSS
+func (h *ocpTimecardHandler) readUTCOffset() {
+	offsetPath := filepath.Join(h.sysfsPath, "utc_tai_offset")
+	if offsetData, err := os.ReadFile(offsetPath); err == nil {
+		if offset, err := strconv.Atoi(strings.TrimSpace(string(offsetData))); err == nil {
+			h.mu.Lock()
+			h.utcOffset = offset
+			h.mu.Unlock()
+		}
+	}
+}
+
 // readRegisters читает данные через PCI драйвер
 func (h *ocpTimecardHandler) readRegisters() (time.Time, uint64, bool, error) {
 	if h.drv == nil {
@@ -462,12 +462,13 @@ func (h *phcHandler) AdjustFrequency(ppb int64) error {
 		return fmt.Errorf("adjustment %d ppb exceeds limits ±%d ppb", ppb, h.caps.MaxAdj)
 	}
 	
-	// Используем adjtimex syscall для корректировки частоты
+	// Частота PHC задается через clock_adjtime по динамическому clockid устройства
 	var timex unix.Timex
 	timex.Modes = unix.ADJ_FREQUENCY
-	timex.Freq = ppb * 65536 / 1000000 // Конвертируем ppb в формат ядра
+	timex.Freq = ppb * 65536 / 1000 // Конвертируем ppb в формат ядра (2^-16 ppm)
 	
-	_, err := unix.Adjtimex(&timex)
+	clockID := int32((^h.fd << 3) | 3) // FD_TO_CLOCKID
+	_, err := unix.ClockAdjtime(clockID, &timex)
 	if err != nil {
 		return fmt.Errorf("failed to adjust PHC frequency: %w", err)
 	}
@@ -21,6 +21,11 @@ const (
 	PPS_SETPARAMS = 0x400870a2
 	PPS_GETCAP    = 0x800870a3
 	PPS_FETCH     = 0xc00870a4
+	PPS_KC_BIND   = 0x400870a5
+
+	// Формат меток и потребитель ядра для PPS_KC_BIND
+	PPS_TSFMT_TSPEC = 0x1000
+	PPS_KC_HARDPPS  = 0
 
 	// PPS capability flags
 	PPS_CAPTUREASSERT = 0x01
@@ -53,6 +58,13 @@ type PPSTimestamp struct {
 	Nsec int32
 }
 
+// PPSBindArgs аргументы PPS_KC_BIND (struct pps_bind_args)
+type PPSBindArgs struct {
+	TSFormat int32
+	Edge     int32 // 0 - отвязать устройство
+	Consumer int32
+}
+
 // PPSParams параметры PPS
 type PPSParams struct {
 	ApiVersion int32
@@ -83,6 +95,7 @@ type ppsHandler struct {
 	capability int32
 	params     PPSParams
 	signalType PPSSignalType
+	kernelBound bool // Устройство привязано к hardpps ядра
 	
 	// Timing data
 	lastTimestamp  time.Time
@@ -158,6 +171,16 @@ func (h *ppsHandler) Start() error {
 		return fmt.Errorf("failed to setup PPS: %w", err)
 	}
 	
+	// Привязка к hardpps ядра возможна только для устройства /dev/ppsN
+	if h.config.PPSKernel && !h.useGPIO {
+		if err := h.bindKernelPPS(h.params.Mode & PPS_CAPTUREBOTH); err != nil {
+			h.logger.WithError(err).Warn("Failed to bind PPS device to kernel hardpps")
+		} else {
+			h.kernelBound = true
+			h.logger.WithField("device", h.device).Info("PPS device bound to kernel hardpps")
+		}
+	}
+	
 	h.running = true
 	h.status.Connected = true
 	h.status.LastActivity = time.Now()
@@ -183,6 +206,13 @@ func (h *ppsHandler) Stop() error {
 	h.running = false
 	h.status.Connected = false
 	
+	if h.kernelBound {
+		if err := h.bindKernelPPS(0); err != nil {
+			h.logger.WithError(err).Warn("Failed to unbind PPS device from kernel hardpps")
+		}
+		h.kernelBound = false
+	}
+	
 	if h.fd >= 0 {
 		unix.Close(h.fd)
 		h.fd = -1
@@ -456,6 +486,34 @@ func (h *ppsHandler) setPPSParams() error {
 	return nil
 }
 
+// bindKernelPPS привязывает устройство к hardpps ядра по фронтам edge
+// (PPS_CAPTUREASSERT/PPS_CAPTURECLEAR) или отвязывает при edge = 0
+func (h *ppsHandler) bindKernelPPS(edge int32) error {
+	args := PPSBindArgs{
+		TSFormat: PPS_TSFMT_TSPEC,
+		Edge:     edge,
+		Consumer: PPS_KC_HARDPPS,
+	}
+	
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL,
+		uintptr(h.fd),
+		uintptr(PPS_KC_BIND),
+		uintptr(unsafe.Pointer(&args)))
+	
+	if errno != 0 {
+		return errno
+	}
+	
+	return nil
+}
+
+// KernelPPSBound возвращает true, если устройство привязано к hardpps ядра
+func (h *ppsHandler) KernelPPSBound() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.kernelBound
+}
+
 // handlePPSEvents обрабатывает PPS события
 func (h *ppsHandler) handlePPSEvents() {
 	if h.useGPIO {
@@ -0,0 +1,62 @@
+package protocols
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+func TestPPSHandlerKernelBindErrors(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	// Обычный файл открывается, но не отвечает на PPS ioctl
+	notDevice := filepath.Join(t.TempDir(), "pps0")
+	if err := os.WriteFile(notDevice, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		device string
+		err    string
+	}{
+		{name: "missing device", device: filepath.Join(t.TempDir(), "missing"), err: "failed to open PPS device"},
+		{name: "not a pps device", device: notDevice, err: "failed to get PPS capability"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.TimeSourceConfig{Type: "pps", Name: "pps0", Device: tt.device, PPSKernel: true}
+			handler, err := NewPPSHandler(cfg, logger)
+			if err != nil {
+				t.Fatalf("NewPPSHandler() error = %v", err)
+			}
+
+			err = handler.Start()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Start() error = %v, want %q", err, tt.err)
+			}
+			defer handler.Stop()
+
+			// Без устройства привязка к hardpps не выполняется
+			pps, ok := handler.(KernelPPSSource)
+			if !ok {
+				t.Fatal("PPS handler does not implement KernelPPSSource")
+			}
+			if pps.KernelPPSBound() {
+				t.Error("PPS device reported as bound to kernel hardpps")
+			}
+			if handler.GetStatus().Connected {
+				t.Error("PPS handler reported as connected")
+			}
+			if h := handler.(*ppsHandler); h.fd >= 0 {
+				t.Errorf("device descriptor %d left open", h.fd)
+			}
+		})
+	}
+}
@@ -33,6 +33,11 @@ const (
 	// PTP Header size
 	PTPHeaderSize = 34
 
+	// Флаги заголовка PTP (второй октет flagField)
+	PTPFlagLeap61           = 0x0001
+	PTPFlagLeap59           = 0x0002
+	PTPFlagUTCOffsetValid   = 0x0004
+
 	// Hardware timestamping constants
 	SOF_TIMESTAMPING_TX_HARDWARE = 1 << 0
 	SOF_TIMESTAMPING_TX_SOFTWARE = 1 << 1
@@ -124,6 +129,8 @@ type ptpHandler struct {
 	
 	// Master информация
 	masterInfo   *PTPMasterInfo
+	leap         LeapIndicator
+	utcOffset    int
 	
 	// Временные метки
 	t1, t2, t3, t4 time.Time
@@ -243,6 +250,7 @@ func (h *ptpHandler) GetTimeInfo() (*TimeInfo, error) {
 	h.mu.RLock()
 	running := h.running
 	masterInfo := h.masterInfo
+	leap, utcOffset := h.leap, h.utcOffset
 	t1, t2, t3, t4 := h.t1, h.t2, h.t3, h.t4
 	h.mu.RUnlock()
 	
@@ -272,6 +280,8 @@ func (h *ptpHandler) GetTimeInfo() (*TimeInfo, error) {
 		Delay:     delay,
 		Quality:   quality,
 		Precision: -20, // Наносекундная точность
+		Leap:      leap,
+		UTCOffset: utcOffset,
 	}
 	
 	h.logger.WithFields(logrus.Fields{
@@ -597,6 +607,20 @@ func (h *ptpHandler) processAnnounceMessage(msg *PTPMessage, addr *net.UDPAddr)
 		StepsRemoved:            int(announce.StepsRemoved),
 		SourcePortIdentity:      fmt.Sprintf("%x:%d", msg.Header.SourcePortIdentity[:8], binary.BigEndian.Uint16(msg.Header.SourcePortIdentity[8:10])),
 	}
+	
+	// Флаги секунды координации и текущее смещение UTC от grandmaster
+	switch {
+	case msg.Header.FlagField&PTPFlagLeap61 != 0:
+		h.leap = LeapInsert
+	case msg.Header.FlagField&PTPFlagLeap59 != 0:
+		h.leap = LeapDelete
+	default:
+		h.leap = LeapNone
+	}
+	if msg.Header.FlagField&PTPFlagUTCOffsetValid != 0 {
+		h.utcOffset = int(announce.CurrentUTCOffset)
+	}
+	
 	h.announceCount++
 	h.portState = PTPPortStateSlave
 	h.mu.Unlock()
@@ -0,0 +1,294 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DefaultRTCDevice = "/dev/rtc0"
+
+	defaultRTCPollInterval = 64 * time.Second
+	rtcEdgePollStep        = time.Millisecond
+	rtcEdgeTimeout         = 1100 * time.Millisecond
+
+	// RTC не синхронизируется сам, его дисперсия заведомо велика
+	rtcRootDispersion = 50 * time.Millisecond
+)
+
+// RTCDevice аппаратные часы реального времени (/dev/rtcN), хранящие UTC
+type RTCDevice interface {
+	// ReadTime читает время RTC (разрешение 1 секунда)
+	ReadTime() (time.Time, error)
+
+	// SetTime записывает время в RTC
+	SetTime(t time.Time) error
+
+	// Close закрывает устройство
+	Close() error
+}
+
+// OpenRTCDevice открывает RTC по пути. Переменная, чтобы тесты могли
+// подставить поддельное устройство.
+var OpenRTCDevice = func(path string) (RTCDevice, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RTC device %s: %w", path, err)
+	}
+	return &rtcDevice{path: path, fd: fd}, nil
+}
+
+// rtcDevice RTC, управляемые через ioctl RTC_RD_TIME/RTC_SET_TIME
+type rtcDevice struct {
+	path string
+	fd   int
+}
+
+// ReadTime читает время RTC
+func (d *rtcDevice) ReadTime() (time.Time, error) {
+	rt, err := unix.IoctlGetRTCTime(d.fd)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read RTC %s: %w", d.path, err)
+	}
+	return time.Date(int(rt.Year)+1900, time.Month(rt.Mon+1), int(rt.Mday),
+		int(rt.Hour), int(rt.Min), int(rt.Sec), 0, time.UTC), nil
+}
+
+// SetTime записывает время в RTC
+func (d *rtcDevice) SetTime(t time.Time) error {
+	t = t.UTC()
+	rt := unix.RTCTime{
+		Sec:  int32(t.Second()),
+		Min:  int32(t.Minute()),
+		Hour: int32(t.Hour()),
+		Mday: int32(t.Day()),
+		Mon:  int32(t.Month()) - 1,
+		Year: int32(t.Year()) - 1900,
+		Wday: int32(t.Weekday()),
+		Yday: int32(t.YearDay()) - 1,
+	}
+	if err := unix.IoctlSetRTCTime(d.fd, &rt); err != nil {
+		return fmt.Errorf("failed to set RTC %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// Close закрывает устройство
+func (d *rtcDevice) Close() error {
+	return unix.Close(d.fd)
+}
+
+// MeasureRTCOffset измеряет смещение RTC относительно системных часов.
+// RTC читается с разрешением в секунду, поэтому ожидается смена секунды
+// RTC: в этот момент его время известно с точностью до шага опроса.
+func MeasureRTCOffset(dev RTCDevice) (time.Duration, error) {
+	first, err := dev.ReadTime()
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(rtcEdgeTimeout)
+	for time.Now().Before(deadline) {
+		rtcTime, err := dev.ReadTime()
+		if err != nil {
+			return 0, err
+		}
+		if !rtcTime.Equal(first) {
+			return rtcTime.Sub(time.Now()), nil
+		}
+		time.Sleep(rtcEdgePollStep)
+	}
+
+	return 0, fmt.Errorf("RTC time is not advancing")
+}
+
+// WriteRTC записывает системное время в RTC на границе секунды
+func WriteRTC(dev RTCDevice) error {
+	now := time.Now()
+	next := now.Truncate(time.Second).Add(time.Second)
+	time.Sleep(next.Sub(now))
+	return dev.SetTime(next)
+}
+
+// rtcHandler источник времени по RTC: последний резерв, позволяющий
+// установить время при загрузке, когда остальные источники недоступны
+type rtcHandler struct {
+	config config.TimeSourceConfig
+	logger *logrus.Logger
+
+	mu      sync.RWMutex
+	running bool
+	status  ConnectionStatus
+
+	device   string
+	interval time.Duration
+
+	offset      time.Duration
+	lastMeasure time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRTCHandler создает источник времени по RTC
+func NewRTCHandler(config config.TimeSourceConfig, logger *logrus.Logger) (TimeSourceHandler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := &rtcHandler{
+		config:   config,
+		logger:   logger,
+		device:   config.Device,
+		interval: config.PollingInterval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if h.device == "" {
+		h.device = DefaultRTCDevice
+	}
+	if h.interval <= 0 {
+		h.interval = defaultRTCPollInterval
+	}
+
+	return h, nil
+}
+
+// Start открывает RTC и запускает измерения
+func (h *rtcHandler) Start() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.running {
+		return fmt.Errorf("RTC handler already running")
+	}
+
+	h.logger.WithField("device", h.device).Info("Starting RTC handler")
+
+	// Устройство RTC открывается монопольно, поэтому держим его открытым
+	// только на время измерения, чтобы не мешать записи времени в RTC
+	dev, err := OpenRTCDevice(h.device)
+	if err != nil {
+		return err
+	}
+	dev.Close()
+
+	h.running = true
+
+	go h.pollLoop()
+
+	return nil
+}
+
+// Stop закрывает RTC
+func (h *rtcHandler) Stop() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.running {
+		return nil
+	}
+
+	h.logger.Info("Stopping RTC handler")
+
+	h.cancel()
+	h.running = false
+	h.status.Connected = false
+
+	return nil
+}
+
+// pollLoop периодически измеряет смещение RTC. Первое измерение
+// выполняется сразу, чтобы время можно было установить при загрузке.
+func (h *rtcHandler) pollLoop() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.measure()
+
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// measure измеряет смещение RTC и обновляет статус. Измерение занимает до
+// секунды, поэтому выполняется без блокировки.
+func (h *rtcHandler) measure() {
+	var offset time.Duration
+	dev, err := OpenRTCDevice(h.device)
+	if err == nil {
+		offset, err = MeasureRTCOffset(dev)
+		dev.Close()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.running {
+		return
+	}
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to measure RTC offset")
+		h.status.Connected = false
+		h.status.ErrorCount++
+		h.status.LastError = err
+		return
+	}
+
+	h.offset = offset
+	h.lastMeasure = time.Now()
+	h.status.Connected = true
+	h.status.LastActivity = h.lastMeasure
+	h.status.LastError = nil
+	h.status.PacketsRx++
+
+	h.logger.WithField("offset", offset).Debug("RTC offset measured")
+}
+
+// GetTimeInfo возвращает последнее измерение RTC
+func (h *rtcHandler) GetTimeInfo() (*TimeInfo, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.running {
+		return nil, fmt.Errorf("RTC handler not running")
+	}
+	if h.lastMeasure.IsZero() {
+		return nil, fmt.Errorf("no RTC measurements available")
+	}
+
+	return &TimeInfo{
+		Timestamp:      h.lastMeasure,
+		Offset:         h.offset + time.Duration(h.config.Offset),
+		Quality:        50,
+		Stratum:        15,  // Всегда хуже любого сетевого или аппаратного источника
+		Precision:      -10, // Граница секунды RTC ловится с шагом ~1 мс
+		RootDispersion: rtcRootDispersion,
+	}, nil
+}
+
+// GetStatus возвращает статус RTC
+func (h *rtcHandler) GetStatus() ConnectionStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+// GetConfig возвращает конфигурацию
+func (h *rtcHandler) GetConfig() config.TimeSourceConfig {
+	return h.config
+}
+
+// GetGNSSInfo возвращает пустую GNSS информацию (RTC не поддерживает GNSS)
+func (h *rtcHandler) GetGNSSInfo() GNSSStatus {
+	return GNSSStatus{}
+}
@@ -0,0 +1,114 @@
+package protocols
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/shiwatime/shiwatime/internal/config"
+)
+
+// fakeRTC RTC с разрешением в секунду, идущий со смещением от системных часов
+type fakeRTC struct {
+	mu     sync.Mutex
+	offset time.Duration
+	writes int
+}
+
+func (f *fakeRTC) ReadTime() (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Now().Add(f.offset).Truncate(time.Second), nil
+}
+
+func (f *fakeRTC) SetTime(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset = t.Sub(time.Now())
+	f.writes++
+	return nil
+}
+
+func (f *fakeRTC) Close() error {
+	return nil
+}
+
+func useFakeRTC(t *testing.T, rtc *fakeRTC) {
+	open := OpenRTCDevice
+	OpenRTCDevice = func(path string) (RTCDevice, error) {
+		return rtc, nil
+	}
+	t.Cleanup(func() {
+		OpenRTCDevice = open
+	})
+}
+
+func TestMeasureRTCOffset(t *testing.T) {
+	rtc := &fakeRTC{offset: 3*time.Second + 250*time.Millisecond}
+
+	offset, err := MeasureRTCOffset(rtc)
+	if err != nil {
+		t.Fatalf("MeasureRTCOffset() error = %v", err)
+	}
+
+	if diff := offset - rtc.offset; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+		t.Errorf("MeasureRTCOffset() = %v, want %v", offset, rtc.offset)
+	}
+}
+
+func TestWriteRTC(t *testing.T) {
+	rtc := &fakeRTC{offset: -time.Hour}
+
+	if err := WriteRTC(rtc); err != nil {
+		t.Fatalf("WriteRTC() error = %v", err)
+	}
+
+	if rtc.writes != 1 {
+		t.Errorf("writes = %d, want 1", rtc.writes)
+	}
+	if rtc.offset < -20*time.Millisecond || rtc.offset > 20*time.Millisecond {
+		t.Errorf("offset after write = %v, want ~0", rtc.offset)
+	}
+}
+
+func TestRTCHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	rtc := &fakeRTC{offset: -90 * time.Second}
+	useFakeRTC(t, rtc)
+
+	handler, err := NewTimeSourceHandler(config.TimeSourceConfig{
+		Type:   "rtc",
+		Device: "/dev/rtc-fake",
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewTimeSourceHandler() error = %v", err)
+	}
+
+	if err := handler.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer handler.Stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !handler.GetStatus().Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("RTC handler did not produce a measurement")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	info, err := handler.GetTimeInfo()
+	if err != nil {
+		t.Fatalf("GetTimeInfo() error = %v", err)
+	}
+
+	if diff := info.Offset - rtc.offset; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+		t.Errorf("Offset = %v, want %v", info.Offset, rtc.offset)
+	}
+	if info.Stratum != 15 {
+		t.Errorf("Stratum = %d, want 15", info.Stratum)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"io"
+	"sort"
 	"time"
 	
 	"github.com/gliderlabs/ssh"
@@ -10,6 +11,7 @@ import (
 	
 	"github.com/shiwatime/shiwatime/internal/clock"
 	"github.com/shiwatime/shiwatime/internal/config"
+	"github.com/shiwatime/shiwatime/internal/protocols"
 )
 
 // CLIServer SSH CLI сервер
@@ -69,6 +71,15 @@ func (s *CLIServer) handleSession(sess ssh.Session) {
 	io.WriteString(sess, fmt.Sprintf("User: %s\n", user))
 	io.WriteString(sess, fmt.Sprintf("Time: %s\n\n", time.Now().Format(time.RFC3339)))
 	
+	// События часов выводятся сразу, без опроса командой status
+	notices := s.clockManager.Events().Subscribe(clock.EventFilter{}, 16)
+	defer notices.Close()
+	go func() {
+		for event := range notices.C {
+			io.WriteString(sess, fmt.Sprintf("\n*** %s: %s\n", event.Type, event.Message))
+		}
+	}()
+	
 	// Простой интерактивный интерфейс
 	for {
 		io.WriteString(sess, "shiwatime> ")
@@ -102,6 +113,10 @@ func (s *CLIServer) handleCommand(sess ssh.Session, command string) {
 		s.handleStatusCommand(sess)
 	case "sources":
 		s.handleSourcesCommand(sess)
+	case "state":
+		s.handleStateCommand(sess)
+	case "events":
+		s.handleEventsCommand(sess)
 	case "help":
 		s.handleHelpCommand(sess)
 	case "":
@@ -119,6 +134,21 @@ func (s *CLIServer) handleStatusCommand(sess ssh.Session) {
 	
 	io.WriteString(sess, fmt.Sprintf("Clock State: %s\n", state.String()))
 	
+	if monitor, ok := s.clockManager.GetMonitorStatus(); ok {
+		io.WriteString(sess, "Mode: monitor (adjust_clock: false)\n")
+		switch monitor.Action {
+		case "step":
+			step := monitor.Step.String()
+			if monitor.Step > 0 {
+				step = "+" + step
+			}
+			io.WriteString(sess, fmt.Sprintf("  Would step %s\n", step))
+		case "slew":
+			io.WriteString(sess, fmt.Sprintf("  Would slew %+.1fppb\n", monitor.Frequency))
+		}
+		io.WriteString(sess, fmt.Sprintf("  Virtual correction: %v (%d steps)\n", monitor.Correction, monitor.Steps))
+	}
+	
 	if selectedSource != nil {
 		// Find the name of the selected source
 		allSources := s.clockManager.GetSources()
@@ -134,8 +164,8 @@ func (s *CLIServer) handleStatusCommand(sess ssh.Session) {
 		status := selectedSource.GetStatus()
 		timeInfo, err := selectedSource.GetTimeInfo()
 		
-		io.WriteString(sess, fmt.Sprintf("Selected Source: %s (%s)\n", 
-			sourceName, config.Type))
+		io.WriteString(sess, fmt.Sprintf("Selected Source: %s (%s, %s)\n", 
+			sourceName, config.Type, s.clockManager.GetSourceTier(sourceName)))
 		
 		if err == nil && timeInfo != nil {
 			io.WriteString(sess, fmt.Sprintf("  Offset: %s\n", timeInfo.Offset))
@@ -157,49 +187,68 @@ func (s *CLIServer) handleStatusCommand(sess ssh.Session) {
 	io.WriteString(sess, "\n")
 }
 
+// handleStateCommand обрабатывает команду state
+func (s *CLIServer) handleStateCommand(sess ssh.Session) {
+	status := s.clockManager.GetStateStatus()
+	
+	io.WriteString(sess, fmt.Sprintf("Clock State: %s (for %s)\n",
+		status.State, status.TimeInState.Truncate(time.Second)))
+	io.WriteString(sess, fmt.Sprintf("  ADEV: %.3g (max %.3g)\n", status.ADEV, status.MaxADEV))
+	io.WriteString(sess, fmt.Sprintf("  Lock: |offset| <= %s for %s, unlock above %s\n",
+		status.LockThreshold, status.LockTime, status.UnlockThreshold))
+	
+	io.WriteString(sess, "\nTransitions:\n")
+	for _, transition := range s.clockManager.GetStateHistory() {
+		io.WriteString(sess, fmt.Sprintf("  %s  %s -> %s (%s), offset %s\n",
+			transition.Timestamp.Format(time.RFC3339), transition.From, transition.To,
+			transition.Reason, transition.Offset))
+	}
+	
+	io.WriteString(sess, "\n")
+}
+
+// handleEventsCommand обрабатывает команду events
+func (s *CLIServer) handleEventsCommand(sess ssh.Session) {
+	for _, event := range s.clockManager.Events().History(clock.EventFilter{}, 0) {
+		io.WriteString(sess, fmt.Sprintf("  %s  %-15s %s\n",
+			event.Timestamp.Format(time.RFC3339), event.Type, event.Message))
+	}
+	
+	io.WriteString(sess, "\n")
+}
+
 // handleSourcesCommand обрабатывает команду sources
 func (s *CLIServer) handleSourcesCommand(sess ssh.Session) {
 	primarySources, secondarySources := s.clockManager.GetSourcesByPriority()
-	selectedSource := s.clockManager.GetSelectedSource()
+	selection := s.clockManager.GetSelection()
 	
 	io.WriteString(sess, "Primary Sources:\n")
-	for name, handler := range primarySources {
-		status := "inactive"
-		handlerStatus := handler.GetStatus()
-		config := handler.GetConfig()
-		
-		if handlerStatus.Connected {
-			status = "active"
-		}
-		if handler == selectedSource {
-			status = "selected"
-		}
-		
-		timeInfo, err := handler.GetTimeInfo()
-		offset := "unknown"
-		quality := 0
-		if err == nil && timeInfo != nil {
-			offset = timeInfo.Offset.String()
-			quality = timeInfo.Quality
-		}
-		
-		io.WriteString(sess, fmt.Sprintf("  %s (%s) - %s\n", 
-			name, config.Type, status))
-		io.WriteString(sess, fmt.Sprintf("    Offset: %s, Quality: %d\n", 
-			offset, quality))
-	}
+	writeSources(sess, primarySources, selection)
 	
 	io.WriteString(sess, "\nSecondary Sources:\n")
-	for name, handler := range secondarySources {
+	writeSources(sess, secondarySources, selection)
+	
+	io.WriteString(sess, "\n")
+}
+
+// writeSources выводит источники одного уровня в порядке имен
+func writeSources(sess ssh.Session, sources map[string]protocols.TimeSourceHandler, selection map[string]clock.SourceSelection) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	for _, name := range names {
+		handler := sources[name]
 		status := "inactive"
-		handlerStatus := handler.GetStatus()
-		config := handler.GetConfig()
-		
-		if handlerStatus.Connected {
+		if handler.GetStatus().Connected {
 			status = "active"
 		}
-		if handler == selectedSource {
-			status = "selected"
+		
+		result := selection[name].Status
+		if result == "" {
+			result = clock.SelectionUnusable
 		}
 		
 		timeInfo, err := handler.GetTimeInfo()
@@ -210,13 +259,11 @@ func (s *CLIServer) handleSourcesCommand(sess ssh.Session) {
 			quality = timeInfo.Quality
 		}
 		
-		io.WriteString(sess, fmt.Sprintf("  %s (%s) - %s\n", 
-			name, config.Type, status))
+		io.WriteString(sess, fmt.Sprintf("  %s (%s) - %s, %s\n", 
+			name, handler.GetConfig().Type, status, result))
 		io.WriteString(sess, fmt.Sprintf("    Offset: %s, Quality: %d\n", 
 			offset, quality))
 	}
-	
-	io.WriteString(sess, "\n")
 }
 
 // handleHelpCommand обрабатывает команду help
@@ -224,6 +271,8 @@ func (s *CLIServer) handleHelpCommand(sess ssh.Session) {
 	help := `Available commands:
   status   - Show clock synchronization status
   sources  - Show time sources information
+  state    - Show clock state machine and transitions
+  events   - Show recent clock and source events
   help     - Show this help message
   exit     - Exit CLI session
 
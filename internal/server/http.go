@@ -3,7 +3,11 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 	
 	"github.com/gin-gonic/gin"
@@ -12,6 +16,7 @@ import (
 	"github.com/shiwatime/shiwatime/internal/clock"
 	"github.com/shiwatime/shiwatime/internal/config"
 	"github.com/shiwatime/shiwatime/internal/protocols"
+	"github.com/shiwatime/shiwatime/internal/stability"
 )
 
 // HTTPServer HTTP сервер для веб-интерфейса
@@ -20,12 +25,32 @@ type HTTPServer struct {
 	clockManager *clock.Manager
 	logger       *logrus.Logger
 	server       *http.Server
+	
+	// Счетчики событий по подписке на шину
+	countersMu  sync.Mutex
+	transitions map[stateEdge]int
+	events      map[clock.EventType]int
+	counting    *clock.EventSubscription
+}
+
+// stateEdge переход между двумя состояниями часов
+type stateEdge struct {
+	from clock.ClockState
+	to   clock.ClockState
 }
 
 // StatusResponse ответ статуса
 type StatusResponse struct {
 	Status         string                 `json:"status"`
 	ClockState     string                 `json:"clock_state"`
+	Algorithm      string                 `json:"algorithm"`
+	Target         string                 `json:"target"`
+	Adaptive       *clock.AdaptiveStatus  `json:"adaptive,omitempty"`
+	Monitor        *clock.MonitorStatus   `json:"monitor,omitempty"`
+	Loop           *clock.LoopStatus      `json:"loop,omitempty"`
+	Temperature    *clock.TemperatureStatus `json:"temperature,omitempty"`
+	Holdover       clock.HoldoverStatus   `json:"holdover"`
+	Leap           clock.LeapStatus       `json:"leap"`
 	SelectedSource *TimeSourceResponse    `json:"selected_source,omitempty"`
 	PrimarySources []TimeSourceResponse   `json:"primary_sources"`
 	SecondarySources []TimeSourceResponse `json:"secondary_sources"`
@@ -35,6 +60,7 @@ type StatusResponse struct {
 // TimeSourceResponse информация об источнике времени
 type TimeSourceResponse struct {
 	ID         string    `json:"id"`
+	Tier       string    `json:"tier"`
 	Protocol   string    `json:"protocol"`
 	Active     bool      `json:"active"`
 	Selected   bool      `json:"selected"`
@@ -43,6 +69,13 @@ type TimeSourceResponse struct {
 	Quality    int       `json:"quality"`
 	ErrorCount int       `json:"error_count"`
 	LastError  string    `json:"last_error,omitempty"`
+	
+	// Результат алгоритма выбора источников
+	Selection    string  `json:"selection"`
+	RootDistance string  `json:"root_distance,omitempty"`
+	Jitter       string  `json:"jitter,omitempty"`
+	Dispersion   string  `json:"dispersion,omitempty"`
+	Weight       float64 `json:"weight"`
 }
 
 // NewHTTPServer создает новый HTTP сервер
@@ -51,6 +84,8 @@ func NewHTTPServer(cfg config.HTTPConfig, clockManager *clock.Manager, logger *l
 		config:       cfg,
 		clockManager: clockManager,
 		logger:       logger,
+		transitions:  make(map[stateEdge]int),
+		events:       make(map[clock.EventType]int),
 	}
 }
 
@@ -84,6 +119,10 @@ func (s *HTTPServer) Start() error {
 	// Регистрируем маршруты
 	s.registerRoutes(router)
 	
+	// События считаются по подписке, а не при опросе /metrics
+	s.counting = s.clockManager.Events().Subscribe(clock.EventFilter{}, 0)
+	go s.countEvents(s.counting)
+	
 	// Настраиваем HTTP сервер
 	addr := fmt.Sprintf("%s:%d", s.config.BindHost, s.config.BindPort)
 	s.server = &http.Server{
@@ -104,6 +143,10 @@ func (s *HTTPServer) Start() error {
 func (s *HTTPServer) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping HTTP server")
 	
+	if s.counting != nil {
+		s.counting.Close()
+	}
+	
 	if s.server != nil {
 		return s.server.Shutdown(ctx)
 	}
@@ -111,6 +154,18 @@ func (s *HTTPServer) Stop(ctx context.Context) error {
 	return nil
 }
 
+// countEvents считает события и переходы машины состояний до закрытия подписки
+func (s *HTTPServer) countEvents(sub *clock.EventSubscription) {
+	for event := range sub.C {
+		s.countersMu.Lock()
+		s.events[event.Type]++
+		if transition, ok := event.Data.(clock.StateTransition); ok {
+			s.transitions[stateEdge{from: transition.From, to: transition.To}]++
+		}
+		s.countersMu.Unlock()
+	}
+}
+
 // registerRoutes регистрирует маршруты
 func (s *HTTPServer) registerRoutes(router *gin.Engine) {
 	// API маршруты
@@ -119,7 +174,16 @@ func (s *HTTPServer) registerRoutes(router *gin.Engine) {
 		api.GET("/status", s.handleStatus)
 		api.GET("/sources", s.handleSources)
 		api.GET("/sources/:id", s.handleSourceDetails)
+		api.GET("/sources/:id/history", s.handleSourceHistory)
+		api.GET("/sources/:id/stability", s.handleSourceStability)
+		api.GET("/stability", s.handleStability)
 		api.GET("/health", s.handleHealth)
+		api.GET("/steps", s.handleSteps)
+		api.GET("/switches", s.handleSwitches)
+		api.GET("/state", s.handleState)
+		api.GET("/events", s.handleEvents)
+		api.GET("/events/stream", s.handleEventStream)
+		api.GET("/targets", s.handleTargets)
 	}
 	
 	// Статические файлы и UI
@@ -134,21 +198,41 @@ func (s *HTTPServer) registerRoutes(router *gin.Engine) {
 func (s *HTTPServer) handleStatus(c *gin.Context) {
 	primarySources, secondarySources := s.clockManager.GetSourcesByPriority()
 	selectedSource := s.clockManager.GetSelectedSource()
+	selection := s.clockManager.GetSelection()
+	
+	stats := s.clockManager.GetStatistics()
 	
 	response := StatusResponse{
 		Status:           "ok",
 		ClockState:       s.clockManager.GetState().String(),
-		PrimarySources:   convertSources(primarySources),
-		SecondarySources: convertSources(secondarySources),
+		Algorithm:        s.clockManager.GetAlgorithm(),
+		Target:           s.clockManager.GetTarget(),
+		Holdover:         stats.Holdover,
+		Leap:             stats.Leap,
+		PrimarySources:   convertSources(primarySources, clock.SourceTierPrimary, selection),
+		SecondarySources: convertSources(secondarySources, clock.SourceTierSecondary, selection),
 		Timestamp:        time.Now(),
 	}
 	
+	if adaptive, ok := s.clockManager.GetAdaptiveStatus(); ok {
+		response.Adaptive = &adaptive
+	}
+	if monitor, ok := s.clockManager.GetMonitorStatus(); ok {
+		response.Monitor = &monitor
+	}
+	if loop, ok := s.clockManager.GetLoopStatus(); ok {
+		response.Loop = &loop
+	}
+	if temperature, ok := s.clockManager.GetTemperatureStatus(); ok {
+		response.Temperature = &temperature
+	}
+	
 	if selectedSource != nil {
 		// Find the name of the selected source
 		allSources := s.clockManager.GetSources()
 		for name, handler := range allSources {
 			if handler == selectedSource {
-				sourceResp := convertSource(name, handler)
+				sourceResp := convertSource(name, s.clockManager.GetSourceTier(name), handler, selection[name])
 				sourceResp.Selected = true
 				response.SelectedSource = &sourceResp
 				break
@@ -162,10 +246,11 @@ func (s *HTTPServer) handleStatus(c *gin.Context) {
 // handleSources обрабатывает запрос списка источников
 func (s *HTTPServer) handleSources(c *gin.Context) {
 	primarySources, secondarySources := s.clockManager.GetSourcesByPriority()
+	selection := s.clockManager.GetSelection()
 	
 	response := map[string]interface{}{
-		"primary_sources":   convertSources(primarySources),
-		"secondary_sources": convertSources(secondarySources),
+		"primary_sources":   convertSources(primarySources, clock.SourceTierPrimary, selection),
+		"secondary_sources": convertSources(secondarySources, clock.SourceTierSecondary, selection),
 		"timestamp":         time.Now(),
 	}
 	
@@ -177,11 +262,12 @@ func (s *HTTPServer) handleSourceDetails(c *gin.Context) {
 	sourceID := c.Param("id")
 	
 	allSources := s.clockManager.GetSources()
+	selection := s.clockManager.GetSelection()
 	
 	for name, source := range allSources {
 		if name == sourceID {
 			response := map[string]interface{}{
-				"source": convertSource(name, source),
+				"source": convertSource(name, s.clockManager.GetSourceTier(name), source, selection[name]),
 				"timestamp": time.Now(),
 			}
 			
@@ -193,12 +279,96 @@ func (s *HTTPServer) handleSourceDetails(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
 }
 
+// handleSourceHistory возвращает историю измерений источника. Параметры
+// from и to принимают время в RFC3339 или длительность назад от текущего
+// момента (например, from=1h), step - интервал усреднения (например, 1m).
+func (s *HTTPServer) handleSourceHistory(c *gin.Context) {
+	sourceID := c.Param("id")
+	now := time.Now()
+	
+	from, err := parseHistoryTime(c.Query("from"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+		return
+	}
+	to, err := parseHistoryTime(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+		return
+	}
+	
+	var step time.Duration
+	if value := c.Query("step"); value != "" {
+		step, err = time.ParseDuration(value)
+		if err != nil || step < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid step"})
+			return
+		}
+	}
+	
+	points, ok := s.clockManager.GetSourceHistory(sourceID, from, to, step)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+	
+	response := map[string]interface{}{
+		"source":    sourceID,
+		"from":      from,
+		"to":        to,
+		"step":      step,
+		"history":   points,
+		"timestamp": now,
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleSourceStability возвращает ADEV, MDEV, TDEV и MTIE источника
+func (s *HTTPServer) handleSourceStability(c *gin.Context) {
+	sourceID := c.Param("id")
+	
+	result, ok := s.clockManager.GetSourceStability(sourceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+	
+	response := map[string]interface{}{
+		"source":    sourceID,
+		"stability": result,
+		"timestamp": time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleStability возвращает характеристики стабильности часов и всех источников
+func (s *HTTPServer) handleStability(c *gin.Context) {
+	c.JSON(http.StatusOK, s.clockManager.GetStability())
+}
+
+// parseHistoryTime разбирает границу интервала истории: пустая строка -
+// без ограничения, длительность - момент на столько раньше now
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		if ago < 0 {
+			ago = -ago
+		}
+		return now.Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // handleHealth обрабатывает запрос здоровья
 func (s *HTTPServer) handleHealth(c *gin.Context) {
 	state := s.clockManager.GetState()
 	
 	status := "healthy"
-	if state == clock.ClockStateUnsynchronized || state == clock.ClockStateUnknown {
+	if state == clock.ClockStateFreeRunning {
 		status = "unhealthy"
 	}
 	
@@ -211,6 +381,95 @@ func (s *HTTPServer) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// handleSteps обрабатывает запрос журнала шагов часов
+func (s *HTTPServer) handleSteps(c *gin.Context) {
+	response := map[string]interface{}{
+		"steps":     s.clockManager.GetStepHistory(),
+		"timestamp": time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleSwitches возвращает журнал переключений системного источника
+func (s *HTTPServer) handleSwitches(c *gin.Context) {
+	response := map[string]interface{}{
+		"switches":  s.clockManager.GetSwitchHistory(),
+		"timestamp": time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleState возвращает состояние машины состояний часов и журнал переходов
+func (s *HTTPServer) handleState(c *gin.Context) {
+	response := map[string]interface{}{
+		"state":       s.clockManager.GetStateStatus(),
+		"transitions": s.clockManager.GetStateHistory(),
+		"timestamp":   time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleEvents возвращает последние события шины. Параметры type и source
+// принимают списки через запятую, since - номер последнего полученного события.
+func (s *HTTPServer) handleEvents(c *gin.Context) {
+	filter := clock.ParseEventFilter(c.Query("type"), c.Query("source"))
+	
+	var since uint64
+	if value := c.Query("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since"})
+			return
+		}
+		since = parsed
+	}
+	
+	response := map[string]interface{}{
+		"events":    s.clockManager.Events().History(filter, since),
+		"timestamp": time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
+// handleEventStream передает события шины в формате Server-Sent Events,
+// пока клиент не закроет соединение
+func (s *HTTPServer) handleEventStream(c *gin.Context) {
+	filter := clock.ParseEventFilter(c.Query("type"), c.Query("source"))
+	sub := s.clockManager.Events().Subscribe(filter, 0)
+	defer sub.Close()
+	
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			c.SSEvent(string(event.Type), event)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// handleTargets возвращает состояние синхронизации часов между собой
+func (s *HTTPServer) handleTargets(c *gin.Context) {
+	response := map[string]interface{}{
+		"target":    s.clockManager.GetTarget(),
+		"targets":   s.clockManager.GetTargets(),
+		"timestamp": time.Now(),
+	}
+	
+	c.JSON(http.StatusOK, response)
+}
+
 // handleIndex обрабатывает главную страницу
 func (s *HTTPServer) handleIndex(c *gin.Context) {
 	html := `<!DOCTYPE html>
@@ -242,7 +501,7 @@ func (s *HTTPServer) handleIndex(c *gin.Context) {
             let html = '<h2>Clock Status: ' + data.clock_state + '</h2>';
             
             if (data.selected_source) {
-                html += '<p><strong>Selected Source:</strong> ' + data.selected_source.id + ' (' + data.selected_source.protocol + ')</p>';
+                html += '<p><strong>Selected Source:</strong> ' + data.selected_source.id + ' (' + data.selected_source.protocol + ', ' + data.selected_source.tier + ')</p>';
             }
             
             html += '<h3>Primary Sources</h3>';
@@ -269,6 +528,7 @@ func (s *HTTPServer) handleIndex(c *gin.Context) {
                 html += '<div class="' + className + '">';
                 html += '<h4>' + source.id + ' (' + source.protocol + ')</h4>';
                 html += '<p>Status: ' + (source.active ? 'Active' : 'Inactive') + '</p>';
+                html += '<p>Selection: ' + source.selection + '</p>';
                 html += '<p>Offset: ' + source.offset + '</p>';
                 html += '<p>Quality: ' + source.quality + '</p>';
                 if (source.last_error) {
@@ -324,10 +584,47 @@ func (s *HTTPServer) handleMetrics(c *gin.Context) {
 	// Простые метрики в формате Prometheus
 	allSources := s.clockManager.GetSources()
 	
-	metrics := fmt.Sprintf("# HELP shiwatime_clock_state Current clock state (0=unknown, 1=synchronized, 2=unsynchronized)\n")
+	metrics := fmt.Sprintf("# HELP shiwatime_clock_state Current clock state (0=free_running, 1=synchronizing, 2=locked, 3=holdover)\n")
 	metrics += fmt.Sprintf("# TYPE shiwatime_clock_state gauge\n")
 	metrics += fmt.Sprintf("shiwatime_clock_state %d\n", int(s.clockManager.GetState()))
 	
+	status := s.clockManager.GetStateStatus()
+	metrics += fmt.Sprintf("# HELP shiwatime_clock_state_seconds Time spent in the current clock state\n")
+	metrics += fmt.Sprintf("# TYPE shiwatime_clock_state_seconds gauge\n")
+	metrics += fmt.Sprintf("shiwatime_clock_state_seconds %.3f\n", status.TimeInState.Seconds())
+	
+	metrics += fmt.Sprintf("# HELP shiwatime_clock_state_transitions_total Clock state machine transitions\n")
+	metrics += fmt.Sprintf("# TYPE shiwatime_clock_state_transitions_total counter\n")
+	s.countersMu.Lock()
+	edges := make([]stateEdge, 0, len(s.transitions))
+	for edge := range s.transitions {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	for _, edge := range edges {
+		metrics += fmt.Sprintf("shiwatime_clock_state_transitions_total{from=%q,to=%q} %d\n",
+			edge.from.String(), edge.to.String(), s.transitions[edge])
+	}
+	
+	metrics += fmt.Sprintf("# HELP shiwatime_events_total Clock and source events published on the event bus\n")
+	metrics += fmt.Sprintf("# TYPE shiwatime_events_total counter\n")
+	types := make([]string, 0, len(s.events))
+	for eventType := range s.events {
+		types = append(types, string(eventType))
+	}
+	sort.Strings(types)
+	for _, eventType := range types {
+		metrics += fmt.Sprintf("shiwatime_events_total{type=%q} %d\n", eventType, s.events[clock.EventType(eventType)])
+	}
+	s.countersMu.Unlock()
+	
+	metrics += stabilityMetrics(s.clockManager.GetStability())
+	
 	metrics += fmt.Sprintf("# HELP shiwatime_sources_total Total number of time sources\n")
 	metrics += fmt.Sprintf("# TYPE shiwatime_sources_total gauge\n")
 	metrics += fmt.Sprintf("shiwatime_sources_total %d\n", len(allSources))
@@ -348,16 +645,19 @@ func (s *HTTPServer) handleMetrics(c *gin.Context) {
 }
 
 // convertSources конвертирует источники в ответ
-func convertSources(sources map[string]protocols.TimeSourceHandler) []TimeSourceResponse {
+func convertSources(sources map[string]protocols.TimeSourceHandler, tier clock.SourceTier, selection map[string]clock.SourceSelection) []TimeSourceResponse {
 	result := make([]TimeSourceResponse, 0, len(sources))
 	for name, handler := range sources {
-		result = append(result, convertSource(name, handler))
+		result = append(result, convertSource(name, tier, handler, selection[name]))
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
 	return result
 }
 
 // convertSource конвертирует источник в ответ
-func convertSource(name string, handler protocols.TimeSourceHandler) TimeSourceResponse {
+func convertSource(name string, tier clock.SourceTier, handler protocols.TimeSourceHandler, selection clock.SourceSelection) TimeSourceResponse {
 	status := handler.GetStatus()
 	config := handler.GetConfig()
 	
@@ -374,13 +674,25 @@ func convertSource(name string, handler protocols.TimeSourceHandler) TimeSourceR
 	
 	resp := TimeSourceResponse{
 		ID:         name,
+		Tier:       string(tier),
 		Protocol:   config.Type,
 		Active:     status.Connected,
-		Selected:   false, // Will be set separately for selected source
+		Selected:   selection.Status == clock.SelectionSelected,
 		LastSync:   lastSync,
 		Offset:     offset,
 		Quality:    quality,
 		ErrorCount: int(status.ErrorCount),
+		Selection:  string(selection.Status),
+		Weight:     selection.Weight,
+	}
+	
+	if resp.Selection == "" {
+		resp.Selection = string(clock.SelectionUnusable)
+	}
+	if selection.RootDistance > 0 {
+		resp.RootDistance = selection.RootDistance.String()
+		resp.Jitter = selection.Jitter.String()
+		resp.Dispersion = selection.Dispersion.String()
 	}
 	
 	if status.LastError != nil {
@@ -397,4 +709,59 @@ func convertDurations(durations []time.Duration) []string {
 		result[i] = d.String()
 	}
 	return result
-}
\ No newline at end of file
+}
+
+// stabilityMetrics форматирует характеристики стабильности для Prometheus.
+// Ряды часов не имеют метки source, ряды источников помечены ее именем.
+func stabilityMetrics(report clock.StabilityReport) string {
+	names := make([]string, 0, len(report.Sources))
+	for name := range report.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	type labeledResult struct {
+		labels string
+		result stability.Result
+	}
+	series := []labeledResult{{labels: "", result: report.Clock}}
+	for _, name := range names {
+		series = append(series, labeledResult{labels: fmt.Sprintf("source=%q,", name), result: report.Sources[name]})
+	}
+	
+	families := []struct {
+		name  string
+		help  string
+		value func(stability.Point) float64
+	}{
+		{"shiwatime_stability_adev", "Overlapping Allan deviation", func(p stability.Point) float64 { return p.ADEV }},
+		{"shiwatime_stability_mdev", "Modified Allan deviation", func(p stability.Point) float64 { return p.MDEV }},
+		{"shiwatime_stability_tdev_seconds", "Time deviation", func(p stability.Point) float64 { return p.TDEV }},
+		{"shiwatime_stability_mtie_seconds", "Maximum time interval error", func(p stability.Point) float64 { return p.MTIE }},
+	}
+	
+	metrics := ""
+	for _, family := range families {
+		metrics += fmt.Sprintf("# HELP %s %s by tau (seconds)\n", family.name, family.help)
+		metrics += fmt.Sprintf("# TYPE %s gauge\n", family.name)
+		for _, s := range series {
+			for _, point := range s.result.Points {
+				metrics += fmt.Sprintf("%s{%stau=\"%g\"} %g\n", family.name, s.labels, point.Tau.Seconds(), family.value(point))
+			}
+		}
+	}
+	
+	metrics += "# HELP shiwatime_stability_mtie_mask_pass MTIE within the configured ITU-T mask (1) or not (0)\n"
+	metrics += "# TYPE shiwatime_stability_mtie_mask_pass gauge\n"
+	for _, s := range series {
+		for _, mask := range s.result.Masks {
+			pass := 0
+			if mask.Pass {
+				pass = 1
+			}
+			metrics += fmt.Sprintf("shiwatime_stability_mtie_mask_pass{%smask=%q} %d\n", s.labels, mask.Name, pass)
+		}
+	}
+	
+	return metrics
+}
@@ -773,13 +773,13 @@ func (h *WebHandler) addProtocolSpecificInfo(info *SourceInfo, handler protocols
 // getClockStatusClass возвращает CSS класс для состояния часов
 func (h *WebHandler) getClockStatusClass(state clock.ClockState) string {
 	switch state {
-	case clock.ClockStateSynchronized:
+	case clock.ClockStateLocked:
 		return "good"
 	case clock.ClockStateSynchronizing:
 		return "warning"
 	case clock.ClockStateHoldover:
 		return "warning"
-	case clock.ClockStateUnsynchronized:
+	case clock.ClockStateFreeRunning:
 		return "error"
 	default:
 		return "unknown"
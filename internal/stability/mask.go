@@ -0,0 +1,91 @@
+package stability
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mask предел MTIE в зависимости от τ
+type Mask struct {
+	Name  string
+	Limit func(tau float64) float64 // τ и предел в секундах
+	// Диапазон τ, на котором маска определена
+	MinTau time.Duration
+	MaxTau time.Duration // 0 - без ограничения
+}
+
+// Маски MTIE из рекомендаций ITU-T
+var (
+	// G.811: первичный эталонный генератор (PRC)
+	MaskG811PRC = Mask{
+		Name:   "g811_prc",
+		MinTau: 100 * time.Millisecond,
+		Limit: func(tau float64) float64 {
+			if tau <= 1000 {
+				return 0.275e-3*tau*1e-6 + 0.025e-6
+			}
+			return 1e-5*tau*1e-6 + 0.29e-6
+		},
+	}
+
+	// G.8272: первичный эталон времени класса A (PRTC-A)
+	MaskG8272PRTCA = Mask{
+		Name:   "g8272_prtc_a",
+		MinTau: 100 * time.Millisecond,
+		Limit: func(tau float64) float64 {
+			if tau <= 273 {
+				return 0.275e-3*tau*1e-6 + 0.025e-6
+			}
+			return 0.1e-6
+		},
+	}
+
+	// G.8272: первичный эталон времени класса B (PRTC-B)
+	MaskG8272PRTCB = Mask{
+		Name:   "g8272_prtc_b",
+		MinTau: 100 * time.Millisecond,
+		Limit: func(tau float64) float64 {
+			if tau <= 54.5 {
+				return 0.275e-3*tau*1e-6 + 0.025e-6
+			}
+			return 0.04e-6
+		},
+	}
+)
+
+// Masks все известные маски по именам
+var Masks = map[string]Mask{
+	MaskG811PRC.Name:    MaskG811PRC,
+	MaskG8272PRTCA.Name: MaskG8272PRTCA,
+	MaskG8272PRTCB.Name: MaskG8272PRTCB,
+}
+
+// ParseMasks возвращает маски по списку имен
+func ParseMasks(names []string) ([]Mask, error) {
+	masks := make([]Mask, 0, len(names))
+	for _, name := range names {
+		mask, ok := Masks[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown MTIE mask %q", name)
+		}
+		masks = append(masks, mask)
+	}
+	return masks, nil
+}
+
+// Check сравнивает MTIE точек с маской в диапазоне ее определения
+func (m Mask) Check(points []Point) MaskResult {
+	result := MaskResult{Name: m.Name, Pass: true}
+	for _, point := range points {
+		if point.Tau < m.MinTau || (m.MaxTau > 0 && point.Tau > m.MaxTau) {
+			continue
+		}
+		if point.MTIE > m.Limit(point.Tau.Seconds()) {
+			result.Pass = false
+			result.FailTau = point.Tau
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,223 @@
+// Package stability вычисляет характеристики стабильности часов по истории
+// фазы: перекрывающуюся девиацию Аллана (ADEV), модифицированную девиацию
+// (MDEV), временную девиацию (TDEV) и максимальную ошибку интервала времени
+// (MTIE) на октавной сетке τ, а также сравнивает MTIE с масками ITU-T.
+package stability
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// MinSamples минимальная длина истории фазы для анализа (τ = τ0)
+	MinSamples = 4
+
+	// gapFactor интервал между измерениями больше медианного в столько раз
+	// считается разрывом истории
+	gapFactor = 2.5
+)
+
+// Point характеристики стабильности для одного τ. ADEV и MDEV безразмерны,
+// TDEV и MTIE в секундах.
+type Point struct {
+	Tau  time.Duration `json:"tau"`
+	ADEV float64       `json:"adev"`
+	MDEV float64       `json:"mdev"`
+	TDEV float64       `json:"tdev"`
+	MTIE float64       `json:"mtie"`
+	N    int           `json:"n"` // Число слагаемых в оценке ADEV
+}
+
+// MaskResult результат сравнения MTIE с маской
+type MaskResult struct {
+	Name string `json:"name"`
+	Pass bool   `json:"pass"`
+	// Наименьший τ, на котором MTIE превышает маску
+	FailTau time.Duration `json:"fail_tau,omitempty"`
+}
+
+// Result характеристики стабильности одной истории фазы
+type Result struct {
+	Samples int           `json:"samples"`
+	Tau0    time.Duration `json:"tau0"`
+	Span    time.Duration `json:"span"`
+	Points  []Point       `json:"points"`
+	Masks   []MaskResult  `json:"masks,omitempty"`
+}
+
+// ADEV возвращает ADEV на наименьшем τ (0, если точек нет)
+func (r Result) ADEV() float64 {
+	if len(r.Points) == 0 {
+		return 0
+	}
+	return r.Points[0].ADEV
+}
+
+// Analyze вычисляет характеристики равномерно измеренной фазы phase
+// (секунды, интервал tau0) для τ = τ0, 2τ0, 4τ0, ..., пока для MDEV
+// остается хотя бы одно слагаемое. Результат сравнивается с масками masks.
+func Analyze(phase []float64, tau0 time.Duration, masks ...Mask) Result {
+	result := Result{
+		Samples: len(phase),
+		Tau0:    tau0,
+		Points:  []Point{},
+	}
+	if len(phase) > 1 {
+		result.Span = time.Duration(len(phase)-1) * tau0
+	}
+	if len(phase) < MinSamples || tau0 <= 0 {
+		return result
+	}
+
+	t0 := tau0.Seconds()
+	for m := 1; 3*m < len(phase); m *= 2 {
+		adev, n := overlappingADEV(phase, t0, m)
+		mdev := modifiedADEV(phase, t0, m)
+		tau := float64(m) * t0
+		result.Points = append(result.Points, Point{
+			Tau:  time.Duration(m) * tau0,
+			ADEV: adev,
+			MDEV: mdev,
+			TDEV: tau / math.Sqrt(3) * mdev,
+			MTIE: mtie(phase, m),
+			N:    n,
+		})
+	}
+
+	for _, mask := range masks {
+		result.Masks = append(result.Masks, mask.Check(result.Points))
+	}
+
+	return result
+}
+
+// AnalyzeSamples анализирует неравномерную историю смещений. Интервал τ0
+// берется медианным, а анализируется последний непрерывный участок без
+// разрывов; внутри него измерения считаются равномерными.
+func AnalyzeSamples(timestamps []time.Time, offsets []time.Duration, masks ...Mask) Result {
+	phase, tau0 := Resample(timestamps, offsets)
+	return Analyze(phase, tau0, masks...)
+}
+
+// Resample возвращает фазу последнего непрерывного участка истории в
+// секундах и медианный интервал между измерениями
+func Resample(timestamps []time.Time, offsets []time.Duration) ([]float64, time.Duration) {
+	n := len(timestamps)
+	if len(offsets) < n {
+		n = len(offsets)
+	}
+	if n < 2 {
+		return nil, 0
+	}
+
+	intervals := make([]time.Duration, 0, n-1)
+	for i := 1; i < n; i++ {
+		if dt := timestamps[i].Sub(timestamps[i-1]); dt > 0 {
+			intervals = append(intervals, dt)
+		}
+	}
+	if len(intervals) == 0 {
+		return nil, 0
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	tau0 := intervals[len(intervals)/2]
+
+	start := n - 1
+	for start > 0 {
+		dt := timestamps[start].Sub(timestamps[start-1])
+		if dt <= 0 || float64(dt) > gapFactor*float64(tau0) {
+			break
+		}
+		start--
+	}
+
+	phase := make([]float64, 0, n-start)
+	for i := start; i < n; i++ {
+		phase = append(phase, offsets[i].Seconds())
+	}
+	return phase, tau0
+}
+
+// overlappingADEV перекрывающаяся девиация Аллана для τ = m·τ0:
+// σ²(τ) = Σ (x[i+2m] - 2x[i+m] + x[i])² / (2τ²(N-2m))
+func overlappingADEV(phase []float64, tau0 float64, m int) (float64, int) {
+	n := len(phase) - 2*m
+	if n < 1 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		d := phase[i+2*m] - 2*phase[i+m] + phase[i]
+		sum += d * d
+	}
+
+	tau := float64(m) * tau0
+	return math.Sqrt(sum / (2 * tau * tau * float64(n))), n
+}
+
+// modifiedADEV модифицированная девиация Аллана для τ = m·τ0:
+// Mod σ²(τ) = Σj (Σ_{i=j}^{j+m-1} (x[i+2m] - 2x[i+m] + x[i]))² / (2m²τ²(N-3m+1))
+func modifiedADEV(phase []float64, tau0 float64, m int) float64 {
+	n := len(phase) - 3*m + 1
+	if n < 1 {
+		return 0
+	}
+
+	second := func(i int) float64 {
+		return phase[i+2*m] - 2*phase[i+m] + phase[i]
+	}
+
+	// Скользящая сумма вторых разностей по окну из m слагаемых
+	inner := 0.0
+	for i := 0; i < m; i++ {
+		inner += second(i)
+	}
+
+	sum := inner * inner
+	for j := 1; j < n; j++ {
+		inner += second(j+m-1) - second(j-1)
+		sum += inner * inner
+	}
+
+	tau := float64(m) * tau0
+	return math.Sqrt(sum / (2 * float64(m) * float64(m) * tau * tau * float64(n)))
+}
+
+// mtie максимальный размах фазы в окнах из m+1 измерений (τ = m·τ0).
+// Минимум и максимум окна ведутся монотонными очередями за O(N).
+func mtie(phase []float64, m int) float64 {
+	window := m + 1
+	if len(phase) < window {
+		return 0
+	}
+
+	var maxQ, minQ []int
+	result := 0.0
+	for i, x := range phase {
+		for len(maxQ) > 0 && phase[maxQ[len(maxQ)-1]] <= x {
+			maxQ = maxQ[:len(maxQ)-1]
+		}
+		maxQ = append(maxQ, i)
+		for len(minQ) > 0 && phase[minQ[len(minQ)-1]] >= x {
+			minQ = minQ[:len(minQ)-1]
+		}
+		minQ = append(minQ, i)
+
+		if maxQ[0] <= i-window {
+			maxQ = maxQ[1:]
+		}
+		if minQ[0] <= i-window {
+			minQ = minQ[1:]
+		}
+
+		if i >= window-1 {
+			if spread := phase[maxQ[0]] - phase[minQ[0]]; spread > result {
+				result = spread
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package stability
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeLinearPhase(t *testing.T) {
+	// Постоянное смещение частоты 1e-6: ADEV и MDEV нулевые, MTIE = y·τ
+	phase := make([]float64, 1000)
+	for i := range phase {
+		phase[i] = 1e-6 * float64(i)
+	}
+
+	result := Analyze(phase, time.Second)
+	if len(result.Points) != 9 {
+		t.Fatalf("points = %d, want 9 (τ = 1..256 s)", len(result.Points))
+	}
+	for i, point := range result.Points {
+		if want := time.Duration(1<<i) * time.Second; point.Tau != want {
+			t.Errorf("point %d τ = %v, want %v", i, point.Tau, want)
+		}
+		if point.ADEV > 1e-15 || point.MDEV > 1e-15 || point.TDEV > 1e-15 {
+			t.Errorf("τ = %v: ADEV %g, MDEV %g, TDEV %g, want 0", point.Tau, point.ADEV, point.MDEV, point.TDEV)
+		}
+		if want := 1e-6 * point.Tau.Seconds(); math.Abs(point.MTIE-want) > 1e-12 {
+			t.Errorf("τ = %v: MTIE %g, want %g", point.Tau, point.MTIE, want)
+		}
+	}
+}
+
+func TestAnalyzeWhiteFM(t *testing.T) {
+	// Белый шум частоты: ADEV(τ) = σ/√τ, MDEV(τ) ≈ σ/√(2τ) при больших m
+	const sigma = 1e-9
+	rng := rand.New(rand.NewSource(1))
+	phase := make([]float64, 1<<16)
+	for i := 1; i < len(phase); i++ {
+		phase[i] = phase[i-1] + sigma*rng.NormFloat64()
+	}
+
+	result := Analyze(phase, time.Second)
+	for _, point := range result.Points {
+		tau := point.Tau.Seconds()
+		if tau > 1024 {
+			break
+		}
+		if want := sigma / math.Sqrt(tau); math.Abs(point.ADEV-want)/want > 0.1 {
+			t.Errorf("τ = %v: ADEV %g, want %g", point.Tau, point.ADEV, want)
+		}
+		if tau >= 16 {
+			if want := sigma / math.Sqrt(2*tau); math.Abs(point.MDEV-want)/want > 0.1 {
+				t.Errorf("τ = %v: MDEV %g, want %g", point.Tau, point.MDEV, want)
+			}
+		}
+		if want := tau / math.Sqrt(3) * point.MDEV; math.Abs(point.TDEV-want) > 1e-20 {
+			t.Errorf("τ = %v: TDEV %g, want %g", point.Tau, point.TDEV, want)
+		}
+	}
+}
+
+func TestResampleUsesLastContiguousRun(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var timestamps []time.Time
+	var offsets []time.Duration
+	for i := 0; i < 20; i++ {
+		timestamps = append(timestamps, start.Add(time.Duration(i)*time.Second))
+		offsets = append(offsets, time.Duration(i)*time.Microsecond)
+	}
+	for i := 0; i < 30; i++ {
+		timestamps = append(timestamps, start.Add(time.Minute+time.Duration(i)*time.Second))
+		offsets = append(offsets, time.Duration(100+i)*time.Microsecond)
+	}
+
+	phase, tau0 := Resample(timestamps, offsets)
+	if tau0 != time.Second {
+		t.Errorf("tau0 = %v, want 1s", tau0)
+	}
+	if len(phase) != 30 || phase[0] != 100e-6 {
+		t.Errorf("phase = %d samples from %g, want 30 from 1e-4", len(phase), phase[0])
+	}
+}
+
+func TestMaskCheck(t *testing.T) {
+	points := []Point{
+		{Tau: time.Second, MTIE: 20e-9},
+		{Tau: 64 * time.Second, MTIE: 30e-9},
+		{Tau: 512 * time.Second, MTIE: 90e-9},
+	}
+
+	if result := MaskG8272PRTCA.Check(points); !result.Pass {
+		t.Errorf("PRTC-A failed at %v", result.FailTau)
+	}
+	result := MaskG8272PRTCB.Check(points)
+	if result.Pass || result.FailTau != 512*time.Second {
+		t.Errorf("PRTC-B = %+v, want failure at 512s", result)
+	}
+
+	if _, err := ParseMasks([]string{"g811_prc", "G8272_PRTC_A"}); err != nil {
+		t.Errorf("ParseMasks: %v", err)
+	}
+	if _, err := ParseMasks([]string{"g999"}); err == nil {
+		t.Error("ParseMasks accepted unknown mask")
+	}
+}